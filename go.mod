@@ -29,6 +29,7 @@ replace (
 require (
 	code.cloudfoundry.org/bytefmt v0.0.0-20180108190415-b31f603f5e1e
 	github.com/GehirnInc/crypt v0.0.0-20190301055215-6c0105aabd46
+	github.com/andybalholm/brotli v1.0.1
 	github.com/asaskevich/govalidator v0.0.0-20180319081651-7d2e70ef918f
 	github.com/basho/backoff v0.0.0-20150307023525-2ff7c4694083 // indirect
 	github.com/basho/riak-go-client v1.7.1-0.20170327205844-5587c16e0b8b
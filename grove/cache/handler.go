@@ -15,6 +15,7 @@ package cache
 */
 
 import (
+	"math"
 	"net/http"
 	"os"
 	"strconv"
@@ -23,9 +24,11 @@ import (
 	"unsafe"
 
 	"github.com/apache/trafficcontrol/grove/cachedata"
+	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/plugin"
 
 	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/sibling"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -69,6 +72,7 @@ type Handler struct {
 	httpConns       *web.ConnMap
 	httpsConns      *web.ConnMap
 	interfaceName   string
+	siblings        *sibling.Siblings
 	requestID       uint64 // Atomic - DO NOT access or modify without atomic operations
 	// keyThrottlers     Throttlers
 	// nocacheThrottlers Throttlers
@@ -112,6 +116,7 @@ func NewHandler(
 	httpConns *web.ConnMap,
 	httpsConns *web.ConnMap,
 	interfaceName string,
+	siblings *sibling.Siblings,
 ) *Handler {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -134,6 +139,7 @@ func NewHandler(
 		httpConns:       httpConns,
 		httpsConns:      httpsConns,
 		interfaceName:   interfaceName,
+		siblings:        siblings,
 		// keyThrottlers:     NewThrottlers(keyLimit),
 		// nocacheThrottlers: NewThrottlers(nocacheLimit),
 	}
@@ -166,8 +172,16 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reqID := atomic.AddUint64(&h.requestID, 1)
 	pluginContext := copyPluginContext(h.pluginContext) // must give each request a copy, because they can modify in parallel
 	srvrData := cachedata.SrvrData{h.hostname, h.port, h.scheme}
+	remappingProducer, err := h.remapper.RemappingProducer(r, h.scheme)
+
+	// onRequest plugins are given the plugin config of the matched remap rule, which includes the global configs the rule doesn't override, so they may be configured per rule.
+	onReqCfg := h.remapper.PluginCfg()
 	onReqData := plugin.OnRequestData{W: w, R: r, Stats: h.stats, StatRules: h.remapper.StatRules(), HTTPConns: h.httpConns, HTTPSConns: h.httpsConns, InterfaceName: h.interfaceName, SrvrData: srvrData, RequestID: reqID}
-	stop := h.plugins.OnRequest(h.remapper.PluginCfg(), pluginContext, onReqData)
+	if err == nil {
+		onReqCfg = remappingProducer.PluginCfg()
+		onReqData.RemapRule = remappingProducer.Name()
+	}
+	stop := h.plugins.OnRequest(onReqCfg, pluginContext, onReqData)
 	if stop {
 		return
 	}
@@ -181,8 +195,6 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	remappingProducer, err := h.remapper.RemappingProducer(r, h.scheme)
-
 	if err == nil { // if we failed to get a remapping, there's no DSCP to set.
 		if err := conn.SetDSCP(remappingProducer.DSCP()); err != nil {
 			log.Infoln(time.Now().Format(time.RFC3339Nano) + " " + r.RemoteAddr + " " + r.Method + " " + r.RequestURI + ": could not set DSCP: " + err.Error() + " (reqid " + strconv.FormatUint(reqID, 10) + ")")
@@ -193,13 +205,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	clientIP, _ := web.GetClientIPPort(r)
 
 	toFQDN := ""
+	statsKey := r.Host
 	pluginCfg := map[string]interface{}{}
 	if remappingProducer != nil {
 		toFQDN = remappingProducer.FirstFQDN()
+		statsKey = remappingProducer.StatsKey(r.Host)
 		pluginCfg = remappingProducer.PluginCfg()
 	}
 
-	reqData := cachedata.ReqData{r, conn, clientIP, reqTime, toFQDN}
+	reqData := cachedata.ReqData{r, conn, clientIP, reqTime, toFQDN, statsKey}
 	responder := NewResponder(w, pluginCfg, pluginContext, srvrData, reqData, h.plugins, h.stats, reqID)
 
 	if err != nil {
@@ -218,6 +232,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if ip, err := web.GetIP(r); err == nil {
+		if limiter := remappingProducer.RateLimiter(); limiter != nil {
+			allow := limiter.Allow
+			if h.siblings.IsSibling(ip) {
+				allow = limiter.AllowPeer // siblings' requests are on behalf of all their clients, so they aren't limited as a single client
+			}
+			if ok, retryAfter := allow(ip); !ok {
+				log.Debugf("rule %v rate limited %v, retry after %v (reqid %v)\n", remappingProducer.Name(), ip, retryAfter, reqID)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				*responder.ResponseCode = limiter.Code()
+				responder.Do()
+				return
+			}
+		}
+	}
+
 	reqCacheControl := rfc.ParseCacheControl(reqHeader)
 	log.Debugf("Serve got Cache-Control %+v (reqid %v)\n", reqCacheControl, reqID)
 
@@ -232,9 +262,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	cache := remappingProducer.Cache()
 
 	var reqHost *string
-	cacheObj, ok := cache.Get(cacheKey)
+	cacheObj, ok := getVariant(cache, cacheKey, reqHeader)
 	if !ok {
 		log.Debugf("cache.Handler.ServeHTTP: '%v' not in cache (reqid %v)\n", cacheKey, reqID)
+		if reqCacheControl.Has(sibling.OnlyIfCached) {
+			*responder.ResponseCode = http.StatusGatewayTimeout
+			responder.Do()
+			return
+		}
 		beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
 		h.plugins.OnBeforeParentRequest(remappingProducer.PluginCfg(), pluginContext, beforeParentRequestData)
 		cacheObj, reqHost, err = retrier.Get(r, nil)
@@ -251,14 +286,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		responder.OriginCode = cacheObj.OriginCode
 		// create new pointers, so plugins don't modify the cacheObj
-		codePtr, hdrsPtr, bodyPtr := cacheObj.Code, cacheObj.RespHeaders, cacheObj.Body
+		codePtr, hdrsPtr, bodyPtr := cacheObj.Code, cacheObj.RespHeaders, cacheobj.NewReader(cacheObj.Body)
 		responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
 		responder.OriginReqSuccess = true
 		responder.ProxyStr = cacheObj.ProxyURL
 		if reqHost != nil {
 			responder.ToFQDN = *reqHost
 		}
-		beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
+		beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name(), Cache: cache, CacheKey: cacheKey}
 		h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
 		responder.Do()
 		return
@@ -267,6 +302,19 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reqHeaders := r.Header
 	canReuseStored := rfc.CanReuseStored(reqHeaders, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, h.strictRFC)
 
+	if cacheObj.Invalidated && canReuseStored != rfc.ReuseCannot {
+		log.Debugf("cache.Handler.ServeHTTP: '%v' was invalidated by a purge (reqid %v)\n", cacheKey, reqID)
+		canReuseStored = rfc.ReuseMustRevalidate
+	}
+
+	// RFC 7234 5.2.1.7 only-if-cached requests, such as from siblings, must not be requested from parents.
+	if canReuseStored != rfc.ReuseCan && reqCacheControl.Has(sibling.OnlyIfCached) {
+		log.Debugf("cache.Handler.ServeHTTP: '%v' only-if-cached, but can't reuse without revalidating (reqid %v)\n", cacheKey, reqID)
+		*responder.ResponseCode = http.StatusGatewayTimeout
+		responder.Do()
+		return
+	}
+
 	if canReuseStored != rfc.ReuseCan { // run the BeforeParentRequest hook for revalidations / ReuseCannot
 		beforeParentRequestData := plugin.BeforeParentRequestData{Req: r, RemapRule: remappingProducer.Name()}
 		h.plugins.OnBeforeParentRequest(remappingProducer.PluginCfg(), pluginContext, beforeParentRequestData)
@@ -292,18 +340,29 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case rfc.ReuseMustRevalidateCanStale:
+		staleWhileRevalidate, staleIfError := staleWindows(cacheObj, remappingProducer)
+		stale := staleness(cacheObj)
+		if stale <= staleWhileRevalidate {
+			log.Debugf("cache.Handler.ServeHTTP: '%v' stale %v within stale-while-revalidate %v, serving stale and revalidating in the background (reqid %v)\n", cacheKey, stale, staleWhileRevalidate, reqID)
+			revalidateInBackground(retrier, r, cacheObj, cacheKey, reqID)
+			break
+		}
 		log.Debugf("cache.Handler.ServeHTTP: '%v' must revalidate (but allowed stale) (reqid %v)\n", cacheKey, reqID)
 		oldCacheObj := cacheObj
 		cacheObj, reqHost, err = retrier.Get(r, cacheObj)
 		if err != nil {
 			log.Errorf("retrying get error - serving stale as allowed: %v (reqid %v)\n", err, reqID)
 			cacheObj = oldCacheObj
+		} else if isServerError(cacheObj) && stale <= staleIfError {
+			log.Errorf("cache.Handler.ServeHTTP: '%v' revalidation returned %v - stale %v within stale-if-error %v, serving stale (reqid %v)\n", cacheKey, cacheObj.Code, stale, staleIfError, reqID)
+			cacheObj = oldCacheObj
+			reqHost = nil
 		}
 	}
 	log.Debugf("cache.Handler.ServeHTTP: '%v' responding with %v (reqid %v)\n", cacheKey, cacheObj.Code, reqID)
 
 	// create new pointers, so plugins don't modify the cacheObj
-	codePtr, hdrsPtr, bodyPtr := cacheObj.Code, cacheObj.RespHeaders, cacheObj.Body
+	codePtr, hdrsPtr, bodyPtr := cacheObj.Code, cacheObj.RespHeaders, cacheobj.NewReader(cacheObj.Body)
 	responder.SetResponse(&codePtr, &hdrsPtr, &bodyPtr, connectionClose)
 	responder.OriginReqSuccess = true
 	responder.Reuse = canReuseStored
@@ -313,7 +372,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if reqHost != nil {
 		responder.ToFQDN = *reqHost
 	}
-	beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name()}
+	beforeRespData := plugin.BeforeRespondData{Req: r, CacheObj: cacheObj, Code: &codePtr, Hdr: &hdrsPtr, Body: &bodyPtr, RemapRule: remappingProducer.Name(), Cache: cache, CacheKey: cacheKey}
 	h.plugins.OnBeforeRespond(remappingProducer.PluginCfg(), pluginContext, beforeRespData)
 	responder.Do()
 }
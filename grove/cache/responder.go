@@ -15,6 +15,7 @@ package cache
 */
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/apache/trafficcontrol/grove/cachedata"
@@ -78,7 +79,7 @@ func NewResponder(w http.ResponseWriter, pluginCfg map[string]interface{}, plugi
 }
 
 // SetResponse is a helper which sets the RespondFunc of r to `web.Respond` with the given code, headers, body, and connectionClose. Note it takes a pointer to the headers and body, which may be modified after calling this but before the Do() sends the response.
-func (r *Responder) SetResponse(code *int, hdrs *http.Header, body *[]byte, connectionClose bool) {
+func (r *Responder) SetResponse(code *int, hdrs *http.Header, body *io.Reader, connectionClose bool) {
 	r.ResponseCode = code
 	r.F = func() (uint64, error) {
 		if r.Req.Method == http.MethodHead {
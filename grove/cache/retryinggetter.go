@@ -16,13 +16,16 @@ package cache
 
 import (
 	"errors"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/sibling"
 	"github.com/apache/trafficcontrol/grove/thread"
 	"github.com/apache/trafficcontrol/grove/web"
 
@@ -54,29 +57,68 @@ func NewRetrier(h *Handler, reqHdr http.Header, reqTime time.Time, reqCacheContr
 // Get takes the HTTP request and the cached object if there is one, and makes a new request, retrying according to its RemappingProducer. If no cached object exists, pass a nil obj.
 // Along with the cacheobj.CacheObj, a string pointer to the request hostname used to fetch the cacheobj.CacheObj is returned.
 func (r *Retrier) Get(req *http.Request, obj *cacheobj.CacheObj) (*cacheobj.CacheObj, *string, error) {
-	retryGetFunc := func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) *cacheobj.CacheObj {
+	clientReq := req
+	siblingTried := false
+	retryGetFunc := func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) (*cacheobj.CacheObj, string) {
 		// return true for Revalidate, and issue revalidate requests separately.
 		canReuse := func(cacheObj *cacheobj.CacheObj) bool {
 			return cacheobj.CanReuse(r.ReqHdr, r.ReqCacheControl, cacheObj, r.H.strictRFC, true)
 		}
+		siblingHost := ""
 		getAndCache := func() *cacheobj.CacheObj {
-			return GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.Transport, r.ReqID)
+			// siblings are only asked for objects missing from the cache, once, before the first parent.
+			if obj == nil && !siblingTried {
+				siblingTried = true
+				if siblingObj, host, ok := r.getFromSibling(clientReq, remapping); ok {
+					siblingHost = host
+					return siblingObj
+				}
+			}
+			return GetAndCache(remapping.Request, remapping.ProxyURL, remapping.CacheKey, remapping.Name, remapping.Request.Header, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], obj, remapping.Timeout, retryFailures, remapping.RetryNum, remapping.RetryCodes, remapping.Transport, remapping.MaxVariants, r.ReqID)
 		}
 		gotObj, getReqID := r.H.getter.Get(remapping.CacheKey, getAndCache, canReuse, r.ReqID)
 
 		req := remapping.Request
-		log.Debugf("Retrier.Get Y URI %v %v %v remapping.CacheKey %v rule %v parent %v code %v headers %+v len(body) %v getterid %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), remapping.CacheKey, remapping.Name, remapping.ProxyURL, gotObj.Code, gotObj.RespHeaders, len(gotObj.Body), getReqID, r.ReqID)
+		log.Debugf("Retrier.Get Y URI %v %v %v remapping.CacheKey %v rule %v parent %v code %v headers %+v getterid %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), remapping.CacheKey, remapping.Name, remapping.ProxyURL, gotObj.Code, gotObj.RespHeaders, getReqID, r.ReqID)
 
-		return gotObj
+		return gotObj, siblingHost
 	}
 
 	return retryingGet(retryGetFunc, req, r.RemappingProducer, obj)
 }
 
+// siblingRetryCodes are the codes of sibling responses which aren't cached, and are retried with the parents. A sibling responds 504 to an only-if-cached request if it no longer has the object.
+var siblingRetryCodes = map[int]struct{}{http.StatusGatewayTimeout: {}}
+
+// getFromSibling returns the object of the client request from a sibling which has it, and caches it, and the sibling's host. Returns false if no sibling has it or the request may not be made to siblings.
+func (r *Retrier) getFromSibling(clientReq *http.Request, remapping remap.Remapping) (*cacheobj.CacheObj, string, bool) {
+	if r.H.siblings == nil || !sibling.CanLookUp(clientReq.Method, r.ReqHdr, r.ReqCacheControl) {
+		return nil, "", false
+	}
+	sib := r.H.siblings.LookUp(r.H.scheme, clientReq, r.ReqHdr)
+	if sib == nil {
+		return nil, "", false
+	}
+	req, err := sibling.NewRequest(http.MethodGet, r.H.scheme, clientReq, r.ReqHdr)
+	if err != nil {
+		log.Errorf("sibling %v creating request: %v (reqid %v)\n", sib.Host, err, r.ReqID)
+		return nil, "", false
+	}
+	obj := GetAndCache(req, &url.URL{Host: sib.Host}, remapping.CacheKey, remapping.Name, r.ReqHdr, r.ReqTime, r.H.strictRFC, remapping.Cache, r.H.ruleThrottlers[remapping.Name], nil, remapping.Timeout, false, remapping.RetryNum, siblingRetryCodes, sib.Transport(r.H.scheme), remapping.MaxVariants, r.ReqID)
+	if obj.Code != http.StatusOK {
+		log.Debugf("sibling %v returned %v for %v, requesting parent (reqid %v)\n", sib.Host, obj.Code, remapping.CacheKey, r.ReqID)
+		return nil, "", false
+	}
+	log.Debugf("sibling %v hit for %v (reqid %v)\n", sib.Host, remapping.CacheKey, r.ReqID)
+	r.H.siblings.AddFetched()
+	return obj, sib.Host, true
+}
+
 // retryingGet takes a function, and retries failures up to the RemappingProducer RetryNum limit. On failure, it creates a new remapping. The func f should use `remapping` to make its request. If it hits failures up to the limit, it returns the last received cacheobj.CacheObj
 // Along with the cacheobj.CacheObj, a string pointer to the request hostname used to fetch the cacheobj.CacheObj is returned.
+// If getCacheObj returns a sibling host, the object was fetched from that sibling rather than the remapping's parent, so no parent result is reported, and the sibling host is returned as the host used.
 // TODO refactor to not close variables - it's awkward and confusing.
-func retryingGet(getCacheObj func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) *cacheobj.CacheObj, request *http.Request, remappingProducer *remap.RemappingProducer, cachedObj *cacheobj.CacheObj) (*cacheobj.CacheObj, *string, error) {
+func retryingGet(getCacheObj func(remapping remap.Remapping, retryFailures bool, obj *cacheobj.CacheObj) (*cacheobj.CacheObj, string), request *http.Request, remappingProducer *remap.RemappingProducer, cachedObj *cacheobj.CacheObj) (*cacheobj.CacheObj, *string, error) {
 	obj := (*cacheobj.CacheObj)(nil)
 	for {
 		remapping, retryAllowed, err := remappingProducer.GetNext(request)
@@ -88,7 +130,12 @@ func retryingGet(getCacheObj func(remapping remap.Remapping, retryFailures bool,
 		} else if err != nil {
 			return nil, nil, err
 		}
-		obj = getCacheObj(remapping, retryAllowed, cachedObj)
+		siblingHost := ""
+		obj, siblingHost = getCacheObj(remapping, retryAllowed, cachedObj)
+		if siblingHost != "" {
+			return obj, &siblingHost, nil
+		}
+		remappingProducer.ReportParentResult(remapping, isParentFailure(obj))
 		if !isFailure(obj, remapping.RetryCodes) {
 			return obj, &remapping.Request.URL.Host, nil
 		}
@@ -100,10 +147,17 @@ func isFailure(o *cacheobj.CacheObj, retryCodes map[int]struct{}) bool {
 	return failureCode || o.Code == CodeConnectFailure
 }
 
+// isParentFailure returns whether the object indicates the parent failed, that is, it couldn't be reached, or it returned a server error. Such failures count toward marking the parent down.
+func isParentFailure(o *cacheobj.CacheObj) bool {
+	return o.Code == CodeConnectFailure || o.Code >= 500
+}
+
 const ModifiedSinceHdr = "If-Modified-Since"
 
 // GetAndCache makes a client request for the given `http.Request` and caches it if `CanCache`.
 // THe `ruleThrottler` may be nil, in which case the request will be unthrottled.
+//
+// The object is returned as soon as the parent responds with headers, and its body is read from the parent in the background, so clients may be sent the body as it's fetched. The object is cached once its whole body has been fetched. The parent request counts against the rule throttler until then.
 func GetAndCache(
 	req *http.Request,
 	proxyURL *url.URL,
@@ -120,10 +174,12 @@ func GetAndCache(
 	retryNum int,
 	retryCodes map[int]struct{},
 	transport *http.Transport,
+	maxVariants int,
 	reqID uint64,
 ) *cacheobj.CacheObj {
 	// TODO this is awkward, with 'revalidateObj' indicating whether the request is a Revalidate. Should Getting and Caching be split up? How?
-	get := func() *cacheobj.CacheObj {
+	// get returns the object, and a func to fetch its body, which must be called if it's non-nil.
+	get := func() (*cacheobj.CacheObj, func()) {
 		// TODO figure out why respReqTime isn't used by rules
 		log.Debugf("GetAndCache calling request %v %v %v %v %v (reqid %v)\n", req.Method, req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), req.Header, reqID)
 		// TODO Verify overriding the passed reqTime is the right thing to do
@@ -137,16 +193,17 @@ func GetAndCache(
 			req.Header.Del(ModifiedSinceHdr)
 		}
 		respCode, respHeader, respBody, reqTime, reqRespTime, err := web.Request(transport, req)
-		log.Debugf("GetAndCache web.Request URI %v %v %v cacheKey %v rule %v parent %v error %v reval %v code %v len(body) %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, revalidateObj != nil, respCode, len(respBody), reqID)
+		log.Debugf("GetAndCache web.Request URI %v %v %v cacheKey %v rule %v parent %v error %v reval %v code %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, revalidateObj != nil, respCode, reqID)
 
 		if err != nil {
 			log.Errorf("Parent error for URI %v %v %v cacheKey %v rule %v parent %v error %v (reqid %v)\n", req.URL.Scheme, req.URL.Host, req.URL.EscapedPath(), cacheKey, remapName, proxyURLStr, err, reqID)
 			code := CodeConnectFailure
-			body := []byte(http.StatusText(code))
-			return cacheobj.New(reqHeader, body, code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
+			body := cacheobj.NewMemBodyBytes([]byte(http.StatusText(code)))
+			return cacheobj.New(reqHeader, body, code, code, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{}), nil
 		}
 		if _, ok := retryCodes[respCode]; ok && !cacheFailure {
-			return cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{})
+			body := cacheobj.NewMemBody()
+			return cacheobj.New(reqHeader, body, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, reqRespTime, time.Time{}), fetchBody(body, respBody, cacheKey, reqID, nil)
 		}
 
 		log.Debugf("GetAndCache request returned %v headers %+v (reqid %v)\n", respCode, respHeader, reqID)
@@ -166,40 +223,96 @@ func GetAndCache(
 		log.Debugf("GetAndCache respCode %v (reqid %v)\n", respCode, reqID)
 		if revalidateObj == nil || respCode != http.StatusNotModified {
 			log.Debugf("GetAndCache new %v (reqid %v)\n", cacheKey, reqID)
-			obj = cacheobj.New(reqHeader, respBody, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, respRespTime, lastModified)
 			if !rfc.CanCache(req.Method, reqHeader, respCode, respHeader, strictRFC) {
-				return obj // return without caching
-			}
-		} else {
-			log.Debugf("GetAndCache revalidating %v len(revalidateObj.Body) %v (reqid %v)\n", cacheKey, len(revalidateObj.Body), reqID)
-			// must copy, because this cache object may be concurrently read by other goroutines
-			newRespHeader := web.CopyHeader(revalidateObj.RespHeaders)
-			newRespHeader.Set("Date", respHeader.Get("Date"))
-			obj = &cacheobj.CacheObj{
-				Body:             revalidateObj.Body,
-				ReqHeaders:       revalidateObj.ReqHeaders,
-				RespHeaders:      newRespHeader,
-				RespCacheControl: revalidateObj.RespCacheControl,
-				Code:             revalidateObj.Code,
-				OriginCode:       respCode,
-				ProxyURL:         proxyURLStr,
-				ReqTime:          reqTime,
-				ReqRespTime:      reqRespTime,
-				RespRespTime:     respRespTime,
-				LastModified:     revalidateObj.LastModified,
-				Size:             revalidateObj.Size,
-				HitCount:         revalidateObj.HitCount, // no need to +1 here, the cache Get did that
+				body := cacheobj.NewMemBody()
+				obj = cacheobj.New(reqHeader, body, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, respRespTime, lastModified)
+				return obj, fetchBody(body, respBody, cacheKey, reqID, nil) // return without caching
 			}
+			body := newCacheBody(cache, cacheKey, reqHeader, respHeader)
+			obj = cacheobj.New(reqHeader, body, respCode, respCode, proxyURLStr, respHeader, reqTime, reqRespTime, respRespTime, lastModified)
+			return obj, fetchBody(body, respBody, cacheKey, reqID, func() {
+				// the object may be concurrently read by clients, so the completed object with its size is a copy
+				cached := *obj
+				cached.Size = cached.ComputeSize()
+				addVariant(cache, cacheKey, &cached, maxVariants, reqID)
+			})
+		}
+
+		log.Debugf("GetAndCache revalidating %v revalidateObj.Size %v (reqid %v)\n", cacheKey, revalidateObj.Size, reqID)
+		closeBody(respBody, cacheKey, reqID) // a 304 has no body
+		// must copy, because this cache object may be concurrently read by other goroutines
+		newRespHeader := web.CopyHeader(revalidateObj.RespHeaders)
+		newRespHeader.Set("Date", respHeader.Get("Date"))
+		obj = &cacheobj.CacheObj{
+			Body:             revalidateObj.Body,
+			ReqHeaders:       revalidateObj.ReqHeaders,
+			RespHeaders:      newRespHeader,
+			RespCacheControl: revalidateObj.RespCacheControl,
+			Code:             revalidateObj.Code,
+			OriginCode:       respCode,
+			ProxyURL:         proxyURLStr,
+			ReqTime:          reqTime,
+			ReqRespTime:      reqRespTime,
+			RespRespTime:     respRespTime,
+			LastModified:     revalidateObj.LastModified,
+			Size:             revalidateObj.Size,
+			HitCount:         revalidateObj.HitCount, // no need to +1 here, the cache Get did that
 		}
-		cache.Add(cacheKey, obj) // TODO store pointer?
-		return obj
+		addVariant(cache, cacheKey, obj, maxVariants, reqID) // TODO store pointer?
+		return obj, nil
 	}
 
-	c := (*cacheobj.CacheObj)(nil)
 	if ruleThrottler == nil {
 		log.Errorf("rule %v not in ruleThrottlers map. Requesting with no origin limit! (reqid %v)\n", remapName, reqID)
 		ruleThrottler = thread.NewNoThrottler()
 	}
-	ruleThrottler.Throttle(func() { c = get() })
-	return c
+	objChan := make(chan *cacheobj.CacheObj, 1)
+	go ruleThrottler.Throttle(func() {
+		obj, fetch := get()
+		objChan <- obj
+		if fetch != nil {
+			fetch() // the parent connection is still in use until the body is fetched
+		}
+	})
+	return <-objChan
+}
+
+// newCacheBody returns the body to fetch a cacheable parent response into. If the cache is an icache.Spooler, the body is spooled to it for the key the object will be added at, as it's fetched, so the whole body isn't held in memory.
+func newCacheBody(cache icache.Cache, cacheKey string, reqHeader http.Header, respHeader http.Header) *cacheobj.MemBody {
+	spooler, ok := cache.(icache.Spooler)
+	if !ok {
+		return cacheobj.NewMemBody()
+	}
+	key, ok := variantStoreKey(cacheKey, reqHeader, respHeader)
+	if !ok {
+		return cacheobj.NewMemBody()
+	}
+	size, _ := strconv.ParseUint(respHeader.Get("Content-Length"), 10, 64) // 0 if unknown
+	spool := spooler.Spool(key, size)
+	if spool == nil {
+		return cacheobj.NewMemBody()
+	}
+	return cacheobj.NewSpooledBody(spool)
+}
+
+// fetchBody returns a func which reads the parent response body into the object body, and closes it. If the whole body is read, onDone is called, if it isn't nil. The body's spool, if it has one, is then discarded, unless onDone added it to the cache.
+func fetchBody(body *cacheobj.MemBody, respBody io.ReadCloser, cacheKey string, reqID uint64, onDone func()) func() {
+	return func() {
+		defer body.DiscardSpool()
+		_, err := body.ReadFrom(respBody)
+		closeBody(respBody, cacheKey, reqID)
+		if err != nil {
+			log.Errorf("GetAndCache reading body for cacheKey %v, not caching: %v (reqid %v)\n", cacheKey, err, reqID)
+			return
+		}
+		if onDone != nil {
+			onDone()
+		}
+	}
+}
+
+func closeBody(respBody io.ReadCloser, cacheKey string, reqID uint64) {
+	if err := respBody.Close(); err != nil {
+		log.Errorf("GetAndCache closing body for cacheKey %v: %v (reqid %v)\n", cacheKey, err, reqID)
+	}
 }
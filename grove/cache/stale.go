@@ -0,0 +1,65 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// staleWindows returns how long after the given object becomes stale it may be served while it's revalidated in the background, and when revalidating it fails, per RFC5861. The object's Cache-Control directives are used if it has them, otherwise the remap rule defaults.
+func staleWindows(obj *cacheobj.CacheObj, remappingProducer *remap.RemappingProducer) (time.Duration, time.Duration) {
+	staleWhileRevalidate, ok := rfc.StaleWhileRevalidate(obj.RespCacheControl)
+	if !ok {
+		staleWhileRevalidate = remappingProducer.StaleWhileRevalidate()
+	}
+	staleIfError, ok := rfc.StaleIfError(obj.RespCacheControl)
+	if !ok {
+		staleIfError = remappingProducer.StaleIfError()
+	}
+	return staleWhileRevalidate, staleIfError
+}
+
+// staleness returns how long the given object has been stale. This is negative if it's still fresh.
+func staleness(obj *cacheobj.CacheObj) time.Duration {
+	return -rfc.FreshFor(obj.RespHeaders, obj.RespCacheControl, obj.ReqRespTime, obj.RespRespTime)
+}
+
+// isServerError returns whether the given object is an error which permits serving a stale object per RFC5861 stale-if-error, i.e. a 5xx from the parent, or failing to reach it.
+func isServerError(obj *cacheobj.CacheObj) bool {
+	return obj.Code >= http.StatusInternalServerError
+}
+
+// revalidateInBackground revalidates the given stale object, which has already been served to the client. The revalidation goes through the Getter like any other, so concurrent requests for the same stale object only revalidate it once.
+func revalidateInBackground(retrier *Retrier, r *http.Request, obj *cacheobj.CacheObj, cacheKey string, reqID uint64) {
+	// the client request may be modified by the server once the handler returns, so the revalidation must have its own copy
+	revalReq := *r
+	revalReq.Header = web.CopyHeader(r.Header)
+	go func() {
+		newObj, _, err := retrier.Get(&revalReq, obj)
+		if err != nil {
+			log.Errorf("background revalidation of '%v' error: %v (reqid %v)\n", cacheKey, err, reqID)
+			return
+		}
+		log.Debugf("background revalidation of '%v' returned %v (reqid %v)\n", cacheKey, newObj.Code, reqID)
+	}()
+}
@@ -0,0 +1,231 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/remap"
+	"github.com/apache/trafficcontrol/grove/stat"
+	"github.com/apache/trafficcontrol/grove/thread"
+	"github.com/apache/trafficcontrol/grove/web"
+)
+
+const testStaleRulesJSON = `{
+	"parent_selection": "consistent-hash",
+	"retry_num": 1,
+	"timeout_ms": 5000,
+	"retry_codes": [],
+	"rules": [
+		{
+			"name": "stale",
+			"from": "http://stale.example.net",
+			"to": [{"url": "%s"}]
+		}
+	]
+}`
+
+// testParent is a parent whose response is set by the test, which counts its requests.
+type testParent struct {
+	*httptest.Server
+	requests     uint64 // atomic: MUST NOT access without sync.atomic
+	m            sync.Mutex
+	code         int
+	cacheControl string
+	version      string
+	block        chan struct{} // if not nil, requests wait for it to be closed before responding
+}
+
+func newTestParent() *testParent {
+	p := &testParent{code: http.StatusOK}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint64(&p.requests, 1)
+		p.m.Lock()
+		code, cacheControl, version, block := p.code, p.cacheControl, p.version, p.block
+		p.m.Unlock()
+		if block != nil {
+			<-block
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("Date", time.Now().Add(-10*time.Second).Format(http.TimeFormat)) // older than the max-age of the tests' responses, so they're stale as soon as they're cached
+		w.Header().Set("X-Version", version)
+		w.WriteHeader(code)
+		w.Write([]byte(version))
+	}))
+	return p
+}
+
+// respond sets the parent's response to subsequent requests.
+func (p *testParent) respond(code int, cacheControl string, version string, block chan struct{}) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.code, p.cacheControl, p.version, p.block = code, cacheControl, version, block
+}
+
+func (p *testParent) Requests() uint64 { return atomic.LoadUint64(&p.requests) }
+
+// countingGetter is a thread.Getter which counts its Gets.
+type countingGetter struct {
+	thread.Getter
+	gets uint64 // atomic: MUST NOT access without sync.atomic
+}
+
+func (g *countingGetter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse func(*cacheobj.CacheObj) bool, reqID uint64) (*cacheobj.CacheObj, uint64) {
+	atomic.AddUint64(&g.gets, 1)
+	return g.Getter.Get(key, actualGet, canUse, reqID)
+}
+
+func (g *countingGetter) Gets() uint64 { return atomic.LoadUint64(&g.gets) }
+
+func newTestHandler(t *testing.T, parentURL string) (*Handler, icache.Cache) {
+	dir, err := ioutil.TempDir("", "grove-cache-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "remap.json")
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(testStaleRulesJSON, parentURL)), 0600); err != nil {
+		t.Fatalf("writing rules: %v", err)
+	}
+	cache := memcache.New(1024*1024, nil)
+	caches := map[string]icache.Cache{"": cache}
+	plugins := plugin.Get(nil)
+	remapper, err := remap.LoadRemapper(path, plugins.LoadFuncs(), caches, http.DefaultTransport.(*http.Transport))
+	if err != nil {
+		t.Fatalf("loading remapper: %v", err)
+	}
+	httpConns, httpsConns := web.NewConnMap(), web.NewConnMap()
+	stats := stat.New(remapper.Rules(), caches, cache.Capacity(), httpConns, httpsConns, "test")
+	return NewHandler(remapper, 0, stats, "http", "80", httpConns, false, false, plugins, map[string]*interface{}{}, httpConns, httpsConns, "", nil), cache
+}
+
+// serve makes a request to the handler, and returns the response code and body.
+func serve(h *Handler) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "http://stale.example.net/obj", nil)
+	req.RequestURI = req.URL.RequestURI()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+// waitFor returns whether the given func returns true within a second.
+func waitFor(f func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if f() {
+			return true
+		}
+	}
+	return f()
+}
+
+// cachedVersion returns the version of the single object in the given cache, or the empty string if there's none.
+func cachedVersion(cache icache.Cache) string {
+	for _, key := range cache.Keys() {
+		if obj, ok := cache.Peek(key); ok {
+			return obj.RespHeaders.Get("X-Version")
+		}
+	}
+	return ""
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	parent := newTestParent()
+	defer parent.Close()
+	h, cache := newTestHandler(t, parent.URL)
+	getter := &countingGetter{Getter: h.getter}
+	h.getter = getter
+
+	parent.respond(http.StatusOK, "max-age=1, stale-while-revalidate=60", "1", nil)
+	if code, body := serve(h); code != http.StatusOK || body != "1" {
+		t.Fatalf("uncached request expected %v %v, actual %v %v", http.StatusOK, "1", code, body)
+	}
+	if !waitFor(func() bool { return cachedVersion(cache) == "1" }) {
+		t.Fatalf("uncached request expected object to be cached, actual not cached")
+	}
+
+	// revalidations wait until released, so requests are only served stale if they don't wait for them
+	release := make(chan struct{})
+	parent.respond(http.StatusOK, "max-age=60", "2", release)
+	for i := 0; i < 2; i++ {
+		if code, body := serve(h); code != http.StatusOK || body != "1" {
+			t.Fatalf("stale request %v expected %v %v, actual %v %v", i, http.StatusOK, "1", code, body)
+		}
+	}
+	if !waitFor(func() bool { return getter.Gets() == 3 }) {
+		t.Fatalf("stale requests expected background revalidations, actual %v gets", getter.Gets())
+	}
+	close(release)
+
+	if !waitFor(func() bool { return cachedVersion(cache) == "2" }) {
+		t.Fatalf("background revalidation expected revalidated object to be cached, actual version %v", cachedVersion(cache))
+	}
+	if requests := parent.Requests(); requests != 2 {
+		t.Errorf("parent requests for concurrent stale requests expected %v, actual %v", 2, requests)
+	}
+	if code, body := serve(h); code != http.StatusOK || body != "2" {
+		t.Errorf("request after revalidation expected %v %v, actual %v %v", http.StatusOK, "2", code, body)
+	}
+	if requests := parent.Requests(); requests != 2 {
+		t.Errorf("parent requests after revalidation expected %v, actual %v", 2, requests)
+	}
+}
+
+func TestStaleIfError(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		fail         func(parent *testParent)
+		expectedCode int
+		expectedBody string
+	}{
+		{"server error within window", "max-age=1, stale-if-error=60", func(p *testParent) { p.respond(http.StatusServiceUnavailable, "", "error", nil) }, http.StatusOK, "1"},
+		{"connect failure within window", "max-age=1, stale-if-error=60", func(p *testParent) { p.Close() }, http.StatusOK, "1"},
+		{"server error outside window", "max-age=1, stale-if-error=5", func(p *testParent) { p.respond(http.StatusServiceUnavailable, "", "error", nil) }, http.StatusServiceUnavailable, "error"},
+		{"no stale-if-error", "max-age=1", func(p *testParent) { p.respond(http.StatusServiceUnavailable, "", "error", nil) }, http.StatusServiceUnavailable, "error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent := newTestParent()
+			defer parent.Close()
+			h, cache := newTestHandler(t, parent.URL)
+
+			parent.respond(http.StatusOK, test.cacheControl, "1", nil)
+			if code, body := serve(h); code != http.StatusOK || body != "1" {
+				t.Fatalf("uncached request expected %v %v, actual %v %v", http.StatusOK, "1", code, body)
+			}
+			if !waitFor(func() bool { return cachedVersion(cache) == "1" }) {
+				t.Fatalf("uncached request expected object to be cached, actual not cached")
+			}
+
+			test.fail(parent)
+			if code, body := serve(h); code != test.expectedCode || body != test.expectedBody {
+				t.Errorf("stale request expected %v %v, actual %v %v", test.expectedCode, test.expectedBody, code, body)
+			}
+		})
+	}
+}
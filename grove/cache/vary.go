@@ -0,0 +1,129 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// variantsM serializes changes to variants objects, which must be read, modified, and re-added to the cache.
+var variantsM sync.Mutex
+
+// getVariant gets the object for the given primary cache key, and if it's a variants object, the variant for the given request headers.
+func getVariant(cache icache.Cache, cacheKey string, reqHeader http.Header) (*cacheobj.CacheObj, bool) {
+	obj, ok := cache.Get(cacheKey)
+	if !ok || !obj.IsVariants() {
+		return obj, ok
+	}
+	variantKey := cacheobj.VariantKey(cacheKey, obj.Vary, reqHeader)
+	if !obj.HasVariant(variantKey) {
+		return nil, false // the variant was never cached, or was dropped to keep the number of variants under the limit
+	}
+	return cache.Get(variantKey)
+}
+
+// addVariant adds the given object to the cache. If the object has a Vary header, it's added at its variant key, and the variants object at the primary key is updated, dropping the oldest variant if there are more than maxVariants. Objects with `Vary: *` aren't cached.
+//
+// Variants which are dropped, or whose variants object is replaced because the Vary header changed or the object no longer varies, are removed from the cache, so they don't stay cached where they can never be gotten.
+func addVariant(cache icache.Cache, cacheKey string, obj *cacheobj.CacheObj, maxVariants int, reqID uint64) {
+	vary, varyAny := cacheobj.ParseVary(obj.RespHeaders)
+	if varyAny {
+		log.Debugf("cache.addVariant '%v' has Vary *, not caching (reqid %v)\n", cacheKey, reqID)
+		return
+	}
+
+	variantKey := cacheKey
+	if len(vary) != 0 {
+		variantKey = cacheobj.VariantKey(cacheKey, vary, obj.ReqHeaders)
+		cache.Add(variantKey, obj)
+	}
+
+	variantsM.Lock()
+	defer variantsM.Unlock()
+	variantKeys := []string{}
+	if oldVariants, ok := cache.Peek(cacheKey); ok && oldVariants.IsVariants() {
+		if len(vary) != 0 && equalStrs(oldVariants.Vary, vary) {
+			variantKeys = oldVariants.Variants
+		} else {
+			log.Debugf("cache.addVariant '%v' Vary changed from %v to %v, removing %v old variants (reqid %v)\n", cacheKey, oldVariants.Vary, vary, len(oldVariants.Variants), reqID)
+			removeVariants(cache, oldVariants.Variants, variantKey)
+		}
+	}
+	if len(vary) == 0 {
+		cache.Add(cacheKey, obj)
+		return
+	}
+	if containsStr(variantKeys, variantKey) {
+		return
+	}
+	// must copy, because the old variants object may be concurrently read by other goroutines
+	newVariantKeys := make([]string, 0, len(variantKeys)+1)
+	newVariantKeys = append(append(newVariantKeys, variantKeys...), variantKey)
+	if len(newVariantKeys) > maxVariants {
+		dropped := newVariantKeys[:len(newVariantKeys)-maxVariants]
+		log.Debugf("cache.addVariant '%v' has more than %v variants, dropping %v (reqid %v)\n", cacheKey, maxVariants, dropped, reqID)
+		removeVariants(cache, dropped, variantKey)
+		newVariantKeys = newVariantKeys[len(newVariantKeys)-maxVariants:]
+	}
+	cache.Add(cacheKey, cacheobj.NewVariants(vary, newVariantKeys))
+}
+
+// removeVariants removes the given variant keys from the cache, except the given key being added.
+func removeVariants(cache icache.Cache, variantKeys []string, except string) {
+	for _, key := range variantKeys {
+		if key != except {
+			cache.Remove(key)
+		}
+	}
+}
+
+// variantStoreKey returns the key addVariant adds the object of the given response at, and false if it isn't cached because it has `Vary: *`.
+func variantStoreKey(cacheKey string, reqHeader http.Header, respHeader http.Header) (string, bool) {
+	vary, varyAny := cacheobj.ParseVary(respHeader)
+	if varyAny {
+		return "", false
+	}
+	if len(vary) == 0 {
+		return cacheKey, true
+	}
+	return cacheobj.VariantKey(cacheKey, vary, reqHeader), true
+}
+
+func equalStrs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsStr(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package cache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/memcache"
+)
+
+func newVaryTestObj(vary string, reqHeaderName string, reqHeaderVal string) *cacheobj.CacheObj {
+	reqHeader, respHeader := http.Header{}, http.Header{}
+	if vary != "" {
+		respHeader.Set("Vary", vary)
+	}
+	reqHeader.Set(reqHeaderName, reqHeaderVal)
+	return cacheobj.New(reqHeader, cacheobj.NewMemBodyBytes([]byte(reqHeaderVal)), http.StatusOK, http.StatusOK, "", respHeader, time.Now(), time.Now(), time.Now(), time.Now())
+}
+
+func TestAddVariantRemovesDropped(t *testing.T) {
+	cache := memcache.New(1024*1024, nil)
+	key := "GET:http://foo.example.net/a"
+
+	objs := []*cacheobj.CacheObj{
+		newVaryTestObj("Accept-Encoding", "Accept-Encoding", "gzip"),
+		newVaryTestObj("Accept-Encoding", "Accept-Encoding", "br"),
+		newVaryTestObj("Accept-Encoding", "Accept-Encoding", "identity"),
+	}
+	variantKeys := []string{}
+	for _, obj := range objs {
+		addVariant(cache, key, obj, 2, 0)
+		variantKeys = append(variantKeys, cacheobj.VariantKey(key, []string{"Accept-Encoding"}, obj.ReqHeaders))
+	}
+	if _, ok := cache.Peek(variantKeys[0]); ok {
+		t.Errorf("variant dropped over max_variants expected removed from cache, actual cached")
+	}
+	for _, variantKey := range variantKeys[1:] {
+		if _, ok := cache.Peek(variantKey); !ok {
+			t.Errorf("variant within max_variants expected cached, actual not cached")
+		}
+	}
+	if variants, ok := cache.Peek(key); !ok || len(variants.Variants) != 2 {
+		t.Fatalf("variants object expected 2 variants, actual found %v", ok)
+	}
+
+	// a different Vary replaces all the old variants
+	langObj := newVaryTestObj("Accept-Language", "Accept-Language", "en")
+	addVariant(cache, key, langObj, 2, 0)
+	for _, variantKey := range variantKeys[1:] {
+		if _, ok := cache.Peek(variantKey); ok {
+			t.Errorf("variant of old Vary expected removed from cache, actual cached")
+		}
+	}
+	langKey := cacheobj.VariantKey(key, []string{"Accept-Language"}, langObj.ReqHeaders)
+	if _, ok := cache.Peek(langKey); !ok {
+		t.Errorf("variant of new Vary expected cached, actual not cached")
+	}
+
+	// an object without Vary replaces the variants object and its variants
+	addVariant(cache, key, newVaryTestObj("", "Accept-Language", "en"), 2, 0)
+	if _, ok := cache.Peek(langKey); ok {
+		t.Errorf("variant replaced by object without Vary expected removed from cache, actual cached")
+	}
+	if obj, ok := cache.Peek(key); !ok || obj.IsVariants() {
+		t.Errorf("object without Vary expected cached at the primary key, actual found %v", ok)
+	}
+	if keys := cache.Keys(); len(keys) != 1 {
+		t.Errorf("cache keys expected only the primary key, actual %v", keys)
+	}
+}
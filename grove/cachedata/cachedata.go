@@ -48,6 +48,8 @@ type ReqData struct {
 	ClientIP string
 	ReqTime  time.Time
 	ToFQDN   string
+	// StatsKey is the key of the remap stats of the request's rule. See stat.StatsRemaps.
+	StatsKey string
 }
 
 type RespData struct {
@@ -0,0 +1,234 @@
+package cacheobj
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ChunkSize is the size in bytes of the chunks object bodies are stored in. Every chunk but the last of a body is exactly this size.
+const ChunkSize = 64 * 1024
+
+// Body is the body of a cached object, stored as ChunkSize chunks. Bodies may be read while they're still being fetched from the origin, and needn't be in memory, e.g. disk cache bodies are read from disk a chunk at a time.
+type Body interface {
+	// Chunk returns the i'th chunk, blocking until it's been fetched if the body is still being fetched. It returns io.EOF if there is no i'th chunk, or the error the fetch failed with. The returned chunk MUST NOT be modified.
+	Chunk(i int) ([]byte, error)
+	// Done returns a channel which is closed when the body is complete, whether or not it was fetched successfully.
+	Done() <-chan struct{}
+}
+
+// Spool stores the chunks of a body as it's fetched, e.g. on disk, so the whole body needn't be in memory.
+type Spool interface {
+	// Write stores the given chunks, which follow the chunks already written. Write blocks until they're stored, so a body isn't fetched faster than it can be stored.
+	Write(chunks [][]byte) error
+	// Chunk returns the i'th chunk written.
+	Chunk(i int) ([]byte, error)
+	// Discard deletes the chunks written, unless the body was added to the cache the spool is from. It must be called when the body is complete, and the cache has been added to, or won't be.
+	Discard()
+}
+
+// SpoolChunks is the number of chunks a spooled MemBody holds in memory before writing them to its spool.
+const SpoolChunks = 16
+
+// MemBody is a Body in memory, which may be written and read concurrently.
+//
+// If the body has a spool, its chunks are written to it as they're fetched, and only the chunks not yet written are held in memory.
+type MemBody struct {
+	chunks  [][]byte // the chunks not yet spooled, from index spooled
+	spool   Spool    // may be nil, if the body is only in memory
+	spooled int      // the number of chunks written to the spool
+	size    uint64
+	done    bool
+	err     error
+	doneCh  chan struct{}
+	m       *sync.Mutex
+	cond    *sync.Cond
+}
+
+// NewMemBody returns an empty MemBody, to be written with ReadFrom.
+func NewMemBody() *MemBody {
+	m := &sync.Mutex{}
+	return &MemBody{doneCh: make(chan struct{}), m: m, cond: sync.NewCond(m)}
+}
+
+// NewSpooledBody returns an empty MemBody, to be written with ReadFrom, whose chunks are written to the given spool as they're fetched.
+func NewSpooledBody(spool Spool) *MemBody {
+	b := NewMemBody()
+	b.spool = spool
+	return b
+}
+
+// NewMemBodyBytes returns a complete MemBody of the given bytes.
+func NewMemBodyBytes(bts []byte) *MemBody {
+	b := NewMemBody()
+	b.size = uint64(len(bts))
+	for len(bts) > ChunkSize {
+		b.chunks = append(b.chunks, bts[:ChunkSize])
+		bts = bts[ChunkSize:]
+	}
+	if len(bts) > 0 {
+		b.chunks = append(b.chunks, bts)
+	}
+	b.finish(nil)
+	return b
+}
+
+// ReadFrom reads r into the body until EOF or an error, making each chunk available to readers as soon as it's full. The body is complete when this returns, and the error is returned to readers of chunks which weren't read.
+// If the body has a spool, chunks are written to it every SpoolChunks chunks, and when the body is complete, and aren't held in memory after. An error writing to the spool fails the body.
+// This MUST NOT be called more than once, or concurrently.
+func (b *MemBody) ReadFrom(r io.Reader) (int64, error) {
+	total := int64(0)
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			total += int64(n)
+			chunk := make([]byte, n) // exactly n bytes, so short chunks don't hold a whole buffer
+			copy(chunk, buf)
+			b.m.Lock()
+			b.chunks = append(b.chunks, chunk)
+			b.size += uint64(n)
+			b.m.Unlock()
+			b.cond.Broadcast()
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = b.writeSpool(true)
+			b.finish(err)
+			return total, err
+		}
+		if err == nil {
+			err = b.writeSpool(false)
+		}
+		if err != nil {
+			b.finish(err)
+			return total, err
+		}
+	}
+}
+
+// writeSpool writes the chunks in memory to the spool, if the body has one, and there are SpoolChunks of them, or all is true. The chunks are then dropped from memory, and read from the spool.
+func (b *MemBody) writeSpool(all bool) error {
+	if b.spool == nil {
+		return nil
+	}
+	b.m.Lock()
+	chunks := b.chunks
+	b.m.Unlock()
+	if len(chunks) == 0 || (len(chunks) < SpoolChunks && !all) {
+		return nil
+	}
+	// only ReadFrom appends chunks, so they can be written without holding the lock, while readers read them from memory
+	if err := b.spool.Write(chunks); err != nil {
+		return errors.New("writing to spool: " + err.Error())
+	}
+	b.m.Lock()
+	b.chunks = append([][]byte(nil), b.chunks[len(chunks):]...) // a new array, so the written chunks can be freed
+	b.spooled += len(chunks)
+	b.m.Unlock()
+	return nil
+}
+
+// finish marks the body complete, with the given fetch error, if any, and wakes all waiting readers.
+func (b *MemBody) finish(err error) {
+	b.m.Lock()
+	b.done = true
+	b.err = err
+	b.m.Unlock()
+	close(b.doneCh)
+	b.cond.Broadcast()
+}
+
+// Chunk implements Body.
+func (b *MemBody) Chunk(i int) ([]byte, error) {
+	b.m.Lock()
+	for i >= b.spooled+len(b.chunks) && !b.done {
+		b.cond.Wait()
+	}
+	spool, spooled, chunks, err := b.spool, b.spooled, b.chunks, b.err
+	b.m.Unlock()
+	if i < spooled {
+		return spool.Chunk(i)
+	}
+	if i < spooled+len(chunks) {
+		return chunks[i-spooled], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Spool returns the body's spool, or nil if it doesn't have one.
+func (b *MemBody) Spool() Spool { return b.spool }
+
+// DiscardSpool discards the body's spool, if it has one. See Spool.Discard.
+func (b *MemBody) DiscardSpool() {
+	if b.spool != nil {
+		b.spool.Discard()
+	}
+}
+
+// InMemory returns whether the whole body is in memory, i.e. it's a MemBody without a spool.
+func InMemory(body Body) bool {
+	b, ok := body.(*MemBody)
+	return ok && b.spool == nil
+}
+
+// Done implements Body.
+func (b *MemBody) Done() <-chan struct{} { return b.doneCh }
+
+// Err returns the error fetching the body, if any. It's only meaningful once the body is Done.
+func (b *MemBody) Err() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.err
+}
+
+// Size returns the number of bytes in the body so far. Once the body is Done, this is its size.
+func (b *MemBody) Size() uint64 {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.size
+}
+
+// NewReader returns a reader of the given body, which reads each chunk as it becomes available. It's safe to create any number of readers of a body.
+func NewReader(body Body) io.Reader {
+	return &bodyReader{body: body}
+}
+
+type bodyReader struct {
+	body  Body
+	chunk []byte
+	next  int
+	err   error
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(r.chunk) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.chunk, r.err = r.body.Chunk(r.next)
+		r.next++
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
@@ -0,0 +1,136 @@
+package cacheobj
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMemBodyConcurrentRead(t *testing.T) {
+	bts := make([]byte, ChunkSize*3+42)
+	for i := range bts {
+		bts[i] = byte(i)
+	}
+
+	pr, pw := io.Pipe()
+	body := NewMemBody()
+	go body.ReadFrom(pr)
+
+	results := make(chan []byte, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			read, err := ioutil.ReadAll(NewReader(body))
+			if err != nil {
+				t.Errorf("reading body: expected nil error, actual %v", err)
+			}
+			results <- read
+		}()
+	}
+
+	for i := 0; i < len(bts); i += 1000 {
+		end := i + 1000
+		if end > len(bts) {
+			end = len(bts)
+		}
+		pw.Write(bts[i:end])
+	}
+	pw.Close()
+
+	for i := 0; i < 2; i++ {
+		if read := <-results; !bytes.Equal(read, bts) {
+			t.Errorf("reading body: expected %v bytes, actual %v bytes not equal", len(bts), len(read))
+		}
+	}
+	if body.Size() != uint64(len(bts)) {
+		t.Errorf("body size: expected %v, actual %v", len(bts), body.Size())
+	}
+}
+
+func TestMemBodyFetchError(t *testing.T) {
+	pr, pw := io.Pipe()
+	body := NewMemBody()
+	go body.ReadFrom(pr)
+
+	expectedErr := errors.New("parent reset")
+	pw.Write(make([]byte, ChunkSize+1))
+	pw.CloseWithError(expectedErr)
+
+	read, err := ioutil.ReadAll(NewReader(body))
+	if err != expectedErr {
+		t.Errorf("reading failed body: expected error %v, actual %v", expectedErr, err)
+	}
+	if len(read) != ChunkSize+1 {
+		t.Errorf("reading failed body: expected the %v received bytes, actual %v", ChunkSize+1, len(read))
+	}
+	<-body.Done()
+}
+
+func TestMemBodyShortChunk(t *testing.T) {
+	body := NewMemBody()
+	body.ReadFrom(bytes.NewReader(make([]byte, ChunkSize+42)))
+	chunk, err := body.Chunk(1)
+	if err != nil {
+		t.Fatalf("reading short chunk: expected nil error, actual %v", err)
+	}
+	if len(chunk) != 42 || cap(chunk) != 42 {
+		t.Errorf("short chunk: expected len and cap 42, actual len %v cap %v", len(chunk), cap(chunk))
+	}
+}
+
+// memSpool is a Spool in memory, which records the chunks written to it.
+type memSpool struct {
+	chunks    [][]byte
+	writes    int
+	discarded bool
+}
+
+func (s *memSpool) Write(chunks [][]byte) error {
+	s.chunks = append(s.chunks, chunks...)
+	s.writes++
+	return nil
+}
+
+func (s *memSpool) Chunk(i int) ([]byte, error) { return s.chunks[i], nil }
+
+func (s *memSpool) Discard() { s.discarded = true }
+
+func TestMemBodySpool(t *testing.T) {
+	bts := make([]byte, ChunkSize*(SpoolChunks+1)+42)
+	for i := range bts {
+		bts[i] = byte(i)
+	}
+	spool := &memSpool{}
+	body := NewSpooledBody(spool)
+	if _, err := body.ReadFrom(bytes.NewReader(bts)); err != nil {
+		t.Fatalf("reading spooled body: expected nil error, actual %v", err)
+	}
+	if len(spool.chunks) != SpoolChunks+2 || spool.writes != 2 {
+		t.Errorf("spool: expected %v chunks in 2 writes, actual %v chunks in %v writes", SpoolChunks+2, len(spool.chunks), spool.writes)
+	}
+	if len(body.chunks) != 0 {
+		t.Errorf("spooled body: expected no chunks in memory, actual %v", len(body.chunks))
+	}
+	if read, err := ioutil.ReadAll(NewReader(body)); err != nil || !bytes.Equal(read, bts) {
+		t.Errorf("reading spooled body: expected %v bytes, actual %v bytes, error %v", len(bts), len(read), err)
+	}
+	body.DiscardSpool()
+	if !spool.discarded {
+		t.Errorf("DiscardSpool: expected spool discarded, actual not")
+	}
+}
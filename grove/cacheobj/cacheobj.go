@@ -22,7 +22,7 @@ import (
 )
 
 type CacheObj struct {
-	Body             []byte
+	Body             Body
 	ReqHeaders       http.Header
 	RespHeaders      http.Header
 	RespCacheControl rfc.CacheControlMap
@@ -33,19 +33,26 @@ type CacheObj struct {
 	ReqRespTime      time.Time // our client's time when the object was received
 	RespRespTime     time.Time // the origin server's Date time when the object was sent
 	LastModified     time.Time // the origin LastModified if it exists, or Date if it doesn't
-	Size             uint64
-	HitCount         uint64 // the number of times this object was hit
+	Size             uint64    // the size of the body. This is 0 until the body is complete, for objects still being fetched
+	HitCount         uint64    // the number of times this object was hit
+	Vary             []string  // the normalized request header names the variants are selected by, if this is a variants object. See IsVariants
+	Variants         []string  // the cache keys of the variants, oldest first, if this is a variants object
+	Invalidated      bool      // whether the object was invalidated by a purge, and must be revalidated before it's served
 }
 
 // ComputeSize computes the size of the given CacheObj. This computation is expensive, as the headers must be iterated over. Thus, the size should be computed once and stored, not computed on-the-fly for every new request for the cached object.
+// Bodies other than a MemBody aren't in memory, and their size must already be known, so it isn't recomputed.
 func (c CacheObj) ComputeSize() uint64 {
 	// TODO include headers size
-	return uint64(len(c.Body))
+	if body, ok := c.Body.(*MemBody); ok {
+		return body.Size()
+	}
+	return c.Size
 }
 
-func New(reqHeader http.Header, bytes []byte, code int, originCode int, proxyURL string, respHeader http.Header, reqTime time.Time, reqRespTime time.Time, respRespTime time.Time, lastModified time.Time) *CacheObj {
+func New(reqHeader http.Header, body Body, code int, originCode int, proxyURL string, respHeader http.Header, reqTime time.Time, reqRespTime time.Time, respRespTime time.Time, lastModified time.Time) *CacheObj {
 	obj := &CacheObj{
-		Body:             bytes,
+		Body:             body,
 		ReqHeaders:       reqHeader,
 		RespHeaders:      respHeader,
 		RespCacheControl: rfc.ParseCacheControl(respHeader),
@@ -76,5 +83,8 @@ func CanReuse(
 	revalidateCanReuse bool,
 ) bool {
 	canReuse := rfc.CanReuseStored(reqHeader, cacheObj.RespHeaders, reqCacheControl, cacheObj.RespCacheControl, cacheObj.ReqHeaders, cacheObj.ReqRespTime, cacheObj.RespRespTime, strictRFC)
+	if !cacheObj.VaryMatches(reqHeader) {
+		return false
+	}
 	return canReuse == rfc.ReuseCan || (canReuse == rfc.ReuseMustRevalidate && revalidateCanReuse)
 }
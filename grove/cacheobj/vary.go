@@ -0,0 +1,113 @@
+package cacheobj
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ParseVary returns the names of the request headers in the given response's Vary header, canonicalized, sorted, and without duplicates, so equivalent Vary headers give equal names. It also returns whether the Vary is `*`, in which case the response varies on more than request headers, and can't be cached.
+func ParseVary(respHeader http.Header) ([]string, bool) {
+	names := map[string]struct{}{}
+	for _, vary := range respHeader["Vary"] {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, true
+			}
+			if name != "" {
+				names[http.CanonicalHeaderKey(name)] = struct{}{}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, false
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted, false
+}
+
+// VaryValue returns the normalized value of the given request header, for selecting variants: all values of the header, with each comma-separated element trimmed and lower-cased, so requests differing only in case and whitespace get the same variant.
+func VaryValue(reqHeader http.Header, name string) string {
+	elems := []string{}
+	for _, val := range reqHeader[name] {
+		for _, elem := range strings.Split(val, ",") {
+			if elem = strings.ToLower(strings.TrimSpace(elem)); elem != "" {
+				elems = append(elems, elem)
+			}
+		}
+	}
+	return strings.Join(elems, ",")
+}
+
+// VariantKey returns the cache key of the variant of the object at the given primary key, for a request with the given headers, of a response which varies on the given normalized names.
+func VariantKey(primaryKey string, vary []string, reqHeader http.Header) string {
+	key := primaryKey
+	for _, name := range vary {
+		key += "\x00" + name + ":" + VaryValue(reqHeader, name)
+	}
+	return key
+}
+
+// PrimaryKey returns the primary key of the given cache key, which is the key itself unless it's the key of a variant.
+func PrimaryKey(key string) string {
+	if i := strings.Index(key, "\x00"); i != -1 {
+		return key[:i]
+	}
+	return key
+}
+
+// IsVariants returns whether the object is a variants object, which is cached at the primary key of a response with a Vary header, in place of the response itself, to select its variants.
+func (c *CacheObj) IsVariants() bool { return len(c.Vary) > 0 }
+
+// VaryMatches returns whether the object is the variant for a request with the given headers, that is, whether the request headers named in the object's Vary header have the same normalized values as the request the object was fetched for.
+func (c *CacheObj) VaryMatches(reqHeader http.Header) bool {
+	vary, varyAny := ParseVary(c.RespHeaders)
+	if varyAny {
+		return false
+	}
+	for _, name := range vary {
+		if VaryValue(reqHeader, name) != VaryValue(c.ReqHeaders, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewVariants returns a variants object, to be cached at the primary key of a response varying on the given normalized header names, whose variants are cached at the given keys.
+func NewVariants(vary []string, variantKeys []string) *CacheObj {
+	return &CacheObj{
+		Body:     NewMemBodyBytes(nil),
+		Vary:     vary,
+		Variants: variantKeys,
+		HitCount: 1,
+	}
+}
+
+// HasVariant returns whether the given key is one of the variants object's current variants.
+func (c *CacheObj) HasVariant(key string) bool {
+	for _, variant := range c.Variants {
+		if variant == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package cacheobj
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseVary(t *testing.T) {
+	hdr := http.Header{}
+	hdr.Add("Vary", "accept-language, Accept-Encoding")
+	hdr.Add("Vary", "ACCEPT-ENCODING")
+	vary, varyAny := ParseVary(hdr)
+	if expected := []string{"Accept-Encoding", "Accept-Language"}; !reflect.DeepEqual(vary, expected) || varyAny {
+		t.Errorf("ParseVary expected %v false, actual %v %v", expected, vary, varyAny)
+	}
+
+	hdr.Add("Vary", "*")
+	if vary, varyAny := ParseVary(hdr); !varyAny {
+		t.Errorf("ParseVary with * expected true, actual %v %v", vary, varyAny)
+	}
+
+	if vary, varyAny := ParseVary(http.Header{}); vary != nil || varyAny {
+		t.Errorf("ParseVary without Vary expected nil false, actual %v %v", vary, varyAny)
+	}
+}
+
+func TestVariantKey(t *testing.T) {
+	vary := []string{"Accept-Encoding", "Accept-Language"}
+
+	a := http.Header{}
+	a.Set("Accept-Encoding", "gzip,  BR")
+	a.Set("Accept-Language", "en-US")
+	b := http.Header{}
+	b.Set("Accept-Encoding", "GZIP,br")
+	b.Set("Accept-Language", "en-us")
+	b.Set("User-Agent", "varies but isn't in Vary")
+	if ak, bk := VariantKey("key", vary, a), VariantKey("key", vary, b); ak != bk {
+		t.Errorf("VariantKey for equivalent headers expected equal, actual '%v' '%v'", ak, bk)
+	}
+
+	b.Set("Accept-Language", "fr")
+	if ak, bk := VariantKey("key", vary, a), VariantKey("key", vary, b); ak == bk {
+		t.Errorf("VariantKey for different headers expected different, actual both '%v'", ak)
+	}
+
+	obj := &CacheObj{ReqHeaders: a, RespHeaders: http.Header{"Vary": {"Accept-Language"}}}
+	if obj.VaryMatches(b) {
+		t.Errorf("VaryMatches for different Accept-Language expected false, actual true")
+	}
+	b.Set("Accept-Language", "EN-us")
+	if !obj.VaryMatches(b) {
+		t.Errorf("VaryMatches for equivalent Accept-Language expected true, actual false")
+	}
+}
@@ -0,0 +1,215 @@
+package certstore
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// DefaultName is the name of the default certificate, from the config cert_file and key_file, which is served to clients whose SNI host doesn't have a certificate.
+const DefaultName = "default"
+
+// ExpiryWarning is how long before a certificate expires that loading it logs a warning.
+const ExpiryWarning = 30 * 24 * time.Hour
+
+// Info is the information about a loaded certificate.
+type Info struct {
+	// Name is the name of the remap rule the certificate is for, or DefaultName.
+	Name string `json:"name"`
+	// Hosts are the SNI hosts the certificate is served for. They may be wildcards, such as *.example.net.
+	Hosts    []string  `json:"hosts,omitempty"`
+	File     string    `json:"file"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// fileStamp is the modification time and size of a file when it was loaded, to detect changes.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Certs is a set of loaded certificates, by SNI host. It must not be modified after it's loaded.
+type Certs struct {
+	hosts map[string]*tls.Certificate
+	def   *tls.Certificate
+	infos []Info
+	files map[string]fileStamp
+}
+
+// Load loads the certificates of the given remap rules, and the default certificate if certFile and keyFile aren't empty.
+//
+// Each rule's certificate is served for the host of its From. Rules without a From host, such as regex rules, are served for the DNS names of their certificate. If multiple rules have the same host, the first rule's certificate is served.
+func Load(rules []remapdata.RemapRule, certFile string, keyFile string) (*Certs, error) {
+	c := &Certs{hosts: map[string]*tls.Certificate{}, files: map[string]fileStamp{}}
+	for _, rule := range rules {
+		if rule.CertificateFile == "" && rule.CertificateKeyFile == "" {
+			continue
+		}
+		if rule.CertificateFile == "" {
+			return nil, errors.New("rule " + rule.Name + " has a key but no certificate")
+		}
+		if rule.CertificateKeyFile == "" {
+			return nil, errors.New("rule " + rule.Name + " has a certificate but no key")
+		}
+		cert, err := c.load(rule.CertificateFile, rule.CertificateKeyFile)
+		if err != nil {
+			return nil, errors.New("loading rule " + rule.Name + " certificate: " + err.Error())
+		}
+		hosts := cert.Leaf.DNSNames
+		if host := fromHost(rule.From); host != "" {
+			hosts = []string{host}
+		}
+		info := Info{Name: rule.Name, File: rule.CertificateFile, Subject: cert.Leaf.Subject.String(), NotAfter: cert.Leaf.NotAfter}
+		for _, host := range hosts {
+			host = strings.ToLower(host)
+			if _, ok := c.hosts[host]; ok {
+				continue
+			}
+			c.hosts[host] = cert
+			info.Hosts = append(info.Hosts, host)
+		}
+		c.infos = append(c.infos, info)
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := c.load(certFile, keyFile)
+		if err != nil {
+			return nil, errors.New("loading default certificate: " + err.Error())
+		}
+		c.def = cert
+		c.infos = append(c.infos, Info{Name: DefaultName, File: certFile, Subject: cert.Leaf.Subject.String(), NotAfter: cert.Leaf.NotAfter})
+	}
+	return c, nil
+}
+
+// load loads the given certificate and key files, and records their modification times.
+func (c *Certs) load(certFile string, keyFile string) (*tls.Certificate, error) {
+	// the files are stamped before they're read, so a change while reading is detected by the next check.
+	for _, file := range []string{certFile, keyFile} {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		c.files[file] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, errors.New("parsing certificate: " + err.Error())
+		}
+	}
+	return &cert, nil
+}
+
+// fromHost returns the lower-case host of a rule From, without the port, or the empty string if it has none.
+func fromHost(from string) string {
+	if from == "" {
+		return ""
+	}
+	u, err := url.Parse(from)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Get returns the certificate for the given SNI host: the certificate for the exact host, or else for the wildcard of its parent domain, or else the default certificate. If there's no default, an error is returned.
+func (c *Certs) Get(serverName string) (*tls.Certificate, error) {
+	host := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if cert, ok := c.hosts[host]; ok {
+		return cert, nil
+	}
+	if i := strings.Index(host, "."); i > 0 {
+		if cert, ok := c.hosts["*"+host[i:]]; ok {
+			return cert, nil
+		}
+	}
+	if c.def != nil {
+		return c.def, nil
+	}
+	return nil, errors.New("no certificate for '" + serverName + "'")
+}
+
+// Infos returns the information about the loaded certificates, in rule order, followed by the default certificate.
+func (c *Certs) Infos() []Info {
+	return c.infos
+}
+
+// Changed returns whether any certificate or key file has changed since it was loaded.
+func (c *Certs) Changed() bool {
+	for file, stamp := range c.files {
+		fi, err := os.Stat(file)
+		if err != nil || !fi.ModTime().Equal(stamp.modTime) || fi.Size() != stamp.size {
+			return true
+		}
+	}
+	return false
+}
+
+// LogExpiry logs the expiration of each certificate, as a warning if it expires within ExpiryWarning of the given time, and as an error if it's expired.
+func (c *Certs) LogExpiry(now time.Time) {
+	for _, info := range c.infos {
+		switch {
+		case now.After(info.NotAfter):
+			log.Errorf("certificate %v '%v' for %v expired at %v\n", info.Name, info.Subject, info.Hosts, info.NotAfter.Format(time.RFC3339))
+		case now.Add(ExpiryWarning).After(info.NotAfter):
+			log.Warnf("certificate %v '%v' for %v expires soon, at %v\n", info.Name, info.Subject, info.Hosts, info.NotAfter.Format(time.RFC3339))
+		default:
+			log.Infof("certificate %v '%v' for %v expires at %v\n", info.Name, info.Subject, info.Hosts, info.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// Store holds the certificates being served, which may be swapped while serving, to reload them.
+type Store struct {
+	certs atomic.Value // *Certs
+}
+
+// New creates a new Store serving the given certificates.
+func New(certs *Certs) *Store {
+	s := &Store{}
+	s.Set(certs)
+	return s
+}
+
+// Set swaps in the given certificates. Connections already established keep their certificates.
+func (s *Store) Set(certs *Certs) {
+	s.certs.Store(certs)
+}
+
+// Certs returns the certificates being served.
+func (s *Store) Certs() *Certs {
+	return s.certs.Load().(*Certs)
+}
+
+// GetCertificate returns the certificate for the client's SNI host. It's the tls.Config.GetCertificate func, so certificates may be reloaded without recreating the listener.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.Certs().Get(hello.ServerName)
+}
@@ -0,0 +1,137 @@
+package certstore
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+// writeCert writes a self-signed certificate for the given DNS names and its key to the given directory, and returns their paths.
+func writeCert(t *testing.T, dir string, name string, dnsNames []string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: name}, DNSNames: dnsNames, NotBefore: time.Now().Add(-time.Hour), NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func ruleWithCert(name string, from string, certFile string, keyFile string) remapdata.RemapRule {
+	return remapdata.RemapRule{RemapRuleBase: remapdata.RemapRuleBase{Name: name, From: from, CertificateFile: certFile, CertificateKeyFile: keyFile}}
+}
+
+func TestLoadGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certstore")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	fooCert, fooKey := writeCert(t, dir, "foo", []string{"ignored.example.net"}, notAfter)
+	wildCert, wildKey := writeCert(t, dir, "wild", []string{"*.video.example.net"}, notAfter)
+	defCert, defKey := writeCert(t, dir, "default", []string{"cdn.example.net"}, notAfter)
+
+	rules := []remapdata.RemapRule{
+		ruleWithCert("foo", "https://Foo.example.net:8443/path", fooCert, fooKey),
+		ruleWithCert("regex", "", wildCert, wildKey),
+		ruleWithCert("nocert", "https://bar.example.net", "", ""),
+	}
+	certs, err := Load(rules, defCert, defKey)
+	if err != nil {
+		t.Fatalf("Load expected nil error, actual %v", err)
+	}
+	s := New(certs)
+
+	tests := map[string]string{
+		"foo.example.net":       "foo",
+		"FOO.example.net.":      "foo",
+		"a.video.example.net":   "wild",
+		"a.b.video.example.net": "default",
+		"bar.example.net":       "default",
+		"":                      "default",
+	}
+	for serverName, expected := range tests {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			t.Errorf("GetCertificate '%v' expected nil error, actual %v", serverName, err)
+			continue
+		}
+		if actual := cert.Leaf.Subject.CommonName; actual != expected {
+			t.Errorf("GetCertificate '%v' expected certificate '%v', actual '%v'", serverName, expected, actual)
+		}
+	}
+
+	infos := certs.Infos()
+	if len(infos) != 3 || infos[0].Name != "foo" || infos[0].Hosts[0] != "foo.example.net" || infos[1].Hosts[0] != "*.video.example.net" || infos[2].Name != DefaultName {
+		t.Fatalf("Infos expected foo, regex, and default, actual %+v", infos)
+	}
+	if !infos[0].NotAfter.Equal(notAfter) {
+		t.Errorf("Infos expected NotAfter %v, actual %v", notAfter, infos[0].NotAfter)
+	}
+
+	if certs.Changed() {
+		t.Errorf("Changed expected false before the files change")
+	}
+	// certificates may be rewritten within the file system's time resolution, so the size must change too
+	writeCert(t, dir, "foo", []string{"foo.example.net", "www.foo.example.net"}, notAfter)
+	if !certs.Changed() {
+		t.Errorf("Changed expected true after the files change")
+	}
+
+	noDefault, err := Load(rules[:1], "", "")
+	if err != nil {
+		t.Fatalf("Load without a default expected nil error, actual %v", err)
+	}
+	if _, err := noDefault.Get("bar.example.net"); err == nil {
+		t.Errorf("Get of a host without a certificate and no default expected error, actual nil")
+	}
+
+	if _, err := Load([]remapdata.RemapRule{ruleWithCert("nokey", "https://a.example.net", fooCert, "")}, "", ""); err == nil {
+		t.Errorf("Load of a rule without a key expected error, actual nil")
+	}
+	if _, err := Load(nil, defCert, filepath.Join(dir, "nonexistent.key")); err == nil {
+		t.Errorf("Load of a nonexistent default key expected error, actual nil")
+	}
+}
@@ -142,3 +142,16 @@ func (h *SimpleATSConsistentHash) LookupHash(hashVal uint64) (OrderedMapUint64No
 	}
 	return iter, wrapped
 }
+
+// NextAvailable returns the first iterator at or after iter, wrapping, whose node is available. This is used to skip parents which are marked down. If no node is available, iter is returned.
+func NextAvailable(iter OrderedMapUint64NodeIterator, available func(*ATSConsistentHashNode) bool) OrderedMapUint64NodeIterator {
+	start := iter.Index() // not Key, which for a Lookup is the hash looked up, not the node's
+	for i := iter; ; {
+		if available(i.Val()) {
+			return i
+		}
+		if i = i.NextWrap(); i.Index() == start {
+			return iter
+		}
+	}
+}
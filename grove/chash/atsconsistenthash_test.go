@@ -89,3 +89,30 @@ func TestSimpleATSConsistentHashLookup(t *testing.T) {
 	}
 
 }
+
+func TestNextAvailable(t *testing.T) {
+	names := []string{"foo", "bar", "baz"}
+	h := NewSimpleATSConsistentHash(10)
+	for _, name := range names {
+		h.Insert(&ATSConsistentHashNode{Name: name}, 1.0)
+	}
+
+	i, _, err := h.Lookup("lookupasdf")
+	if err != nil {
+		t.Fatalf("ATSConsistentHash.Lookup expected nil error, actual %v", err)
+	}
+	down := i.Val().Name
+
+	available := NextAvailable(i, func(n *ATSConsistentHashNode) bool { return n.Name != down })
+	if available.Val().Name == down {
+		t.Errorf("NextAvailable expected node other than down node %v, actual %v", down, available.Val().Name)
+	}
+
+	if unchanged := NextAvailable(i, func(n *ATSConsistentHashNode) bool { return true }); unchanged.Index() != i.Index() {
+		t.Errorf("NextAvailable with all nodes available expected %v actual %v", i.Val().Name, unchanged.Val().Name)
+	}
+
+	if none := NextAvailable(i, func(n *ATSConsistentHashNode) bool { return false }); none.Index() != i.Index() {
+		t.Errorf("NextAvailable with no nodes available expected %v actual %v", i.Val().Name, none.Val().Name)
+	}
+}
@@ -15,7 +15,9 @@ package config
 */
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -38,7 +40,9 @@ type Config struct {
 	ConcurrentRuleRequests int    `json:"concurrent_rule_requests"`
 	CertFile               string `json:"cert_file"`
 	KeyFile                string `json:"key_file"`
-	InterfaceName          string `json:"interface_name"`
+	// CertReloadIntervalMS is how often the certificate and key files of the config and remap rules are checked for changes, and reloaded if they changed. If 0, they're only reloaded with the config.
+	CertReloadIntervalMS int    `json:"cert_reload_interval_ms"`
+	InterfaceName        string `json:"interface_name"`
 	// ConnectionClose determines whether to send a `Connection: close` header. This is primarily designed for maintenance, to drain the cache of incoming requestors. This overrides rule-specific `connection-close: false` configuration, under the assumption that draining a cache is a temporary maintenance operation, and if connectionClose is true on the service and false on some rules, those rules' configuration is probably a permament setting whereas the operator probably wants to drain all connections if the global setting is true. If it's necessary to leave connection close false on some rules, set all other rules' connectionClose to true and leave the global connectionClose unset.
 	ConnectionClose bool `json:"connection_close"`
 
@@ -55,12 +59,19 @@ type Config struct {
 	ReqMaxIdleConns      int `json:"parent_request_max_idle_connections"`
 	ReqIdleConnTimeoutMS int `json:"parent_request_idle_connection_timeout_ms"`
 
-	ServerIdleTimeoutMS  int                    `json:"server_idle_timeout_ms"`
-	ServerWriteTimeoutMS int                    `json:"server_write_timeout_ms"`
-	ServerReadTimeoutMS  int                    `json:"server_read_timeout_ms"`
-	CacheFiles           map[string][]CacheFile `json:"cache_files"`
+	ServerIdleTimeoutMS  int                       `json:"server_idle_timeout_ms"`
+	ServerWriteTimeoutMS int                       `json:"server_write_timeout_ms"`
+	ServerReadTimeoutMS  int                       `json:"server_read_timeout_ms"`
+	CacheFiles           map[string]CacheFileGroup `json:"cache_files"`
 	// FileMemBytes is the amount of memory to use as an LRU in front of each name in CacheFiles, that is, each named group of files. E.g. if there are 10 files, the amount of memory used will be 10*FileMemBytes+CacheSizeBytes.
 	FileMemBytes int `json:"file_mem_bytes"`
+	// FileMemWarm is whether to warm the memory in front of each named group of files with the most hit objects on disk, on startup.
+	FileMemWarm bool `json:"file_mem_warm"`
+
+	// Siblings are the hosts or IPs of the peer caches, typically in the same cache group, which are asked for objects missing from the cache before parents. They must serve on the same ports.
+	Siblings []string `json:"siblings"`
+	// SiblingTimeoutMS is how long to wait for siblings to respond whether they have an object, before requesting it from a parent.
+	SiblingTimeoutMS int `json:"sibling_timeout_ms"`
 }
 
 type CacheFile struct {
@@ -68,6 +79,36 @@ type CacheFile struct {
 	Bytes uint64 `json:"size_bytes"`
 }
 
+// AdmissionTinyLFU is the CacheFileGroup Admission policy which only adds a new object to a full cache if it's been requested more frequently than the object it would evict.
+const AdmissionTinyLFU = "tinylfu"
+
+// CacheFileGroup is a named group of cache files, and the policies for adding objects to them and to the memory cache in front of them. It may be given as just the JSON array of files, to use the default policies.
+type CacheFileGroup struct {
+	Files []CacheFile `json:"files"`
+	// Admission is the policy for adding new objects to the files and memory cache when they're full. The empty string admits all objects, evicting the least recently used; "tinylfu" admits objects requested more frequently than the object they'd evict.
+	Admission string `json:"admission"`
+	// AdmissionCounters is the number of frequency counters used by the "tinylfu" admission policy, which should be roughly the number of objects the files hold. If 0, tinylfu.DefaultCounters is used.
+	AdmissionCounters uint64 `json:"admission_counters"`
+	// MemPromoteHits is the number of times an object must be hit on disk, before it's added to the memory cache. If 0, objects are added to memory when they're added to disk.
+	MemPromoteHits uint64 `json:"mem_promote_hits"`
+}
+
+// UnmarshalJSON unmarshals either a JSON object of the group's files and policies, or a JSON array of its files.
+func (g *CacheFileGroup) UnmarshalJSON(b []byte) error {
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		*g = CacheFileGroup{}
+		return json.Unmarshal(b, &g.Files)
+	}
+	type cacheFileGroup CacheFileGroup // avoid recursing into UnmarshalJSON
+	if err := json.Unmarshal(b, (*cacheFileGroup)(g)); err != nil {
+		return err
+	}
+	if g.Admission != "" && g.Admission != AdmissionTinyLFU {
+		return errors.New("unknown admission policy '" + g.Admission + "'")
+	}
+	return nil
+}
+
 func (c Config) ErrorLog() log.LogLocation {
 	return log.LogLocation(c.LogLocationError)
 }
@@ -108,6 +149,8 @@ var DefaultConfig = Config{
 	ServerIdleTimeoutMS:    10 * MSPerSec,
 	ServerWriteTimeoutMS:   3 * MSPerSec,
 	ServerReadTimeoutMS:    3 * MSPerSec,
+	CertReloadIntervalMS:   60 * MSPerSec,
+	SiblingTimeoutMS:       50,
 	FileMemBytes:           bytesPerMebibyte * 100,
 }
 
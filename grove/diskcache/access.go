@@ -0,0 +1,226 @@
+package diskcache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// AccessBucketName is the bucket of the access metadata of cache objects, which is used to rebuild the LRU in the right order after a restart. Values are the big-endian int64 Unix nanosecond last access time, followed by the big-endian uint64 hit count.
+const AccessBucketName = "a"
+
+// AccessFlushInterval is how often access metadata is written to disk. Accesses are kept in memory until then, so reading objects doesn't write to disk.
+const AccessFlushInterval = 10 * time.Second
+
+// recoveryBatchSize is the number of entries read in each transaction when recovering after a restart, so large caches don't hold transactions open.
+const recoveryBatchSize = 10000
+
+// accessMeta is the access metadata of a cache object.
+type accessMeta struct {
+	lastAccess time.Time
+	hits       uint64
+}
+
+func (m accessMeta) bytes() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, uint64(m.lastAccess.UnixNano()))
+	binary.BigEndian.PutUint64(b[8:], m.hits)
+	return b
+}
+
+func parseAccessMeta(b []byte) (accessMeta, bool) {
+	if len(b) != 16 {
+		return accessMeta{}, false
+	}
+	return accessMeta{
+		lastAccess: time.Unix(0, int64(binary.BigEndian.Uint64(b))),
+		hits:       binary.BigEndian.Uint64(b[8:]),
+	}, true
+}
+
+// recordAccess records that the object with the given key was accessed now, and has been hit the given number of times. It's written to disk on the next flush.
+func (c *DiskCache) recordAccess(key string, hits uint64) {
+	c.accessM.Lock()
+	c.accesses[key] = accessMeta{lastAccess: time.Now(), hits: hits}
+	c.accessM.Unlock()
+}
+
+// pendingAccess returns the access of the given key which hasn't been flushed to disk yet, if any.
+func (c *DiskCache) pendingAccess(key string) (accessMeta, bool) {
+	c.accessM.Lock()
+	defer c.accessM.Unlock()
+	m, ok := c.accesses[key]
+	return m, ok
+}
+
+// flushManager flushes accesses to disk every AccessFlushInterval, until the cache is closed. It should be called in a goroutine.
+func (c *DiskCache) flushManager() {
+	ticker := time.NewTicker(AccessFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flushAccesses()
+		case <-c.closing:
+			c.flushAccesses()
+			close(c.closed)
+			return
+		}
+	}
+}
+
+// flushAccesses writes the accesses since the last flush to disk. Accesses of objects which have since been deleted are dropped.
+func (c *DiskCache) flushAccesses() {
+	c.accessM.Lock()
+	accesses := c.accesses
+	c.accesses = map[string]accessMeta{}
+	c.accessM.Unlock()
+	if len(accesses) == 0 {
+		return
+	}
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		access := tx.Bucket([]byte(AccessBucketName))
+		if b == nil || access == nil {
+			return errors.New("bucket does not exist")
+		}
+		for key, meta := range accesses {
+			if b.Get([]byte(key)) == nil {
+				continue
+			}
+			if err := access.Put([]byte(key), meta.bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorln("DiskCache flushing access metadata for '" + c.db.Path() + "': " + err.Error())
+	}
+}
+
+// forEachBatch calls f with each key and value in the given bucket, in transactions of recoveryBatchSize entries. The key and value are only valid during the call to f.
+func (c *DiskCache) forEachBatch(bucket string, f func(k []byte, v []byte)) error {
+	last := []byte(nil)
+	for {
+		n := 0
+		err := c.db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				return errors.New("bucket '" + bucket + "' does not exist")
+			}
+			cursor := b.Cursor()
+			k, v := cursor.First()
+			if last != nil {
+				if k, v = cursor.Seek(last); k != nil && bytes.Equal(k, last) {
+					k, v = cursor.Next()
+				}
+			}
+			for ; k != nil && n < recoveryBatchSize; k, v = cursor.Next() {
+				f(k, v)
+				last = append(last[:0], k...)
+				n++
+			}
+			return nil
+		})
+		if err != nil || n < recoveryBatchSize {
+			return err
+		}
+	}
+}
+
+// deleteBatches deletes the given keys from the given bucket, in transactions of recoveryBatchSize keys.
+func (c *DiskCache) deleteBatches(bucket string, keys [][]byte) error {
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > recoveryBatchSize {
+			batch = batch[:recoveryBatchSize]
+		}
+		keys = keys[len(batch):]
+		err := c.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				return errors.New("bucket '" + bucket + "' does not exist")
+			}
+			for _, k := range batch {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recovered returns a channel which is closed when ResetAfterRestart has finished rebuilding the LRU.
+func (c *DiskCache) Recovered() <-chan struct{} { return c.recovered }
+
+// accessMetas returns the access metadata of every object, including accesses not yet flushed to disk.
+func (c *DiskCache) accessMetas() (map[string]accessMeta, error) {
+	metas := map[string]accessMeta{}
+	err := c.forEachBatch(AccessBucketName, func(k []byte, v []byte) {
+		if meta, ok := parseAccessMeta(v); ok {
+			metas[string(k)] = meta
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.accessM.Lock()
+	for key, meta := range c.accesses {
+		metas[key] = meta
+	}
+	c.accessM.Unlock()
+	return metas, nil
+}
+
+// HottestKeys returns the keys of the objects in the cache, most hit first, and most recently accessed first among objects with the same hits. It blocks until the cache has recovered after a restart.
+func (c *DiskCache) HottestKeys() []string {
+	<-c.recovered
+	metas, err := c.accessMetas()
+	if err != nil {
+		log.Errorln("DiskCache.HottestKeys reading access metadata for '" + c.db.Path() + "': " + err.Error())
+		return nil
+	}
+	return hottestKeys(metas)
+}
+
+func hottestKeys(metas map[string]accessMeta) []string {
+	keys := make([]string, 0, len(metas))
+	for key := range metas {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := metas[keys[i]], metas[keys[j]]
+		if a.hits != b.hits {
+			return a.hits > b.hits
+		}
+		return a.lastAccess.After(b.lastAccess)
+	})
+	return keys
+}
@@ -16,12 +16,18 @@ package diskcache
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/lru"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -34,81 +40,304 @@ type DiskCache struct {
 	sizeBytes    uint64
 	maxSizeBytes uint64
 	lru          *lru.LRU
+	accesses     map[string]accessMeta // mutexed: MUST NOT access without locking accessM. Accesses not yet flushed to disk.
+	accessM      sync.Mutex
+	recovered    chan struct{}
+	closing      chan struct{}
+	closed       chan struct{}
+	admitter     icache.Admitter // may be nil, to admit all objects
+	stats        icache.StatsCounter
+	openGen      uint64 // the last body generation when the database was opened. Later generations were created by this process, and aren't recovered.
 }
 
+// BucketName is the bucket of cache objects, without their bodies. Values are the big-endian uint64 generation of the object's body, followed by the gob-encoded object.
 const BucketName = "b"
 
-func New(path string, cacheSizeBytes uint64) (*DiskCache, error) {
+// ChunkBucketName is the bucket of the chunks of cache object bodies. Chunks are keyed by the object key, followed by chunkKeySep, the big-endian uint64 generation of the body, and the big-endian uint32 chunk index.
+// Each body stored for a key has a new generation, from the bucket's sequence, so a new body's chunks never overwrite those of the old body, which may still be being read.
+const ChunkBucketName = "c"
+
+const chunkKeySep = "\x00"
+
+// chunkKeySuffixLen is the length of the chunk key after the object key.
+const chunkKeySuffixLen = len(chunkKeySep) + 8 + 4
+
+// genLen is the length of the generation at the start of object values.
+const genLen = 8
+
+// chunksPerTx is the number of chunks written in each transaction when adding an object. Bolt holds a transaction's writes in memory until it's committed, so large objects are written in multiple transactions.
+const chunksPerTx = 64
+
+// New creates a new DiskCache in the given file, with the given capacity in bytes. If admitter is not nil, it decides whether new objects are added when the cache is full.
+func New(path string, cacheSizeBytes uint64, admitter icache.Admitter) (*DiskCache, error) {
 	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
 		return nil, errors.New("opening database '" + path + "': " + err.Error())
 	}
 
+	openGen := uint64(0)
 	err = db.Update(func(tx *bolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists([]byte(BucketName)); err != nil {
-			return errors.New("creating bucket: " + err.Error())
+		for _, bucket := range []string{BucketName, ChunkBucketName, AccessBucketName} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return errors.New("creating bucket '" + bucket + "': " + err.Error())
+			}
 		}
+		openGen = tx.Bucket([]byte(ChunkBucketName)).Sequence()
 		return nil
 	})
 	if err != nil {
-		return nil, errors.New("creating bucket for database '" + path + "': " + err.Error())
+		return nil, errors.New("creating buckets for database '" + path + "': " + err.Error())
 	}
 
-	return &DiskCache{db: db, maxSizeBytes: cacheSizeBytes, lru: lru.NewLRU(), sizeBytes: 0}, nil
+	c := &DiskCache{
+		db:           db,
+		maxSizeBytes: cacheSizeBytes,
+		lru:          lru.NewLRU(),
+		sizeBytes:    0,
+		accesses:     map[string]accessMeta{},
+		recovered:    make(chan struct{}),
+		closing:      make(chan struct{}),
+		closed:       make(chan struct{}),
+		admitter:     admitter,
+		openGen:      openGen,
+	}
+	go c.flushManager()
+	return c, nil
 }
 
-// ResetAfterRestart rebuilds the LRU with an arbirtrary order and sets sizeBytes. This seems crazy, but it is better than doing nothing, sice gc is based on the LRU and sizeBytes. In the future, we may want to periodically sync the LRU to disk, but we'll still need to iterate over all keys in the disk DB to avoid orphaning objects.
-// Note: this assumes the LRU is empty. Don't run twice
+func chunkKey(key string, gen uint64, i int) []byte {
+	k := make([]byte, len(key)+chunkKeySuffixLen)
+	copy(k, key+chunkKeySep)
+	binary.BigEndian.PutUint64(k[len(key)+len(chunkKeySep):], gen)
+	binary.BigEndian.PutUint32(k[len(k)-4:], uint32(i))
+	return k
+}
+
+// parseChunkKey returns the object key and generation of the given chunk key, and false if it isn't a valid chunk key.
+func parseChunkKey(k []byte) (string, uint64, bool) {
+	if len(k) < chunkKeySuffixLen {
+		return "", 0, false
+	}
+	keyLen := len(k) - chunkKeySuffixLen
+	return string(k[:keyLen]), binary.BigEndian.Uint64(k[keyLen+len(chunkKeySep):]), true
+}
+
+// objectValue returns the value an object is stored as, with the given body generation.
+func objectValue(gen uint64, obj []byte) []byte {
+	v := make([]byte, genLen+len(obj))
+	binary.BigEndian.PutUint64(v, gen)
+	copy(v[genLen:], obj)
+	return v
+}
+
+// objectGen returns the body generation of the given stored object value, and false if it's not a valid object value.
+func objectGen(v []byte) (uint64, bool) {
+	if len(v) < genLen {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(v), true
+}
+
+// ResetAfterRestart rebuilds the LRU and sets sizeBytes, from the objects on disk. The LRU is ordered by the access metadata persisted with the objects, so the objects evicted first after a restart are the ones least recently used before it. Objects without access metadata are treated as least recently used.
+// Chunks without an object or of an old generation of their object, from an Add interrupted by the restart, and access metadata without an object, are deleted.
+// This runs in a goroutine, reading the database in batches, so it doesn't block starting or using the cache. Objects accessed before it finishes keep their place at the front of the LRU. Recovered is closed when it finishes.
+// Note: this must be called at most once.
 func (c *DiskCache) ResetAfterRestart() {
-	go c.db.View(func(tx *bolt.Tx) error {
+	go func() {
+		defer close(c.recovered)
 		log.Infof("Starting cache recovery from disk for: %s... ", c.db.Path())
-		size := 0
-		b := tx.Bucket([]byte(BucketName))
+		sizes := map[string]uint64{}
+		gens := map[string]uint64{}
+		err := c.forEachBatch(BucketName, func(k []byte, v []byte) {
+			sizes[string(k)] = uint64(len(v))
+			gens[string(k)], _ = objectGen(v)
+		})
+		if err != nil {
+			log.Errorln("DiskCache.ResetAfterRestart reading objects for '" + c.db.Path() + "': " + err.Error())
+			return
+		}
+
+		orphans := [][]byte{}
+		err = c.forEachBatch(ChunkBucketName, func(k []byte, v []byte) {
+			key, gen, ok := parseChunkKey(k)
+			if ok && gen > c.openGen {
+				return // written since the restart, by an Add or Spool which may not have stored its object yet
+			}
+			if objGen, hasObj := gens[key]; !ok || !hasObj || objGen != gen {
+				orphans = append(orphans, append([]byte(nil), k...))
+				return
+			}
+			sizes[key] += uint64(len(v))
+		})
+		if err != nil {
+			log.Errorln("DiskCache.ResetAfterRestart reading chunks for '" + c.db.Path() + "': " + err.Error())
+			return
+		}
 
-		cursor := b.Cursor()
+		metas := map[string]accessMeta{}
+		orphanMetas := [][]byte{}
+		err = c.forEachBatch(AccessBucketName, func(k []byte, v []byte) {
+			if _, ok := sizes[string(k)]; !ok {
+				orphanMetas = append(orphanMetas, append([]byte(nil), k...))
+				return
+			}
+			if meta, ok := parseAccessMeta(v); ok {
+				metas[string(k)] = meta
+			}
+		})
+		if err != nil {
+			log.Errorln("DiskCache.ResetAfterRestart reading access metadata for '" + c.db.Path() + "': " + err.Error())
+			return
+		}
 
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			c.lru.Add(string(k), uint64(len(v)))
-			size += len(v)
+		// orphans may have been written by an Add since they were read, so the objects are checked again before deleting
+		if err := c.deleteBatches(ChunkBucketName, c.withoutObjects(orphans, true)); err != nil {
+			log.Errorln("DiskCache.ResetAfterRestart deleting orphaned chunks for '" + c.db.Path() + "': " + err.Error())
+		}
+		if err := c.deleteBatches(AccessBucketName, c.withoutObjects(orphanMetas, false)); err != nil {
+			log.Errorln("DiskCache.ResetAfterRestart deleting orphaned access metadata for '" + c.db.Path() + "': " + err.Error())
 		}
 
-		atomic.AddUint64(&c.sizeBytes, uint64(size))
-		log.Infof("Cache recovery from disk for %s done (%d bytes). ", c.db.Path(), c.sizeBytes)
+		// most recently accessed first, each pushed to the back, behind any objects added or accessed since the restart
+		keys := make([]string, 0, len(sizes))
+		for key := range sizes {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return metas[keys[i]].lastAccess.After(metas[keys[j]].lastAccess) })
+		size := uint64(0)
+		for _, key := range keys {
+			if c.lru.PushBack(key, sizes[key]) {
+				size += sizes[key]
+			}
+		}
+		newSizeBytes := atomic.AddUint64(&c.sizeBytes, size)
+		if newSizeBytes > c.maxSizeBytes {
+			go c.gc(newSizeBytes)
+		}
+		log.Infof("Cache recovery from disk for %s done (%d bytes, %d objects, %d with access metadata, %d orphaned chunks deleted). ", c.db.Path(), newSizeBytes, len(keys), len(metas), len(orphans))
+	}()
+}
+
+// withoutObjects returns the given chunk or access metadata keys whose objects don't exist. Chunks of a generation other than their object's are also returned.
+func (c *DiskCache) withoutObjects(keys [][]byte, areChunks bool) [][]byte {
+	without := [][]byte{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketName))
+		if b == nil {
+			return errors.New("bucket does not exist")
+		}
+		for _, k := range keys {
+			if !areChunks {
+				if b.Get(k) == nil {
+					without = append(without, k)
+				}
+				continue
+			}
+			objKey, gen, ok := parseChunkKey(k)
+			if !ok {
+				without = append(without, k)
+				continue
+			}
+			if objGen, ok := objectGen(b.Get([]byte(objKey))); !ok || objGen != gen {
+				without = append(without, k)
+			}
+		}
 		return nil
 	})
+	if err != nil {
+		log.Errorln("DiskCache checking objects for '" + c.db.Path() + "': " + err.Error())
+		return nil
+	}
+	return without
 }
 
 // Add takes a key and value to add. Returns whether an eviction occurred
 // The size is taken to fulfill the Cache interface, but the DiskCache doesn't use it.
 // Instead, we compute size from the serialized bytes stored to disk.
 //
+// The object's body is stored as chunks, separately from the object, and read a chunk at a time, so it's never all in memory. The chunks are written with a new generation before the object, so the object is never found without all its chunks, and readers of an old object never read the new object's chunks. The old object's chunks are deleted once the new object is stored.
+// If the body was spooled to this cache for the key, with Spool, its chunks are already stored, and only the object is written.
+//
 // Note DiskCache.Add does garbage collection in a goroutine, and thus it is not possible to determine eviction without impacting performance. This always returns false.
 func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 	log.Debugf("DiskCache Add CALLED key '%+v' size '%+v'\n", key, val.Size)
 	eviction := false
 
+	obj := *val
+	obj.Body = nil // the body is stored in chunks
 	buf := bytes.Buffer{}
-	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
+	if err := gob.NewEncoder(&buf).Encode(&obj); err != nil {
 		log.Errorln("DiskCache.Add encoding cache object: " + err.Error())
 		return eviction
 	}
-	valBytes := buf.Bytes()
 
-	err := c.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(BucketName))
-		if b == nil {
-			return errors.New("bucket does not exist")
+	isNew := !c.lru.Contains(key)
+	gen, bodyBytes, err := uint64(0), uint64(0), error(nil)
+	sameGen := false // whether the body is already stored for the key with gen, i.e. the object was revalidated or invalidated
+	sp := c.ownSpool(key, val.Body)
+	if body, ok := val.Body.(*diskBody); ok && body.db == c.db && body.key == key {
+		gen, bodyBytes, sameGen = body.gen, body.size, true
+	} else if sp != nil {
+		if gen, bodyBytes, err = sp.written(); err != nil {
+			log.Errorln("DiskCache.Add adding spooled '" + key + "': " + err.Error())
+			return eviction
 		}
-		return b.Put([]byte(key), valBytes)
-	})
+		if isNew {
+			c.stats.CountAdmit(true) // spools are only created for admitted objects
+		}
+	} else {
+		if isNew {
+			admitted := c.admit(key, val.Size)
+			c.stats.CountAdmit(admitted)
+			if !admitted {
+				log.Debugf("DiskCache Add rejected key '%+v' size '%+v'\n", key, val.Size)
+				return eviction
+			}
+		}
+		gen, bodyBytes, err = c.putChunks(key, val.Body)
+	}
+
+	valBytes := objectValue(gen, buf.Bytes())
+	oldGen, hadOld := uint64(0), false
+	if err == nil {
+		err = c.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(BucketName))
+			if b == nil {
+				return errors.New("bucket does not exist")
+			}
+			oldGen, hadOld = objectGen(b.Get([]byte(key)))
+			if sameGen && (!hadOld || oldGen != gen) {
+				return errBodyReplaced
+			}
+			return b.Put([]byte(key), valBytes)
+		})
+	}
+	if err == errBodyReplaced {
+		log.Debugf("DiskCache Add key '%+v' body was removed or replaced since it was gotten, not adding\n", key)
+		return eviction
+	}
 	if err != nil {
 		log.Errorln("DiskCache.Add inserting '" + key + "' in database: " + err.Error())
+		if !sameGen && sp == nil {
+			c.deleteChunks(key, gen) // spooled chunks are deleted when the spool is discarded
+		}
 		return eviction
 	}
+	if sp != nil {
+		sp.commit()
+	}
+	if hadOld && oldGen != gen {
+		c.deleteChunks(key, oldGen)
+	}
 
-	c.lru.Add(key, uint64(len(valBytes)))
+	size := uint64(len(valBytes)) + bodyBytes
+	oldSize := c.lru.Add(key, size)
+	c.recordAccess(key, val.HitCount)
 
-	newSizeBytes := atomic.AddUint64(&c.sizeBytes, uint64(len(valBytes)))
+	newSizeBytes := atomic.AddUint64(&c.sizeBytes, size)
+	if oldSize > 0 {
+		newSizeBytes = atomic.AddUint64(&c.sizeBytes, ^uint64(oldSize-1)) // subtract oldSize
+	}
 	if newSizeBytes > c.maxSizeBytes {
 		go c.gc(newSizeBytes)
 	}
@@ -117,6 +346,146 @@ func (c *DiskCache) Add(key string, val *cacheobj.CacheObj) bool {
 	return eviction
 }
 
+// errBodyReplaced is returned by the Add transaction of an object whose body was already stored, if the body was since removed or replaced.
+var errBodyReplaced = errors.New("body replaced")
+
+// ownSpool returns the spool of the given body, if it was spooled to this cache for the given key, else nil.
+func (c *DiskCache) ownSpool(key string, body cacheobj.Body) *spool {
+	memBody, ok := body.(*cacheobj.MemBody)
+	if !ok {
+		return nil
+	}
+	sp, ok := memBody.Spool().(*spool)
+	if !ok || sp.c != c || sp.key != key {
+		return nil
+	}
+	return sp
+}
+
+// admit returns whether a new object of the given size should be added. Objects are always admitted if there's room, or if there's no admitter.
+func (c *DiskCache) admit(key string, size uint64) bool {
+	if c.admitter == nil || atomic.LoadUint64(&c.sizeBytes)+size <= c.maxSizeBytes {
+		return true
+	}
+	victim, ok := c.lru.Oldest()
+	return !ok || c.admitter.Admit(key, victim)
+}
+
+// newGen returns a new body generation.
+func (c *DiskCache) newGen() (uint64, error) {
+	gen := uint64(0)
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		chunks := tx.Bucket([]byte(ChunkBucketName))
+		if chunks == nil {
+			return errors.New("chunk bucket does not exist")
+		}
+		var err error
+		gen, err = chunks.NextSequence()
+		return err
+	})
+	return gen, err
+}
+
+// putChunks stores the chunks of the given complete body for the key, with a new generation. Returns the generation, and the number of body bytes stored.
+func (c *DiskCache) putChunks(key string, body cacheobj.Body) (uint64, uint64, error) {
+	gen, err := c.newGen()
+	if err != nil {
+		return 0, 0, errors.New("creating generation: " + err.Error())
+	}
+	size := uint64(0)
+	for i, done := 0, false; !done; {
+		err := c.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(ChunkBucketName))
+			if b == nil {
+				return errors.New("chunk bucket does not exist")
+			}
+			for n := 0; n < chunksPerTx; n++ {
+				chunk, err := body.Chunk(i)
+				if err == io.EOF {
+					done = true
+					return nil
+				} else if err != nil {
+					return errors.New("reading body: " + err.Error())
+				}
+				if err := b.Put(chunkKey(key, gen, i), chunk); err != nil {
+					return err
+				}
+				size += uint64(len(chunk))
+				i++
+			}
+			return nil
+		})
+		if err != nil {
+			c.deleteChunks(key, gen)
+			return 0, 0, fmt.Errorf("storing chunk %d: %v", i, err)
+		}
+	}
+	return gen, size, nil
+}
+
+// deleteChunks deletes the chunks of the given generation of the key's body, in transactions of chunksPerTx chunks.
+func (c *DiskCache) deleteChunks(key string, gen uint64) {
+	for i, done := 0, false; !done; {
+		err := c.db.Update(func(tx *bolt.Tx) error {
+			chunks := tx.Bucket([]byte(ChunkBucketName))
+			if chunks == nil {
+				return errors.New("chunk bucket does not exist")
+			}
+			for n := 0; n < chunksPerTx; n++ {
+				k := chunkKey(key, gen, i)
+				if chunks.Get(k) == nil {
+					done = true
+					return nil
+				}
+				if err := chunks.Delete(k); err != nil {
+					return err
+				}
+				i++
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("DiskCache deleting chunk %d of '%s' generation %d: %v\n", i, key, gen, err)
+			return
+		}
+	}
+}
+
+// deleteObject deletes the object and its chunks from the database.
+func deleteObject(tx *bolt.Tx, key string) error {
+	b := tx.Bucket([]byte(BucketName))
+	if b == nil {
+		return errors.New("bucket does not exist")
+	}
+	chunks := tx.Bucket([]byte(ChunkBucketName))
+	if chunks == nil {
+		return errors.New("chunk bucket does not exist")
+	}
+	access := tx.Bucket([]byte(AccessBucketName))
+	if access == nil {
+		return errors.New("access bucket does not exist")
+	}
+	gen, ok := objectGen(b.Get([]byte(key)))
+	if !ok {
+		return nil
+	}
+	if err := b.Delete([]byte(key)); err != nil {
+		return err
+	}
+	if err := access.Delete([]byte(key)); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		k := chunkKey(key, gen, i)
+		if chunks.Get(k) == nil {
+			return nil
+		}
+		if err := chunks.Delete(k); err != nil {
+			return err
+		}
+	}
+}
+
 // gc does garbage collection, deleting stored entries until the DiskCache's size is less than maxSizeBytes. This is threadsafe, and should be called in a goroutine to avoid blocking the caller.
 // The given cacheSizeBytes must be `c.Size()`; it's passed here, because gc should be called immediately after an insert updates the size, so it saves an atomic instruction to pass rather than calling Size() again.
 func (c *DiskCache) gc(cacheSizeBytes uint64) {
@@ -132,13 +501,7 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 
 		log.Debugf("DiskCache.gc deleting key '" + key + "'")
 		err := c.db.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(BucketName))
-			if b == nil {
-				return errors.New("bucket does not exist")
-			}
-			b.Delete([]byte(key))
-
-			return b.Delete([]byte(key))
+			return deleteObject(tx, key)
 		})
 		if err != nil {
 			log.Errorln("removing '" + key + "' from cache: " + err.Error())
@@ -150,11 +513,19 @@ func (c *DiskCache) gc(cacheSizeBytes uint64) {
 
 // Get takes a key, and returns its value, and whether it was found, and updates the lru-ness and hitcount
 func (c *DiskCache) Get(key string) (*cacheobj.CacheObj, bool) {
-	val, found := c.Peek(key)
+	if c.admitter != nil {
+		c.admitter.Access(key)
+	}
+	val, storedSize, found := c.peek(key)
+	c.stats.CountGet(found)
 	if found {
-		c.lru.Add(key, val.Size) // TODO directly call c.ll.MoveToFront
+		if oldSize := c.lru.Add(key, storedSize); oldSize == 0 {
+			// the object isn't in the LRU yet if it's requested before ResetAfterRestart recovers it
+			atomic.AddUint64(&c.sizeBytes, storedSize)
+		}
 		log.Debugln("DiskCache.Get getting '" + key + "' from cache and updating LRU")
-		atomic.AddUint64(&val.HitCount, 1)
+		val.HitCount++
+		c.recordAccess(key, val.HitCount)
 		return val, true
 	}
 	return nil, false
@@ -163,43 +534,236 @@ func (c *DiskCache) Get(key string) (*cacheobj.CacheObj, bool) {
 
 // Peek takes a key, and returns its value, and whether it was found, without changing the lru-ness or hitcount
 func (c *DiskCache) Peek(key string) (*cacheobj.CacheObj, bool) {
+	val, _, found := c.peek(key)
+	return val, found
+}
+
+// peek is Peek, and also returns the number of bytes the object and its body are stored in.
+// The returned object's body isn't read; it's read from disk as its chunks are read.
+func (c *DiskCache) peek(key string) (*cacheobj.CacheObj, uint64, bool) {
 	log.Debugln("DiskCache.Get key '" + key + "'")
 	valBytes := []byte(nil)
+	meta, hasMeta := accessMeta{}, false
 
 	err := c.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(BucketName))
-		if b == nil {
+		access := tx.Bucket([]byte(AccessBucketName))
+		if b == nil || access == nil {
 			return errors.New("bucket does not exist")
 		}
-		valBytes = b.Get([]byte(key))
+		if v := b.Get([]byte(key)); v != nil {
+			valBytes = append([]byte(nil), v...) // bolt values are only valid during the transaction
+			meta, hasMeta = parseAccessMeta(access.Get([]byte(key)))
+		}
 		return nil
 	})
 	if err != nil {
 		log.Errorln("DiskCache.Peek getting '" + key + "' from cache: " + err.Error())
-		return nil, false
+		return nil, 0, false
 	}
 
 	if valBytes == nil {
 		log.Debugln("DiskCache.Peek key '" + key + "' CACHE MISS")
-		return nil, false
+		return nil, 0, false
 	}
 
-	buf := bytes.NewBuffer(valBytes)
+	gen, ok := objectGen(valBytes)
+	if !ok {
+		log.Errorln("DiskCache.Peek decoding '" + key + "' from cache: object too short")
+		return nil, 0, false
+	}
+	buf := bytes.NewBuffer(valBytes[genLen:])
 	val := cacheobj.CacheObj{}
 	if err := gob.NewDecoder(buf).Decode(&val); err != nil {
 		log.Errorln("DiskCache.Peek decoding '" + key + "' from cache: " + err.Error())
-		return nil, false
+		return nil, 0, false
+	}
+	val.Body = &diskBody{db: c.db, key: key, gen: gen, size: val.Size}
+	// the hit count in the object is only its count when it was added; later hits are in its access metadata
+	if pending, ok := c.pendingAccess(key); ok {
+		meta, hasMeta = pending, true
+	}
+	if hasMeta {
+		val.HitCount = meta.hits
 	}
 
 	log.Debugln("DiskCache.Peek key '" + key + "' CACHE HIT")
-	return &val, true
+	return &val, uint64(len(valBytes)) + val.Size, true
+}
+
+// Remove removes the object and its body from the database.
+func (c *DiskCache) Remove(key string) bool {
+	_, found := c.Peek(key)
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		return deleteObject(tx, key)
+	})
+	if err != nil {
+		log.Errorln("DiskCache.Remove removing '" + key + "' from cache: " + err.Error())
+	}
+	if sizeBytes, inLRU := c.lru.Remove(key); inLRU {
+		atomic.AddUint64(&c.sizeBytes, ^uint64(sizeBytes-1)) // subtract sizeBytes
+	}
+	return found
+}
+
+// Invalidate marks the object Invalidated. Only the object is rewritten, not its body.
+func (c *DiskCache) Invalidate(key string) bool {
+	val, found := c.Peek(key)
+	if !found {
+		return false
+	}
+	val.Invalidated = true
+	c.Add(key, val)
+	return true
+}
+
+// Spool implements icache.Spooler. The chunks written to the spool are stored on disk with a new generation, and become the object's body when the spooled body is added for the key.
+// Returns nil if a new object of the given size wouldn't be admitted, so the body isn't written to disk only to be rejected.
+func (c *DiskCache) Spool(key string, size uint64) cacheobj.Spool {
+	if !c.lru.Contains(key) && !c.admit(key, size) {
+		return nil
+	}
+	gen, err := c.newGen()
+	if err != nil {
+		log.Errorln("DiskCache.Spool creating generation for '" + key + "': " + err.Error())
+		return nil
+	}
+	return &spool{c: c, key: key, gen: gen}
+}
+
+// spool is a cacheobj.Spool of a DiskCache, which stores chunks with a generation that isn't yet any object's.
+type spool struct {
+	c         *DiskCache
+	key       string
+	gen       uint64
+	m         sync.Mutex
+	n         int    // the number of chunks written
+	size      uint64 // the number of bytes written
+	committed bool   // whether the spooled body was added to the cache, so its chunks are the object's
+	discarded bool
+}
+
+// Write implements cacheobj.Spool, writing the chunks in one transaction.
+func (s *spool) Write(chunks [][]byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.discarded {
+		return errors.New("spool discarded")
+	}
+	err := s.c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ChunkBucketName))
+		if b == nil {
+			return errors.New("chunk bucket does not exist")
+		}
+		for i, chunk := range chunks {
+			if err := b.Put(chunkKey(s.key, s.gen, s.n+i), chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.n += len(chunks)
+	for _, chunk := range chunks {
+		s.size += uint64(len(chunk))
+	}
+	return nil
+}
+
+// Chunk implements cacheobj.Spool.
+func (s *spool) Chunk(i int) ([]byte, error) {
+	return getChunk(s.c.db, s.key, s.gen, i)
+}
+
+// written returns the generation and number of bytes of the chunks written, or an error if the spool was discarded.
+func (s *spool) written() (uint64, uint64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.discarded {
+		return 0, 0, errors.New("spool discarded")
+	}
+	return s.gen, s.size, nil
 }
 
+// commit marks the spool's chunks as the body of its object, so Discard doesn't delete them.
+func (s *spool) commit() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.committed = true
+}
+
+// Discard implements cacheobj.Spool.
+func (s *spool) Discard() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.committed || s.discarded {
+		return
+	}
+	s.discarded = true
+	s.c.deleteChunks(s.key, s.gen)
+}
+
+// diskBody is a cacheobj.Body stored in a DiskCache, whose chunks are read from disk as they're requested.
+type diskBody struct {
+	db   *bolt.DB
+	key  string
+	gen  uint64
+	size uint64
+}
+
+// closedChan is a closed channel, for the Done of bodies which are always complete.
+var closedChan = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// Chunk implements cacheobj.Body. If the object was evicted or replaced after it was gotten, its chunks no longer exist, and an error is returned.
+func (b *diskBody) Chunk(i int) ([]byte, error) {
+	if uint64(i)*cacheobj.ChunkSize >= b.size {
+		return nil, io.EOF
+	}
+	return getChunk(b.db, b.key, b.gen, i)
+}
+
+// getChunk returns the i'th chunk of the given generation of the key's body.
+func getChunk(db *bolt.DB, key string, gen uint64, i int) ([]byte, error) {
+	chunk := []byte(nil)
+	err := db.View(func(tx *bolt.Tx) error {
+		chunks := tx.Bucket([]byte(ChunkBucketName))
+		if chunks == nil {
+			return errors.New("chunk bucket does not exist")
+		}
+		if v := chunks.Get(chunkKey(key, gen, i)); v != nil {
+			chunk = append([]byte(nil), v...) // bolt values are only valid during the transaction
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if chunk == nil {
+		return nil, fmt.Errorf("chunk %d of '%s' not found, the object was probably evicted or replaced", i, key)
+	}
+	return chunk, nil
+}
+
+// Done implements cacheobj.Body.
+func (b *diskBody) Done() <-chan struct{} { return closedChan }
+
+// Stats returns the counts of requests to the cache, and of objects admitted and rejected.
+func (c *DiskCache) Stats() icache.Stats { return c.stats.Stats() }
+
 func (c *DiskCache) Size() uint64 {
 	return atomic.LoadUint64(&c.sizeBytes)
 }
 
+// Close flushes access metadata to disk, and closes the database.
 func (c *DiskCache) Close() {
+	close(c.closing)
+	<-c.closed
 	c.db.Close()
 }
 
@@ -0,0 +1,237 @@
+package diskcache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/tinylfu"
+)
+
+func TestResetAfterRestartOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-diskcache-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+
+	c, err := New(path, 1024*1024, nil)
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+	c.ResetAfterRestart()
+	<-c.Recovered()
+	for _, key := range []string{"a", "b", "c"} {
+		body := cacheobj.NewMemBodyBytes([]byte("body of " + key))
+		c.Add(key, cacheobj.New(http.Header{}, body, http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now()))
+		time.Sleep(time.Millisecond) // access times must differ
+	}
+	// a is the most recently used, and b the most hit
+	for i := 0; i < 3; i++ {
+		c.Get("b")
+	}
+	time.Sleep(time.Millisecond)
+	c.Get("a")
+	c.Close()
+
+	c, err = New(path, 1024*1024, nil)
+	if err != nil {
+		t.Fatalf("reopening cache: %v", err)
+	}
+	defer c.Close()
+	c.ResetAfterRestart()
+	<-c.Recovered()
+
+	// Keys are least recently used first
+	if keys, expected := c.Keys(), []string{"c", "b", "a"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("LRU after restart expected %v, actual %v", expected, keys)
+	}
+	if keys, expected := c.HottestKeys(), []string{"b", "a", "c"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("HottestKeys after restart expected %v, actual %v", expected, keys)
+	}
+	if obj, ok := c.Peek("b"); !ok || obj.HitCount != 4 {
+		t.Errorf("Peek hit count after restart expected 4, actual %v %v", obj, ok)
+	}
+	if size := c.Size(); size == 0 {
+		t.Errorf("size after restart expected > 0, actual 0")
+	}
+}
+
+// newTestCache returns a new cache in a temp dir, and a func to close and remove it.
+func newTestCache(t *testing.T) (*DiskCache, func()) {
+	return newTestCacheSize(t, 64*1024*1024, nil)
+}
+
+func newTestCacheSize(t *testing.T, bytes uint64, admitter icache.Admitter) (*DiskCache, func()) {
+	dir, err := ioutil.TempDir("", "grove-diskcache-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	c, err := New(filepath.Join(dir, "cache.db"), bytes, admitter)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("creating cache: %v", err)
+	}
+	c.ResetAfterRestart()
+	<-c.Recovered()
+	return c, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestObj(body cacheobj.Body) *cacheobj.CacheObj {
+	return cacheobj.New(http.Header{}, body, http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+}
+
+func TestReplaceWhileReading(t *testing.T) {
+	c, done := newTestCache(t)
+	defer done()
+
+	oldBytes := bytes.Repeat([]byte("o"), 3*cacheobj.ChunkSize)
+	newBytes := bytes.Repeat([]byte("n"), 3*cacheobj.ChunkSize)
+	c.Add("a", newTestObj(cacheobj.NewMemBodyBytes(oldBytes)))
+
+	old, ok := c.Get("a")
+	if !ok {
+		t.Fatalf("Get expected found, actual not found")
+	}
+	if chunk, err := old.Body.Chunk(0); err != nil || !bytes.Equal(chunk, oldBytes[:cacheobj.ChunkSize]) {
+		t.Fatalf("old chunk 0 before replacing expected old body, actual error %v", err)
+	}
+
+	c.Add("a", newTestObj(cacheobj.NewMemBodyBytes(newBytes)))
+
+	// the old body's remaining chunks must never be the new body's
+	for i := 1; i < 3; i++ {
+		chunk, err := old.Body.Chunk(i)
+		if err == nil && !bytes.Equal(chunk, oldBytes[i*cacheobj.ChunkSize:(i+1)*cacheobj.ChunkSize]) {
+			t.Errorf("old chunk %d after replacing expected old body or error, actual other bytes", i)
+		}
+	}
+
+	obj, ok := c.Get("a")
+	if !ok {
+		t.Fatalf("Get after replacing expected found, actual not found")
+	}
+	if body, err := ioutil.ReadAll(cacheobj.NewReader(obj.Body)); err != nil || !bytes.Equal(body, newBytes) {
+		t.Errorf("body after replacing expected new body, actual error %v len %v", err, len(body))
+	}
+	if n := countChunks(t, c); n != 3 {
+		t.Errorf("chunks after replacing expected 3, actual %v", n)
+	}
+}
+
+func TestSpool(t *testing.T) {
+	c, done := newTestCache(t)
+	defer done()
+
+	bts := bytes.Repeat([]byte("s"), (cacheobj.SpoolChunks+1)*cacheobj.ChunkSize+1)
+	spool := c.Spool("a", uint64(len(bts)))
+	if spool == nil {
+		t.Fatalf("Spool expected spool, actual nil")
+	}
+	body := cacheobj.NewSpooledBody(spool)
+	if _, err := body.ReadFrom(bytes.NewReader(bts)); err != nil {
+		t.Fatalf("reading spooled body: %v", err)
+	}
+	if n := countChunks(t, c); n != cacheobj.SpoolChunks+2 {
+		t.Errorf("chunks spooled expected %v, actual %v", cacheobj.SpoolChunks+2, n)
+	}
+	if cacheobj.InMemory(body) {
+		t.Errorf("spooled body InMemory expected false, actual true")
+	}
+
+	c.Add("a", newTestObj(body))
+	body.DiscardSpool() // must not delete the chunks of the added body
+	obj, ok := c.Get("a")
+	if !ok {
+		t.Fatalf("Get expected found, actual not found")
+	}
+	if read, err := ioutil.ReadAll(cacheobj.NewReader(obj.Body)); err != nil || !bytes.Equal(read, bts) {
+		t.Errorf("spooled body expected %v bytes, actual error %v len %v", len(bts), err, len(read))
+	}
+
+	discarded := cacheobj.NewSpooledBody(c.Spool("b", uint64(len(bts))))
+	if _, err := discarded.ReadFrom(bytes.NewReader(bts)); err != nil {
+		t.Fatalf("reading spooled body: %v", err)
+	}
+	discarded.DiscardSpool()
+	if n := countChunks(t, c); n != cacheobj.SpoolChunks+2 {
+		t.Errorf("chunks after discarding expected %v, actual %v", cacheobj.SpoolChunks+2, n)
+	}
+}
+
+func countChunks(t *testing.T, c *DiskCache) int {
+	n := 0
+	if err := c.forEachBatch(ChunkBucketName, func(k []byte, v []byte) { n++ }); err != nil {
+		t.Fatalf("reading chunks: %v", err)
+	}
+	return n
+}
+
+func TestAdmission(t *testing.T) {
+	c, done := newTestCacheSize(t, 4096, tinylfu.New(1024))
+	defer done()
+
+	c.Add("hot", newTestObj(cacheobj.NewMemBodyBytes(bytes.Repeat([]byte("h"), 3000))))
+	for i := 0; i < 3; i++ {
+		if _, ok := c.Get("hot"); !ok {
+			t.Fatalf("Get hot expected found, actual not found")
+		}
+	}
+	sizeBefore, chunksBefore := c.Size(), countChunks(t, c)
+
+	// a new object which doesn't fit, and was requested less than the object it would evict, is rejected, and none of its body is written
+	c.Add("cold", newTestObj(cacheobj.NewMemBodyBytes(bytes.Repeat([]byte("c"), 3000))))
+	if _, ok := c.Peek("cold"); ok {
+		t.Errorf("Peek rejected object expected not found, actual found")
+	}
+	if chunks := countChunks(t, c); chunks != chunksBefore {
+		t.Errorf("chunks after rejecting expected %v, actual %v", chunksBefore, chunks)
+	}
+	if size := c.Size(); size != sizeBefore {
+		t.Errorf("Size after rejecting expected %v, actual %v", sizeBefore, size)
+	}
+	if expected, actual := (icache.Stats{Hits: 3, Admitted: 1, Rejected: 1}), c.Stats(); actual != expected {
+		t.Errorf("Stats after rejecting expected %+v, actual %+v", expected, actual)
+	}
+	// a spool isn't created for a rejected object, so its body isn't written to disk only to be rejected
+	if sp := c.Spool("cold", 3000); sp != nil {
+		t.Errorf("Spool rejected object expected nil, actual %v", sp)
+	}
+
+	// a new object requested more than the object it would evict is admitted
+	for i := 0; i < 5; i++ {
+		c.Get("hotter")
+	}
+	c.Add("hotter", newTestObj(cacheobj.NewMemBodyBytes(bytes.Repeat([]byte("r"), 3000))))
+	if _, ok := c.Peek("hotter"); !ok {
+		t.Errorf("Peek admitted object expected found, actual not found")
+	}
+	if expected, actual := (icache.Stats{Hits: 3, Misses: 5, Admitted: 2, Rejected: 1}), c.Stats(); actual != expected {
+		t.Errorf("Stats after admitting expected %+v, actual %+v", expected, actual)
+	}
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/icache"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 
@@ -28,10 +29,11 @@ import (
 // MultiDiskCache is a disk cache using multiple files. It exists primarily to allow caching across multiple physical disks, but may be used for other purposes. For example, it may be more performant to use multiple files, or it may be advantageous to keep each remap rule in its own file. Keys are evenly distributed across the given files via consistent hashing.
 type MultiDiskCache []*DiskCache
 
-func NewMulti(files []config.CacheFile) (*MultiDiskCache, error) {
+// NewMulti creates a new MultiDiskCache of the given files. If admitter is not nil, it decides whether new objects are added to full files. It's shared by all files, which is safe because each key is only ever in one file.
+func NewMulti(files []config.CacheFile, admitter icache.Admitter) (*MultiDiskCache, error) {
 	caches := make([]*DiskCache, len(files), len(files))
 	for i, file := range files {
-		cache, err := New(file.Path, file.Bytes)
+		cache, err := New(file.Path, file.Bytes, admitter)
 		if err != nil {
 			return nil, errors.New("creating disk cache '" + file.Path + "': " + err.Error())
 		}
@@ -60,12 +62,55 @@ func (c *MultiDiskCache) Get(key string) (*cacheobj.CacheObj, bool) {
 	return (*c)[i].Get(key)
 }
 
+// Spool implements icache.Spooler.
+func (c *MultiDiskCache) Spool(key string, size uint64) cacheobj.Spool {
+	return (*c)[c.keyIdx(key)].Spool(key, size)
+}
+
 func (c *MultiDiskCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 	i := c.keyIdx(key)
 	log.Debugf("MultiDiskCache.Get key '%+v' mapped to %+v\n", key, i)
 	return (*c)[i].Peek(key)
 }
 
+func (c *MultiDiskCache) Remove(key string) bool {
+	i := c.keyIdx(key)
+	log.Debugf("MultiDiskCache.Remove key '%+v' mapped to %+v\n", key, i)
+	return (*c)[i].Remove(key)
+}
+
+func (c *MultiDiskCache) Invalidate(key string) bool {
+	i := c.keyIdx(key)
+	log.Debugf("MultiDiskCache.Invalidate key '%+v' mapped to %+v\n", key, i)
+	return (*c)[i].Invalidate(key)
+}
+
+// HottestKeys returns the keys of the objects in all the files, most hit first, and most recently accessed first among objects with the same hits. It blocks until all files have recovered after a restart.
+func (c *MultiDiskCache) HottestKeys() []string {
+	metas := map[string]accessMeta{}
+	for _, cache := range *c {
+		<-cache.Recovered()
+		cacheMetas, err := cache.accessMetas()
+		if err != nil {
+			log.Errorln("MultiDiskCache.HottestKeys reading access metadata for '" + cache.db.Path() + "': " + err.Error())
+			continue
+		}
+		for key, meta := range cacheMetas {
+			metas[key] = meta
+		}
+	}
+	return hottestKeys(metas)
+}
+
+// Stats returns the sum of the stats of all files.
+func (c *MultiDiskCache) Stats() icache.Stats {
+	sum := icache.Stats{}
+	for _, cache := range *c {
+		sum = sum.Add(cache.Stats())
+	}
+	return sum
+}
+
 func (c *MultiDiskCache) Size() uint64 {
 	sum := uint64(0)
 	for _, cache := range *c {
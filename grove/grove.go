@@ -29,6 +29,7 @@ import (
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -37,6 +38,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-log"
 
 	"github.com/apache/trafficcontrol/grove/cache"
+	"github.com/apache/trafficcontrol/grove/certstore"
 	"github.com/apache/trafficcontrol/grove/config"
 	"github.com/apache/trafficcontrol/grove/diskcache"
 	"github.com/apache/trafficcontrol/grove/icache"
@@ -44,8 +46,10 @@ import (
 	"github.com/apache/trafficcontrol/grove/plugin"
 	"github.com/apache/trafficcontrol/grove/remap"
 	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/sibling"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/tiercache"
+	"github.com/apache/trafficcontrol/grove/tinylfu"
 	"github.com/apache/trafficcontrol/grove/web"
 )
 
@@ -81,7 +85,7 @@ func main() {
 	}
 	log.Init(eventW, errW, warnW, infoW, debugW)
 
-	caches, err := createCaches(cfg.CacheFiles, uint64(cfg.FileMemBytes), uint64(cfg.CacheSizeBytes))
+	caches, err := createCaches(cfg.CacheFiles, uint64(cfg.FileMemBytes), uint64(cfg.CacheSizeBytes), cfg.FileMemWarm)
 	if err != nil {
 		log.Errorln("starting service: creating caches: " + err.Error())
 		os.Exit(1)
@@ -92,6 +96,7 @@ func main() {
 	reqMaxIdleConns := cfg.ReqMaxIdleConns
 	reqIdleConnTimeout := time.Duration(cfg.ReqIdleConnTimeoutMS) * time.Millisecond
 	baseTransport := remap.NewRemappingTransport(reqTimeout, reqKeepAlive, reqMaxIdleConns, reqIdleConnTimeout)
+	siblings := newSiblings(cfg)
 
 	plugins := plugin.Get(cfg.Plugins)
 	remapper, err := remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
@@ -100,17 +105,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	certs, err := loadCerts(remapper.Rules())
+	certs, err := certstore.Load(remapper.Rules(), cfg.CertFile, cfg.KeyFile)
 	if err != nil {
 		log.Errorf("starting service: loading certificates: %v\n", err)
 		os.Exit(1)
 	}
-	defaultCert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
-	if err != nil {
-		log.Errorf("starting service: loading default certificate: %v\n", err)
-		os.Exit(1)
-	}
-	certs = append(certs, defaultCert)
+	certs.LogExpiry(time.Now())
+	certStore := certstore.New(certs)
 
 	httpListener, httpConns, httpConnStateCallback, err := web.InterceptListen("tcp", fmt.Sprintf(":%d", cfg.Port))
 	if err != nil {
@@ -123,8 +124,8 @@ func main() {
 	httpsListener := net.Listener(nil)
 	httpsConnStateCallback := (func(net.Conn, http.ConnState))(nil)
 	tlsConfig := (*tls.Config)(nil)
-	if cfg.CertFile != "" && cfg.KeyFile != "" {
-		if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certs, cfg.DisableHTTP2); err != nil {
+	if len(certs.Infos()) > 0 {
+		if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certStore.GetCertificate, cfg.DisableHTTP2); err != nil {
 			log.Errorf("creating HTTPS listener %v: %v\n", cfg.HTTPSPort, err)
 			return
 		}
@@ -132,6 +133,8 @@ func main() {
 
 	// TODO pass total size for all file groups?
 	stats := stat.New(remapper.Rules(), caches, uint64(cfg.CacheSizeBytes), httpConns, httpsConns, Version)
+	stats.System().SetCertificates(certs.Infos())
+	stats.System().SetSiblings(siblings)
 
 	buildHandler := func(scheme string, port string, conns *web.ConnMap, stats stat.Stats, pluginContext map[string]*interface{}) *cache.HandlerPointer {
 		return cache.NewHandlerPointer(cache.NewHandler(
@@ -148,6 +151,7 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			siblings,
 		))
 	}
 
@@ -160,32 +164,77 @@ func main() {
 	readTimeout := time.Duration(cfg.ServerReadTimeoutMS) * time.Millisecond
 	writeTimeout := time.Duration(cfg.ServerWriteTimeoutMS) * time.Millisecond
 
-	plugins.OnStartup(remapper.PluginCfg(), pluginContext, plugin.StartupData{Config: cfg, Shared: remapper.PluginSharedCfg()})
+	// reloadMutex serializes reloads, which may come from both signals and plugins.
+	reloadMutex := sync.Mutex{}
 
-	// TODO add config to not serve HTTP (only HTTPS). If port is not set?
-	httpServer := startServer(httpHandler, httpListener, httpConnStateCallback, nil, cfg.Port, idleTimeout, readTimeout, writeTimeout, cfg.DisableHTTP2, "http")
+	// reloadConfig is called by the reload closure given to plugins, because it needs the plugins, and so can't exist until after they're started.
+	reloadConfig := (func() (remapdata.RulesDiff, error))(nil)
+	reload := func() (remapdata.RulesDiff, error) { return reloadConfig() }
 
-	if cfg.CertFile != "" && cfg.KeyFile != "" {
-		httpsServer = startServer(httpsHandler, httpsListener, httpsConnStateCallback, tlsConfig, cfg.HTTPSPort, idleTimeout, readTimeout, writeTimeout, cfg.DisableHTTP2, "https")
+	// reloadCerts loads the certificates of the running config and remap rules, and if they're all valid, swaps them in. It must be called with reloadMutex locked.
+	reloadCerts := func() ([]certstore.Info, error) {
+		newCerts, err := certstore.Load(remapper.Rules(), cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certStore.Set(newCerts)
+		stats.System().SetCertificates(newCerts.Infos())
+		newCerts.LogExpiry(time.Now())
+		return newCerts.Infos(), nil
 	}
+	reloadCertificates := func() ([]certstore.Info, error) {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
+		log.Infoln("reloading certificates")
+		return reloadCerts()
+	}
+
+	plugins.OnStartup(remapper.PluginCfg(), pluginContext, plugin.StartupData{Config: cfg, Shared: remapper.PluginSharedCfg(), RemapRules: remapper.Rules(), Reload: reload, ReloadCertificates: reloadCertificates})
 
-	reloadConfig := func() {
+	httpServer := (*http.Server)(nil)
+
+	// reloadConfig loads and validates the config file and remap rules, and if they're valid, swaps them in, and returns the difference between the old and new remap rules. Requests in progress finish with the old rules. If anything is invalid, an error is returned, and the running config and rules are kept.
+	reloadConfig = func() (remapdata.RulesDiff, error) {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
 		log.Infoln("reloading config")
-		err := error(nil)
-		oldCfg := cfg
-		cfg, err = config.LoadConfig(*configFileName)
+		stats.System().AddConfigReloadRequests()
+		stats.System().SetLastReloadRequest(time.Now())
+
+		newCfg, err := config.LoadConfig(*configFileName)
 		if err != nil {
-			log.Errorln("reloading config: failed to load config file, keeping existing config: " + err.Error())
-			cfg = oldCfg
-			return
+			return remapdata.RulesDiff{}, errors.New("loading config file: " + err.Error())
 		}
-		eventW, errW, warnW, infoW, debugW, err := log.GetLogWriters(cfg)
+		eventW, errW, warnW, infoW, debugW, err := log.GetLogWriters(newCfg)
 		if err != nil {
-			log.Errorln("reloading config: failed to get log writers from '" + *configFileName + "', keeping existing log locations: " + err.Error())
-		} else {
-			log.Init(eventW, errW, warnW, infoW, debugW)
+			return remapdata.RulesDiff{}, errors.New("getting log writers from '" + *configFileName + "': " + err.Error())
+		}
+		newPlugins := plugin.Get(newCfg.Plugins)
+		newRemapper, diff, err := remap.ReloadRemapper(remapper, newCfg.RemapRulesFile, newPlugins.LoadFuncs(), caches, baseTransport)
+		if err != nil {
+			return remapdata.RulesDiff{}, errors.New("loading remap rules: " + err.Error())
+		}
+		newCerts, err := certstore.Load(newRemapper.Rules(), newCfg.CertFile, newCfg.KeyFile)
+		if err != nil {
+			remap.CloseReplacedRules(newRemapper.Rules(), remapper.Rules())
+			return remapdata.RulesDiff{}, errors.New("loading certificates: " + err.Error())
+		}
+
+		newHTTPListener, newHTTPConns, newHTTPConnStateCallback := httpListener, httpConns, httpConnStateCallback
+		if newCfg.Port != cfg.Port {
+			if newHTTPListener, newHTTPConns, newHTTPConnStateCallback, err = web.InterceptListen("tcp", fmt.Sprintf(":%d", newCfg.Port)); err != nil {
+				remap.CloseReplacedRules(newRemapper.Rules(), remapper.Rules())
+				return remapdata.RulesDiff{}, fmt.Errorf("creating HTTP listener %v: %v", newCfg.Port, err)
+			}
 		}
 
+		// everything is valid, apply the new config
+
+		oldCfg := cfg
+		cfg = newCfg
+		log.Init(eventW, errW, warnW, infoW, debugW)
+		httpListener, httpConns, httpConnStateCallback = newHTTPListener, newHTTPConns, newHTTPConnStateCallback
+
 		// TODO add cache file reloading
 		// The problem is, the disk db needs file locks, so there's no way to close and create new files without making all requests cache miss in the meantime.
 		// Thus, the file paths must be kept, diffed, only removed paths' dbs closed, only new paths opened, and dbs for existing paths passed into the new caches object.
@@ -193,33 +242,28 @@ func main() {
 			log.Warnln("reloading config: caches changed in new config! Dynamic cache reloading is not supported! Old cache files and sizes will be used, and new cache config will NOT be loaded! Restart service to apply cache changes!")
 		}
 
-		plugins = plugin.Get(cfg.Plugins)
+		plugins = newPlugins
 		oldRemapper := remapper
-		remapper, err = remap.LoadRemapper(cfg.RemapRulesFile, plugins.LoadFuncs(), caches, baseTransport)
-		if err != nil {
-			log.Errorln("reloading config: failed to load remap rules, keeping existing rules: " + err.Error())
-			remapper = oldRemapper
-			return
-		}
-
-		if cfg.Port != oldCfg.Port {
-			if httpListener, httpConns, httpConnStateCallback, err = web.InterceptListen("tcp", fmt.Sprintf(":%d", cfg.Port)); err != nil {
-				log.Errorf("reloading config: creating HTTP listener %v: %v\n", cfg.Port, err)
-				return
-			}
-		}
+		remapper = newRemapper
 
-		if (cfg.CertFile != oldCfg.CertFile || cfg.KeyFile != oldCfg.KeyFile) && cfg.HTTPSPort != oldCfg.HTTPSPort {
-			log.Warnln("config certificate changed, but port did not. Cannot recreate listener on same port without stopping the service. Restart the service to load the new certificate.")
-		}
+		// the listener gets certificates from the store, so new certificates are served to new connections without recreating it.
+		certStore.Set(newCerts)
+		newCerts.LogExpiry(time.Now())
 
-		if cfg.HTTPSPort != oldCfg.HTTPSPort {
-			if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certs, cfg.DisableHTTP2); err != nil {
+		if (httpsListener == nil || cfg.HTTPSPort != oldCfg.HTTPSPort) && len(newCerts.Infos()) > 0 {
+			if httpsListener, httpsConns, httpsConnStateCallback, tlsConfig, err = web.InterceptListenTLS("tcp", fmt.Sprintf(":%d", cfg.HTTPSPort), certStore.GetCertificate, cfg.DisableHTTP2); err != nil {
 				log.Errorf("creating HTTPS listener %v: %v\n", cfg.HTTPSPort, err)
 			}
 		}
 
-		stats = stat.New(remapper.Rules(), caches, uint64(cfg.CacheSizeBytes), httpConns, httpsConns, Version) // TODO copy stats from old stats object?
+		// siblings which didn't change keep their connections and counts.
+		if siblingsChanged(oldCfg, cfg) {
+			siblings = newSiblings(cfg)
+		}
+
+		stats = stat.NewWithSystem(stats.System(), remapper.Rules(), caches, uint64(cfg.CacheSizeBytes), httpConns, httpsConns) // TODO copy remap stats from old stats object?
+		stats.System().SetCertificates(newCerts.Infos())
+		stats.System().SetSiblings(siblings)
 
 		httpCacheHandler := cache.NewHandler(
 			remapper,
@@ -235,6 +279,7 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			siblings,
 		)
 		httpHandler.Set(httpCacheHandler)
 
@@ -252,48 +297,64 @@ func main() {
 			httpConns,
 			httpsConns,
 			cfg.InterfaceName,
+			siblings,
 		)
 		httpsHandler.Set(httpsCacheHandler)
 
-		plugins.OnStartup(remapper.PluginCfg(), pluginContext, plugin.StartupData{Config: cfg, Shared: remapper.PluginSharedCfg()})
+		plugins.OnStartup(remapper.PluginCfg(), pluginContext, plugin.StartupData{Config: cfg, Shared: remapper.PluginSharedCfg(), RemapRules: remapper.Rules(), Reload: reload, ReloadCertificates: reloadCertificates})
 
-		if cfg.Port != oldCfg.Port {
-			ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
-			defer cancel()
-			if err := httpServer.Shutdown(ctx); err != nil {
-				if err == context.DeadlineExceeded {
-					log.Errorf("closing http server: connections didn't close gracefully in %v, forcefully closing.\n", ShutdownTimeout)
-					httpServer.Close()
-				} else {
-					log.Errorf("closing http server: %v\n", err)
-				}
+		// requests in progress with the old rules may still use their health, but they no longer need to be checked.
+		remap.CloseReplacedRules(oldRemapper.Rules(), remapper.Rules())
+		stats.System().AddConfigReload()
+		stats.System().SetLastReload(time.Now())
+		log.Infof("reloaded config: remap rules added %v removed %v changed %v reordered %v\n", diff.Added, diff.Removed, diff.Changed, diff.Reordered)
 
-			}
+		// Servers on a changed port are replaced. The new server is started first, and the old one shut down in the background, because the reload may be a request to the old server, such as to the http_reload plugin, which its Shutdown would wait for.
+		if cfg.Port != oldCfg.Port {
+			go shutdownServer(httpServer, "http")
 			httpServer = startServer(httpHandler, httpListener, httpConnStateCallback, nil, cfg.Port, idleTimeout, readTimeout, writeTimeout, cfg.DisableHTTP2, "http")
 		}
 
-		if (httpsServer == nil || cfg.HTTPSPort != oldCfg.HTTPSPort) && cfg.CertFile != "" && cfg.KeyFile != "" {
+		if (httpsServer == nil || cfg.HTTPSPort != oldCfg.HTTPSPort) && len(newCerts.Infos()) > 0 {
 			if httpsServer != nil {
-				ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
-				defer cancel()
-				if err := httpsServer.Shutdown(ctx); err != nil {
-					if err == context.DeadlineExceeded {
-						log.Errorf("closing https server: connections didn't close gracefully in %v, forcefully closing.\n", ShutdownTimeout)
-						httpServer.Close()
-					} else {
-						log.Errorf("closing https server: %v\n", err)
-					}
-				}
+				go shutdownServer(httpsServer, "https")
 			}
-
 			httpsServer = startServer(httpsHandler, httpsListener, httpsConnStateCallback, tlsConfig, cfg.HTTPSPort, idleTimeout, readTimeout, writeTimeout, cfg.DisableHTTP2, "https")
 		}
+		return diff, nil
+	}
+
+	// the servers are started after reloadConfig is set, so requests to plugins which reload never call it before it exists.
+	// TODO add config to not serve HTTP (only HTTPS). If port is not set?
+	httpServer = startServer(httpHandler, httpListener, httpConnStateCallback, nil, cfg.Port, idleTimeout, readTimeout, writeTimeout, cfg.DisableHTTP2, "http")
+
+	if httpsListener != nil {
+		httpsServer = startServer(httpsHandler, httpsListener, httpsConnStateCallback, tlsConfig, cfg.HTTPSPort, idleTimeout, readTimeout, writeTimeout, cfg.DisableHTTP2, "https")
+	}
+
+	// reloadChangedCerts reloads the certificates if any of their files changed since they were loaded, and returns how long until they should be checked again.
+	reloadChangedCerts := func() time.Duration {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
+		interval := time.Duration(cfg.CertReloadIntervalMS) * time.Millisecond
+		if interval > 0 && certStore.Certs().Changed() {
+			log.Infoln("certificate files changed, reloading certificates")
+			if _, err := reloadCerts(); err != nil {
+				log.Errorln("reloading changed certificates, keeping existing certificates: " + err.Error())
+			}
+		}
+		return interval
 	}
+	go certReloader(reloadChangedCerts)
 
 	if *pprof {
 		profile()
 	}
-	signalReloader(unix.SIGHUP, reloadConfig)
+	signalReloader(unix.SIGHUP, func() {
+		if _, err := reloadConfig(); err != nil {
+			log.Errorln("reloading config, keeping existing config: " + err.Error())
+		}
+	})
 }
 
 func profile() {
@@ -323,6 +384,20 @@ func signalReloader(sig os.Signal, f func()) {
 	}
 }
 
+// shutdownServer gracefully shuts down the given server, waiting up to ShutdownTimeout for its requests to finish before closing it.
+func shutdownServer(server *http.Server, protocol string) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		if err == context.DeadlineExceeded {
+			log.Errorf("closing %s server: connections didn't close gracefully in %v, forcefully closing.\n", protocol, ShutdownTimeout)
+			server.Close()
+		} else {
+			log.Errorf("closing %s server: %v\n", protocol, err)
+		}
+	}
+}
+
 // startServer starts an HTTP or HTTPS server on the given port, and returns it.
 func startServer(handler http.Handler, listener net.Listener, connState func(net.Conn, http.ConnState), tlsConfig *tls.Config, port int, idleTimeout time.Duration, readTimeout time.Duration, writeTimeout time.Duration, h2Disabled bool, protocol string) *http.Server {
 
@@ -358,44 +433,71 @@ func startServer(handler http.Handler, listener net.Listener, connState func(net
 	return server
 }
 
-func loadCerts(rules []remapdata.RemapRule) ([]tls.Certificate, error) {
-	certs := []tls.Certificate{}
-	for _, rule := range rules {
-		if rule.CertificateFile == "" && rule.CertificateKeyFile == "" {
-			continue
-		}
-		if rule.CertificateFile == "" {
-			return nil, errors.New("rule " + rule.Name + " has a certificate but no key, using default certificate\n")
-		}
-		if rule.CertificateKeyFile == "" {
-			return nil, errors.New("rule " + rule.Name + " has a key but no certificate, using default certificate\n")
-		}
+// CertReloadDisabledInterval is how often certReloader calls its func when it returns 0, because checking certificates is disabled, so enabling it in a reloaded config takes effect.
+const CertReloadDisabledInterval = time.Minute
 
-		cert, err := tls.LoadX509KeyPair(rule.CertificateFile, rule.CertificateKeyFile)
-		if err != nil {
-			return nil, errors.New("loading rule " + rule.Name + " certificate: " + err.Error() + "\n")
+// certReloader calls f forever, waiting the duration it returns between calls.
+func certReloader(f func() time.Duration) {
+	for {
+		interval := f()
+		if interval <= 0 {
+			interval = CertReloadDisabledInterval
 		}
-		certs = append(certs, cert)
+		time.Sleep(interval)
 	}
-	return certs, nil
 }
 
-// createCaches creates the caches specified in the config. The nameFiles is the map of names to groups of files, nameMemBytes is the amount of memory to use for each named group, and memCacheBytes is the amount of memory to use for the default memory cache.
-func createCaches(nameFiles map[string][]config.CacheFile, nameMemBytes uint64, memCacheBytes uint64) (map[string]icache.Cache, error) {
+// createCaches creates the caches specified in the config. The nameFiles is the map of names to groups of files and their admission policies, nameMemBytes is the amount of memory to use for each named group, and memCacheBytes is the amount of memory to use for the default memory cache. If warmNameMem, the memory of each named group is warmed with its hottest objects on disk, in the background.
+func createCaches(nameFiles map[string]config.CacheFileGroup, nameMemBytes uint64, memCacheBytes uint64, warmNameMem bool) (map[string]icache.Cache, error) {
 	caches := map[string]icache.Cache{}
-	caches[""] = memcache.New(memCacheBytes) // default empty names to the mem cache
+	caches[""] = memcache.New(memCacheBytes, nil) // default empty names to the mem cache
 
-	for name, files := range nameFiles {
-		multiDiskCache, err := diskcache.NewMulti(files)
+	for name, group := range nameFiles {
+		multiDiskCache, err := diskcache.NewMulti(group.Files, newAdmitter(group))
 		if err != nil {
 			return nil, errors.New("creating cache '" + name + "': " + err.Error())
 		}
-		caches[name] = tiercache.New(memcache.New(nameMemBytes), multiDiskCache)
+		tierCache := tiercache.New(memcache.New(nameMemBytes, newAdmitter(group)), multiDiskCache, group.MemPromoteHits)
+		if warmNameMem {
+			go tierCache.Warm()
+		}
+		caches[name] = tierCache
 	}
 
 	return caches, nil
 }
 
+// newAdmitter returns a new admitter for the group's admission policy, or nil if the group admits all objects. Each cache gets its own admitter, because each sees different requests.
+func newAdmitter(group config.CacheFileGroup) icache.Admitter {
+	if group.Admission != config.AdmissionTinyLFU {
+		return nil
+	}
+	return tinylfu.New(group.AdmissionCounters)
+}
+
+// newSiblings creates the siblings of the config, or nil if it has none.
+func newSiblings(cfg config.Config) *sibling.Siblings {
+	return sibling.New(
+		cfg.Siblings,
+		cfg.Port,
+		cfg.HTTPSPort,
+		time.Duration(cfg.SiblingTimeoutMS)*time.Millisecond,
+		time.Duration(cfg.ReqKeepAliveMS)*time.Millisecond,
+		cfg.ReqMaxIdleConns,
+		time.Duration(cfg.ReqIdleConnTimeoutMS)*time.Millisecond,
+	)
+}
+
+func siblingsChanged(oldCfg, newCfg config.Config) bool {
+	return !reflect.DeepEqual(oldCfg.Siblings, newCfg.Siblings) ||
+		oldCfg.SiblingTimeoutMS != newCfg.SiblingTimeoutMS ||
+		oldCfg.Port != newCfg.Port ||
+		oldCfg.HTTPSPort != newCfg.HTTPSPort ||
+		oldCfg.ReqKeepAliveMS != newCfg.ReqKeepAliveMS ||
+		oldCfg.ReqMaxIdleConns != newCfg.ReqMaxIdleConns ||
+		oldCfg.ReqIdleConnTimeoutMS != newCfg.ReqIdleConnTimeoutMS
+}
+
 func cachesChanged(oldCfg, newCfg config.Config) bool {
 	return oldCfg.FileMemBytes == newCfg.FileMemBytes &&
 		oldCfg.CacheSizeBytes != newCfg.CacheSizeBytes &&
@@ -265,7 +265,7 @@ func main() {
 	// end of API 1.2 stuff
 
 	if hostProfile.Type == GroveProfileType {
-		updateRequired, cfg, err := createGroveCfg(toc, hostServer)
+		updateRequired, cfg, err := createGroveCfg(toc, hostServer, servers)
 		if err != nil {
 			fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting config rules for '" + GroveConfigPath + "' :" + err.Error())
 			os.Exit(ExitError)
@@ -349,10 +349,11 @@ func main() {
 	os.Exit(ExitSuccess)
 }
 
-func createGroveCfg(toc *to.Session, server tc.Server) (bool, config.Config, error) {
+func createGroveCfg(toc *to.Session, server tc.Server, servers map[string]tc.Server) (bool, config.Config, error) {
 	var newCfg config.Config
 	var currCfg config.Config
 	var pluginParams = []string{}
+	var siblingLookup = false
 
 	// load the servers current config parameters.
 	if _, err := os.Stat(GroveConfigPath); err == nil {
@@ -376,6 +377,11 @@ func createGroveCfg(toc *to.Session, server tc.Server) (bool, config.Config, err
 			if p.ConfigFile == GroveConfigFile {
 				if p.Name == "plugins" {
 					pluginParams = append(pluginParams, p.Value)
+				} else if p.Name == SiblingLookupParameter {
+					if siblingLookup, err = strconv.ParseBool(p.Value); err != nil {
+						fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error setting config parameter '" + p.Name + "' :" + err.Error())
+						return false, currCfg, err
+					}
 				} else {
 					err := setConfigParameter(&newCfg, p.Name, p.Value)
 					if err != nil {
@@ -387,6 +393,9 @@ func createGroveCfg(toc *to.Session, server tc.Server) (bool, config.Config, err
 		}
 		sort.Strings(pluginParams)
 		newCfg.Plugins = pluginParams
+		if siblingLookup {
+			newCfg.Siblings = getSiblings(server, servers)
+		}
 	}
 	// no update is required if the configs are the same
 	areEqual := reflect.DeepEqual(newCfg, currCfg)
@@ -399,6 +408,26 @@ func createGroveCfg(toc *to.Session, server tc.Server) (bool, config.Config, err
 	}
 }
 
+// SiblingLookupParameter is the Grove profile parameter which, if true, sets the config siblings to the other available Grove servers in the server's cache group.
+const SiblingLookupParameter = "sibling_lookup"
+
+// getSiblings returns the sorted IP addresses of the available servers with the same cache group, CDN, and profile as the given server, excluding it. Servers with the same profile serve on the same ports.
+func getSiblings(server tc.Server, servers map[string]tc.Server) []string {
+	statuses := AvailableStatuses()
+	siblings := []string{}
+	for _, sibling := range servers {
+		if _, ok := statuses[strings.ToLower(sibling.Status)]; !ok {
+			continue
+		}
+		if sibling.HostName == server.HostName || sibling.Cachegroup != server.Cachegroup || sibling.CDNName != server.CDNName || sibling.Profile != server.Profile || sibling.IPAddress == "" {
+			continue
+		}
+		siblings = append(siblings, sibling.IPAddress)
+	}
+	sort.Strings(siblings)
+	return siblings
+}
+
 func setConfigParameter(cfg *config.Config, name string, value string) error {
 	var err error
 
@@ -449,6 +478,8 @@ func setConfigParameter(cfg *config.Config, name string, value string) error {
 		cfg.ServerReadTimeoutMS, err = strconv.Atoi(value)
 	case "file_mem_bytes":
 		cfg.FileMemBytes, err = strconv.Atoi(value)
+	case "sibling_timeout_ms":
+		cfg.SiblingTimeoutMS, err = strconv.Atoi(value)
 	default:
 		err = fmt.Errorf(time.Now().Format(time.RFC3339Nano) + "No such config parameter '" + name + "', parameter ignored")
 	}
@@ -522,7 +553,110 @@ func createRulesOldAPI(toc *to.Session, host string, certDir string, servers map
 	}
 	dsCerts := makeDSCertMap(cdnSSLKeys)
 
-	return createRulesOld(host, deliveryservices, parents, deliveryserviceRegexes, cdns, serverParameters, dsCerts, certDir)
+	dsURLSigKeys, dsURISigningKeys, err := getDSSigningKeys(toc, deliveryservices)
+	if err != nil {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Deliveryservice signing keys: " + err.Error())
+		os.Exit(1)
+	}
+
+	dsCacheKeys, err := getDSCacheKeys(toc, deliveryservices)
+	if err != nil {
+		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Error getting Traffic Ops Deliveryservice cache key parameters: " + err.Error())
+		os.Exit(1)
+	}
+
+	return createRulesOld(host, deliveryservices, parents, deliveryserviceRegexes, cdns, serverParameters, dsCerts, dsURLSigKeys, dsURISigningKeys, dsCacheKeys, certDir)
+}
+
+// CacheKeyParameterConfigFile is the config file of delivery service profile parameters for the ATS cachekey plugin, which are translated to the Grove cache_key plugin.
+const CacheKeyParameterConfigFile = "cachekey.config"
+
+// getDSCacheKeys returns the cache_key plugin configs of the delivery services whose profiles have ATS cachekey parameters, by XMLID.
+func getDSCacheKeys(toc *to.Session, dses []tc.DeliveryServiceNullable) (map[string]map[string]interface{}, error) {
+	profileParams := map[string][]tc.Parameter{}
+	cacheKeys := map[string]map[string]interface{}{}
+	for _, ds := range dses {
+		if ds.XMLID == nil || ds.ProfileName == nil || *ds.ProfileName == "" {
+			continue
+		}
+		params, ok := profileParams[*ds.ProfileName]
+		if !ok {
+			allParams, _, err := toc.GetParametersByProfileName(*ds.ProfileName)
+			if err != nil {
+				return nil, errors.New("getting deliveryservice '" + *ds.XMLID + "' profile '" + *ds.ProfileName + "' parameters: " + err.Error())
+			}
+			for _, param := range allParams {
+				if param.ConfigFile == CacheKeyParameterConfigFile {
+					params = append(params, param)
+				}
+			}
+			profileParams[*ds.ProfileName] = params
+		}
+		if len(params) == 0 {
+			continue
+		}
+		cacheKeys[*ds.XMLID] = makeCacheKey(*ds.XMLID, params)
+	}
+	return cacheKeys, nil
+}
+
+// makeCacheKey returns the cache_key plugin config of the given ATS cachekey parameters. Parameters with no Grove equivalent are skipped, with a warning.
+func makeCacheKey(xmlID string, params []tc.Parameter) map[string]interface{} {
+	list := func(val string) []string {
+		strs := []string{}
+		for _, str := range strings.Split(val, ",") {
+			if str = strings.TrimSpace(str); str != "" {
+				strs = append(strs, str)
+			}
+		}
+		return strs
+	}
+	cacheKey := map[string]interface{}{}
+	for _, param := range params {
+		switch param.Name {
+		case "sort-params":
+			cacheKey["sort_params"] = param.Value == "true"
+		case "remove-all-params":
+			cacheKey["remove_all_params"] = param.Value == "true"
+		case "include-params":
+			cacheKey["include_params"] = list(param.Value)
+		case "exclude-params":
+			cacheKey["exclude_params"] = list(param.Value)
+		case "include-headers":
+			cacheKey["include_headers"] = list(param.Value)
+		case "include-cookies":
+			cacheKey["include_cookies"] = list(param.Value)
+		default:
+			fmt.Fprint(os.Stderr, time.Now().Format(time.RFC3339Nano)+" Warning: deliveryservice '"+xmlID+"' cachekey parameter '"+param.Name+"' not supported by Grove, skipping\n")
+		}
+	}
+	return cacheKey
+}
+
+// getDSSigningKeys returns the url_sig keys and uri_signing keys of the delivery services with those signing algorithms, by XMLID.
+func getDSSigningKeys(toc *to.Session, dses []tc.DeliveryServiceNullable) (map[string]tc.URLSigKeys, map[string]json.RawMessage, error) {
+	urlSigKeys := map[string]tc.URLSigKeys{}
+	uriSigningKeys := map[string]json.RawMessage{}
+	for _, ds := range dses {
+		if ds.XMLID == nil || ds.SigningAlgorithm == nil {
+			continue
+		}
+		switch *ds.SigningAlgorithm {
+		case tc.SigningAlgorithmURLSig:
+			keys, _, err := toc.GetDeliveryServiceURLSigKeys(*ds.XMLID)
+			if err != nil {
+				return nil, nil, errors.New("getting deliveryservice '" + *ds.XMLID + "' url_sig keys: " + err.Error())
+			}
+			urlSigKeys[*ds.XMLID] = keys
+		case tc.SigningAlgorithmURISigning:
+			keys, _, err := toc.GetDeliveryServiceURISigningKeys(*ds.XMLID)
+			if err != nil {
+				return nil, nil, errors.New("getting deliveryservice '" + *ds.XMLID + "' uri_signing keys: " + err.Error())
+			}
+			uriSigningKeys[*ds.XMLID] = json.RawMessage(keys)
+		}
+	}
+	return urlSigKeys, uriSigningKeys, nil
 }
 
 // func createRulesNewAPI(toc *to.Session, host string, certDir string) (remap.RemapRules, error) {
@@ -862,6 +996,9 @@ func createRulesOld(
 	cdns map[string]tc.CDN,
 	hostParams []tc.Parameter,
 	dsCerts map[string]tc.CDNSSLKeys,
+	dsURLSigKeys map[string]tc.URLSigKeys,
+	dsURISigningKeys map[string]json.RawMessage,
+	dsCacheKeys map[string]map[string]interface{},
 	certDir string,
 ) (remap.RemapRules, error) {
 	rules := []remapdata.RemapRule{}
@@ -1026,6 +1163,20 @@ func createRulesOld(
 						rule.PluginsShared[web.RemapTextKey] = remapTextJSON
 					}
 				}
+				if rule.Plugins == nil {
+					rule.Plugins = map[string]interface{}{}
+				}
+				// the url_sig and uri_signing plugins must be enabled in the Grove config "plugins" parameters, or the rules fail to load, rather than serving unsigned requests.
+				if keys, ok := dsURLSigKeys[*ds.XMLID]; ok {
+					rule.Plugins["url_sig"] = keys
+				}
+				if keys, ok := dsURISigningKeys[*ds.XMLID]; ok {
+					rule.Plugins["uri_signing"] = keys
+				}
+				// the cache_key plugin must also be enabled in the Grove config, for the cache keys to be normalized.
+				if cacheKey, ok := dsCacheKeys[*ds.XMLID]; ok {
+					rule.Plugins["cache_key"] = cacheKey
+				}
 				rules = append(rules, rule)
 			}
 		}
@@ -0,0 +1,264 @@
+package health
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+const DefaultIntervalMS = 10000
+const DefaultTimeoutMS = 2000
+const DefaultUnhealthyThreshold = 3
+const DefaultHealthyThreshold = 2
+const DefaultMarkdownMS = 30000
+
+// Config is the health checking configuration of a remap rule's parents.
+type Config struct {
+	// Path is the path requested from each parent by active health checks. If empty, parents aren't actively checked.
+	Path string `json:"path"`
+	// IntervalMS is the time between active health checks of each parent.
+	IntervalMS int `json:"interval_ms"`
+	// TimeoutMS is the time an active health check waits for a parent to respond, before it's failed.
+	TimeoutMS int `json:"timeout_ms"`
+	// UnhealthyThreshold is the number of consecutive failed active health checks after which a parent is marked down.
+	UnhealthyThreshold int `json:"unhealthy_threshold"`
+	// HealthyThreshold is the number of consecutive successful active health checks after which a marked down parent is marked up.
+	HealthyThreshold int `json:"healthy_threshold"`
+	// MarkdownFailures is the number of consecutive failed client requests to a parent after which it's marked down. If 0, parents aren't marked down by failed client requests.
+	MarkdownFailures int `json:"markdown_failures"`
+	// MarkdownMS is how long a parent marked down by failed client requests is skipped, if parents aren't actively checked, before client requests are sent to it again.
+	MarkdownMS int `json:"markdown_ms"`
+}
+
+// Validate returns an error if the config is invalid, and sets defaults for unset values.
+func (c *Config) Validate() error {
+	if c.IntervalMS < 0 || c.TimeoutMS < 0 || c.UnhealthyThreshold < 0 || c.HealthyThreshold < 0 || c.MarkdownFailures < 0 || c.MarkdownMS < 0 {
+		return errors.New("values must not be negative")
+	}
+	if c.IntervalMS == 0 {
+		c.IntervalMS = DefaultIntervalMS
+	}
+	if c.TimeoutMS == 0 {
+		c.TimeoutMS = DefaultTimeoutMS
+	}
+	if c.UnhealthyThreshold == 0 {
+		c.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+	if c.HealthyThreshold == 0 {
+		c.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if c.MarkdownMS == 0 {
+		c.MarkdownMS = DefaultMarkdownMS
+	}
+	return nil
+}
+
+// Parent is a parent to check, and the transport to check it with.
+type Parent struct {
+	URL       string
+	Transport *http.Transport
+}
+
+// Status is the health of a parent.
+type Status struct {
+	Available bool
+	// Failures is the number of consecutive failed client requests.
+	Failures int
+	// CheckFailures is the number of consecutive failed active health checks.
+	CheckFailures int
+	// DownSince is when the parent was marked down, if it isn't Available.
+	DownSince time.Time
+	// LastCheck is when the parent was last actively checked, or zero if it never has been.
+	LastCheck time.Time
+}
+
+// Checker tracks the health of a remap rule's parents. Parents are marked down after consecutive failed client requests or active health checks, and marked up after successful client requests or consecutive successful active health checks.
+//
+// A nil *Checker considers all parents available.
+type Checker struct {
+	rule    string
+	cfg     Config
+	parents map[string]*parent // constant: MUST NOT be modified after creation. The parents themselves are mutexed.
+	done    chan struct{}
+	once    sync.Once
+}
+
+type parent struct {
+	Parent
+	status         Status
+	checkSuccesses int
+	m              sync.Mutex
+}
+
+// New creates a new Checker of the given rule's parents. If the config has a Path, the parents are actively checked in the background, until Close is called.
+func New(rule string, cfg Config, parents []Parent) *Checker {
+	c := &Checker{rule: rule, cfg: cfg, parents: map[string]*parent{}, done: make(chan struct{})}
+	for _, p := range parents {
+		c.parents[p.URL] = &parent{Parent: p, status: Status{Available: true}}
+	}
+	if cfg.Path != "" {
+		for _, p := range c.parents {
+			go c.checkManager(p)
+		}
+	}
+	return c
+}
+
+// Up returns whether the parent with the given URL should be sent requests. Parents which aren't checked are always up.
+func (c *Checker) Up(parentURL string) bool {
+	if c == nil {
+		return true
+	}
+	p, ok := c.parents[parentURL]
+	if !ok {
+		return true
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.status.Available {
+		return true
+	}
+	// without active checks, a parent marked down by client requests is tried again after the markdown time, and marked down again if it fails.
+	return c.cfg.Path == "" && time.Since(p.status.DownSince) >= time.Duration(c.cfg.MarkdownMS)*time.Millisecond
+}
+
+// ReportResult records the result of a client request to the parent with the given URL.
+func (c *Checker) ReportResult(parentURL string, failed bool) {
+	if c == nil {
+		return
+	}
+	p, ok := c.parents[parentURL]
+	if !ok {
+		return
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if !failed {
+		p.status.Failures = 0
+		c.markUp(p, "client request succeeded")
+		return
+	}
+	p.status.Failures++
+	if c.cfg.MarkdownFailures > 0 && p.status.Failures >= c.cfg.MarkdownFailures {
+		c.markDown(p, strconv.Itoa(p.status.Failures)+" consecutive client requests failed")
+	}
+}
+
+// Statuses returns the health of each parent, by URL.
+func (c *Checker) Statuses() map[string]Status {
+	statuses := map[string]Status{}
+	if c == nil {
+		return statuses
+	}
+	for url, p := range c.parents {
+		p.m.Lock()
+		statuses[url] = p.status
+		p.m.Unlock()
+	}
+	return statuses
+}
+
+// Close stops active health checks. It's safe to call multiple times.
+func (c *Checker) Close() {
+	if c == nil {
+		return
+	}
+	c.once.Do(func() { close(c.done) })
+}
+
+// markDown marks the parent down, if it isn't already. It must be called with the parent locked. If the parent is already down, but was tried again after the markdown time, the markdown time is restarted.
+func (c *Checker) markDown(p *parent, reason string) {
+	if p.status.Available {
+		log.Warnf("health: rule '%v' parent '%v' marked down: %v\n", c.rule, p.URL, reason)
+	}
+	p.status.Available = false
+	p.status.DownSince = time.Now()
+	p.checkSuccesses = 0
+}
+
+// markUp marks the parent up, if it isn't already. It must be called with the parent locked.
+func (c *Checker) markUp(p *parent, reason string) {
+	if p.status.Available {
+		return
+	}
+	log.Warnf("health: rule '%v' parent '%v' marked up: %v\n", c.rule, p.URL, reason)
+	p.status.Available = true
+	p.status.DownSince = time.Time{}
+}
+
+// checkManager actively checks the parent every interval, until the Checker is closed. It should be run in a goroutine.
+func (c *Checker) checkManager(p *parent) {
+	client := &http.Client{
+		Transport: p.Transport,
+		Timeout:   time.Duration(c.cfg.TimeoutMS) * time.Millisecond,
+		// redirects are responses from the parent, and so are healthy; they shouldn't be followed to other servers.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	ticker := time.NewTicker(time.Duration(c.cfg.IntervalMS) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		c.check(client, p)
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check actively checks the parent once, and marks it up or down if it's reached the threshold.
+func (c *Checker) check(client *http.Client, p *parent) {
+	err := checkParent(client, p.URL+c.cfg.Path)
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.status.LastCheck = time.Now()
+	if err != nil {
+		log.Debugf("health: rule '%v' parent '%v' check failed: %v\n", c.rule, p.URL, err)
+		p.checkSuccesses = 0
+		p.status.CheckFailures++
+		if p.status.CheckFailures >= c.cfg.UnhealthyThreshold {
+			c.markDown(p, strconv.Itoa(p.status.CheckFailures)+" consecutive health checks failed, last: "+err.Error())
+		}
+		return
+	}
+	p.status.CheckFailures = 0
+	p.checkSuccesses++
+	if p.checkSuccesses >= c.cfg.HealthyThreshold {
+		c.markUp(p, strconv.Itoa(p.checkSuccesses)+" consecutive health checks succeeded")
+	}
+}
+
+// checkParent requests the given URL, and returns an error if the request fails or the response code isn't 2xx or 3xx.
+func checkParent(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body) // read the body, so the connection can be reused
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return errors.New("response code " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
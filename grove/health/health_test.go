@@ -0,0 +1,88 @@
+package health
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPassiveMarkdown(t *testing.T) {
+	cfg := Config{MarkdownFailures: 2, MarkdownMS: 50}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	c := New("rule", cfg, []Parent{{URL: "http://parent"}})
+	defer c.Close()
+
+	c.ReportResult("http://parent", true)
+	if !c.Up("http://parent") {
+		t.Errorf("expected parent up after 1 failure")
+	}
+	c.ReportResult("http://parent", true)
+	if c.Up("http://parent") {
+		t.Errorf("expected parent down after 2 consecutive failures")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !c.Up("http://parent") {
+		t.Errorf("expected marked down parent to be tried again after the markdown time")
+	}
+	c.ReportResult("http://parent", false)
+	if status := c.Statuses()["http://parent"]; !status.Available || status.Failures != 0 {
+		t.Errorf("expected parent available with 0 failures after success, actual %+v", status)
+	}
+
+	if !(*Checker)(nil).Up("http://parent") {
+		t.Errorf("expected nil checker to consider all parents up")
+	}
+}
+
+func TestActiveCheck(t *testing.T) {
+	healthy := int32(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{Path: "/health", IntervalMS: 10, UnhealthyThreshold: 2, HealthyThreshold: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	c := New("rule", cfg, []Parent{{URL: srv.URL, Transport: &http.Transport{}}})
+	defer c.Close()
+
+	waitFor := func(up bool) {
+		for i := 0; i < 100 && c.Up(srv.URL) != up; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if c.Up(srv.URL) != up {
+			t.Fatalf("expected parent up %v, actual %v", up, !up)
+		}
+	}
+
+	atomic.StoreInt32(&healthy, 0)
+	waitFor(false)
+	atomic.StoreInt32(&healthy, 1)
+	waitFor(true)
+	if status := c.Statuses()[srv.URL]; status.LastCheck.IsZero() || status.CheckFailures != 0 {
+		t.Errorf("expected checked parent with 0 check failures, actual %+v", status)
+	}
+}
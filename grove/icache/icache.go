@@ -15,17 +15,106 @@ package icache
 */
 
 import (
+	"sync/atomic"
+
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 )
 
 // TODO change to return errors
 
 type Cache interface {
+	// Add adds the given object, whose body MUST be complete.
 	Add(key string, val *cacheobj.CacheObj) bool
 	Capacity() uint64
 	Get(key string) (*cacheobj.CacheObj, bool)
 	Peek(key string) (*cacheobj.CacheObj, bool)
+	// Remove removes the object with the given key. Returns whether it existed.
+	Remove(key string) bool
+	// Invalidate marks the object with the given key Invalidated, so it must be revalidated before it's served again. Returns whether it existed.
+	Invalidate(key string) bool
 	Keys() []string
 	Size() uint64
 	Close()
 }
+
+// Spooler is a Cache which can store the body of an object as it's fetched, rather than once it's complete, so the whole body needn't be in memory.
+type Spooler interface {
+	// Spool returns a spool for the body of the object which will be added with the given key, whose size is expected to be the given size, or 0 if it's unknown. If the body is written to the spool with cacheobj.NewSpooledBody, Add stores the object without copying the body again. Spool returns nil if the body shouldn't be spooled, e.g. if the object won't be admitted.
+	Spool(key string, size uint64) cacheobj.Spool
+}
+
+// Hotter is a Cache which can list its objects by how frequently they're requested, e.g. to warm a faster cache in front of it.
+type Hotter interface {
+	// HottestKeys returns the keys of the cache's objects, most frequently requested first.
+	HottestKeys() []string
+}
+
+// Admitter decides whether new objects are added to a full cache. Caches with an Admitter call Access on every Get, whether the object is found or not, and only add a new object which would make the cache exceed its capacity if Admit returns true.
+type Admitter interface {
+	// Access records a request for the given key.
+	Access(key string)
+	// Admit returns whether the candidate key should be added to the cache, when it would evict the victim key, the least recently used.
+	Admit(candidate, victim string) bool
+}
+
+// Stats are counts of requests to a cache, and of the objects it admitted and rejected.
+type Stats struct {
+	Hits     uint64
+	Misses   uint64
+	Admitted uint64
+	Rejected uint64
+}
+
+// HitRatio returns the ratio of requests which were hits, or 0 if there were no requests.
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Add returns the sum of the stats.
+func (s Stats) Add(o Stats) Stats {
+	return Stats{Hits: s.Hits + o.Hits, Misses: s.Misses + o.Misses, Admitted: s.Admitted + o.Admitted, Rejected: s.Rejected + o.Rejected}
+}
+
+// Statser is a Cache which counts its requests and admissions.
+type Statser interface {
+	Stats() Stats
+}
+
+// StatsCounter is a threadsafe counter of Stats, for caches to embed.
+type StatsCounter struct {
+	hits     uint64 // atomic: MUST NOT access without sync.atomic
+	misses   uint64 // atomic: MUST NOT access without sync.atomic
+	admitted uint64 // atomic: MUST NOT access without sync.atomic
+	rejected uint64 // atomic: MUST NOT access without sync.atomic
+}
+
+// CountGet counts a request which was a hit if found, else a miss.
+func (c *StatsCounter) CountGet(found bool) {
+	if found {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+// CountAdmit counts an object which was admitted if admitted, else rejected.
+func (c *StatsCounter) CountAdmit(admitted bool) {
+	if admitted {
+		atomic.AddUint64(&c.admitted, 1)
+	} else {
+		atomic.AddUint64(&c.rejected, 1)
+	}
+}
+
+// Stats returns the current counts.
+func (c *StatsCounter) Stats() Stats {
+	return Stats{
+		Hits:     atomic.LoadUint64(&c.hits),
+		Misses:   atomic.LoadUint64(&c.misses),
+		Admitted: atomic.LoadUint64(&c.admitted),
+		Rejected: atomic.LoadUint64(&c.rejected),
+	}
+}
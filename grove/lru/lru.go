@@ -48,6 +48,17 @@ func (c *LRU) Add(key string, size uint64) uint64 {
 	return 0
 }
 
+// PushBack adds the key to the back of the LRU, as the least recently used, with the given size, if it doesn't exist. Returns whether it was added.
+func (c *LRU) PushBack(key string, size uint64) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if _, ok := c.lElems[key]; ok {
+		return false
+	}
+	c.lElems[key] = c.l.PushBack(&listObj{key, size})
+	return true
+}
+
 // RemoveOldest returns the key, size, and true if the LRU is nonempty; else false.
 func (c *LRU) RemoveOldest() (string, uint64, bool) {
 	c.m.Lock()
@@ -63,6 +74,38 @@ func (c *LRU) RemoveOldest() (string, uint64, bool) {
 	return obj.key, obj.size, true
 }
 
+// Oldest returns the least recently used key, and true if the LRU is nonempty; else false.
+func (c *LRU) Oldest() (string, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	elem := c.l.Back()
+	if elem == nil {
+		return "", false
+	}
+	return elem.Value.(*listObj).key, true
+}
+
+// Contains returns whether the key is in the LRU, without changing its recent-used-ness.
+func (c *LRU) Contains(key string) bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	_, ok := c.lElems[key]
+	return ok
+}
+
+// Remove removes the key from the LRU. Returns its size and true if it existed; else false.
+func (c *LRU) Remove(key string) (uint64, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	elem, ok := c.lElems[key]
+	if !ok {
+		return 0, false
+	}
+	c.l.Remove(elem)
+	delete(c.lElems, key)
+	return elem.Value.(*listObj).size, true
+}
+
 // Keys returns a string array of the keys
 func (c *LRU) Keys() []string {
 	c.m.RLock()
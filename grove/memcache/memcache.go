@@ -19,6 +19,7 @@ import (
 	"sync/atomic"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/lru"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -32,9 +33,12 @@ type MemCache struct {
 	sizeBytes    uint64                        // atomic: MUST NOT access without sync.atomic
 	maxSizeBytes uint64                        // constant: MUST NOT be modified after creation
 	gcChan       chan<- uint64
+	admitter     icache.Admitter // may be nil, to admit all objects
+	stats        icache.StatsCounter
 }
 
-func New(bytes uint64) *MemCache {
+// New creates a new MemCache with the given capacity in bytes. If admitter is not nil, it decides whether new objects are added when the cache is full.
+func New(bytes uint64, admitter icache.Admitter) *MemCache {
 	log.Errorf("MemCache.New: creating cache with %d capacity.", bytes)
 	gcChan := make(chan uint64, 1)
 	c := &MemCache{
@@ -42,12 +46,16 @@ func New(bytes uint64) *MemCache {
 		cache:        map[string]*cacheobj.CacheObj{},
 		maxSizeBytes: bytes,
 		gcChan:       gcChan,
+		admitter:     admitter,
 	}
 	go c.gcManager(gcChan)
 	return c
 }
 
 func (c *MemCache) Get(key string) (*cacheobj.CacheObj, bool) {
+	if c.admitter != nil {
+		c.admitter.Access(key)
+	}
 	c.cacheM.RLock()
 	obj, ok := c.cache[key]
 	if ok {
@@ -55,6 +63,7 @@ func (c *MemCache) Get(key string) (*cacheobj.CacheObj, bool) {
 		atomic.AddUint64(&obj.HitCount, 1)
 	}
 	c.cacheM.RUnlock()
+	c.stats.CountGet(ok)
 	return obj, ok
 }
 
@@ -67,8 +76,18 @@ func (c *MemCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 
 func (c *MemCache) Add(key string, val *cacheobj.CacheObj) bool {
 	c.cacheM.Lock()
+	_, exists := c.cache[key]
+	if !exists && !c.admit(key, val.Size) {
+		c.cacheM.Unlock()
+		c.stats.CountAdmit(false)
+		log.Debugf("MemCache.Add rejected key '%+v' size '%+v'\n", key, val.Size)
+		return false
+	}
 	c.cache[key] = val
 	c.cacheM.Unlock()
+	if !exists {
+		c.stats.CountAdmit(true)
+	}
 	oldSize := c.lru.Add(key, val.Size)
 	sizeChange := val.Size - oldSize
 	if sizeChange == 0 {
@@ -82,6 +101,43 @@ func (c *MemCache) Add(key string, val *cacheobj.CacheObj) bool {
 	return false // TODO remove eviction from interface; it's unnecessary and expensive
 }
 
+func (c *MemCache) Remove(key string) bool {
+	c.cacheM.Lock()
+	_, ok := c.cache[key]
+	delete(c.cache, key)
+	c.cacheM.Unlock()
+	if sizeBytes, inLRU := c.lru.Remove(key); inLRU {
+		atomic.AddUint64(&c.sizeBytes, ^uint64(sizeBytes-1)) // subtract sizeBytes
+	}
+	return ok
+}
+
+func (c *MemCache) Invalidate(key string) bool {
+	c.cacheM.Lock()
+	defer c.cacheM.Unlock()
+	obj, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	// must copy, because the object may be concurrently read by other goroutines
+	invalidated := *obj
+	invalidated.Invalidated = true
+	c.cache[key] = &invalidated
+	return true
+}
+
+// admit returns whether a new object of the given size should be added. Objects are always admitted if there's room, or if there's no admitter.
+func (c *MemCache) admit(key string, size uint64) bool {
+	if c.admitter == nil || atomic.LoadUint64(&c.sizeBytes)+size <= c.maxSizeBytes {
+		return true
+	}
+	victim, ok := c.lru.Oldest()
+	return !ok || c.admitter.Admit(key, victim)
+}
+
+// Stats returns the counts of requests to the cache, and of objects admitted and rejected.
+func (c *MemCache) Stats() icache.Stats { return c.stats.Stats() }
+
 func (c *MemCache) Size() uint64 { return atomic.LoadUint64(&c.sizeBytes) }
 func (c *MemCache) Close()       {}
 
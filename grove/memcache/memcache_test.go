@@ -0,0 +1,81 @@
+package memcache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/tinylfu"
+)
+
+func newTestObj(size int) *cacheobj.CacheObj {
+	body := cacheobj.NewMemBodyBytes(bytes.Repeat([]byte("a"), size))
+	return cacheobj.New(http.Header{}, body, http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+}
+
+func TestAdmission(t *testing.T) {
+	c := New(100, tinylfu.New(1024))
+
+	c.Add("hot", newTestObj(60))
+	for i := 0; i < 3; i++ {
+		if _, ok := c.Get("hot"); !ok {
+			t.Fatalf("Get hot expected found, actual not found")
+		}
+	}
+
+	// a new object which doesn't fit, and was requested less than the object it would evict, is rejected
+	c.Add("cold", newTestObj(60))
+	if _, ok := c.Peek("cold"); ok {
+		t.Errorf("Peek rejected object expected not found, actual found")
+	}
+	if _, ok := c.Peek("hot"); !ok {
+		t.Errorf("Peek victim of rejected object expected found, actual not found")
+	}
+	if size := c.Size(); size != 60 {
+		t.Errorf("Size after rejecting expected %v, actual %v", 60, size)
+	}
+	if expected, actual := (icache.Stats{Hits: 3, Admitted: 1, Rejected: 1}), c.Stats(); actual != expected {
+		t.Errorf("Stats after rejecting expected %+v, actual %+v", expected, actual)
+	}
+
+	// a new object requested more than the object it would evict is admitted
+	for i := 0; i < 5; i++ {
+		c.Get("hotter")
+	}
+	c.Add("hotter", newTestObj(60))
+	if _, ok := c.Peek("hotter"); !ok {
+		t.Errorf("Peek admitted object expected found, actual not found")
+	}
+	if expected, actual := (icache.Stats{Hits: 3, Misses: 5, Admitted: 2, Rejected: 1}), c.Stats(); actual != expected {
+		t.Errorf("Stats after admitting expected %+v, actual %+v", expected, actual)
+	}
+}
+
+func TestAdmissionNoAdmitter(t *testing.T) {
+	c := New(100, nil)
+	c.Add("a", newTestObj(60))
+	c.Add("b", newTestObj(60))
+	if _, ok := c.Peek("b"); !ok {
+		t.Errorf("Peek without admitter expected found, actual not found")
+	}
+	if expected, actual := (icache.Stats{Admitted: 2}), c.Stats(); actual != expected {
+		t.Errorf("Stats without admitter expected %+v, actual %+v", expected, actual)
+	}
+}
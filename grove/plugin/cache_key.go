@@ -0,0 +1,183 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+func init() {
+	// after url_sig and uri_signing, so their parameters are already removed from the key.
+	AddPlugin(2000, Funcs{load: cacheKeyLoad, beforeCacheLookUp: cacheKey})
+}
+
+// CacheKeySeparator separates the URL of a cache key from the headers and cookies the cache_key plugin adds to it. URLs requested never contain it, because it begins a fragment.
+const CacheKeySeparator = "#"
+
+// cacheKeyConfig is the cache key normalization of a remap rule, similar to the ATS cachekey plugin.
+type cacheKeyConfig struct {
+	// SortParams is whether to sort the query parameters by name, so the same parameters in any order have the same key.
+	SortParams bool `json:"sort_params"`
+	// IncludeParams is the only query parameters to keep in the key. If empty, all parameters are kept, except ExcludeParams.
+	IncludeParams []string `json:"include_params"`
+	// ExcludeParams is the query parameters to remove from the key, such as tracking parameters.
+	ExcludeParams []string `json:"exclude_params"`
+	// RemoveAllParams is whether to remove the query from the key. If true, IncludeParams and ExcludeParams are ignored.
+	RemoveAllParams bool `json:"remove_all_params"`
+	// LowercaseHost is whether to lowercase the host of the key.
+	LowercaseHost bool `json:"lowercase_host"`
+	// CollapseSlashes is whether to replace consecutive slashes in the key path with one.
+	CollapseSlashes bool `json:"collapse_slashes"`
+	// IncludeHeaders is the request headers whose values are added to the key, so requests with different values are cached separately.
+	IncludeHeaders []string `json:"include_headers"`
+	// IncludeCookies is the request cookies whose values are added to the key.
+	IncludeCookies []string `json:"include_cookies"`
+
+	include map[string]struct{}
+	exclude map[string]struct{}
+}
+
+func cacheKeyLoad(b json.RawMessage) interface{} {
+	cfg := cacheKeyConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Errorln("cache_key loading config, unmarshalling JSON: " + err.Error())
+		return nil
+	}
+	cfg.include = strSet(cfg.IncludeParams)
+	cfg.exclude = strSet(cfg.ExcludeParams)
+	for i, name := range cfg.IncludeHeaders {
+		cfg.IncludeHeaders[i] = http.CanonicalHeaderKey(name)
+	}
+	return &cfg
+}
+
+func strSet(strs []string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, str := range strs {
+		set[str] = struct{}{}
+	}
+	return set
+}
+
+// cacheKey normalizes the cache key of requests to rules with a cache_key config.
+func cacheKey(icfg interface{}, d BeforeCacheLookUpData) {
+	cfg, ok := icfg.(*cacheKeyConfig)
+	if !ok {
+		return
+	}
+	if key := normalizeCacheKey(cfg, d.DefaultCacheKey, d.Req); key != d.DefaultCacheKey {
+		log.Debugf("cache_key '%v' normalized to '%v'\n", d.DefaultCacheKey, key)
+		d.CacheKeyOverrideFunc(key)
+	}
+}
+
+// normalizeCacheKey returns the given cache key, of the form method:URL, normalized per the config, with the config's headers and cookies from the given request.
+func normalizeCacheKey(cfg *cacheKeyConfig, key string, req *http.Request) string {
+	method, uri := "", key
+	if i := strings.Index(key, ":"); i != -1 {
+		method, uri = key[:i+1], key[i+1:]
+	}
+	suffix := ""
+	if i := strings.Index(uri, CacheKeySeparator); i != -1 {
+		uri, suffix = uri[:i], uri[i:] // keep anything added to the key by plugins called before
+	}
+	query := ""
+	if i := strings.Index(uri, "?"); i != -1 {
+		uri, query = uri[:i], uri[i+1:]
+	}
+	host, path := uri, ""
+	hostStart := 0
+	if i := strings.Index(uri, "://"); i != -1 {
+		hostStart = i + len("://")
+	}
+	if i := strings.Index(uri[hostStart:], "/"); i != -1 {
+		host, path = uri[:hostStart+i], uri[hostStart+i:]
+	}
+
+	if cfg.LowercaseHost {
+		host = strings.ToLower(host)
+	}
+	if cfg.CollapseSlashes {
+		path = collapseSlashes(path)
+	}
+	query = normalizeQuery(cfg, query)
+
+	key = method + host + path
+	if query != "" {
+		key += "?" + query
+	}
+	return key + suffix + keyHeadersCookies(cfg, req)
+}
+
+// normalizeQuery returns the raw query with only the parameters the config includes, without those it excludes, sorted if the config sorts them.
+func normalizeQuery(cfg *cacheKeyConfig, rawQuery string) string {
+	if cfg.RemoveAllParams {
+		return ""
+	}
+	if len(cfg.include) > 0 || len(cfg.exclude) > 0 {
+		rawQuery = removeQueryParams(rawQuery, func(name string) bool {
+			if _, ok := cfg.include[name]; !ok && len(cfg.include) > 0 {
+				return true
+			}
+			_, ok := cfg.exclude[name]
+			return ok
+		})
+	}
+	if !cfg.SortParams || rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	sort.SliceStable(params, func(i, j int) bool { return queryParamName(params[i]) < queryParamName(params[j]) })
+	return strings.Join(params, "&")
+}
+
+func queryParamName(param string) string {
+	if i := strings.Index(param, "="); i != -1 {
+		return param[:i]
+	}
+	return param
+}
+
+// collapseSlashes returns the path with consecutive slashes replaced by one.
+func collapseSlashes(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.Replace(path, "//", "/", -1)
+	}
+	return path
+}
+
+// keyHeadersCookies returns the config's headers and cookies from the request, to add to the key, or the empty string if the config has none.
+func keyHeadersCookies(cfg *cacheKeyConfig, req *http.Request) string {
+	if len(cfg.IncludeHeaders) == 0 && len(cfg.IncludeCookies) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for _, name := range cfg.IncludeHeaders {
+		parts = append(parts, "h:"+name+"="+strings.Join(req.Header[name], ","))
+	}
+	for _, name := range cfg.IncludeCookies {
+		val := ""
+		if cookie, err := req.Cookie(name); err == nil {
+			val = cookie.Value
+		}
+		parts = append(parts, "c:"+name+"="+val)
+	}
+	return CacheKeySeparator + strings.Join(parts, "&")
+}
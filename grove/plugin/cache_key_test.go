@@ -0,0 +1,60 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNormalizeCacheKey(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://cdn.example.net/a", nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+	req.Header.Set("Accept-Language", "en")
+	req.AddCookie(&http.Cookie{Name: "tier", Value: "gold"})
+
+	tests := []struct {
+		cfg      string
+		key      string
+		expected string
+	}{
+		{`{}`, "GET:http://Origin.example.net//a//b?b=2&a=1", "GET:http://Origin.example.net//a//b?b=2&a=1"},
+		{`{"sort_params": true}`, "GET:http://origin.example.net/a?b=2&a=1&a=0&c", "GET:http://origin.example.net/a?a=1&a=0&b=2&c"},
+		{`{"exclude_params": ["utm_source", "utm_medium"]}`, "GET:http://origin.example.net/a?utm_source=x&b=2&utm_medium=y", "GET:http://origin.example.net/a?b=2"},
+		{`{"include_params": ["id"], "sort_params": true}`, "GET:http://origin.example.net/a?x=1&id=2", "GET:http://origin.example.net/a?id=2"},
+		{`{"include_params": ["id"]}`, "GET:http://origin.example.net/a?x=1", "GET:http://origin.example.net/a"},
+		{`{"include_params": ["id", "x"], "exclude_params": ["x"]}`, "GET:http://origin.example.net/a?x=1&id=2&y=3", "GET:http://origin.example.net/a?id=2"},
+		{`{"remove_all_params": true, "include_params": ["x"]}`, "GET:http://origin.example.net/a?x=1", "GET:http://origin.example.net/a"},
+		{`{"lowercase_host": true, "collapse_slashes": true}`, "GET:http://Origin.Example.net:8080//a///b/?x=//", "GET:http://origin.example.net:8080/a/b/?x=//"},
+		{`{"lowercase_host": true}`, "GET:http://Origin.example.net", "GET:http://origin.example.net"},
+		{`{"include_headers": ["accept-language", "X-Missing"], "include_cookies": ["tier"]}`, "GET:http://origin.example.net/a", "GET:http://origin.example.net/a#h:Accept-Language=en&h:X-Missing=&c:tier=gold"},
+	}
+	for _, test := range tests {
+		cfg, ok := cacheKeyLoad([]byte(test.cfg)).(*cacheKeyConfig)
+		if !ok {
+			t.Errorf("cacheKeyLoad '%v' expected config, actual nil", test.cfg)
+			continue
+		}
+		if actual := normalizeCacheKey(cfg, test.key, req); actual != test.expected {
+			t.Errorf("normalizeCacheKey '%v' '%v' expected '%v', actual '%v'", test.cfg, test.key, test.expected, actual)
+		}
+	}
+
+	if cfg := cacheKeyLoad([]byte(`{"sort_params": 1}`)); cfg != nil {
+		t.Errorf("cacheKeyLoad of invalid JSON expected nil, actual %+v", cfg)
+	}
+}
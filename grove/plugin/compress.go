@@ -0,0 +1,357 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+
+	"github.com/andybalholm/brotli"
+)
+
+func init() {
+	AddPlugin(6000, Funcs{load: compressLoad, beforeRespond: compress})
+}
+
+const CompressEncodingBrotli = "br"
+const CompressEncodingGzip = "gzip"
+
+const CompressDefaultMinBytes = 1024
+const CompressDefaultGzipLevel = gzip.DefaultCompression
+const CompressDefaultBrotliLevel = 5
+const CompressDefaultMaxCachedBytes = 16 * 1024 * 1024
+
+// CompressDefaultContentTypes are the media types compressed if the config has no content_types, the text types commonly sent uncompressed by origins, including HLS and DASH manifests.
+var CompressDefaultContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-mpegurl",
+	"application/vnd.apple.mpegurl",
+	"application/dash+xml",
+	"image/svg+xml",
+}
+
+// compressVariantKeyPrefix separates the cache key of a compressed variant from the key of the object it's compressed from. It starts with the variant key separator, so the compressed variant's primary key is the object's primary key.
+const compressVariantKeyPrefix = "\x00Content-Encoding:"
+
+const compressReadBufSize = 32 * 1024
+
+type compressConfig struct {
+	// Encodings are the encodings to compress with, in order of preference. The first encoding accepted by the client is used.
+	Encodings []string `json:"encodings"`
+	// ContentTypes are the media types to compress. Types ending in '/' match all subtypes.
+	ContentTypes []string `json:"content_types"`
+	// MinBytes is the smallest response compressed. Responses whose size isn't known yet are always compressed.
+	MinBytes    int64 `json:"min_bytes"`
+	GzipLevel   int   `json:"gzip_level"`
+	BrotliLevel int   `json:"brotli_level"`
+	// MaxCachedBytes is the largest compressed variant cached. Larger variants are compressed for every request, so their bodies aren't held in memory to cache them.
+	MaxCachedBytes int64 `json:"max_cached_bytes"`
+}
+
+func compressLoad(b json.RawMessage) interface{} {
+	cfg := compressConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Errorln("compress loading config, unmarshalling JSON: " + err.Error())
+		return nil
+	}
+	if len(cfg.Encodings) == 0 {
+		cfg.Encodings = []string{CompressEncodingBrotli, CompressEncodingGzip}
+	}
+	for _, encoding := range cfg.Encodings {
+		if encoding != CompressEncodingBrotli && encoding != CompressEncodingGzip {
+			log.Errorln("compress loading config: unknown encoding '" + encoding + "', must be br or gzip")
+			return nil
+		}
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = append([]string{}, CompressDefaultContentTypes...)
+	}
+	for i, contentType := range cfg.ContentTypes {
+		cfg.ContentTypes[i] = strings.ToLower(contentType)
+	}
+	if cfg.MinBytes == 0 {
+		cfg.MinBytes = CompressDefaultMinBytes
+	}
+	if cfg.GzipLevel == 0 {
+		cfg.GzipLevel = CompressDefaultGzipLevel
+	}
+	if cfg.GzipLevel != gzip.DefaultCompression && (cfg.GzipLevel < gzip.BestSpeed || cfg.GzipLevel > gzip.BestCompression) {
+		log.Errorln("compress loading config: gzip_level must be between 1 and 9")
+		return nil
+	}
+	if cfg.MaxCachedBytes == 0 {
+		cfg.MaxCachedBytes = CompressDefaultMaxCachedBytes
+	}
+	if cfg.BrotliLevel == 0 {
+		cfg.BrotliLevel = CompressDefaultBrotliLevel
+	}
+	if cfg.BrotliLevel < 1 || cfg.BrotliLevel > brotli.BestCompression {
+		log.Errorln("compress loading config: brotli_level must be between 1 and 11")
+		return nil
+	}
+	return &cfg
+}
+
+// compress compresses responses of the configured content types with the best encoding the client accepts. Compressed variants are cached in the rule's cache, so objects are only compressed once, until they change.
+func compress(icfg interface{}, d BeforeRespondData) {
+	cfg, ok := icfg.(*compressConfig)
+	if !ok {
+		return
+	}
+	if !cfg.compressible(d) {
+		return
+	}
+	encoding := negotiateEncoding(d.Req.Header, cfg.Encodings)
+	if encoding == "" {
+		// the response varies on Accept-Encoding, even if this client doesn't accept any encoding
+		*d.Hdr = addVaryAcceptEncoding(web.CopyHeader(*d.Hdr))
+		return
+	}
+
+	key := compressedVariantKey(d.CacheKey, d.CacheObj, encoding)
+	if d.Cache != nil {
+		if obj, ok := d.Cache.Get(key); ok && isCompressedVariant(obj, d.CacheObj, encoding) {
+			log.Debugf("compress rule %v '%v' compressed variant hit\n", d.RemapRule, key)
+			*d.Hdr = compressedHeader(*d.Hdr, encoding, int64(obj.Size))
+			*d.Body = cacheobj.NewReader(obj.Body)
+			return
+		}
+	}
+
+	store, maxStore := (func([]byte))(nil), cfg.MaxCachedBytes
+	if d.Cache != nil && !d.CacheObj.RespCacheControl.Has("no-store") && !d.CacheObj.RespCacheControl.Has("private") {
+		src, cache := d.CacheObj, d.Cache
+		store = func(compressed []byte) {
+			obj := cacheobj.New(src.ReqHeaders, cacheobj.NewMemBodyBytes(compressed), src.Code, src.OriginCode, src.ProxyURL, compressedHeader(src.RespHeaders, encoding, int64(len(compressed))), src.ReqTime, src.ReqRespTime, src.RespRespTime, src.LastModified)
+			cache.Add(key, obj)
+		}
+		// a variant larger than the whole cache could never be cached
+		if capacity := cache.Capacity(); capacity < uint64(maxStore) {
+			maxStore = int64(capacity)
+		}
+	}
+	*d.Hdr = compressedHeader(*d.Hdr, encoding, -1)
+	*d.Body = newCompressReader(*d.Body, cfg.newWriter(encoding), store, maxStore)
+}
+
+// compressible returns whether the response is compressed by the config, if the client accepts it.
+func (cfg *compressConfig) compressible(d BeforeRespondData) bool {
+	if d.CacheObj == nil || *d.Code != http.StatusOK || *d.Body == nil {
+		return false
+	}
+	if d.Req.Header.Get("Range") != "" {
+		return false // compressing would change the bytes of the range
+	}
+	if enc := (*d.Hdr).Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		return false
+	}
+	if d.CacheObj.RespCacheControl.Has("no-transform") {
+		return false
+	}
+	if !cfg.compressibleType((*d.Hdr).Get("Content-Type")) {
+		return false
+	}
+	size := d.CacheObj.Size
+	if contentLength, err := strconv.ParseUint((*d.Hdr).Get("Content-Length"), 10, 64); err == nil {
+		size = contentLength
+	}
+	return size == 0 || size >= uint64(cfg.MinBytes) // a size of 0 is unknown, for objects still being fetched without a Content-Length
+}
+
+func (cfg *compressConfig) compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, compressible := range cfg.ContentTypes {
+		if mediaType == compressible || (strings.HasSuffix(compressible, "/") && strings.HasPrefix(mediaType, compressible)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *compressConfig) newWriter(encoding string) func(io.Writer) io.WriteCloser {
+	if encoding == CompressEncodingBrotli {
+		return func(w io.Writer) io.WriteCloser { return brotli.NewWriterLevel(w, cfg.BrotliLevel) }
+	}
+	return func(w io.Writer) io.WriteCloser {
+		gz, _ := gzip.NewWriterLevel(w, cfg.GzipLevel) // the level was validated when the config was loaded
+		return gz
+	}
+}
+
+// negotiateEncoding returns the first of the given encodings accepted by the request's Accept-Encoding header, or the empty string if none are.
+func negotiateEncoding(reqHeader http.Header, encodings []string) string {
+	accepted := map[string]bool{}
+	for _, val := range reqHeader["Accept-Encoding"] {
+		for _, elem := range strings.Split(val, ",") {
+			params := strings.Split(elem, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name == "" {
+				continue
+			}
+			accepted[name] = true
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if !strings.HasPrefix(param, "q=") {
+					continue
+				}
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil && q <= 0 {
+					accepted[name] = false
+				}
+			}
+		}
+	}
+	for _, encoding := range encodings {
+		if ok, listed := accepted[encoding]; ok || (!listed && accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressedVariantKey returns the cache key of the given object compressed with the given encoding.
+func compressedVariantKey(cacheKey string, obj *cacheobj.CacheObj, encoding string) string {
+	vary, _ := cacheobj.ParseVary(obj.RespHeaders)
+	return cacheobj.VariantKey(cacheKey, vary, obj.ReqHeaders) + compressVariantKeyPrefix + encoding
+}
+
+// isCompressedVariant returns whether the cached compressed object was compressed from the given object, and not a previous version of it.
+func isCompressedVariant(compressed *cacheobj.CacheObj, obj *cacheobj.CacheObj, encoding string) bool {
+	return compressed.LastModified.Equal(obj.LastModified) &&
+		compressed.RespHeaders.Get("ETag") == compressedETag(obj.RespHeaders.Get("ETag"), encoding) &&
+		compressed.RespHeaders.Get("Content-Encoding") == encoding
+}
+
+// compressedHeader returns a copy of the given response header, for the response compressed with the given encoding, of the given size, or -1 if the size isn't known.
+func compressedHeader(hdr http.Header, encoding string, size int64) http.Header {
+	hdr = web.CopyHeader(hdr)
+	hdr.Set("Content-Encoding", encoding)
+	if size < 0 {
+		hdr.Del("Content-Length")
+	} else {
+		hdr.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if etag := hdr.Get("ETag"); etag != "" {
+		hdr.Set("ETag", compressedETag(etag, encoding))
+	}
+	hdr.Del("Accept-Ranges") // ranges of the compressed response aren't served
+	return addVaryAcceptEncoding(hdr)
+}
+
+// compressedETag returns the ETag of the compressed response with the given uncompressed ETag, which has the encoding appended inside the quotes, so it differs from the uncompressed ETag and each other encoding.
+func compressedETag(etag string, encoding string) string {
+	if len(etag) < 2 || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + encoding + `"`
+}
+
+// addVaryAcceptEncoding adds Accept-Encoding to the Vary of the given header, if it isn't already, and returns the header.
+func addVaryAcceptEncoding(hdr http.Header) http.Header {
+	vary, varyAny := cacheobj.ParseVary(hdr)
+	if varyAny {
+		return hdr
+	}
+	for _, name := range vary {
+		if name == "Accept-Encoding" {
+			return hdr
+		}
+	}
+	hdr.Add("Vary", "Accept-Encoding")
+	return hdr
+}
+
+// compressReader compresses the body it reads, as it's read, so bodies still being fetched are streamed. If store isn't nil, it's called with the complete compressed body, once the whole body has been read successfully, unless the compressed body is larger than maxStore bytes.
+type compressReader struct {
+	src   io.Reader
+	w     io.WriteCloser
+	out   bytes.Buffer  // compressed bytes not yet read
+	all   limitedBuffer // all compressed bytes, if they're to be stored
+	buf   []byte
+	store func([]byte)
+	eof   bool
+}
+
+func newCompressReader(src io.Reader, newWriter func(io.Writer) io.WriteCloser, store func([]byte), maxStore int64) *compressReader {
+	r := &compressReader{src: src, buf: make([]byte, compressReadBufSize), store: store, all: limitedBuffer{max: maxStore}}
+	if store == nil {
+		r.w = newWriter(&r.out)
+	} else {
+		r.w = newWriter(io.MultiWriter(&r.out, &r.all))
+	}
+	return r
+}
+
+func (r *compressReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		n, err := r.src.Read(r.buf)
+		if n > 0 {
+			if _, err := r.w.Write(r.buf[:n]); err != nil {
+				return 0, err
+			}
+		}
+		if err == io.EOF {
+			if err := r.w.Close(); err != nil {
+				return 0, err
+			}
+			r.eof = true
+			if r.store != nil && !r.all.exceeded {
+				r.store(r.all.Bytes())
+			}
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return r.out.Read(p)
+}
+
+// limitedBuffer buffers the bytes written to it, until more than max bytes are written, after which it discards what it buffered, and buffers nothing more.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.exceeded {
+		return len(p), nil
+	}
+	if int64(b.Len()+len(p)) > b.max {
+		log.Debugf("compress body larger than %v bytes, not caching\n", b.max)
+		b.exceeded = true
+		b.Buffer = bytes.Buffer{}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,153 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/memcache"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	encodings := []string{CompressEncodingBrotli, CompressEncodingGzip}
+	tests := map[string]string{
+		"":                   "",
+		"gzip":               "gzip",
+		"gzip, deflate, br":  "br",
+		"br;q=0, gzip;q=0.5": "gzip",
+		"GZIP":               "gzip",
+		"*":                  "br",
+		"*, br;q=0":          "gzip",
+		"identity":           "",
+		"deflate;q=1.0":      "",
+	}
+	for acceptEncoding, expected := range tests {
+		hdr := http.Header{"Accept-Encoding": {acceptEncoding}}
+		if actual := negotiateEncoding(hdr, encodings); actual != expected {
+			t.Errorf("negotiateEncoding of '%v' expected '%v' actual '%v'", acceptEncoding, expected, actual)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	cfg := compressLoad([]byte(`{"min_bytes": 10}`)).(*compressConfig)
+	cache := memcache.New(1024*1024, nil)
+	body := []byte(strings.Repeat("#EXTINF:6.0,\nsegment.ts\n", 100))
+	respHdr := http.Header{"Content-Type": {"application/vnd.apple.mpegurl"}, "Etag": {`"abc"`}, "Accept-Ranges": {"bytes"}}
+	now := time.Now()
+	obj := cacheobj.New(http.Header{}, cacheobj.NewMemBodyBytes(body), http.StatusOK, http.StatusOK, "", respHdr, now, now, now, now)
+
+	respond := func(acceptEncoding string) (http.Header, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, "http://cdn.example.net/live.m3u8", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		code, hdr, body := obj.Code, obj.RespHeaders, cacheobj.NewReader(obj.Body)
+		compress(cfg, BeforeRespondData{Req: req, CacheObj: obj, Code: &code, Hdr: &hdr, Body: &body, Cache: cache, CacheKey: "GET:http://cdn.example.net/live.m3u8"})
+		bts, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Fatalf("reading body expected nil error, actual %v", err)
+		}
+		return hdr, bts
+	}
+
+	hdr, compressed := respond("gzip")
+	if hdr.Get("Content-Encoding") != "gzip" || hdr.Get("Content-Length") != "" || hdr.Get("Etag") != `"abc-gzip"` || hdr.Get("Vary") != "Accept-Encoding" || hdr.Get("Accept-Ranges") != "" {
+		t.Errorf("compress expected gzip headers without length, actual %+v", hdr)
+	}
+	if respHdr.Get("Content-Encoding") != "" {
+		t.Errorf("compress expected the cached object's headers not to be modified, actual %+v", respHdr)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip.NewReader expected nil error, actual %v", err)
+	}
+	if decompressed, err := ioutil.ReadAll(gz); err != nil || !bytes.Equal(decompressed, body) {
+		t.Errorf("decompressing expected the original body, actual err %v body '%s'", err, decompressed)
+	}
+
+	// the compressed variant is now cached, and served with its length
+	hdr, cached := respond("gzip")
+	if !bytes.Equal(cached, compressed) || hdr.Get("Content-Length") != strconv.Itoa(len(compressed)) {
+		t.Errorf("compress expected the cached compressed variant of length %v, actual length '%v' and %v bytes", len(compressed), hdr.Get("Content-Length"), len(cached))
+	}
+
+	hdr, compressed = respond("br")
+	if hdr.Get("Content-Encoding") != "br" || hdr.Get("Etag") != `"abc-br"` {
+		t.Errorf("compress expected br headers, actual %+v", hdr)
+	}
+	if decompressed, err := ioutil.ReadAll(brotli.NewReader(bytes.NewReader(compressed))); err != nil || !bytes.Equal(decompressed, body) {
+		t.Errorf("decompressing br expected the original body, actual err %v body '%s'", err, decompressed)
+	}
+
+	hdr, uncompressed := respond("identity")
+	if hdr.Get("Content-Encoding") != "" || hdr.Get("Vary") != "Accept-Encoding" || !bytes.Equal(uncompressed, body) {
+		t.Errorf("compress without an accepted encoding expected the uncompressed body varying on Accept-Encoding, actual %+v", hdr)
+	}
+
+	// a new version of the object must not be served the old compressed variant
+	obj = cacheobj.New(http.Header{}, cacheobj.NewMemBodyBytes([]byte(strings.Repeat("changed\n", 100))), http.StatusOK, http.StatusOK, "", respHdr, now, now, now, now.Add(time.Second))
+	if _, changed := respond("gzip"); bytes.Equal(changed, cached) {
+		t.Errorf("compress of a changed object expected a new compressed variant, actual the cached one")
+	}
+}
+
+func TestCompressMaxCachedBytes(t *testing.T) {
+	body := []byte(strings.Repeat("#EXTINF:6.0,\nsegment.ts\n", 100))
+	respHdr := http.Header{"Content-Type": {"application/vnd.apple.mpegurl"}}
+	now := time.Now()
+	obj := cacheobj.New(http.Header{}, cacheobj.NewMemBodyBytes(body), http.StatusOK, http.StatusOK, "", respHdr, now, now, now, now)
+	cacheKey := "GET:http://cdn.example.net/live.m3u8"
+
+	tests := []struct {
+		cfg      string
+		capacity uint64
+		cached   bool
+	}{
+		{`{"min_bytes": 10}`, 1024 * 1024, true},
+		{`{"min_bytes": 10, "max_cached_bytes": 10}`, 1024 * 1024, false},
+		{`{"min_bytes": 10}`, 10, false}, // larger than the cache
+	}
+	for _, test := range tests {
+		cfg := compressLoad([]byte(test.cfg)).(*compressConfig)
+		cache := memcache.New(test.capacity, nil)
+		req, _ := http.NewRequest(http.MethodGet, "http://cdn.example.net/live.m3u8", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		code, hdr, rdr := obj.Code, obj.RespHeaders, cacheobj.NewReader(obj.Body)
+		compress(cfg, BeforeRespondData{Req: req, CacheObj: obj, Code: &code, Hdr: &hdr, Body: &rdr, Cache: cache, CacheKey: cacheKey})
+		compressed, err := ioutil.ReadAll(rdr)
+		if err != nil {
+			t.Fatalf("reading body expected nil error, actual %v", err)
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("gzip.NewReader expected nil error, actual %v", err)
+		}
+		if decompressed, err := ioutil.ReadAll(gz); err != nil || !bytes.Equal(decompressed, body) {
+			t.Errorf("config %v capacity %v decompressing expected the original body, actual err %v", test.cfg, test.capacity, err)
+		}
+		if _, cached := cache.Peek(compressedVariantKey(cacheKey, obj, "gzip")); cached != test.cached {
+			t.Errorf("config %v capacity %v compressed variant cached expected %v, actual %v", test.cfg, test.capacity, test.cached, cached)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+func init() {
+	AddPlugin(10000, Funcs{load: purgeLoad, startup: purgeStartup, onRequest: purge})
+}
+
+// PurgeEndpoint is our reserved path
+const PurgeEndpoint = "/_purge"
+
+type purgeConfig struct {
+	// Token is the token which must be sent as an `Authorization: Bearer` header to purge.
+	Token string `json:"token"`
+}
+
+// purgeResponse is the JSON response of a successful purge.
+type purgeResponse struct {
+	Rule        string `json:"rule"`
+	Removed     int    `json:"removed"`
+	Invalidated int    `json:"invalidated"`
+}
+
+func purgeLoad(b json.RawMessage) interface{} {
+	cfg := purgeConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Errorln("http_purge loading config, unmarshalling JSON: " + err.Error())
+		return nil
+	}
+	if cfg.Token == "" {
+		log.Errorln("http_purge loading config: no token, purging will be forbidden")
+	}
+	return &cfg
+}
+
+// purgeStartup puts the remap rules in the context, by name, so requests can find the cache and keys of the rule to purge.
+func purgeStartup(icfg interface{}, d StartupData) {
+	rules := map[string]remapdata.RemapRule{}
+	for _, rule := range d.RemapRules {
+		rules[rule.Name] = rule
+	}
+	*d.Context = rules
+}
+
+// purge serves the purge endpoint, which removes or invalidates the objects of a remap rule, selected by exact cache key, URL prefix, or URL regular expression.
+func purge(icfg interface{}, d OnRequestData) bool {
+	if !strings.HasPrefix(d.R.URL.Path, PurgeEndpoint) {
+		log.Debugf("plugin onrequest http_purge returning, not in path '" + d.R.URL.Path + "'\n")
+		return false
+	}
+
+	w := d.W
+	req := d.R
+	ip, err := web.GetIP(req)
+	if err != nil {
+		writePurgeErr(w, http.StatusInternalServerError, "")
+		log.Errorln("http_purge failed to get IP: " + err.Error())
+		return true
+	}
+	if !d.StatRules.Allowed(ip) {
+		writePurgeErr(w, http.StatusForbidden, "")
+		log.Debugln("http_purge IP " + ip.String() + " FORBIDDEN")
+		return true
+	}
+	cfg, ok := icfg.(*purgeConfig)
+	if !ok || !bearerAuthorized(req, cfg.Token) {
+		writePurgeErr(w, http.StatusForbidden, "")
+		log.Infoln("http_purge request from " + ip.String() + " with invalid token FORBIDDEN")
+		return true
+	}
+	if req.Method != http.MethodPost && req.Method != "PURGE" {
+		writePurgeErr(w, http.StatusMethodNotAllowed, "")
+		return true
+	}
+
+	rules, ok := (*d.Context).(map[string]remapdata.RemapRule)
+	if !ok {
+		writePurgeErr(w, http.StatusInternalServerError, "")
+		log.Errorf("http_purge context '%v' type '%T' expected map[string]remapdata.RemapRule\n", *d.Context, *d.Context)
+		return true
+	}
+
+	query := req.URL.Query()
+	rule, ok := rules[query.Get("rule")]
+	if !ok {
+		writePurgeErr(w, http.StatusBadRequest, "rule not found")
+		return true
+	}
+	soft := query.Get("soft") == "true"
+
+	keys := []string{}
+	if key := query.Get("key"); key != "" {
+		keys = append(keys, key)
+	} else if prefix := query.Get("prefix"); prefix != "" {
+		keys = ruleKeys(rule, func(url string) bool { return strings.HasPrefix(url, prefix) })
+	} else if regex := query.Get("regex"); regex != "" {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			writePurgeErr(w, http.StatusBadRequest, "invalid regex: "+err.Error())
+			return true
+		}
+		keys = ruleKeys(rule, re.MatchString)
+	} else {
+		writePurgeErr(w, http.StatusBadRequest, "one of key, prefix, or regex is required")
+		return true
+	}
+
+	resp := purgeResponse{Rule: rule.Name}
+	for _, key := range keys {
+		n := purgeKey(rule.Cache, key, soft)
+		if soft {
+			resp.Invalidated += n
+		} else {
+			resp.Removed += n
+		}
+	}
+	log.Infof("http_purge from %v rule %v key '%v' prefix '%v' regex '%v' soft %v: removed %v invalidated %v\n", ip, rule.Name, query.Get("key"), query.Get("prefix"), query.Get("regex"), soft, resp.Removed, resp.Invalidated)
+
+	bts, err := json.Marshal(resp)
+	if err != nil {
+		writePurgeErr(w, http.StatusInternalServerError, "")
+		log.Errorln("http_purge marshalling response: " + err.Error())
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bts)
+	return true
+}
+
+// bearerAuthorized returns whether the request has an `Authorization: Bearer` header with the given token. An empty token authorizes nothing.
+func bearerAuthorized(req *http.Request, token string) bool {
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(token)) == 1
+}
+
+// ruleKeys returns the keys in the rule's cache of objects of the rule, whose URLs match. The URL of a key is the parent URL it was requested from, without the method or variant. For rules with a regex match, the parent URL is the To URL with the captures substituted, so keys of any captured values are the rule's.
+func ruleKeys(rule remapdata.RemapRule, match func(url string) bool) []string {
+	isRuleURL := rule.CacheURLMatcher()
+	keys := []string{}
+	for _, key := range rule.Cache.Keys() {
+		url := cacheobj.PrimaryKey(key)
+		if i := strings.Index(url, ":"); i != -1 {
+			url = url[i+1:] // remove the method
+		}
+		if isRuleURL(url) && match(url) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// purgeKey removes or invalidates the object with the given key, and its variants if it has any. Returns the number of objects removed or invalidated.
+func purgeKey(cache icache.Cache, key string, soft bool) int {
+	keys := []string{key}
+	if obj, ok := cache.Peek(key); ok && obj.IsVariants() {
+		keys = append(keys, obj.Variants...)
+	}
+	n := 0
+	for _, key := range keys {
+		if soft && cache.Invalidate(key) || !soft && cache.Remove(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func writePurgeErr(w http.ResponseWriter, code int, msg string) {
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	w.WriteHeader(code)
+	w.Write([]byte(msg))
+}
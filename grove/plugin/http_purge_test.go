@@ -0,0 +1,218 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+// newPurgeTestCache returns a memory cache with an object at each of the given keys.
+func newPurgeTestCache(keys ...string) icache.Cache {
+	cache := memcache.New(1024*1024, nil)
+	for _, key := range keys {
+		body := cacheobj.NewMemBodyBytes([]byte(key))
+		cache.Add(key, cacheobj.New(http.Header{}, body, http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now()))
+	}
+	return cache
+}
+
+func TestRuleKeysRegexRule(t *testing.T) {
+	matcher, err := remapdata.NewRegexMatcher(remapdata.RemapMatch{Host: `^([a-z]+)\.example\.net$`, Path: `^/(.*)$`})
+	if err != nil {
+		t.Fatalf("NewRegexMatcher expected nil error, actual %v", err)
+	}
+	cache := newPurgeTestCache(
+		"GET:http://foo.origin.example/video/a.mp4",
+		"GET:http://bar.origin.example/video/b.mp4",
+		"GET:http://bar.origin.example/img/c.jpg",
+		"GET:http://other.example/video/d.mp4",
+	)
+	rule := remapdata.RemapRule{
+		RemapRuleBase: remapdata.RemapRuleBase{Name: "regex"},
+		To:            []remapdata.RemapRuleTo{{RemapRuleToBase: remapdata.RemapRuleToBase{URL: "http://$1.origin.example/$2"}}},
+		Cache:         cache,
+		Matcher:       matcher,
+	}
+
+	keys := ruleKeys(rule, func(url string) bool { return strings.Contains(url, "/video/") })
+	sort.Strings(keys)
+	expected := []string{"GET:http://bar.origin.example/video/b.mp4", "GET:http://foo.origin.example/video/a.mp4"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("ruleKeys of regex rule expected %v, actual %v", expected, keys)
+	}
+}
+
+// newPurgeTestRule returns a rule from cdn.example.net to origin.example.net, with the given cache.
+func newPurgeTestRule(cache icache.Cache) remapdata.RemapRule {
+	return remapdata.RemapRule{
+		RemapRuleBase: remapdata.RemapRuleBase{Name: "foo", From: "http://cdn.example.net"},
+		To:            []remapdata.RemapRuleTo{{RemapRuleToBase: remapdata.RemapRuleToBase{URL: "http://origin.example.net"}}},
+		Cache:         cache,
+	}
+}
+
+// doPurge serves the given purge request with the given rule and config, and returns the response, and whether the plugin handled the request.
+func doPurge(cfg *purgeConfig, rule remapdata.RemapRule, statRules remapdata.RemapRulesStats, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	context := interface{}(nil)
+	purgeStartup(nil, StartupData{RemapRules: []remapdata.RemapRule{rule}, Context: &context})
+	w := httptest.NewRecorder()
+	handled := purge(cfg, OnRequestData{W: w, R: req, StatRules: statRules, Context: &context})
+	return w, handled
+}
+
+func newPurgeRequest(method string, query string, token string) *http.Request {
+	req := httptest.NewRequest(method, "http://localhost"+PurgeEndpoint+"?"+query, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestPurgeAuth(t *testing.T) {
+	cfg := &purgeConfig{Token: "secret"}
+	rule := newPurgeTestRule(newPurgeTestCache("GET:http://origin.example.net/a"))
+	_, denied, _ := net.ParseCIDR("192.0.2.0/24") // httptest requests are from 192.0.2.1
+
+	tests := []struct {
+		name      string
+		cfg       *purgeConfig
+		statRules remapdata.RemapRulesStats
+		req       *http.Request
+		code      int
+	}{
+		{"no token", cfg, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=foo&key=GET:http://origin.example.net/a", ""), http.StatusForbidden},
+		{"wrong token", cfg, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=foo&key=GET:http://origin.example.net/a", "wrong"), http.StatusForbidden},
+		{"no configured token", &purgeConfig{}, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=foo&key=GET:http://origin.example.net/a", "secret"), http.StatusForbidden},
+		{"denied IP", cfg, remapdata.RemapRulesStats{Deny: []*net.IPNet{denied}}, newPurgeRequest(http.MethodPost, "rule=foo&key=GET:http://origin.example.net/a", "secret"), http.StatusForbidden},
+		{"GET", cfg, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodGet, "rule=foo&key=GET:http://origin.example.net/a", "secret"), http.StatusMethodNotAllowed},
+		{"unknown rule", cfg, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=bar&key=GET:http://origin.example.net/a", "secret"), http.StatusBadRequest},
+		{"no selector", cfg, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=foo", "secret"), http.StatusBadRequest},
+		{"invalid regex", cfg, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=foo&regex=(", "secret"), http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w, handled := doPurge(test.cfg, rule, test.statRules, test.req)
+		if !handled || w.Code != test.code {
+			t.Errorf("purge %v expected handled with code %v, actual handled %v code %v", test.name, test.code, handled, w.Code)
+		}
+	}
+	if _, ok := rule.Cache.Peek("GET:http://origin.example.net/a"); !ok {
+		t.Errorf("purge of rejected requests expected object not purged, actual purged")
+	}
+
+	if _, handled := doPurge(cfg, rule, remapdata.RemapRulesStats{}, httptest.NewRequest(http.MethodPost, "http://localhost/foo", nil)); handled {
+		t.Errorf("purge of a request not to the purge endpoint expected not handled, actual handled")
+	}
+}
+
+func TestPurgeSelection(t *testing.T) {
+	keys := []string{
+		"GET:http://origin.example.net/images/a.jpg",
+		"GET:http://origin.example.net/images/b.png",
+		"GET:http://origin.example.net/video/c.mp4",
+		"GET:http://other.example/images/d.jpg", // another rule's object in the same cache
+	}
+	tests := []struct {
+		query   string
+		removed []string
+	}{
+		{"key=GET:http://origin.example.net/images/a.jpg", keys[:1]},
+		{"prefix=http://origin.example.net/images/", keys[:2]},
+		{"regex=/images/.*\\.jpg$", keys[:1]},
+		{"regex=\\.(jpg|mp4)$", []string{keys[0], keys[2]}},
+		// objects are selected by their parent URL, not the URL clients request
+		{"prefix=http://cdn.example.net/images/", nil},
+	}
+	for _, test := range tests {
+		rule := newPurgeTestRule(newPurgeTestCache(keys...))
+		w, _ := doPurge(&purgeConfig{Token: "secret"}, rule, remapdata.RemapRulesStats{}, newPurgeRequest("PURGE", "rule=foo&"+test.query, "secret"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("purge %v expected code 200, actual %v: %v", test.query, w.Code, w.Body.String())
+		}
+		resp := purgeResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("purge %v decoding response: %v", test.query, err)
+		}
+		if expected := (purgeResponse{Rule: "foo", Removed: len(test.removed)}); resp != expected {
+			t.Errorf("purge %v expected response %+v, actual %+v", test.query, expected, resp)
+		}
+		remaining := []string{}
+		for _, key := range keys {
+			if _, ok := rule.Cache.Peek(key); ok {
+				remaining = append(remaining, key)
+			}
+		}
+		if len(remaining) != len(keys)-len(test.removed) {
+			t.Errorf("purge %v expected %v objects remaining, actual %v", test.query, len(keys)-len(test.removed), remaining)
+		}
+	}
+}
+
+func TestPurgeSoft(t *testing.T) {
+	key := "GET:http://origin.example.net/a.jpg"
+	rule := newPurgeTestRule(newPurgeTestCache(key))
+	w, _ := doPurge(&purgeConfig{Token: "secret"}, rule, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=foo&soft=true&prefix=http://origin.example.net/", "secret"))
+	resp := purgeResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if expected := (purgeResponse{Rule: "foo", Invalidated: 1}); resp != expected {
+		t.Errorf("soft purge expected response %+v, actual %+v", expected, resp)
+	}
+	obj, ok := rule.Cache.Peek(key)
+	if !ok {
+		t.Fatalf("soft purge expected object kept, actual removed")
+	}
+	if !obj.Invalidated {
+		t.Errorf("soft purge expected object invalidated, actual not")
+	}
+}
+
+func TestPurgeVariants(t *testing.T) {
+	key := "GET:http://origin.example.net/a.jpg"
+	variantKeys := []string{
+		cacheobj.VariantKey(key, []string{"Accept-Encoding"}, http.Header{"Accept-Encoding": {"gzip"}}),
+		cacheobj.VariantKey(key, []string{"Accept-Encoding"}, http.Header{}),
+	}
+	cache := newPurgeTestCache(variantKeys...)
+	cache.Add(key, cacheobj.NewVariants([]string{"Accept-Encoding"}, variantKeys))
+	rule := newPurgeTestRule(cache)
+
+	w, _ := doPurge(&purgeConfig{Token: "secret"}, rule, remapdata.RemapRulesStats{}, newPurgeRequest(http.MethodPost, "rule=foo&key="+key, "secret"))
+	resp := purgeResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if expected := (purgeResponse{Rule: "foo", Removed: 3}); resp != expected {
+		t.Errorf("purge of object with variants expected response %+v, actual %+v", expected, resp)
+	}
+	for _, key := range append(variantKeys, key) {
+		if _, ok := cache.Peek(key); ok {
+			t.Errorf("purge of object with variants expected %q removed, actual not", key)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/apache/trafficcontrol/grove/certstore"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+func init() {
+	AddPlugin(10000, Funcs{load: reloadLoad, startup: reloadStartup, onRequest: reload})
+}
+
+// ReloadEndpoint is our reserved path
+const ReloadEndpoint = "/_reload"
+
+// ReloadCertificatesEndpoint reloads only the TLS certificates.
+const ReloadCertificatesEndpoint = ReloadEndpoint + "/certificates"
+
+type reloadConfig struct {
+	// Token is the token which must be sent as an `Authorization: Bearer` header to reload.
+	Token string `json:"token"`
+}
+
+// reloadResponse is the JSON response of a reload. If the reload failed, Error is set instead of the diff, and the running config was kept.
+type reloadResponse struct {
+	*remapdata.RulesDiff
+	Certificates []certstore.Info `json:"certificates,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// reloadFuncs are the reload funcs given at startup, which are put in the context.
+type reloadFuncs struct {
+	reload      func() (remapdata.RulesDiff, error)
+	reloadCerts func() ([]certstore.Info, error)
+}
+
+func reloadLoad(b json.RawMessage) interface{} {
+	cfg := reloadConfig{}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		log.Errorln("http_reload loading config, unmarshalling JSON: " + err.Error())
+		return nil
+	}
+	if cfg.Token == "" {
+		log.Errorln("http_reload loading config: no token, reloading will be forbidden")
+	}
+	return &cfg
+}
+
+// reloadStartup puts the reload funcs in the context, so requests can reload.
+func reloadStartup(icfg interface{}, d StartupData) {
+	*d.Context = reloadFuncs{reload: d.Reload, reloadCerts: d.ReloadCertificates}
+}
+
+// reload serves the reload endpoint, which reloads the config and remap rules, and responds with the difference between the old and new rules. The certificates endpoint reloads only the certificates, and responds with the certificates being served.
+func reload(icfg interface{}, d OnRequestData) bool {
+	if !strings.HasPrefix(d.R.URL.Path, ReloadEndpoint) {
+		log.Debugf("plugin onrequest http_reload returning, not in path '" + d.R.URL.Path + "'\n")
+		return false
+	}
+
+	w := d.W
+	req := d.R
+	ip, err := web.GetIP(req)
+	if err != nil {
+		writeReloadResp(w, http.StatusInternalServerError, reloadResponse{Error: http.StatusText(http.StatusInternalServerError)})
+		log.Errorln("http_reload failed to get IP: " + err.Error())
+		return true
+	}
+	if !d.StatRules.Allowed(ip) {
+		writeReloadResp(w, http.StatusForbidden, reloadResponse{Error: http.StatusText(http.StatusForbidden)})
+		log.Debugln("http_reload IP " + ip.String() + " FORBIDDEN")
+		return true
+	}
+	cfg, ok := icfg.(*reloadConfig)
+	if !ok || !bearerAuthorized(req, cfg.Token) {
+		writeReloadResp(w, http.StatusForbidden, reloadResponse{Error: http.StatusText(http.StatusForbidden)})
+		log.Infoln("http_reload request from " + ip.String() + " with invalid token FORBIDDEN")
+		return true
+	}
+	if req.Method != http.MethodPost {
+		writeReloadResp(w, http.StatusMethodNotAllowed, reloadResponse{Error: http.StatusText(http.StatusMethodNotAllowed)})
+		return true
+	}
+
+	funcs, ok := (*d.Context).(reloadFuncs)
+	if !ok || funcs.reload == nil || funcs.reloadCerts == nil {
+		writeReloadResp(w, http.StatusInternalServerError, reloadResponse{Error: http.StatusText(http.StatusInternalServerError)})
+		log.Errorf("http_reload context '%v' type '%T' expected reloadFuncs\n", *d.Context, *d.Context)
+		return true
+	}
+
+	if req.URL.Path == ReloadCertificatesEndpoint {
+		log.Infoln("http_reload from " + ip.String() + " reloading certificates")
+		certs, err := funcs.reloadCerts()
+		if err != nil {
+			log.Errorln("http_reload from " + ip.String() + " reloading certificates, keeping existing certificates: " + err.Error())
+			writeReloadResp(w, http.StatusBadRequest, reloadResponse{Error: err.Error()})
+			return true
+		}
+		writeReloadResp(w, http.StatusOK, reloadResponse{Certificates: certs})
+		return true
+	}
+
+	log.Infoln("http_reload from " + ip.String() + " reloading config")
+	diff, err := funcs.reload()
+	if err != nil {
+		log.Errorln("http_reload from " + ip.String() + " reloading config, keeping existing config: " + err.Error())
+		writeReloadResp(w, http.StatusBadRequest, reloadResponse{Error: err.Error()})
+		return true
+	}
+	writeReloadResp(w, http.StatusOK, reloadResponse{RulesDiff: &diff})
+	return true
+}
+
+func writeReloadResp(w http.ResponseWriter, code int, resp reloadResponse) {
+	bts, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorln("http_reload marshalling response: " + err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(bts)
+}
@@ -23,8 +23,10 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
+	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/web"
 
@@ -127,9 +129,64 @@ func LoadRemapStats(stats stat.Stats, httpConns *web.ConnMap, httpsConns *web.Co
 	jsonStats["proxy.process.http.cache_capacity_bytes"] = stats.CacheCapacity()
 	jsonStats["proxy.process.http.cache_size_bytes"] = stats.CacheSize()
 
+	for rule, parents := range stats.ParentHealth() {
+		for parent, status := range parents {
+			jsonStats["plugin.parent_health."+rule+"."+parent+".available"] = status.Available
+			jsonStats["plugin.parent_health."+rule+"."+parent+".failures"] = status.Failures
+			jsonStats["plugin.parent_health."+rule+"."+parent+".check_failures"] = status.CheckFailures
+		}
+	}
+
+	for _, cert := range stats.System().Certificates() {
+		jsonStats["plugin.certificates."+cert.Name+".not_after"] = cert.NotAfter.Unix()
+		jsonStats["plugin.certificates."+cert.Name+".seconds_remaining"] = int64(time.Until(cert.NotAfter).Seconds())
+	}
+
+	siblings := stats.System().Siblings()
+	jsonStats["plugin.siblings.lookups"] = siblings.Lookups
+	jsonStats["plugin.siblings.hits"] = siblings.Hits
+	jsonStats["plugin.siblings.fetched"] = siblings.Fetched
+
+	for rule, limits := range stats.RateLimits() {
+		jsonStats["plugin.rate_limit."+rule+".allowed"] = limits.Allowed
+		jsonStats["plugin.rate_limit."+rule+".exempt"] = limits.Exempt
+		jsonStats["plugin.rate_limit."+rule+".client_limited"] = limits.ClientLimited
+		jsonStats["plugin.rate_limit."+rule+".rule_limited"] = limits.RuleLimited
+		jsonStats["plugin.rate_limit."+rule+".clients"] = limits.Clients
+		jsonStats["plugin.rate_limit."+rule+".overflowed"] = limits.Overflowed
+	}
+
+	for _, cacheName := range stats.CacheNames() {
+		cacheStats, ok := stats.CacheStatsByName(cacheName)
+		if !ok {
+			continue
+		}
+		statsName := cacheName
+		if statsName == "" {
+			statsName = DefaultCacheStatsName
+		}
+		addCacheStats(jsonStats, "plugin.cache_stats."+statsName, cacheStats)
+		if first, second, ok := stats.CacheTierStatsByName(cacheName); ok {
+			addCacheStats(jsonStats, "plugin.cache_stats."+statsName+".mem", first)
+			addCacheStats(jsonStats, "plugin.cache_stats."+statsName+".disk", second)
+		}
+	}
+
 	return jsonStats
 }
 
+// DefaultCacheStatsName is the name in stats of the default memory cache, used by remap rules without a cache_name.
+const DefaultCacheStatsName = "default"
+
+// addCacheStats adds the request and admission stats of a cache to jsonStats, with the given key prefix.
+func addCacheStats(jsonStats map[string]interface{}, prefix string, s icache.Stats) {
+	jsonStats[prefix+".hits"] = s.Hits
+	jsonStats[prefix+".misses"] = s.Misses
+	jsonStats[prefix+".hit_ratio"] = s.HitRatio()
+	jsonStats[prefix+".admitted"] = s.Admitted
+	jsonStats[prefix+".rejected"] = s.Rejected
+}
+
 func loadFileAndLog(filename string) string {
 	f, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -17,6 +17,7 @@ package plugin
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path"
@@ -27,7 +28,9 @@ import (
 
 	"github.com/apache/trafficcontrol/grove/cachedata"
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/certstore"
 	"github.com/apache/trafficcontrol/grove/config"
+	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/stat"
 	"github.com/apache/trafficcontrol/grove/web"
@@ -58,6 +61,12 @@ type StartupData struct {
 	Context *interface{}
 	// Shared is the "plugins_shared" data for all rules. This is a `map[ruleName][key]value`. Keys and values are arbitrary data. This allows plugins to do pre-processing on the config, and store computed data in the context, to save processing during requests.
 	Shared map[string]map[string]json.RawMessage
+	// RemapRules are the remap rules being started with.
+	RemapRules []remapdata.RemapRule
+	// Reload reloads the config and remap rules, as if the service were sent a SIGHUP, and returns the difference between the old and new rules. If the new config or rules are invalid, an error is returned, and the running config is kept.
+	Reload func() (remapdata.RulesDiff, error)
+	// ReloadCertificates reloads the TLS certificates of the config and remap rules from disk, and returns the certificates now being served. If any certificate is invalid, an error is returned, and the running certificates are kept.
+	ReloadCertificates func() ([]certstore.Info, error)
 }
 
 type OnRequestData struct {
@@ -69,7 +78,9 @@ type OnRequestData struct {
 	HTTPConns     *web.ConnMap
 	HTTPSConns    *web.ConnMap
 	RequestID     uint64
-	Context       *interface{}
+	// RemapRule is the name of the remap rule matching the request, or empty if no rule matches, or the client isn't allowed by the rule.
+	RemapRule string
+	Context   *interface{}
 	cachedata.SrvrData
 }
 
@@ -81,22 +92,28 @@ type BeforeParentRequestData struct {
 
 // BeforeRespondData holds the data passed to plugins. The objects pointed to MAY NOT be modified, however, the location pointed to may be changed for the Code, Hdr, and Body. That iss, `*d.Hdr = myHdr` is ok, but `d.Hdr.Add("a", "b") is not.
 // If that's confusing, recall `http.Header` is a map, therefore Hdr and Body are both pointers-to-pointers.
+// The Body is a reader, which streams the object as it's fetched or read from the cache. Plugins which change the body should wrap it in a new reader, rather than reading it all, so large objects aren't buffered in memory.
 type BeforeRespondData struct {
 	Req *http.Request
 	// CacheObj is the object to be cached, containing information about the origin request. The code, headers, and body should not be considered authoritative. Look at Code, Hdr, and Body instead, as the actual values about to be sent. Note CacheObj may be nil, if an error occurred (e.g. the Origin failed to respond).
 	CacheObj  *cacheobj.CacheObj
 	Code      *int
 	Hdr       *http.Header
-	Body      *[]byte
+	Body      *io.Reader
 	RemapRule string
-	Context   *interface{}
+	// Cache is the cache of the remap rule, in which plugins may cache their own objects, such as transformed variants of the response.
+	Cache icache.Cache
+	// CacheKey is the cache key of the request, after any changes by BeforeCacheLookup plugins. If the object has a Vary header, this is its primary key.
+	CacheKey string
+	Context  *interface{}
 }
 
 type BeforeCacheLookUpData struct {
 	Req                  *http.Request
 	CacheKeyOverrideFunc func(string)
-	DefaultCacheKey      string
-	Context              *interface{}
+	// DefaultCacheKey is the cache key, including any changes by plugins called before this one.
+	DefaultCacheKey string
+	Context         *interface{}
 }
 
 type AfterRespondData struct {
@@ -197,6 +214,12 @@ func (ps pluginsSlice) OnRequest(cfgs map[string]interface{}, context map[string
 }
 
 func (ps pluginsSlice) OnBeforeCacheLookup(cfgs map[string]interface{}, context map[string]*interface{}, d BeforeCacheLookUpData) {
+	// plugins called later are given the key overridden by plugins called before, so multiple plugins may change the key.
+	override := d.CacheKeyOverrideFunc
+	d.CacheKeyOverrideFunc = func(key string) {
+		override(key)
+		d.DefaultCacheKey = key
+	}
 	for _, p := range ps {
 		if p.funcs.beforeCacheLookUp == nil {
 			continue
@@ -18,6 +18,8 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"sort"
 	"strconv"
@@ -149,6 +151,9 @@ func rangeReqHandleBeforeRespond(icfg interface{}, d BeforeRespondData) {
 	if cfg.Mode == "store_ranges" {
 		return // no need to do anything here.
 	}
+	if *d.Body == nil {
+		return // e.g. a 304 from if_modified_since
+	}
 
 	// mode != store_ranges
 	multipartBoundaryString := cfg.MultiPartBoundary
@@ -164,7 +169,7 @@ func rangeReqHandleBeforeRespond(icfg interface{}, d BeforeRespondData) {
 	if err != nil {
 		log.Errorf("Invalid Content-Length header: %v\n", d.Hdr.Get("Content-Length"))
 	}
-	body := make([]byte, 0)
+	ranges := make([]byteRange, 0, len(ctx))
 	for _, thisRange := range ctx {
 		if thisRange.End == MAXINT64 || thisRange.End >= totalContentLength { // if the end range is "", or too large serve until the end
 			thisRange.End = totalContentLength - 1
@@ -173,28 +178,63 @@ func rangeReqHandleBeforeRespond(icfg interface{}, d BeforeRespondData) {
 			thisRange.Start = totalContentLength - thisRange.End
 			thisRange.End = totalContentLength - 1
 		}
+		if thisRange.Start < 0 || thisRange.Start > thisRange.End {
+			log.Errorf("range_req_handler: skipping unsatisfiable range %d-%d of %d bytes\n", thisRange.Start, thisRange.End, totalContentLength)
+			continue
+		}
+		ranges = append(ranges, thisRange)
+	}
+	// the body is streamed, so the ranges must be read in order
+	ranges = collapseRanges(ranges)
 
+	body := *d.Body
+	readers := make([]io.Reader, 0, len(ranges)*2+1)
+	contentLength := int64(0)
+	pos := int64(0)
+	for _, thisRange := range ranges {
 		rangeString := "bytes " + strconv.FormatInt(thisRange.Start, 10) + "-" + strconv.FormatInt(thisRange.End, 10)
 		log.Debugf("range:%d-%d\n", thisRange.Start, thisRange.End)
 		if multipart {
-			body = append(body, []byte("\r\n--"+multipartBoundaryString+"\r\n")...)
-			body = append(body, []byte("Content-type: "+originalContentType+"\r\n")...)
-			body = append(body, []byte("Content-range: "+rangeString+"/"+strconv.FormatInt(totalContentLength, 10)+"\r\n\r\n")...)
+			part := "\r\n--" + multipartBoundaryString + "\r\n" +
+				"Content-type: " + originalContentType + "\r\n" +
+				"Content-range: " + rangeString + "/" + strconv.FormatInt(totalContentLength, 10) + "\r\n\r\n"
+			readers = append(readers, strings.NewReader(part))
+			contentLength += int64(len(part))
 		} else {
 			d.Hdr.Add("Content-Range", rangeString+"/"+strconv.FormatInt(totalContentLength, 10))
 		}
-		bSlice := (*d.Body)[thisRange.Start : thisRange.End+1]
-		body = append(body, bSlice...)
+		rangeLen := thisRange.End - thisRange.Start + 1
+		readers = append(readers, io.LimitReader(&skipReader{r: body, skip: thisRange.Start - pos}, rangeLen))
+		contentLength += rangeLen
+		pos = thisRange.End + 1
 	}
 	if multipart {
-		body = append(body, []byte("\r\n--"+multipartBoundaryString+"--\r\n")...)
+		end := "\r\n--" + multipartBoundaryString + "--\r\n"
+		readers = append(readers, strings.NewReader(end))
+		contentLength += int64(len(end))
 	}
-	d.Hdr.Set("Content-Length", strconv.Itoa(len(body)))
-	*d.Body = body
+	d.Hdr.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+	*d.Body = io.MultiReader(readers...)
 	*d.Code = http.StatusPartialContent
 	return
 }
 
+// skipReader discards skip bytes of r before the first read, so ranges of a streamed body can be read in order without buffering it.
+type skipReader struct {
+	r    io.Reader
+	skip int64
+}
+
+func (s *skipReader) Read(p []byte) (int, error) {
+	if s.skip > 0 {
+		if _, err := io.CopyN(ioutil.Discard, s.r, s.skip); err != nil {
+			return 0, err
+		}
+		s.skip = 0
+	}
+	return s.r.Read(p)
+}
+
 func parseRange(rangeString string) (byteRange, error) {
 	parts := strings.Split(rangeString, "-")
 
@@ -242,6 +282,15 @@ func parseRangeHeader(rHdrVal string) []byteRange {
 		return byteRanges
 	}
 
+	return collapseRanges(byteRanges)
+}
+
+// collapseRanges sorts the given ranges by Start, and combines overlapping ranges.
+func collapseRanges(byteRanges []byteRange) []byteRange {
+	if len(byteRanges) <= 1 {
+		return byteRanges
+	}
+
 	// Collapse overlapping byte range requests, first sort the array by Start
 	sort.Slice(byteRanges, func(i, j int) bool {
 		return byteRanges[i].Start < byteRanges[j].Start
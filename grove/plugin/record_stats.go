@@ -19,5 +19,5 @@ func init() {
 }
 
 func recordStats(icfg interface{}, d AfterRespondData) {
-	d.Stats.Write(d.W, d.Conn, d.Req.Host, d.Req.RemoteAddr, d.RespCode, d.BytesWritten, d.CacheHit)
+	d.Stats.Write(d.W, d.Conn, d.StatsKey, d.Req.RemoteAddr, d.RespCode, d.BytesWritten, d.CacheHit)
 }
@@ -0,0 +1,199 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func init() {
+	AddPlugin(1000, Funcs{load: uriSigningLoad, onRequest: uriSigning, beforeCacheLookUp: uriSigningBeforeCacheLookUp})
+}
+
+// URISigningPackageParam is the query parameter or cookie with the URI signing JWT, as with ATS uri_signing.
+const URISigningPackageParam = "URISigningPackage"
+
+// URISigningVersion is the only supported cdniv claim, of draft-ietf-cdni-uri-signing.
+const URISigningVersion = 1
+
+const uriSigningContainerRegexPrefix = "regex:"
+
+// uriSigningIssuerJSON is the keys of an issuer in the ATS uri_signing config, as generated by Traffic Ops.
+type uriSigningIssuerJSON struct {
+	RenewalKID string              `json:"renewal_kid"`
+	Keys       []uriSigningKeyJSON `json:"keys"`
+}
+
+// uriSigningKeyJSON is a JSON Web Key.
+type uriSigningKeyJSON struct {
+	Alg string `json:"alg"`
+	KID string `json:"kid"`
+	KTY string `json:"kty"`
+	K   string `json:"k"`
+}
+
+// uriSigningIssuer is an issuer's keys, and their decoded secrets. It marshals as the config it was loaded from.
+type uriSigningIssuer struct {
+	uriSigningIssuerJSON
+	secrets [][]byte // the decoded K of each of Keys
+}
+
+// uriSigningConfig is the keys of each issuer.
+type uriSigningConfig map[string]uriSigningIssuer
+
+func uriSigningLoad(b json.RawMessage) interface{} {
+	issuers := map[string]uriSigningIssuerJSON{}
+	if err := json.Unmarshal(b, &issuers); err != nil {
+		log.Errorln("uri_signing loading config, unmarshalling JSON: " + err.Error())
+		return nil
+	}
+	cfg := uriSigningConfig{}
+	for name, issuerJSON := range issuers {
+		issuer := uriSigningIssuer{uriSigningIssuerJSON: issuerJSON}
+		for _, key := range issuerJSON.Keys {
+			if key.KTY != "oct" {
+				log.Errorln("uri_signing loading config: issuer '" + name + "' key '" + key.KID + "' type '" + key.KTY + "' not supported, must be oct")
+				return nil
+			}
+			if method := jwt.GetSigningMethod(key.Alg); method == nil || !strings.HasPrefix(key.Alg, "HS") {
+				log.Errorln("uri_signing loading config: issuer '" + name + "' key '" + key.KID + "' algorithm '" + key.Alg + "' not supported, must be HS256, HS384, or HS512")
+				return nil
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(key.K, "="))
+			if err != nil {
+				log.Errorln("uri_signing loading config: issuer '" + name + "' key '" + key.KID + "' decoding base64url: " + err.Error())
+				return nil
+			}
+			issuer.secrets = append(issuer.secrets, secret)
+		}
+		if len(issuer.Keys) > 0 {
+			cfg[name] = issuer
+		}
+	}
+	if len(cfg) == 0 {
+		log.Errorln("uri_signing loading config: no keys")
+		return nil
+	}
+	return cfg
+}
+
+// uriSigning rejects requests to rules with uri_signing keys whose JWT is missing, invalid, or expired, or doesn't allow the requested URI, with a 403.
+func uriSigning(icfg interface{}, d OnRequestData) bool {
+	cfg, ok := icfg.(uriSigningConfig)
+	if !ok {
+		return false // the rule isn't signed
+	}
+	token := d.R.URL.Query().Get(URISigningPackageParam)
+	if token == "" {
+		if cookie, err := d.R.Cookie(URISigningPackageParam); err == nil {
+			token = cookie.Value
+		}
+	}
+	uri := d.Scheme + "://" + d.R.Host + d.R.URL.EscapedPath()
+	if query := removeQueryParams(d.R.URL.RawQuery, isURISigningParam); query != "" {
+		uri += "?" + query
+	}
+	if err := validateURISigning(cfg, token, uri, time.Now()); err != nil {
+		ip, _ := web.GetIP(d.R)
+		log.Infof("uri_signing rule '%v' request '%v' from %v FORBIDDEN: %v\n", d.RemapRule, d.R.RequestURI, ip, err)
+		d.W.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// uriSigningBeforeCacheLookUp removes the JWT from the cache key, so every signed URI of an object uses the same cached object.
+func uriSigningBeforeCacheLookUp(icfg interface{}, d BeforeCacheLookUpData) {
+	if _, ok := icfg.(uriSigningConfig); !ok {
+		return
+	}
+	d.CacheKeyOverrideFunc(removeCacheKeyQueryParams(d.DefaultCacheKey, isURISigningParam))
+}
+
+func isURISigningParam(name string) bool { return name == URISigningPackageParam }
+
+// validateURISigning returns an error if the token isn't a valid JWT signed by a key of its issuer, or its claims don't allow the given URI, which must not include the token, at the given time.
+func validateURISigning(cfg uriSigningConfig, tokenStr string, uri string, now time.Time) error {
+	if tokenStr == "" {
+		return errors.New("missing " + URISigningPackageParam)
+	}
+	claims := jwt.MapClaims{}
+	token, parts, err := new(jwt.Parser).ParseUnverified(tokenStr, claims)
+	if err != nil {
+		return errors.New("parsing JWT: " + err.Error())
+	}
+	issuerName, _ := claims["iss"].(string)
+	issuer, ok := cfg[issuerName]
+	if !ok {
+		return errors.New("unknown issuer '" + issuerName + "'")
+	}
+	kid, _ := token.Header["kid"].(string)
+	signingString := strings.Join(parts[:2], ".")
+	verified := false
+	for i, key := range issuer.Keys {
+		if key.Alg != token.Method.Alg() || (kid != "" && key.KID != kid) {
+			continue
+		}
+		if err := token.Method.Verify(signingString, parts[2], issuer.secrets[i]); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return errors.New("invalid signature")
+	}
+
+	nowUnix := now.Unix()
+	if !claims.VerifyExpiresAt(nowUnix, false) {
+		return errors.New("expired")
+	}
+	if !claims.VerifyNotBefore(nowUnix, false) {
+		return errors.New("not yet valid")
+	}
+	if _, ok := claims["cdnicrit"]; ok {
+		return errors.New("critical claims not supported")
+	}
+	if version, ok := claims["cdniv"]; ok {
+		if v, isNum := version.(float64); !isNum || v != URISigningVersion {
+			return errors.New("unsupported cdniv")
+		}
+	}
+	if container, ok := claims["cdniuc"]; ok {
+		containerStr, _ := container.(string)
+		if !strings.HasPrefix(containerStr, uriSigningContainerRegexPrefix) {
+			return errors.New("unsupported cdniuc '" + containerStr + "', only regex is supported")
+		}
+		re, err := regexp.Compile(strings.TrimPrefix(containerStr, uriSigningContainerRegexPrefix))
+		if err != nil {
+			return errors.New("compiling cdniuc regex: " + err.Error())
+		}
+		if !re.MatchString(uri) {
+			return errors.New("cdniuc doesn't match '" + uri + "'")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestValidateURISigning(t *testing.T) {
+	// k is base64url of "secret-key"
+	cfg := uriSigningLoad([]byte(`{"Kabletown URI Authority": {"renewal_kid": "k1", "keys": [{"alg": "HS256", "kid": "k0", "kty": "oct", "k": "c2VjcmV0LWtleQ"}]}}`)).(uriSigningConfig)
+	now := time.Unix(1500000000, 0)
+	uri := "http://cdn.example.net/vod/prog.m3u8"
+
+	sign := func(claims jwt.MapClaims, key string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = "k0"
+		s, err := token.SignedString([]byte(key))
+		if err != nil {
+			t.Fatalf("signing JWT: %v", err)
+		}
+		return s
+	}
+
+	claims := jwt.MapClaims{"iss": "Kabletown URI Authority", "exp": now.Unix() + 60, "cdniv": 1, "cdniuc": `regex:^http://cdn\.example\.net/vod/.*$`}
+	if err := validateURISigning(cfg, sign(claims, "secret-key"), uri, now); err != nil {
+		t.Errorf("validateURISigning expected nil error, actual %v", err)
+	}
+	if err := validateURISigning(cfg, sign(claims, "wrong-key"), uri, now); err == nil {
+		t.Errorf("validateURISigning with the wrong key expected error, actual nil")
+	}
+	if err := validateURISigning(cfg, sign(claims, "secret-key"), uri, now.Add(2*time.Minute)); err == nil {
+		t.Errorf("validateURISigning after expiration expected error, actual nil")
+	}
+	if err := validateURISigning(cfg, sign(claims, "secret-key"), "http://cdn.example.net/live/prog.m3u8", now); err == nil {
+		t.Errorf("validateURISigning of a URI not matching cdniuc expected error, actual nil")
+	}
+	if err := validateURISigning(cfg, "", uri, now); err == nil {
+		t.Errorf("validateURISigning without a token expected error, actual nil")
+	}
+
+	claims["iss"] = "Unknown Authority"
+	if err := validateURISigning(cfg, sign(claims, "secret-key"), uri, now); err == nil {
+		t.Errorf("validateURISigning with an unknown issuer expected error, actual nil")
+	}
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"iss": "Kabletown URI Authority"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("signing JWT: %v", err)
+	}
+	if err := validateURISigning(cfg, none, uri, now); err == nil {
+		t.Errorf("validateURISigning with alg none expected error, actual nil")
+	}
+}
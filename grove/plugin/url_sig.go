@@ -0,0 +1,232 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/web"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+func init() {
+	AddPlugin(1000, Funcs{load: urlSigLoad, onRequest: urlSig, beforeCacheLookUp: urlSigBeforeCacheLookUp})
+}
+
+// The query parameters of ATS url_sig signed URLs.
+const (
+	URLSigClientParam    = "C"
+	URLSigExpiresParam   = "E"
+	URLSigAlgorithmParam = "A"
+	URLSigKeyIndexParam  = "K"
+	URLSigPartsParam     = "P"
+	URLSigSignatureParam = "S"
+)
+
+const URLSigAlgorithmSHA1 = "1"
+const URLSigAlgorithmMD5 = "2"
+
+// URLSigMaxKeys is the number of url_sig keys a rule may have, named key0 through key15.
+const URLSigMaxKeys = 16
+
+const urlSigKeyNamePrefix = "key"
+
+// urlSigConfig is the keys of a remap rule, by index. The config is an object of "key0" through "key15", as in the ATS url_sig config and the Traffic Ops url_sig keys.
+type urlSigConfig map[string]string
+
+func urlSigLoad(b json.RawMessage) interface{} {
+	keys := map[string]string{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		log.Errorln("url_sig loading config, unmarshalling JSON: " + err.Error())
+		return nil
+	}
+	cfg := urlSigConfig{}
+	for name, key := range keys {
+		i, err := strconv.Atoi(strings.TrimPrefix(name, urlSigKeyNamePrefix))
+		if !strings.HasPrefix(name, urlSigKeyNamePrefix) || err != nil || i < 0 || i >= URLSigMaxKeys {
+			log.Errorln("url_sig loading config: invalid key name '" + name + "', must be key0 through key15")
+			return nil
+		}
+		if key == "" {
+			continue
+		}
+		cfg[strconv.Itoa(i)] = key
+	}
+	if len(cfg) == 0 {
+		log.Errorln("url_sig loading config: no keys")
+		return nil
+	}
+	return cfg
+}
+
+// urlSig rejects requests to rules with url_sig keys whose signature is missing, invalid, or expired, with a 403.
+func urlSig(icfg interface{}, d OnRequestData) bool {
+	cfg, ok := icfg.(urlSigConfig)
+	if !ok {
+		return false // the rule isn't signed
+	}
+	ip, err := web.GetIP(d.R)
+	if err != nil {
+		log.Errorln("url_sig failed to get IP: " + err.Error())
+		d.W.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	hostPath := d.R.Host + d.R.URL.EscapedPath()
+	if err := validateURLSig(cfg, hostPath, d.R.URL.RawQuery, ip, time.Now()); err != nil {
+		log.Infof("url_sig rule '%v' request '%v' from %v FORBIDDEN: %v\n", d.RemapRule, d.R.RequestURI, ip, err)
+		d.W.WriteHeader(http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// urlSigBeforeCacheLookUp removes the signing parameters from the cache key, so every signed URL of an object uses the same cached object.
+func urlSigBeforeCacheLookUp(icfg interface{}, d BeforeCacheLookUpData) {
+	if _, ok := icfg.(urlSigConfig); !ok {
+		return
+	}
+	d.CacheKeyOverrideFunc(removeCacheKeyQueryParams(d.DefaultCacheKey, isURLSigParam))
+}
+
+func isURLSigParam(name string) bool {
+	switch name {
+	case URLSigClientParam, URLSigExpiresParam, URLSigAlgorithmParam, URLSigKeyIndexParam, URLSigPartsParam, URLSigSignatureParam:
+		return true
+	}
+	return false
+}
+
+// validateURLSig returns an error if the URL with the given host and path, without the scheme, and query isn't validly signed by the key of its K parameter, for the client IP at the given time.
+//
+// As with ATS url_sig, the signature is the hex HMAC of the parts of the host and path selected by the P parameter, joined with '/', then '?', then the query up to and including "S=".
+func validateURLSig(keys urlSigConfig, hostPath string, rawQuery string, clientIP net.IP, now time.Time) error {
+	params := map[string]string{}
+	signedQueryLen := -1
+	for i := 0; i < len(rawQuery); {
+		end := strings.Index(rawQuery[i:], "&")
+		if end == -1 {
+			end = len(rawQuery)
+		} else {
+			end += i
+		}
+		name, val := rawQuery[i:end], ""
+		if eq := strings.Index(name, "="); eq != -1 {
+			name, val = name[:eq], name[eq+1:]
+		}
+		if _, ok := params[name]; !ok && isURLSigParam(name) {
+			params[name] = val
+			if name == URLSigSignatureParam {
+				signedQueryLen = i + len(URLSigSignatureParam+"=")
+			}
+		}
+		i = end + 1
+	}
+	for _, name := range []string{URLSigExpiresParam, URLSigAlgorithmParam, URLSigKeyIndexParam, URLSigPartsParam, URLSigSignatureParam} {
+		if params[name] == "" {
+			return errors.New("missing " + name + " parameter")
+		}
+	}
+
+	if expires, err := strconv.ParseInt(params[URLSigExpiresParam], 10, 64); err != nil {
+		return errors.New("malformed " + URLSigExpiresParam + " parameter")
+	} else if now.Unix() > expires {
+		return errors.New("expired at " + time.Unix(expires, 0).Format(time.RFC3339))
+	}
+	if client := params[URLSigClientParam]; client != "" && !net.ParseIP(client).Equal(clientIP) {
+		return errors.New("client IP doesn't match " + client)
+	}
+
+	newHash := (func() hash.Hash)(nil)
+	switch params[URLSigAlgorithmParam] {
+	case URLSigAlgorithmSHA1:
+		newHash = sha1.New
+	case URLSigAlgorithmMD5:
+		newHash = md5.New
+	default:
+		return errors.New("unknown algorithm " + params[URLSigAlgorithmParam])
+	}
+	key, ok := keys[params[URLSigKeyIndexParam]]
+	if !ok {
+		return errors.New("no key " + params[URLSigKeyIndexParam])
+	}
+	sig, err := hex.DecodeString(params[URLSigSignatureParam])
+	if err != nil {
+		return errors.New("malformed " + URLSigSignatureParam + " parameter")
+	}
+
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write([]byte(urlSigSignedParts(hostPath, params[URLSigPartsParam]) + "?" + rawQuery[:signedQueryLen]))
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// urlSigSignedParts returns the parts of the host and path which are signed, joined with '/'. Each character of parts is '1' if the corresponding part of the host and path is signed, and '0' if not; the last character applies to all remaining parts.
+func urlSigSignedParts(hostPath string, parts string) string {
+	signed := []string{}
+	j := 0
+	for _, part := range strings.Split(hostPath, "/") {
+		if part == "" {
+			continue
+		}
+		if parts[j] == '1' {
+			signed = append(signed, part)
+		}
+		if j+1 < len(parts) && (parts[j+1] == '0' || parts[j+1] == '1') {
+			j++
+		}
+	}
+	return strings.Join(signed, "/")
+}
+
+// removeCacheKeyQueryParams returns the cache key without the query parameters for which remove returns true.
+func removeCacheKeyQueryParams(key string, remove func(name string) bool) string {
+	i := strings.Index(key, "?")
+	if i == -1 {
+		return key
+	}
+	if query := removeQueryParams(key[i+1:], remove); query != "" {
+		return key[:i+1] + query
+	}
+	return key[:i]
+}
+
+// removeQueryParams returns the raw query without the parameters for which remove returns true.
+func removeQueryParams(rawQuery string, remove func(name string) bool) string {
+	kept := []string{}
+	for _, param := range strings.Split(rawQuery, "&") {
+		name := param
+		if eq := strings.Index(param, "="); eq != -1 {
+			name = param[:eq]
+		}
+		if param != "" && !remove(name) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
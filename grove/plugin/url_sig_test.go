@@ -0,0 +1,68 @@
+package plugin
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValidateURLSig(t *testing.T) {
+	keys := urlSigLoad([]byte(`{"key0": "foo", "key3": "bar"}`)).(urlSigConfig)
+	now := time.Unix(1500000000, 0)
+	clientIP := net.ParseIP("192.0.2.1")
+	hostPath := "cdn.example.net/vod/t/prog.m3u8"
+
+	sign := func(signed string, key string) string {
+		mac := hmac.New(sha1.New, []byte(key))
+		mac.Write([]byte(signed))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	query := "x=1&C=192.0.2.1&E=" + strconv.FormatInt(now.Unix()+60, 10) + "&A=1&K=3&P=1&S="
+	query += sign(hostPath+"?"+query, "bar")
+	if err := validateURLSig(keys, hostPath, query, clientIP, now); err != nil {
+		t.Errorf("validateURLSig expected nil error, actual %v", err)
+	}
+	if err := validateURLSig(keys, hostPath, query, net.ParseIP("192.0.2.2"), now); err == nil {
+		t.Errorf("validateURLSig with a different client IP expected error, actual nil")
+	}
+	if err := validateURLSig(keys, hostPath, query, clientIP, now.Add(2*time.Minute)); err == nil {
+		t.Errorf("validateURLSig after expiration expected error, actual nil")
+	}
+	if err := validateURLSig(keys, "cdn.example.net/vod/t/other.m3u8", query, clientIP, now); err == nil {
+		t.Errorf("validateURLSig of a different path expected error, actual nil")
+	}
+
+	// P=101 signs the host and the 2nd path part onward, so the 1st path part may change.
+	query = "E=" + strconv.FormatInt(now.Unix()+60, 10) + "&A=1&K=0&P=101&S="
+	query += sign("cdn.example.net/t/prog.m3u8?"+query, "foo")
+	if err := validateURLSig(keys, "cdn.example.net/live/t/prog.m3u8", query, clientIP, now); err != nil {
+		t.Errorf("validateURLSig with unsigned parts expected nil error, actual %v", err)
+	}
+	if err := validateURLSig(keys, "cdn.example.net/live/t/prog.m3u8", "E=1&A=1&K=0&P=1", clientIP, now); err == nil {
+		t.Errorf("validateURLSig without a signature expected error, actual nil")
+	}
+
+	expected := "GET:http://origin.example.net/vod/t/prog.m3u8?x=1"
+	if actual := removeCacheKeyQueryParams("GET:http://origin.example.net/vod/t/prog.m3u8?x=1&"+query, isURLSigParam); actual != expected {
+		t.Errorf("removeCacheKeyQueryParams expected '%v' actual '%v'", expected, actual)
+	}
+}
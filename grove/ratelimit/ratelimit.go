@@ -0,0 +1,298 @@
+package ratelimit
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultClientPrefixV4 = 32
+const DefaultClientPrefixV6 = 64 // the smallest network typically assigned to a single IPv6 subscriber
+const DefaultMaxClients = 100000
+const DefaultCode = http.StatusTooManyRequests
+
+// SweepInterval is how often client buckets which have refilled, and so are no different than new buckets, are removed.
+const SweepInterval = time.Minute
+
+// sweepBatch is the number of client buckets checked by each request once a sweep is due, so no request holds the lock to check them all.
+const sweepBatch = 64
+
+// Config is the rate limiting configuration of a remap rule.
+type Config struct {
+	// RequestsPerSecond is the rate of requests permitted to the rule from all clients. If 0, the rule isn't limited.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst is the number of requests to the rule permitted at once. If 0, it's RequestsPerSecond, rounded up.
+	Burst int `json:"burst"`
+	// ClientRequestsPerSecond is the rate of requests to the rule permitted from each client. If 0, clients aren't limited.
+	ClientRequestsPerSecond float64 `json:"client_requests_per_second"`
+	// ClientBurst is the number of requests to the rule permitted at once from each client. If 0, it's ClientRequestsPerSecond, rounded up.
+	ClientBurst int `json:"client_burst"`
+	// ClientPrefixV4 is the prefix length of the IPv4 networks clients are limited by. Clients in the same network share a limit. If 0, each address is limited.
+	ClientPrefixV4 int `json:"client_prefix_v4"`
+	// ClientPrefixV6 is the prefix length of the IPv6 networks clients are limited by. If 0, each /64 network is limited.
+	ClientPrefixV6 int `json:"client_prefix_v6"`
+	// MaxClients is the number of clients whose limits are tracked. New clients beyond it share a single client limit, until tracked clients' buckets refill and are removed. If 0, it's DefaultMaxClients.
+	MaxClients int `json:"max_clients"`
+	// Allow is the CIDRs of clients which aren't limited, by either the client or rule limit.
+	Allow []string `json:"allow"`
+	// Code is the response code of limited requests, 429 or 503. If 0, 429.
+	Code int `json:"code"`
+
+	allow []*net.IPNet
+}
+
+// Validate returns an error if the config is invalid, and sets defaults for unset values.
+func (c *Config) Validate() error {
+	if c.RequestsPerSecond < 0 || c.Burst < 0 || c.ClientRequestsPerSecond < 0 || c.ClientBurst < 0 || c.MaxClients < 0 {
+		return errors.New("values must not be negative")
+	}
+	if c.ClientPrefixV4 < 0 || c.ClientPrefixV4 > 32 {
+		return errors.New("client_prefix_v4 must be between 0 and 32")
+	}
+	if c.ClientPrefixV6 < 0 || c.ClientPrefixV6 > 128 {
+		return errors.New("client_prefix_v6 must be between 0 and 128")
+	}
+	if c.Code != 0 && c.Code != http.StatusTooManyRequests && c.Code != http.StatusServiceUnavailable {
+		return errors.New("code must be 429 or 503")
+	}
+	if c.Burst == 0 {
+		c.Burst = int(math.Ceil(c.RequestsPerSecond))
+	}
+	if c.ClientBurst == 0 {
+		c.ClientBurst = int(math.Ceil(c.ClientRequestsPerSecond))
+	}
+	if c.ClientPrefixV4 == 0 {
+		c.ClientPrefixV4 = DefaultClientPrefixV4
+	}
+	if c.ClientPrefixV6 == 0 {
+		c.ClientPrefixV6 = DefaultClientPrefixV6
+	}
+	if c.MaxClients == 0 {
+		c.MaxClients = DefaultMaxClients
+	}
+	if c.Code == 0 {
+		c.Code = DefaultCode
+	}
+	c.allow = nil
+	for _, cidr := range c.Allow {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.New("parsing allow '" + cidr + "': " + err.Error())
+		}
+		c.allow = append(c.allow, network)
+	}
+	return nil
+}
+
+// Stats are the counts of a Limiter's requests.
+type Stats struct {
+	Allowed uint64
+	// Exempt is the number of requests from clients in the Allow networks.
+	Exempt        uint64
+	ClientLimited uint64
+	RuleLimited   uint64
+	// Clients is the number of clients currently tracked.
+	Clients int
+	// Overflowed is the number of requests from new clients when MaxClients were already tracked, which shared the overflow client limit.
+	Overflowed uint64
+}
+
+// Limiter limits the rate of requests to a remap rule, from all clients and from each client, with token buckets.
+//
+// A nil *Limiter allows all requests.
+type Limiter struct {
+	cfg     Config
+	rule    *bucket
+	clients map[string]*bucket
+	// keys is the keys of clients, in no particular order, which are swept from sweepIdx, sweepBatch at a time.
+	keys          []string
+	sweepIdx      int
+	sweeping      bool
+	lastSweep     time.Time
+	overflow      *bucket // the bucket shared by new clients when MaxClients are tracked
+	m             sync.Mutex
+	allowed       uint64
+	exempt        uint64
+	clientLimited uint64
+	ruleLimited   uint64
+	overflowed    uint64
+}
+
+// New creates a new Limiter. The config must have been validated.
+func New(cfg Config) *Limiter {
+	l := &Limiter{cfg: cfg, clients: map[string]*bucket{}, lastSweep: time.Now()}
+	if cfg.RequestsPerSecond > 0 {
+		l.rule = newBucket(cfg.RequestsPerSecond, cfg.Burst, time.Now())
+	}
+	return l
+}
+
+// Code returns the response code for limited requests.
+func (l *Limiter) Code() int {
+	return l.cfg.Code
+}
+
+// Allow returns whether a request from the given client IP is permitted, and if not, how long until it would be.
+func (l *Limiter) Allow(ip net.IP) (bool, time.Duration) {
+	return l.allow(ip, true)
+}
+
+// AllowPeer is Allow for requests from peer caches, such as siblings, which are only limited by the rule limit, not the client limit, because a peer's requests are on behalf of all its own clients.
+func (l *Limiter) AllowPeer(ip net.IP) (bool, time.Duration) {
+	return l.allow(ip, false)
+}
+
+func (l *Limiter) allow(ip net.IP, limitClient bool) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	for _, network := range l.cfg.allow {
+		if network.Contains(ip) {
+			atomic.AddUint64(&l.exempt, 1)
+			return true, 0
+		}
+	}
+
+	now := time.Now()
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.sweeping || now.Sub(l.lastSweep) >= SweepInterval {
+		l.sweep(now)
+	}
+
+	client := (*bucket)(nil)
+	if limitClient && l.cfg.ClientRequestsPerSecond > 0 {
+		client = l.client(l.clientKey(ip), now)
+		if wait := client.wait(now); wait > 0 {
+			atomic.AddUint64(&l.clientLimited, 1)
+			return false, wait
+		}
+	}
+	if l.rule != nil {
+		if wait := l.rule.wait(now); wait > 0 {
+			atomic.AddUint64(&l.ruleLimited, 1)
+			return false, wait
+		}
+		l.rule.tokens--
+	}
+	if client != nil {
+		client.tokens--
+	}
+	atomic.AddUint64(&l.allowed, 1)
+	return true, 0
+}
+
+// Stats returns the counts of the limiter's requests.
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{}
+	}
+	l.m.Lock()
+	clients := len(l.clients)
+	l.m.Unlock()
+	return Stats{
+		Allowed:       atomic.LoadUint64(&l.allowed),
+		Exempt:        atomic.LoadUint64(&l.exempt),
+		ClientLimited: atomic.LoadUint64(&l.clientLimited),
+		RuleLimited:   atomic.LoadUint64(&l.ruleLimited),
+		Clients:       clients,
+		Overflowed:    atomic.LoadUint64(&l.overflowed),
+	}
+}
+
+// client returns the bucket of the client with the given key, creating it if it doesn't exist. If MaxClients are already tracked, the overflow bucket is returned. It must be called with the limiter locked.
+func (l *Limiter) client(key string, now time.Time) *bucket {
+	if b := l.clients[key]; b != nil {
+		return b
+	}
+	if len(l.clients) >= l.cfg.MaxClients {
+		atomic.AddUint64(&l.overflowed, 1)
+		if l.overflow == nil {
+			l.overflow = newBucket(l.cfg.ClientRequestsPerSecond, l.cfg.ClientBurst, now)
+		}
+		return l.overflow
+	}
+	b := newBucket(l.cfg.ClientRequestsPerSecond, l.cfg.ClientBurst, now)
+	l.clients[key] = b
+	l.keys = append(l.keys, key)
+	return b
+}
+
+// clientKey returns the key of the client's bucket, which is its network of the configured prefix length.
+func (l *Limiter) clientKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(l.cfg.ClientPrefixV4, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(l.cfg.ClientPrefixV6, 128)).String()
+}
+
+// sweep removes the next sweepBatch client buckets which have refilled. Each request continues the sweep until every bucket has been checked, so the work is spread over requests. It must be called with the limiter locked.
+func (l *Limiter) sweep(now time.Time) {
+	l.sweeping = true
+	for n := 0; n < sweepBatch && l.sweepIdx < len(l.keys); n++ {
+		key := l.keys[l.sweepIdx]
+		b := l.clients[key]
+		if b.refill(now); b.tokens < b.burst {
+			l.sweepIdx++
+			continue
+		}
+		delete(l.clients, key)
+		last := len(l.keys) - 1
+		l.keys[l.sweepIdx] = l.keys[last] // the last key is checked next
+		l.keys[last] = ""
+		l.keys = l.keys[:last]
+	}
+	if l.sweepIdx < len(l.keys) {
+		return
+	}
+	l.sweeping = false
+	l.sweepIdx = 0
+	l.lastSweep = now
+	if l.overflow != nil && len(l.clients) < l.cfg.MaxClients {
+		l.overflow = nil
+	}
+}
+
+// bucket is a token bucket. It isn't safe for concurrent use.
+type bucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait refills the bucket, and returns how long until it has a token, or 0 if it has one now. It doesn't take the token.
+func (b *bucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,197 @@
+package ratelimit
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientLimit(t *testing.T) {
+	cfg := Config{ClientRequestsPerSecond: 10, ClientBurst: 2, ClientPrefixV4: 24, Allow: []string{"10.0.0.0/8"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	l := New(cfg)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow(net.ParseIP("192.0.2.1")); !ok {
+			t.Fatalf("expected request %v within the client burst to be allowed", i)
+		}
+	}
+	ok, wait := l.Allow(net.ParseIP("192.0.2.2"))
+	if ok {
+		t.Fatalf("expected request over the client burst from the same network to be limited")
+	}
+	if wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("expected wait between 0 and 100ms, actual %v", wait)
+	}
+	if ok, _ := l.Allow(net.ParseIP("198.51.100.1")); !ok {
+		t.Errorf("expected request from another network to be allowed")
+	}
+	if ok, _ := l.Allow(net.ParseIP("10.1.2.3")); !ok {
+		t.Errorf("expected request from an allowed network to be exempt")
+	}
+
+	time.Sleep(wait + 10*time.Millisecond)
+	if ok, _ := l.Allow(net.ParseIP("192.0.2.1")); !ok {
+		t.Errorf("expected request to be allowed after waiting")
+	}
+
+	expected := Stats{Allowed: 4, Exempt: 1, ClientLimited: 1, Clients: 2}
+	if actual := l.Stats(); actual != expected {
+		t.Errorf("Stats expected %+v actual %+v", expected, actual)
+	}
+}
+
+func TestRuleLimit(t *testing.T) {
+	cfg := Config{RequestsPerSecond: 1, ClientRequestsPerSecond: 1}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	if cfg.Burst != 1 || cfg.Code != DefaultCode {
+		t.Errorf("Config.Validate expected default burst 1 and code %v, actual %v and %v", DefaultCode, cfg.Burst, cfg.Code)
+	}
+	l := New(cfg)
+
+	if ok, _ := l.Allow(net.ParseIP("2001:db8:0:1::1")); !ok {
+		t.Fatalf("expected first request to be allowed")
+	}
+	if ok, _ := l.Allow(net.ParseIP("2001:db8:0:2::1")); ok {
+		t.Errorf("expected request from another client over the rule burst to be limited")
+	}
+	// the limited request mustn't have taken the second client's token
+	if stats := l.Stats(); stats.RuleLimited != 1 || stats.ClientLimited != 0 {
+		t.Errorf("expected 1 rule limited request, actual %+v", stats)
+	}
+
+	if ok, _ := (*Limiter)(nil).Allow(net.ParseIP("192.0.2.1")); !ok {
+		t.Errorf("expected nil limiter to allow all requests")
+	}
+}
+
+func TestAllowPeer(t *testing.T) {
+	cfg := Config{RequestsPerSecond: 3, ClientRequestsPerSecond: 1}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	l := New(cfg)
+	peer := net.ParseIP("192.0.2.1")
+
+	if ok, _ := l.Allow(peer); !ok {
+		t.Fatalf("expected first request to be allowed")
+	}
+	if ok, _ := l.Allow(peer); ok {
+		t.Errorf("expected request over the client burst to be limited")
+	}
+	// peers aren't limited by the client limit, only the rule limit
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.AllowPeer(peer); !ok {
+			t.Errorf("expected peer request %v within the rule burst to be allowed", i)
+		}
+	}
+	if ok, _ := l.AllowPeer(peer); ok {
+		t.Errorf("expected peer request over the rule burst to be limited")
+	}
+	if stats := l.Stats(); stats.Allowed != 3 || stats.ClientLimited != 1 || stats.RuleLimited != 1 {
+		t.Errorf("expected 3 allowed, 1 client limited, and 1 rule limited requests, actual %+v", stats)
+	}
+}
+
+func TestClientPrefixV6Default(t *testing.T) {
+	cfg := Config{ClientRequestsPerSecond: 1}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	l := New(cfg)
+	if ok, _ := l.Allow(net.ParseIP("2001:db8:0:1::1")); !ok {
+		t.Fatalf("expected first request to be allowed")
+	}
+	if ok, _ := l.Allow(net.ParseIP("2001:db8:0:1:ffff::2")); ok {
+		t.Errorf("expected request from another address in the same /64 to be limited")
+	}
+}
+
+func TestMaxClients(t *testing.T) {
+	cfg := Config{ClientRequestsPerSecond: 1, MaxClients: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	l := New(cfg)
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		if ok, _ := l.Allow(net.ParseIP(ip)); !ok {
+			t.Fatalf("expected first request from %v to be allowed", ip)
+		}
+	}
+	// clients beyond MaxClients share the overflow limit
+	if ok, _ := l.Allow(net.ParseIP("192.0.2.4")); ok {
+		t.Errorf("expected request from a new client over MaxClients to share the overflow limit")
+	}
+	if stats := l.Stats(); stats.Clients != 2 || stats.Overflowed != 2 {
+		t.Errorf("expected 2 clients and 2 overflowed requests, actual %+v", stats)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	cfg := Config{ClientRequestsPerSecond: 1000}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Config.Validate expected nil error, actual %v", err)
+	}
+	l := New(cfg)
+	n := sweepBatch*2 + 1
+	for i := 0; i < n; i++ {
+		l.Allow(net.IPv4(10, 0, byte(i/256), byte(i%256)))
+	}
+	limited := net.ParseIP("192.0.2.1")
+	for i := 0; i < 1000; i++ {
+		l.Allow(limited)
+	}
+
+	// each request after the interval sweeps a batch, until every bucket is checked
+	l.m.Lock()
+	l.lastSweep = l.lastSweep.Add(-SweepInterval)
+	l.m.Unlock()
+	time.Sleep(10 * time.Millisecond) // the other clients' buckets refill
+	l.Allow(limited)
+	if clients := l.Stats().Clients; clients <= 1 || clients >= n {
+		t.Errorf("expected one sweep batch removed, actual %v clients of %v", clients, n+1)
+	}
+	for i := 0; i < 3; i++ {
+		l.Allow(limited)
+	}
+	if clients := l.Stats().Clients; clients != 1 {
+		t.Errorf("expected only the limited client left after sweeping, actual %v clients", clients)
+	}
+	if l.sweeping {
+		t.Errorf("expected sweep finished")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	invalid := []Config{
+		{RequestsPerSecond: -1},
+		{ClientPrefixV4: 33},
+		{ClientPrefixV6: 129},
+		{MaxClients: -1},
+		{Code: 500},
+		{Allow: []string{"not a cidr"}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Config.Validate of %+v expected error, actual nil", cfg)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+// ReloadRemapper loads and validates the remap rules at the given path, and returns a new remapper of them, and their difference from the rules of the old remapper. If the rules are invalid, an error is returned, and the old remapper may continue to be used.
+//
+// Rules which didn't change keep the parent health and rate limits of the old rule, rather than starting over. Once the new remapper is in use, CloseReplacedRules must be called with the old rules.
+func ReloadRemapper(old HTTPRequestRemapper, path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) (HTTPRequestRemapper, remapdata.RulesDiff, error) {
+	rules, plugins, statRules, err := LoadRemapRules(path, pluginConfigLoaders, caches, baseTransport)
+	if err != nil {
+		return nil, remapdata.RulesDiff{}, err
+	}
+	oldRules := map[string]remapdata.RemapRule{}
+	for _, rule := range old.Rules() {
+		oldRules[rule.Name] = rule
+	}
+	for i, rule := range rules {
+		if oldRule, ok := oldRules[rule.Name]; ok && !ruleChanged(oldRule, rule) {
+			rule.Health.Close()
+			rules[i].Health = oldRule.Health
+			rules[i].RateLimiter = oldRule.RateLimiter
+		}
+	}
+	return NewHTTPRequestRemapper(rules, plugins, statRules), DiffRules(old.Rules(), rules), nil
+}
+
+// CloseReplacedRules closes the old rules which aren't in the new rules, or whose background work, such as health checks, wasn't kept by the new rules. It should be called after the new rules are in use.
+func CloseReplacedRules(oldRules []remapdata.RemapRule, newRules []remapdata.RemapRule) {
+	kept := map[string]remapdata.RemapRule{}
+	for _, rule := range newRules {
+		kept[rule.Name] = rule
+	}
+	for _, rule := range oldRules {
+		if newRule, ok := kept[rule.Name]; ok && newRule.Health == rule.Health {
+			continue
+		}
+		rule.Health.Close()
+	}
+}
+
+// DiffRules returns the rules added, removed, and changed in newRules from oldRules, by name.
+func DiffRules(oldRules []remapdata.RemapRule, newRules []remapdata.RemapRule) remapdata.RulesDiff {
+	diff := remapdata.RulesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	oldByName := map[string]remapdata.RemapRule{}
+	for _, rule := range oldRules {
+		oldByName[rule.Name] = rule
+	}
+	newByName := map[string]remapdata.RemapRule{}
+	for _, rule := range newRules {
+		newByName[rule.Name] = rule
+	}
+
+	oldOrder := []string{}
+	for _, rule := range oldRules {
+		if _, ok := newByName[rule.Name]; !ok {
+			diff.Removed = append(diff.Removed, rule.Name)
+			continue
+		}
+		oldOrder = append(oldOrder, rule.Name)
+	}
+	newOrder := []string{}
+	for _, rule := range newRules {
+		oldRule, ok := oldByName[rule.Name]
+		if !ok {
+			diff.Added = append(diff.Added, rule.Name)
+			continue
+		}
+		newOrder = append(newOrder, rule.Name)
+		if ruleChanged(oldRule, rule) {
+			diff.Changed = append(diff.Changed, rule.Name)
+		}
+	}
+	for i := range newOrder {
+		if newOrder[i] != oldOrder[i] {
+			diff.Reordered = true
+			break
+		}
+	}
+	return diff
+}
+
+// ruleChanged returns whether the rules differ in any configuration, including their cache and plugin configs, or the defaults they inherit. Rules are compared by the JSON they were loaded from, since loaded plugin configs may not marshal to all their configuration. Rules without ConfigJSON are always changed.
+func ruleChanged(a remapdata.RemapRule, b remapdata.RemapRule) bool {
+	if a.Cache != b.Cache || a.ConfigJSON == nil || b.ConfigJSON == nil {
+		return true
+	}
+	return !bytes.Equal(a.ConfigJSON, b.ConfigJSON)
+}
@@ -0,0 +1,142 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+func TestDiffRules(t *testing.T) {
+	rule := func(name string, configJSON string) remapdata.RemapRule {
+		return remapdata.RemapRule{RemapRuleBase: remapdata.RemapRuleBase{Name: name}, ConfigJSON: []byte(configJSON)}
+	}
+	oldRules := []remapdata.RemapRule{rule("a", `{"a":1}`), rule("b", `{"b":1}`), rule("c", `{"c":1}`)}
+
+	tests := []struct {
+		name     string
+		newRules []remapdata.RemapRule
+		expected remapdata.RulesDiff
+	}{
+		{"unchanged", oldRules, remapdata.RulesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}},
+		{"added removed changed", []remapdata.RemapRule{rule("a", `{"a":2}`), rule("c", `{"c":1}`), rule("d", `{"d":1}`)}, remapdata.RulesDiff{Added: []string{"d"}, Removed: []string{"b"}, Changed: []string{"a"}}},
+		{"reordered", []remapdata.RemapRule{rule("c", `{"c":1}`), rule("a", `{"a":1}`), rule("b", `{"b":1}`)}, remapdata.RulesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}, Reordered: true}},
+		// rules removed or added don't reorder the rules kept
+		{"not reordered", []remapdata.RemapRule{rule("d", `{"d":1}`), rule("a", `{"a":1}`), rule("c", `{"c":1}`)}, remapdata.RulesDiff{Added: []string{"d"}, Removed: []string{"b"}, Changed: []string{}}},
+	}
+	for _, test := range tests {
+		if actual := DiffRules(oldRules, test.newRules); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("DiffRules %v expected %+v, actual %+v", test.name, test.expected, actual)
+		}
+	}
+}
+
+const testRulesJSON = `{
+	"parent_selection": "consistent-hash",
+	"retry_num": 2,
+	"timeout_ms": 5000,
+	"retry_codes": [502],
+	"plugins": {%s},
+	"rules": [
+		{
+			"name": "a",
+			"from": "http://a.example.net",
+			"to": [{"url": "http://a.origin.example"}],
+			"health_check": {"markdown_failures": 3},
+			"rate_limit": {"requests_per_second": 10}
+		},
+		{
+			"name": "b",
+			"from": "http://b.example.net",
+			"to": [{"url": "http://b.origin.example"}],
+			"health_check": {"markdown_failures": %d},
+			"rate_limit": {"requests_per_second": 10}
+		}
+	]
+}`
+
+func TestReloadRemapperKeepsUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-remap-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "remap.json")
+	writeRules := func(plugins string, bMarkdownFailures int) {
+		if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(testRulesJSON, plugins, bMarkdownFailures)), 0600); err != nil {
+			t.Fatalf("writing rules: %v", err)
+		}
+	}
+	caches := map[string]icache.Cache{"": memcache.New(1024*1024, nil)}
+	loaders := plugin.Get(nil).LoadFuncs()
+
+	writeRules("", 3)
+	old, err := LoadRemapper(path, loaders, caches, http.DefaultTransport.(*http.Transport))
+	if err != nil {
+		t.Fatalf("LoadRemapper expected nil error, actual %v", err)
+	}
+	oldRules := map[string]remapdata.RemapRule{}
+	for _, rule := range old.Rules() {
+		oldRules[rule.Name] = rule
+	}
+
+	// whitespace isn't a change
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(testRulesJSON, "  ", 3)), 0600); err != nil {
+		t.Fatalf("writing rules: %v", err)
+	}
+	_, diff, err := ReloadRemapper(old, path, loaders, caches, http.DefaultTransport.(*http.Transport))
+	if err != nil {
+		t.Fatalf("ReloadRemapper expected nil error, actual %v", err)
+	}
+	if len(diff.Changed) != 0 {
+		t.Errorf("ReloadRemapper of reformatted rules expected none changed, actual %v", diff.Changed)
+	}
+
+	writeRules("", 5)
+	reloaded, diff, err := ReloadRemapper(old, path, loaders, caches, http.DefaultTransport.(*http.Transport))
+	if err != nil {
+		t.Fatalf("ReloadRemapper expected nil error, actual %v", err)
+	}
+	if expected := []string{"b"}; !reflect.DeepEqual(diff.Changed, expected) {
+		t.Errorf("ReloadRemapper changed expected %v, actual %v", expected, diff.Changed)
+	}
+	for _, rule := range reloaded.Rules() {
+		kept := rule.Health == oldRules[rule.Name].Health && rule.RateLimiter == oldRules[rule.Name].RateLimiter
+		if expected := rule.Name == "a"; kept != expected {
+			t.Errorf("ReloadRemapper rule %v expected health and rate limiter kept %v, actual %v", rule.Name, expected, kept)
+		}
+	}
+	CloseReplacedRules(old.Rules(), reloaded.Rules())
+
+	// a change to the global config every rule inherits changes every rule
+	writeRules(`"http_stats": {}`, 5)
+	_, diff, err = ReloadRemapper(reloaded, path, loaders, caches, http.DefaultTransport.(*http.Transport))
+	if err != nil {
+		t.Fatalf("ReloadRemapper expected nil error, actual %v", err)
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(diff.Changed, expected) {
+		t.Errorf("ReloadRemapper of changed global plugins expected changed %v, actual %v", expected, diff.Changed)
+	}
+}
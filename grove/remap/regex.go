@@ -0,0 +1,64 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+// RequestRemapper is a Remapper which may also match rules against the request, such as its headers, rather than only its URI.
+type RequestRemapper interface {
+	Remapper
+	// RemapRequest returns the first rule matching the request, whose URI is given, the values captured by the rule's Matcher if it has one, and whether a rule was found.
+	RemapRequest(r *http.Request, uri string) (remapdata.RemapRule, remapdata.Captures, bool)
+}
+
+// regexRemapper matches rules in order. Rules with a Matcher match the regular expressions of its Match against the request, and rules without match their literal From prefix.
+type regexRemapper struct {
+	literalPrefixRemapper
+}
+
+// NewRegexRemapper returns a RequestRemapper of the given rules, which are matched in order.
+func NewRegexRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}) RequestRemapper {
+	return regexRemapper{literalPrefixRemapper{remap: remap, plugins: plugins}}
+}
+
+// Remap returns the first rule without a Matcher whose From prefix matches the URI, and whether one was found. Rules with a Matcher need the request, and are only matched by RemapRequest.
+func (r regexRemapper) Remap(uri string) (remapdata.RemapRule, bool) {
+	for _, rule := range r.remap {
+		if rule.Matcher == nil && strings.HasPrefix(uri, rule.From) {
+			return rule, true
+		}
+	}
+	return remapdata.RemapRule{}, false
+}
+
+func (r regexRemapper) RemapRequest(req *http.Request, uri string) (remapdata.RemapRule, remapdata.Captures, bool) {
+	for _, rule := range r.remap {
+		if rule.Matcher == nil {
+			if strings.HasPrefix(uri, rule.From) {
+				return rule, remapdata.Captures{}, true
+			}
+			continue
+		}
+		if captures, ok := rule.Matcher.Match(strings.ToLower(req.Host), req.URL.Path, req.URL.RawQuery, req.Header); ok {
+			return rule, captures, true
+		}
+	}
+	return remapdata.RemapRule{}, remapdata.Captures{}, false
+}
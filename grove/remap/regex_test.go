@@ -0,0 +1,110 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+// newTestRequest returns a request as received by a server, whose RequestURI is only the path and query.
+func newTestRequest(url string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.RequestURI = req.URL.RequestURI()
+	return req
+}
+
+func newTestRule(t *testing.T, name string, from string, match *remapdata.RemapMatch, to string) remapdata.RemapRule {
+	parentSelection := remapdata.ParentSelectionTypeConsistentHash
+	rule := remapdata.RemapRule{
+		RemapRuleBase:   remapdata.RemapRuleBase{Name: name, From: from, Match: match},
+		ParentSelection: &parentSelection,
+		To:              []remapdata.RemapRuleTo{{RemapRuleToBase: remapdata.RemapRuleToBase{URL: to}}},
+	}
+	if match != nil {
+		matcher, err := remapdata.NewRegexMatcher(*match)
+		if err != nil {
+			t.Fatalf("NewRegexMatcher expected nil error, actual %v", err)
+		}
+		rule.Matcher = matcher
+	}
+	return rule
+}
+
+func TestRegexRemapperOrder(t *testing.T) {
+	rules := []remapdata.RemapRule{
+		newTestRule(t, "literal", "http://foo.example.net/static", nil, "http://static.origin.example"),
+		newTestRule(t, "video", "", &remapdata.RemapMatch{Host: `^([a-z]+)\.example\.net$`, Path: `^/video/`}, "http://video.origin.example"),
+		newTestRule(t, "tenant", "", &remapdata.RemapMatch{Host: `^([a-z]+)\.example\.net$`}, "http://$1.origin.example"),
+		newTestRule(t, "unreached", "", &remapdata.RemapMatch{Host: `^foo\.example\.net$`}, "http://unreached.origin.example"),
+	}
+	remapper := NewRegexRemapper(rules, nil)
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"http://foo.example.net/static/a.css", "literal"},
+		{"http://foo.example.net/video/a.mp4", "video"},
+		{"http://foo.example.net/other", "tenant"},
+		{"http://bar.example.net/static/a.css", "tenant"},
+		// hosts are case-insensitive
+		{"http://FOO.Example.NET/static/a.css", "literal"},
+		{"http://Bar.example.net/other", "tenant"},
+	}
+	for _, test := range tests {
+		req := newTestRequest(test.url)
+		rule, _, ok := remapper.RemapRequest(req, RequestURI(req, "http"))
+		if !ok {
+			t.Errorf("RemapRequest %v expected rule %v, actual none", test.url, test.expected)
+		} else if rule.Name != test.expected {
+			t.Errorf("RemapRequest %v expected rule %v, actual %v", test.url, test.expected, rule.Name)
+		}
+	}
+
+	req := newTestRequest("http://foo.example.org/")
+	if rule, _, ok := remapper.RemapRequest(req, RequestURI(req, "http")); ok {
+		t.Errorf("RemapRequest of unmatched request expected none, actual %v", rule.Name)
+	}
+	if rule, ok := remapper.Remap("http://foo.example.net/video/a.mp4"); ok {
+		t.Errorf("Remap without the request expected regex rules not to match, actual %v", rule.Name)
+	}
+}
+
+func TestRegexRemapperCaptures(t *testing.T) {
+	rule := newTestRule(t, "tenant", "", &remapdata.RemapMatch{Host: `^(?P<tenant>[a-z]+)\.example\.net$`, Path: `^/(.*)$`}, "http://${tenant}.origin.example/v1/$2")
+	rule.QueryString = remapdata.QueryStringRule{Remap: true, Cache: false}
+	statRules := remapdata.RemapRulesStats{}
+	remapper := RemapperToHTTP(NewRegexRemapper([]remapdata.RemapRule{rule}, nil), &statRules)
+
+	req := newTestRequest("http://foo.example.net/a/b.mp4?x=1")
+	producer, err := remapper.RemappingProducer(req, "http")
+	if err != nil {
+		t.Fatalf("RemappingProducer expected nil error, actual %v", err)
+	}
+	if expected, actual := "GET:http://foo.origin.example/v1/a/b.mp4", producer.CacheKey(); actual != expected {
+		t.Errorf("CacheKey expected '%v', actual '%v'", expected, actual)
+	}
+	if expected, actual := "tenant", producer.StatsKey(req.Host); actual != expected {
+		t.Errorf("StatsKey expected '%v', actual '%v'", expected, actual)
+	}
+	uri, _, _, _ := rule.URI(RequestURI(req, "http"), req.URL.Path, req.URL.RawQuery, 0, producer.captures)
+	if expected := "http://foo.origin.example/v1/a/b.mp4?x=1"; uri != expected {
+		t.Errorf("URI expected '%v', actual '%v'", expected, uri)
+	}
+}
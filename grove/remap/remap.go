@@ -15,9 +15,11 @@ package remap
 */
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -26,8 +28,10 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/chash"
+	"github.com/apache/trafficcontrol/grove/health"
 	"github.com/apache/trafficcontrol/grove/icache"
 	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/ratelimit"
 	"github.com/apache/trafficcontrol/grove/remapdata"
 	"github.com/apache/trafficcontrol/grove/web"
 
@@ -108,6 +112,9 @@ type Remapping struct {
 	RetryCodes      map[int]struct{}
 	Cache           icache.Cache
 	Transport       *http.Transport
+	MaxVariants     int
+	// Parent is the To URL of the parent requested, whose result should be reported with RemappingProducer.ReportParentResult.
+	Parent string
 }
 
 // RemappingProducer takes an HTTP Request and returns a Remapping to be used for that request.
@@ -117,6 +124,7 @@ type RemappingProducer struct {
 	rule     remapdata.RemapRule
 	cacheKey string
 	failures int
+	captures remapdata.Captures
 }
 
 func (p *RemappingProducer) CacheKey() string                  { return p.cacheKey }
@@ -126,9 +134,27 @@ func (p *RemappingProducer) Name() string                      { return p.rule.N
 func (p *RemappingProducer) DSCP() int                         { return p.rule.DSCP }
 func (p *RemappingProducer) PluginCfg() map[string]interface{} { return p.rule.Plugins }
 func (p *RemappingProducer) Cache() icache.Cache               { return p.rule.Cache }
+
+// RateLimiter returns the rate limiter of the rule, which is nil if the rule isn't limited.
+func (p *RemappingProducer) RateLimiter() *ratelimit.Limiter { return p.rule.RateLimiter }
+func (p *RemappingProducer) StaleWhileRevalidate() time.Duration {
+	return time.Duration(p.rule.StaleWhileRevalidateSeconds) * time.Second
+}
+func (p *RemappingProducer) StaleIfError() time.Duration {
+	return time.Duration(p.rule.StaleIfErrorSeconds) * time.Second
+}
+
+// StatsKey returns the key of the rule's remap stats, given the request host. Rules with a regex match may match any host, so they're keyed by their name. Other rules are keyed by the host of their From, which is the request host.
+func (p *RemappingProducer) StatsKey(reqHost string) string {
+	if p.rule.Matcher != nil {
+		return p.rule.Name
+	}
+	return reqHost
+}
+
 func (p *RemappingProducer) FirstFQDN() string {
 	// TODO verify To is not allowed to be constructed with < 1 element
-	return strings.TrimPrefix(strings.TrimPrefix(p.rule.To[0].URL, "http://"), "https://")
+	return strings.TrimPrefix(strings.TrimPrefix(p.rule.ToURL(0, p.captures), "http://"), "https://")
 }
 func (p *RemappingProducer) ProxyStr() string {
 	if p.rule.To[0].ProxyURL != nil && p.rule.To[0].ProxyURL.Host != "" {
@@ -142,12 +168,31 @@ var ErrIPNotAllowed = errors.New("IP not allowed")
 var ErrNoMoreRetries = errors.New("retry num exceeded")
 
 // RequestURI returns the URI of the given request. This must be used, because Go does not populate the scheme of requests that come in from clients.
+// The host is lowercased, because hosts are case-insensitive, and rules are matched against it case-sensitively.
 func RequestURI(r *http.Request, scheme string) string {
-	return scheme + "://" + r.Host + r.RequestURI
+	return scheme + "://" + strings.ToLower(r.Host) + r.RequestURI
+}
+
+// lowercaseHost returns the given URI with its scheme and host lowercased, so rules match the lowercased hosts of RequestURI.
+func lowercaseHost(uri string) string {
+	hostStart := 0
+	if i := strings.Index(uri, "://"); i != -1 {
+		hostStart = i + len("://")
+	}
+	hostEnd := len(uri)
+	if i := strings.IndexAny(uri[hostStart:], "/?#"); i != -1 {
+		hostEnd = hostStart + i
+	}
+	return strings.ToLower(uri[:hostEnd]) + uri[hostEnd:]
 }
 func (hr simpleHTTPRequestRemapper) RemappingProducer(r *http.Request, scheme string) (*RemappingProducer, error) {
 	uri := RequestURI(r, scheme)
-	rule, ok := hr.remapper.Remap(uri)
+	rule, captures, ok := remapdata.RemapRule{}, remapdata.Captures{}, false
+	if requestRemapper, isRequestRemapper := hr.remapper.(RequestRemapper); isRequestRemapper {
+		rule, captures, ok = requestRemapper.RemapRequest(r, uri)
+	} else {
+		rule, ok = hr.remapper.Remap(uri)
+	}
 	if !ok {
 		return nil, ErrRuleNotFound
 	}
@@ -160,12 +205,13 @@ func (hr simpleHTTPRequestRemapper) RemappingProducer(r *http.Request, scheme st
 		log.Debugf("Allowed %v\n", ip)
 	}
 
-	cacheKey := rule.CacheKey(r.Method, uri)
+	cacheKey := rule.CacheKey(r.Method, uri, captures, r.URL.RawQuery)
 
 	return &RemappingProducer{
 		rule:     rule,
 		oldURI:   uri,
 		cacheKey: cacheKey,
+		captures: captures,
 	}, nil
 }
 
@@ -175,7 +221,7 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 		return Remapping{}, false, ErrNoMoreRetries
 	}
 
-	newURI, proxyURL, transport := p.rule.URI(p.oldURI, r.URL.Path, r.URL.RawQuery, p.failures)
+	newURI, proxyURL, transport, parent := p.rule.URI(p.oldURI, r.URL.Path, r.URL.RawQuery, p.failures, p.captures)
 	p.failures++
 	newReq, err := http.NewRequest(r.Method, newURI, nil)
 	if err != nil {
@@ -201,14 +247,27 @@ func (p *RemappingProducer) GetNext(r *http.Request) (Remapping, bool, error) {
 		RetryCodes:      p.rule.RetryCodes,
 		Cache:           p.rule.Cache,
 		Transport:       transport,
+		MaxVariants:     p.rule.MaxVariants,
+		Parent:          parent,
 	}, retryAllowed, nil
 }
 
+// ReportParentResult records whether the request of the given remapping to its parent failed, so parents which repeatedly fail are marked down.
+func (p *RemappingProducer) ReportParentResult(remapping Remapping, failed bool) {
+	p.rule.Health.ReportResult(remapping.Parent, failed)
+}
+
 func RemapperToHTTP(r Remapper, statRules *remapdata.RemapRulesStats) HTTPRequestRemapper {
 	return simpleHTTPRequestRemapper{remapper: r, stats: statRules}
 }
 
+// NewHTTPRequestRemapper returns a remapper of the given rules. If any rule has a Match, rules are matched with a RequestRemapper; otherwise, by their literal From prefix.
 func NewHTTPRequestRemapper(remap []remapdata.RemapRule, plugins map[string]interface{}, statRules *remapdata.RemapRulesStats) HTTPRequestRemapper {
+	for _, rule := range remap {
+		if rule.Matcher != nil {
+			return RemapperToHTTP(NewRegexRemapper(remap, plugins), statRules)
+		}
+	}
 	return RemapperToHTTP(NewLiteralPrefixRemapper(remap, plugins), statRules)
 }
 
@@ -253,7 +312,7 @@ func (r literalPrefixRemapper) Remap(s string) (remapdata.RemapRule, bool) {
 }
 
 func (r literalPrefixRemapper) Rules() []remapdata.RemapRule {
-	rules := make([]remapdata.RemapRule, len(r.remap))
+	rules := make([]remapdata.RemapRule, 0, len(r.remap))
 	for _, rule := range r.remap {
 		rules = append(rules, rule)
 	}
@@ -318,6 +377,9 @@ type RemapRuleJSON struct {
 	Plugins         map[string]json.RawMessage `json:"plugins"`
 }
 
+// RequiredPlugins are the plugins which deny requests, such as those validating signatures. Rules configuring them fail to load if they aren't enabled, rather than serving requests the plugins would deny.
+var RequiredPlugins = map[string]struct{}{"url_sig": {}, "uri_signing": {}}
+
 // LoadRemapRules returns the loaded rules, the global plugins, the Stats remap rules, and any error
 func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc, caches map[string]icache.Cache, baseTransport *http.Transport) ([]remapdata.RemapRule, map[string]interface{}, *remapdata.RemapRulesStats, error) {
 	fmt.Println(time.Now().Format(time.RFC3339Nano) + " Loading Remap Rules")
@@ -330,8 +392,16 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 	}
 	defer file.Close()
 
+	remapRulesBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("reading file: %s", err)
+	}
 	remapRulesJSON := RemapRulesJSON{}
-	if err := json.NewDecoder(file).Decode(&remapRulesJSON); err != nil {
+	if err := json.Unmarshal(remapRulesBytes, &remapRulesJSON); err != nil {
+		return nil, nil, nil, fmt.Errorf("decoding JSON: %s", err)
+	}
+	rulesConfigJSON, err := rulesConfigJSON(remapRulesBytes)
+	if err != nil {
 		return nil, nil, nil, fmt.Errorf("decoding JSON: %s", err)
 	}
 
@@ -372,19 +442,28 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 	remapRules.Plugins = make(map[string]interface{}, len(remapRulesJSON.Plugins))
 	for name, b := range remapRulesJSON.Plugins {
 		if loadF := pluginConfigLoaders[name]; loadF != nil {
-			remapRules.Plugins[name] = loadF(b)
+			if remapRules.Plugins[name] = loadF(b); remapRules.Plugins[name] == nil {
+				return nil, nil, nil, fmt.Errorf("error loading plugin %v config: invalid config", name)
+			}
+		} else if _, ok := RequiredPlugins[name]; ok {
+			return nil, nil, nil, fmt.Errorf("error loading plugin %v config: plugin is not enabled", name)
 		}
 	}
 
 	rules := make([]remapdata.RemapRule, len(remapRulesJSON.Rules))
 	for i, jsonRule := range remapRulesJSON.Rules {
 		fmt.Println(time.Now().Format(time.RFC3339Nano) + " Creating Remap Rule " + jsonRule.Name)
-		rule := remapdata.RemapRule{RemapRuleBase: jsonRule.RemapRuleBase}
+		rule := remapdata.RemapRule{RemapRuleBase: jsonRule.RemapRuleBase, ConfigJSON: rulesConfigJSON[i]}
+		rule.From = lowercaseHost(rule.From)
 
 		rule.Plugins = make(map[string]interface{}, len(jsonRule.Plugins))
 		for name, b := range jsonRule.Plugins {
 			if loadF := pluginConfigLoaders[name]; loadF != nil {
-				rule.Plugins[name] = loadF(b)
+				if rule.Plugins[name] = loadF(b); rule.Plugins[name] == nil {
+					return nil, nil, nil, fmt.Errorf("error loading rule %v plugin %v config: invalid config", rule.Name, name)
+				}
+			} else if _, ok := RequiredPlugins[name]; ok {
+				return nil, nil, nil, fmt.Errorf("error loading rule %v plugin %v config: plugin is not enabled", rule.Name, name)
 			}
 		}
 		for name, loader := range remapRules.Plugins {
@@ -422,6 +501,37 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 			rule.PluginsShared = remapRules.PluginsShared
 		}
 
+		if rule.MaxVariants == 0 {
+			rule.MaxVariants = remapdata.DefaultMaxVariants
+		} else if rule.MaxVariants < 0 {
+			return nil, nil, nil, fmt.Errorf("error parsing rule %v max_variants must not be negative: %v", rule.Name, rule.MaxVariants)
+		}
+
+		if rule.StaleWhileRevalidateSeconds < 0 {
+			return nil, nil, nil, fmt.Errorf("error parsing rule %v stale_while_revalidate_seconds must not be negative: %v", rule.Name, rule.StaleWhileRevalidateSeconds)
+		}
+		if rule.StaleIfErrorSeconds < 0 {
+			return nil, nil, nil, fmt.Errorf("error parsing rule %v stale_if_error_seconds must not be negative: %v", rule.Name, rule.StaleIfErrorSeconds)
+		}
+		if rule.Match != nil {
+			if rule.Matcher, err = remapdata.NewRegexMatcher(*rule.Match); err != nil {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v match: %v", rule.Name, err)
+			}
+		}
+
+		if rule.HealthCheck != nil {
+			if err := rule.HealthCheck.Validate(); err != nil {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v health_check: %v", rule.Name, err)
+			}
+		}
+
+		if rule.RateLimit != nil {
+			if err := rule.RateLimit.Validate(); err != nil {
+				return nil, nil, nil, fmt.Errorf("error parsing rule %v rate_limit: %v", rule.Name, err)
+			}
+			rule.RateLimiter = ratelimit.New(*rule.RateLimit)
+		}
+
 		cacheName := "" // default string is the default cache
 		if jsonRule.CacheName != nil {
 			cacheName = *jsonRule.CacheName
@@ -457,6 +567,14 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 			return nil, nil, nil, fmt.Errorf("error parsing rule %v - no to - must have at least one parent", rule.Name)
 		}
 
+		if rule.Matcher != nil && rule.HealthCheck != nil && rule.HealthCheck.Path != "" {
+			for _, to := range rule.To {
+				if strings.Contains(to.URL, "$") {
+					return nil, nil, nil, fmt.Errorf("error parsing rule %v - health_check path can't check to %v, which contains match captures", rule.Name, to.URL)
+				}
+			}
+		}
+
 		if *rule.ParentSelection == remapdata.ParentSelectionTypeConsistentHash {
 			rule.ConsistentHash = makeRuleHash(rule)
 		} else {
@@ -464,9 +582,49 @@ func LoadRemapRules(path string, pluginConfigLoaders map[string]plugin.LoadFunc,
 		rules[i] = rule
 	}
 
+	// health checkers are created after all rules are parsed, so none are started if any rule is invalid
+	for i, rule := range rules {
+		if rule.HealthCheck == nil {
+			continue
+		}
+		parents := make([]health.Parent, 0, len(rule.To))
+		for _, to := range rule.To {
+			parents = append(parents, health.Parent{URL: to.URL, Transport: to.Transport})
+		}
+		rules[i].Health = health.New(rule.Name, *rule.HealthCheck, parents)
+	}
+
 	return rules, remapRules.Plugins, &remapRules.Stats, nil
 }
 
+// rulesConfigJSON returns the ConfigJSON of each rule of the given rules file: the rule's compacted JSON, followed by the JSON of the file without its rules, whose defaults every rule inherits.
+func rulesConfigJSON(remapRulesBytes []byte) ([][]byte, error) {
+	file := map[string]json.RawMessage{}
+	if err := json.Unmarshal(remapRulesBytes, &file); err != nil {
+		return nil, err
+	}
+	rules := []json.RawMessage{}
+	if rulesJSON, ok := file["rules"]; ok {
+		if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+			return nil, err
+		}
+	}
+	delete(file, "rules")
+	global, err := json.Marshal(file) // map keys are sorted, and values compacted
+	if err != nil {
+		return nil, err
+	}
+	configs := make([][]byte, len(rules))
+	for i, rule := range rules {
+		buf := bytes.Buffer{}
+		if err := json.Compact(&buf, rule); err != nil {
+			return nil, err
+		}
+		configs[i] = append(append(buf.Bytes(), '\n'), global...)
+	}
+	return configs, nil
+}
+
 const DefaultReplicas = 1024
 
 func makeRuleHash(rule remapdata.RemapRule) chash.ATSConsistentHash {
@@ -0,0 +1,124 @@
+package remap
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/memcache"
+	"github.com/apache/trafficcontrol/grove/plugin"
+	"github.com/apache/trafficcontrol/grove/remapdata"
+)
+
+const testSignedRulesJSON = `{
+	"parent_selection": "consistent-hash",
+	"retry_num": 2,
+	"timeout_ms": 5000,
+	"retry_codes": [502],
+	"plugins": {%s},
+	"rules": [
+		{
+			"name": "signed",
+			"from": "http://signed.example.net",
+			"to": [{"url": "http://signed.origin.example"}],
+			"plugins": {%s}
+		}
+	]
+}`
+
+func TestLoadRemapRulesRequiredPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grove-remap-test")
+	if err != nil {
+		t.Fatalf("creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "remap.json")
+	caches := map[string]icache.Cache{"": memcache.New(1024*1024, nil)}
+
+	urlSig := `"url_sig": {"key0": "c4bVhz4lBmVqkO5UB2hGI3DeC7ta1IBH"}`
+	tests := []struct {
+		name          string
+		enabled       []string
+		globalPlugins string
+		rulePlugins   string
+		expectErr     bool
+	}{
+		{"rule config, plugin enabled", []string{"url_sig"}, "", urlSig, false},
+		{"rule config, plugin not enabled", nil, "", urlSig, true},
+		{"global config, plugin not enabled", nil, urlSig, "", true},
+		{"no config, plugin not enabled", nil, "", "", false},
+	}
+	for _, test := range tests {
+		if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(testSignedRulesJSON, test.globalPlugins, test.rulePlugins)), 0600); err != nil {
+			t.Fatalf("writing rules: %v", err)
+		}
+		rules, _, _, err := LoadRemapRules(path, plugin.Get(test.enabled).LoadFuncs(), caches, http.DefaultTransport.(*http.Transport))
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("LoadRemapRules %v expected error, actual nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("LoadRemapRules %v expected nil error, actual %v", test.name, err)
+		} else if _, ok := rules[0].Plugins["url_sig"]; ok != (test.rulePlugins != "") {
+			t.Errorf("LoadRemapRules %v rule url_sig config expected %v, actual %v", test.name, test.rulePlugins != "", ok)
+		}
+	}
+}
+
+func TestLowercaseHost(t *testing.T) {
+	tests := map[string]string{
+		"http://Foo.Example.NET/Path?Q=A": "http://foo.example.net/Path?Q=A",
+		"HTTPS://FOO.example.net":         "https://foo.example.net",
+		"http://Foo.example.net?Q":        "http://foo.example.net?Q",
+	}
+	for uri, expected := range tests {
+		if actual := lowercaseHost(uri); actual != expected {
+			t.Errorf("lowercaseHost %v expected %v, actual %v", uri, expected, actual)
+		}
+	}
+}
+
+func TestRemapMixedCaseHost(t *testing.T) {
+	rule := newTestRule(t, "literal", lowercaseHost("http://Foo.Example.net/Static"), nil, "http://static.origin.example")
+	remapper := NewHTTPRequestRemapper([]remapdata.RemapRule{rule}, nil, &remapdata.RemapRulesStats{})
+
+	keys := map[string]struct{}{}
+	for _, url := range []string{"http://foo.example.net/Static/a.css", "http://FOO.EXAMPLE.NET/Static/a.css", "http://Foo.Example.Net/Static/a.css"} {
+		req := newTestRequest(url)
+		producer, err := remapper.RemappingProducer(req, "http")
+		if err != nil {
+			t.Errorf("RemappingProducer %v expected nil error, actual %v", url, err)
+			continue
+		}
+		keys[producer.CacheKey()] = struct{}{}
+	}
+	if len(keys) != 1 {
+		t.Errorf("cache keys of requests with mixed-case hosts expected 1, actual %v", keys)
+	}
+
+	// paths are case-sensitive
+	req := newTestRequest("http://foo.example.net/static/a.css")
+	if _, err := remapper.RemappingProducer(req, "http"); err != ErrRuleNotFound {
+		t.Errorf("RemappingProducer with different case path expected error %v, actual %v", ErrRuleNotFound, err)
+	}
+}
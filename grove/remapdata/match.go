@@ -0,0 +1,157 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RemapMatch is the regular expressions a request must match for a remap rule to apply, instead of the rule's literal From prefix. Empty expressions match anything.
+type RemapMatch struct {
+	// Host is matched against the request Host header, including the port, if any.
+	Host string `json:"host"`
+	// Path is matched against the request path, without the query string.
+	Path string `json:"path"`
+	// Query is matched against the raw request query string, without the leading '?'.
+	Query string `json:"query"`
+	// Headers are matched against the values of the named request headers, joined with commas if there are multiple. Missing headers are matched as the empty string.
+	Headers map[string]string `json:"headers"`
+}
+
+// RegexMatcher is a compiled RemapMatch.
+type RegexMatcher struct {
+	host    *regexp.Regexp
+	path    *regexp.Regexp
+	query   *regexp.Regexp
+	headers []headerRegexp // sorted by name, so captures are numbered consistently
+}
+
+type headerRegexp struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// NewRegexMatcher compiles the given match. Returns an error if any regular expression is invalid.
+func NewRegexMatcher(m RemapMatch) (*RegexMatcher, error) {
+	matcher := &RegexMatcher{}
+	err := error(nil)
+	if matcher.host, err = compileMatch(m.Host); err != nil {
+		return nil, errors.New("compiling host: " + err.Error())
+	}
+	if matcher.path, err = compileMatch(m.Path); err != nil {
+		return nil, errors.New("compiling path: " + err.Error())
+	}
+	if matcher.query, err = compileMatch(m.Query); err != nil {
+		return nil, errors.New("compiling query: " + err.Error())
+	}
+	for name, expr := range m.Headers {
+		re, err := compileMatch(expr)
+		if err != nil {
+			return nil, errors.New("compiling header '" + name + "': " + err.Error())
+		}
+		matcher.headers = append(matcher.headers, headerRegexp{name: http.CanonicalHeaderKey(name), re: re})
+	}
+	sort.Slice(matcher.headers, func(i, j int) bool { return matcher.headers[i].name < matcher.headers[j].name })
+	return matcher, nil
+}
+
+// compileMatch compiles the given expression, or returns nil if it's empty, to match anything.
+func compileMatch(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// Match returns the values captured by the matcher's regular expressions, and whether the request matched all of them.
+// Captures are numbered from 1 across all expressions, in the order host, path, query, then headers sorted by name. Named captures may also be referred to by name.
+func (m *RegexMatcher) Match(host string, path string, query string, hdr http.Header) (Captures, bool) {
+	captures := Captures{Named: map[string]string{}}
+	matches := func(re *regexp.Regexp, s string) bool {
+		if re == nil {
+			return true
+		}
+		submatches := re.FindStringSubmatch(s)
+		if submatches == nil {
+			return false
+		}
+		for i, name := range re.SubexpNames() {
+			if i == 0 {
+				continue
+			}
+			captures.Numbered = append(captures.Numbered, submatches[i])
+			if name != "" {
+				captures.Named[name] = submatches[i]
+			}
+		}
+		return true
+	}
+	if !matches(m.host, host) || !matches(m.path, path) || !matches(m.query, query) {
+		return Captures{}, false
+	}
+	for _, h := range m.headers {
+		if !matches(h.re, strings.Join(hdr[h.name], ",")) {
+			return Captures{}, false
+		}
+	}
+	return captures, true
+}
+
+// Captures are the values captured by a RegexMatcher.
+type Captures struct {
+	// Numbered are the captures in order, where Numbered[0] is $1.
+	Numbered []string
+	Named    map[string]string
+}
+
+var captureRefRegexp = regexp.MustCompile(`\$(\$|[0-9]+|\{[A-Za-z0-9_]+\})`)
+
+// TemplateRegexp returns a regular expression matching the start of every expansion of the template, whatever the captured values.
+func TemplateRegexp(template string) *regexp.Regexp {
+	pattern := "^"
+	last := 0
+	for _, loc := range captureRefRegexp.FindAllStringIndex(template, -1) {
+		pattern += regexp.QuoteMeta(template[last:loc[0]])
+		if template[loc[0]:loc[1]] == "$$" {
+			pattern += `\$`
+		} else {
+			pattern += ".*"
+		}
+		last = loc[1]
+	}
+	return regexp.MustCompile(pattern + regexp.QuoteMeta(template[last:]))
+}
+
+// Expand returns the template with capture references replaced by the captured values. References may be $1 or ${1} by number, ${name} by name, and $$ is a literal $. References to captures which don't exist are replaced with the empty string.
+func (c Captures) Expand(template string) string {
+	return captureRefRegexp.ReplaceAllStringFunc(template, func(ref string) string {
+		ref = strings.TrimSuffix(strings.TrimPrefix(ref[1:], "{"), "}")
+		if ref == "$" {
+			return "$"
+		}
+		if i, err := strconv.Atoi(ref); err == nil {
+			if i < 1 || i > len(c.Numbered) {
+				return ""
+			}
+			return c.Numbered[i-1]
+		}
+		return c.Named[ref]
+	})
+}
@@ -0,0 +1,82 @@
+package remapdata
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRegexMatcher(t *testing.T) {
+	m, err := NewRegexMatcher(RemapMatch{
+		Host:    `^(?P<tenant>[a-z]+)\.example\.net$`,
+		Path:    `^/video/(.*)$`,
+		Headers: map[string]string{"x-device": `^(tv|phone)$`},
+	})
+	if err != nil {
+		t.Fatalf("NewRegexMatcher expected nil error, actual %v", err)
+	}
+
+	hdr := http.Header{"X-Device": {"tv"}}
+	captures, ok := m.Match("foo.example.net", "/video/a/b.mp4", "x=1", hdr)
+	if !ok {
+		t.Fatalf("RegexMatcher.Match expected match")
+	}
+
+	expected := "http://foo-origin.example/tv/a/b.mp4?cost=$1"
+	if actual := captures.Expand("http://${tenant}-origin.example/$3/$2?cost=$$1"); actual != expected {
+		t.Errorf("Captures.Expand expected '%v' actual '%v'", expected, actual)
+	}
+	if actual := captures.Expand("http://o.example/$9${nope}"); actual != "http://o.example/" {
+		t.Errorf("Captures.Expand of nonexistent captures expected empty, actual '%v'", actual)
+	}
+
+	if _, ok := m.Match("foo.example.net", "/video/a", "", http.Header{"X-Device": {"radio"}}); ok {
+		t.Errorf("RegexMatcher.Match expected header mismatch not to match")
+	}
+	if _, ok := m.Match("foo.example.net", "/video/a", "", http.Header{}); ok {
+		t.Errorf("RegexMatcher.Match expected missing header not to match")
+	}
+	if _, ok := m.Match("foo.example.net:8080", "/video/a", "", hdr); ok {
+		t.Errorf("RegexMatcher.Match expected host mismatch not to match")
+	}
+
+	if _, err := NewRegexMatcher(RemapMatch{Path: `(`}); err == nil {
+		t.Errorf("NewRegexMatcher expected error for invalid regex, actual nil")
+	}
+}
+
+func TestTemplateRegexp(t *testing.T) {
+	re := TemplateRegexp("http://${tenant}-origin.example/$1.mp4?cost=$$1")
+	matches := []string{
+		"http://foo-origin.example/a/b.mp4?cost=$1",
+		"http://bar-origin.example/c.mp4?cost=$1&x=1",
+	}
+	for _, url := range matches {
+		if !re.MatchString(url) {
+			t.Errorf("TemplateRegexp expected to match expansion '%v'", url)
+		}
+	}
+	noMatches := []string{
+		"http://foo.example/a.mp4?cost=$1",
+		"http://foo-originXexample/a.mp4?cost=$1",
+		"https://foo-origin.example/a.mp4?cost=$1",
+	}
+	for _, url := range noMatches {
+		if re.MatchString(url) {
+			t.Errorf("TemplateRegexp expected not to match '%v'", url)
+		}
+	}
+}
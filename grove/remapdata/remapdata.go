@@ -25,11 +25,16 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/chash"
+	"github.com/apache/trafficcontrol/grove/health"
 	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/ratelimit"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 )
 
+// DefaultMaxVariants is the maximum number of variants of an object with a Vary header to cache, for rules which don't specify it.
+const DefaultMaxVariants = 16
+
 // ParentSelectionType is the algorithm to use for selecting parents.
 type ParentSelectionType string
 
@@ -98,6 +103,18 @@ type RemapRuleBase struct {
 	RetryNum               *int                       `json:"retry_num"`
 	DSCP                   int                        `json:"dscp"`
 	PluginsShared          map[string]json.RawMessage `json:"plugins_shared"`
+	// StaleWhileRevalidateSeconds is how long objects without an RFC5861 stale-while-revalidate directive may be served stale while they're revalidated in the background. If this is 0, such objects aren't.
+	StaleWhileRevalidateSeconds int `json:"stale_while_revalidate_seconds"`
+	// StaleIfErrorSeconds is how long objects without an RFC5861 stale-if-error directive may be served stale when revalidating them fails with an error or 5xx. If this is 0, such objects are only served stale when the parent can't be reached at all.
+	StaleIfErrorSeconds int `json:"stale_if_error_seconds"`
+	// MaxVariants is the maximum number of variants of an object with a Vary header to cache. When a new variant is cached, the oldest is dropped. If this is 0, DefaultMaxVariants is used.
+	MaxVariants int `json:"max_variants"`
+	// HealthCheck is the configuration of active and passive health checking of the rule's parents. If nil, parents aren't checked, and are always sent requests.
+	HealthCheck *health.Config `json:"health_check"`
+	// Match is the regular expressions a request must match for the rule to apply, instead of the From prefix. Captured values are substituted into the To URLs. If nil, the From prefix is used.
+	Match *RemapMatch `json:"match"`
+	// RateLimit is the configuration of the rate of requests permitted to the rule, from all clients and from each client. If nil, requests aren't limited.
+	RateLimit *ratelimit.Config `json:"rate_limit"`
 }
 
 type RemapRule struct {
@@ -111,6 +128,14 @@ type RemapRule struct {
 	ConsistentHash  chash.ATSConsistentHash
 	Cache           icache.Cache
 	Plugins         map[string]interface{}
+	// Health is the health of the rule's parents. Parents marked down are skipped. If nil, all parents are considered available.
+	Health *health.Checker
+	// Matcher is the compiled Match, or nil if the rule matches its From prefix.
+	Matcher *RegexMatcher
+	// RateLimiter limits the rate of requests to the rule. If nil, requests aren't limited.
+	RateLimiter *ratelimit.Limiter
+	// ConfigJSON is the rule's JSON as loaded, followed by the JSON of the rules file without its rules, whose defaults the rule inherits. Rules with equal ConfigJSON have the same configuration.
+	ConfigJSON []byte
 }
 
 func (r *RemapRule) Allowed(ip net.IP) bool {
@@ -133,8 +158,8 @@ func (r *RemapRule) Allowed(ip net.IP) bool {
 	return false
 }
 
-// URI takes a request URI and maps it to the real URI to proxy-and-cache. The `failures` parameter indicates how many parents have tried and failed, indicating to skip to the nth hashed parent. Returns the URI to request, and the proxy URL (if any)
-func (r RemapRule) URI(fromURI string, path string, query string, failures int) (string, *url.URL, *http.Transport) {
+// URI takes a request URI and maps it to the real URI to proxy-and-cache. The `failures` parameter indicates how many parents have tried and failed, indicating to skip to the nth hashed parent. Parents marked down are skipped. The captures are the values captured by the rule's Matcher, if it has one. Returns the URI to request, the proxy URL (if any), and the To URL of the parent
+func (r RemapRule) URI(fromURI string, path string, query string, failures int, captures Captures) (string, *url.URL, *http.Transport, string) {
 	fromHash := path
 	if r.QueryString.Remap && query != "" {
 		fromHash += "?" + query
@@ -142,13 +167,16 @@ func (r RemapRule) URI(fromURI string, path string, query string, failures int)
 
 	// fmt.Println("RemapRule.URI fromURI " + fromHash)
 	to, proxyURI, transport := r.uriGetTo(fromHash, failures)
+	if r.Matcher != nil {
+		return expandTo(to, captures, query, r.QueryString.Remap), proxyURI, transport, to
+	}
 	uri := to + fromURI[len(r.From):]
 	if !r.QueryString.Remap {
 		if i := strings.Index(uri, "?"); i != -1 {
 			uri = uri[:i]
 		}
 	}
-	return uri, proxyURI, transport
+	return uri, proxyURI, transport, to
 }
 
 // uriGetTo is a helper func for URI. It returns the To URL, based on the Parent Selection type. In the event of failure, it logs the error and returns the first parent. Also returns the URL's Proxy URI (if any).
@@ -181,21 +209,29 @@ func (r RemapRule) uriGetToConsistentHash(fromURI string, failures int) (string,
 		return r.To[0].URL, r.To[0].ProxyURL, r.To[0].Transport
 	}
 
+	available := func(node *chash.ATSConsistentHashNode) bool { return r.Health.Up(node.Name) }
+	iter = chash.NextAvailable(iter, available)
 	for i := 0; i < failures; i++ {
-		iter = iter.NextWrap()
+		iter = chash.NextAvailable(iter.NextWrap(), available)
 	}
 
 	return iter.Val().Name, iter.Val().ProxyURL, iter.Val().Transport
 }
 
-func (r RemapRule) CacheKey(method string, fromURI string) string {
+// CacheKey returns the cache key of a request with the given method and URI. The captures are the values captured by the rule's Matcher, if it has one, and query is the request's raw query string.
+func (r RemapRule) CacheKey(method string, fromURI string, captures Captures, query string) string {
 	// TODO don't cache on `to`, since it's affected by Parent Selection
 	// TODO add parent selection
 	to := r.To[0].URL
-	uri := to + fromURI[len(r.From):]
-	if !r.QueryString.Cache {
-		if i := strings.Index(uri, "?"); i != -1 {
-			uri = uri[:i]
+	uri := ""
+	if r.Matcher != nil {
+		uri = expandTo(to, captures, query, r.QueryString.Cache)
+	} else {
+		uri = to + fromURI[len(r.From):]
+		if !r.QueryString.Cache {
+			if i := strings.Index(uri, "?"); i != -1 {
+				uri = uri[:i]
+			}
 		}
 	}
 	if method == http.MethodHead { // HEAD uses the same key as GET
@@ -205,6 +241,38 @@ func (r RemapRule) CacheKey(method string, fromURI string) string {
 	return key
 }
 
+// CacheURLMatcher returns a func which returns whether the URL of a cache key, without its method, may be the key of an object of the rule. That is, whether it starts with the rule's first To URL, or if the rule has a Matcher, with an expansion of it.
+func (r RemapRule) CacheURLMatcher() func(url string) bool {
+	if len(r.To) == 0 {
+		return func(string) bool { return false }
+	}
+	to := r.To[0].URL // CacheKey uses the first parent
+	if r.Matcher != nil {
+		return TemplateRegexp(to).MatchString
+	}
+	return func(url string) bool { return strings.HasPrefix(url, to) }
+}
+
+// ToURL returns the URL of the rule's ith To, with the given captures substituted if the rule has a Matcher.
+func (r RemapRule) ToURL(i int, captures Captures) string {
+	if r.Matcher == nil {
+		return r.To[i].URL
+	}
+	return captures.Expand(r.To[i].URL)
+}
+
+// expandTo returns the To URL of a rule with a Matcher, with the captures substituted. If withQuery, the request query is appended.
+func expandTo(to string, captures Captures, query string, withQuery bool) string {
+	uri := captures.Expand(to)
+	if !withQuery || query == "" {
+		return uri
+	}
+	if strings.Contains(uri, "?") {
+		return uri + "&" + query
+	}
+	return uri + "?" + query
+}
+
 type RemapRuleToBase struct {
 	URL      string   `json:"url"`
 	Weight   *float64 `json:"weight"`
@@ -223,3 +291,17 @@ type QueryStringRule struct {
 	Remap bool `json:"remap"`
 	Cache bool `json:"cache"`
 }
+
+// RulesDiff is the difference between two sets of remap rules, by rule name.
+type RulesDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+	// Reordered is whether rules in both sets are in a different order. Rules are matched in order, so this may change which rule matches a request.
+	Reordered bool `json:"reordered"`
+}
+
+// Empty returns whether there are no differences.
+func (d RulesDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && !d.Reordered
+}
@@ -0,0 +1,204 @@
+package sibling
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// OnlyIfCached is the request Cache-Control directive sent to siblings, so they respond from their cache, or with a 504 if they don't have the object, and never request it from their own parents or siblings.
+const OnlyIfCached = "only-if-cached"
+
+// Stats are the counts of a Siblings' lookups.
+type Stats struct {
+	Lookups uint64
+	// Hits is the number of lookups for which a sibling had the object.
+	Hits uint64
+	// Fetched is the number of objects successfully fetched from siblings, after a hit.
+	Fetched uint64
+}
+
+// Siblings are the peer caches of this cache, typically the other caches in its cache group, which are asked for objects missing from this cache before its parents.
+//
+// A nil *Siblings has no siblings.
+type Siblings struct {
+	siblings []*Sibling
+	ips      map[string]struct{} // the IPs of the siblings, for recognizing their requests
+	timeout  time.Duration
+	lookups  uint64
+	hits     uint64
+	fetched  uint64
+}
+
+// Sibling is a peer cache.
+type Sibling struct {
+	// Host is the sibling's host or IP, without a port.
+	Host       string
+	transports map[string]*http.Transport // by scheme
+}
+
+// New creates new Siblings with the given hosts. Siblings are requested on the same HTTP and HTTPS ports as this cache serves, and HTTPS requests are made with the SNI host of the client request. Lookups time out after the given timeout.
+func New(hosts []string, httpPort int, httpsPort int, timeout time.Duration, keepAlive time.Duration, maxIdleConns int, idleConnTimeout time.Duration) *Siblings {
+	if len(hosts) == 0 {
+		return nil
+	}
+	s := &Siblings{timeout: timeout, ips: map[string]struct{}{}}
+	for _, host := range hosts {
+		for _, ip := range lookUpIPs(host) {
+			s.ips[ip.String()] = struct{}{}
+		}
+		s.siblings = append(s.siblings, &Sibling{
+			Host: host,
+			transports: map[string]*http.Transport{
+				"http":  newTransport(net.JoinHostPort(host, strconv.Itoa(httpPort)), keepAlive, maxIdleConns, idleConnTimeout),
+				"https": newTransport(net.JoinHostPort(host, strconv.Itoa(httpsPort)), keepAlive, maxIdleConns, idleConnTimeout),
+			},
+		})
+	}
+	return s
+}
+
+// lookUpIPs returns the IPs of the given sibling host, which may be an IP, or a name which is resolved. If it can't be resolved, the error is logged, and no IPs are returned.
+func lookUpIPs(host string) []net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		log.Errorf("sibling %v resolving IPs, its requests won't be recognized as a sibling's: %v\n", host, err)
+		return nil
+	}
+	return ips
+}
+
+// IsSibling returns whether the given IP is one of the siblings', so its requests are on behalf of the sibling's clients.
+func (s *Siblings) IsSibling(ip net.IP) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.ips[ip.String()]
+	return ok
+}
+
+// newTransport returns a transport which connects to the given address for every request, whatever the request URL host, so requests may be made with the client request's URL, and TLS verified with its host.
+func newTransport(addr string, keepAlive time.Duration, maxIdleConns int, idleConnTimeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{KeepAlive: keepAlive}
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSClientConfig:     &tls.Config{},
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     idleConnTimeout,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// Transport returns the transport to request the sibling with the given scheme.
+func (s *Sibling) Transport(scheme string) *http.Transport {
+	return s.transports[scheme]
+}
+
+// CanLookUp returns whether a sibling may be asked for the object of the given client request: it must be a GET, which isn't itself from a sibling, and doesn't require the object from the origin or only part of it.
+func CanLookUp(method string, reqHeader http.Header, reqCacheControl rfc.CacheControlMap) bool {
+	return method == http.MethodGet && !reqCacheControl.Has(OnlyIfCached) && !reqCacheControl.Has("no-cache") && !reqCacheControl.Has("no-store") && reqHeader.Get("Range") == ""
+}
+
+// NewRequest returns the request to a sibling for the object of the given client request, with the given method. The URL is the client request's, with the given scheme.
+func NewRequest(method string, scheme string, clientReq *http.Request, reqHeader http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, scheme+"://"+clientReq.Host+clientReq.URL.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, vals := range reqHeader {
+		req.Header[name] = append([]string{}, vals...)
+	}
+	req.Header.Del("Connection")
+	req.Header.Set("Cache-Control", OnlyIfCached)
+	return req, nil
+}
+
+// LookUp asks every sibling at once whether it has the object of the given client request, with a HEAD only-if-cached request, and returns the first sibling which responds with a 200 within the timeout, or nil if none does.
+func (s *Siblings) LookUp(scheme string, clientReq *http.Request, reqHeader http.Header) *Sibling {
+	if s == nil {
+		return nil
+	}
+	atomic.AddUint64(&s.lookups, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	hits := make(chan *Sibling, len(s.siblings))
+	for _, sibling := range s.siblings {
+		go func(sibling *Sibling) {
+			if sibling.has(ctx, scheme, clientReq, reqHeader) {
+				hits <- sibling
+			} else {
+				hits <- nil
+			}
+		}(sibling)
+	}
+	for range s.siblings {
+		if sibling := <-hits; sibling != nil {
+			atomic.AddUint64(&s.hits, 1)
+			return sibling
+		}
+	}
+	return nil
+}
+
+// has returns whether the sibling has the object of the given client request cached.
+func (s *Sibling) has(ctx context.Context, scheme string, clientReq *http.Request, reqHeader http.Header) bool {
+	req, err := NewRequest(http.MethodHead, scheme, clientReq, reqHeader)
+	if err != nil {
+		log.Errorf("sibling %v lookup creating request: %v\n", s.Host, err)
+		return false
+	}
+	resp, err := s.Transport(scheme).RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		log.Debugf("sibling %v lookup %v error: %v\n", s.Host, req.URL, err)
+		return false
+	}
+	resp.Body.Close()
+	log.Debugf("sibling %v lookup %v returned %v\n", s.Host, req.URL, resp.StatusCode)
+	return resp.StatusCode == http.StatusOK
+}
+
+// AddFetched records that an object was successfully fetched from a sibling.
+func (s *Siblings) AddFetched() {
+	if s != nil {
+		atomic.AddUint64(&s.fetched, 1)
+	}
+}
+
+// Stats returns the counts of the siblings' lookups.
+func (s *Siblings) Stats() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	return Stats{
+		Lookups: atomic.LoadUint64(&s.lookups),
+		Hits:    atomic.LoadUint64(&s.hits),
+		Fetched: atomic.LoadUint64(&s.fetched),
+	}
+}
@@ -0,0 +1,131 @@
+package sibling
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-rfc"
+)
+
+// newTestSiblings returns Siblings with the single sibling of the given test server.
+func newTestSiblings(t *testing.T, server *httptest.Server, timeout time.Duration) *Siblings {
+	host, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("splitting test server address: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parsing test server port: %v", err)
+	}
+	return New([]string{host}, port, port, timeout, time.Second, 10, time.Second)
+}
+
+func TestLookUp(t *testing.T) {
+	cached := map[string]struct{}{"/cached": {}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cache-Control") != OnlyIfCached || r.Host != "cdn.example.net" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if _, ok := cached[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	cached["/slow"] = struct{}{}
+
+	siblings := newTestSiblings(t, server, 50*time.Millisecond)
+	tests := map[string]bool{"/cached": true, "/uncached": false, "/slow": false}
+	for path, expected := range tests {
+		clientReq, err := http.NewRequest(http.MethodGet, "http://cdn.example.net"+path+"?a=1", nil)
+		if err != nil {
+			t.Fatalf("creating request: %v", err)
+		}
+		clientReq.Header.Set("Cache-Control", "max-age=10")
+		if actual := siblings.LookUp("http", clientReq, clientReq.Header) != nil; actual != expected {
+			t.Errorf("LookUp '%v' expected hit %v, actual %v", path, expected, actual)
+		}
+	}
+	if stats := siblings.Stats(); stats.Lookups != 3 || stats.Hits != 1 {
+		t.Errorf("Stats expected 3 lookups and 1 hit, actual %+v", stats)
+	}
+
+	if sibling := (*Siblings)(nil).LookUp("http", &http.Request{}, nil); sibling != nil {
+		t.Errorf("LookUp with no siblings expected nil, actual %+v", sibling)
+	}
+	if siblings := New(nil, 80, 443, time.Second, time.Second, 10, time.Second); siblings != nil {
+		t.Errorf("New with no hosts expected nil, actual %+v", siblings)
+	}
+}
+
+func TestCanLookUp(t *testing.T) {
+	tests := []struct {
+		method       string
+		cacheControl string
+		rangeHdr     string
+		expected     bool
+	}{
+		{http.MethodGet, "", "", true},
+		{http.MethodGet, "max-age=10", "", true},
+		{http.MethodHead, "", "", false},
+		{http.MethodPost, "", "", false},
+		{http.MethodGet, OnlyIfCached, "", false},
+		{http.MethodGet, "no-cache", "", false},
+		{http.MethodGet, "", "bytes=0-10", false},
+	}
+	for _, test := range tests {
+		hdr := http.Header{}
+		if test.cacheControl != "" {
+			hdr.Set("Cache-Control", test.cacheControl)
+		}
+		if test.rangeHdr != "" {
+			hdr.Set("Range", test.rangeHdr)
+		}
+		if actual := CanLookUp(test.method, hdr, rfc.ParseCacheControl(hdr)); actual != test.expected {
+			t.Errorf("CanLookUp %v '%v' range '%v' expected %v, actual %v", test.method, test.cacheControl, test.rangeHdr, test.expected, actual)
+		}
+	}
+}
+
+func TestIsSibling(t *testing.T) {
+	s := New([]string{"192.0.2.1", "2001:db8::1", "localhost"}, 80, 443, time.Second, time.Second, 10, time.Second)
+	tests := map[string]bool{
+		"192.0.2.1":        true,
+		"::ffff:192.0.2.1": true,
+		"2001:db8::1":      true,
+		"2001:db8:0::1":    true,
+		"127.0.0.1":        true, // resolved from localhost
+		"192.0.2.2":        false,
+	}
+	for ip, expected := range tests {
+		if actual := s.IsSibling(net.ParseIP(ip)); actual != expected {
+			t.Errorf("IsSibling %v expected %v, actual %v", ip, expected, actual)
+		}
+	}
+	if (*Siblings)(nil).IsSibling(net.ParseIP("192.0.2.1")) {
+		t.Errorf("IsSibling of nil Siblings expected false, actual true")
+	}
+}
@@ -21,8 +21,12 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/certstore"
+	"github.com/apache/trafficcontrol/grove/health"
 	"github.com/apache/trafficcontrol/grove/icache"
+	"github.com/apache/trafficcontrol/grove/ratelimit"
 	"github.com/apache/trafficcontrol/grove/remapdata"
+	"github.com/apache/trafficcontrol/grove/sibling"
 	"github.com/apache/trafficcontrol/grove/web"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
@@ -34,6 +38,8 @@ type StatsSystem interface {
 	AddConfigReload()
 	SetLastReload(time.Time)
 	SetAstatsLoad(time.Time)
+	SetCertificates([]certstore.Info)
+	SetSiblings(*sibling.Siblings)
 
 	ConfigReloadRequests() uint64
 	LastReloadRequest() time.Time
@@ -41,6 +47,10 @@ type StatsSystem interface {
 	LastReload() time.Time
 	AstatsLoad() time.Time
 	Version() string
+	// Certificates returns the TLS certificates being served, and when they expire.
+	Certificates() []certstore.Info
+	// Siblings returns the counts of lookups of objects from sibling caches.
+	Siblings() sibling.Stats
 }
 
 type Stats interface {
@@ -65,13 +75,37 @@ type Stats interface {
 	CacheCapacityByName(string) (uint64, bool)
 	CacheNames() []string
 	CachePeek(string, string) (*cacheobj.CacheObj, bool)
+	CacheStatsByName(string) (icache.Stats, bool)
+	CacheTierStatsByName(string) (icache.Stats, icache.Stats, bool)
+
+	// ParentHealth returns the health of the parents of each remap rule with health checks, by rule name and parent URL.
+	ParentHealth() map[string]map[string]health.Status
+	// RateLimits returns the rate limiting stats of each remap rule with a rate limit, by rule name.
+	RateLimits() map[string]ratelimit.Stats
 }
 
 func New(remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cacheCapacityBytes uint64, httpConns *web.ConnMap, httpsConns *web.ConnMap, version string) Stats {
+	return NewWithSystem(NewStatsSystem(version), remapRules, caches, cacheCapacityBytes, httpConns, httpsConns)
+}
+
+// NewWithSystem is like New, but with the given system stats, so system stats such as config reloads may be kept when the other stats are recreated.
+func NewWithSystem(system StatsSystem, remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cacheCapacityBytes uint64, httpConns *web.ConnMap, httpsConns *web.ConnMap) Stats {
 	cacheHits := uint64(0)
 	cacheMisses := uint64(0)
+	parentHealth := map[string]*health.Checker{}
+	for _, rule := range remapRules {
+		if rule.Health != nil {
+			parentHealth[rule.Name] = rule.Health
+		}
+	}
+	rateLimiters := map[string]*ratelimit.Limiter{}
+	for _, rule := range remapRules {
+		if rule.RateLimiter != nil {
+			rateLimiters[rule.Name] = rule.RateLimiter
+		}
+	}
 	return &stats{
-		system:             NewStatsSystem(version),
+		system:             system,
 		remap:              NewStatsRemaps(remapRules),
 		cacheHits:          &cacheHits,
 		cacheMisses:        &cacheMisses,
@@ -79,10 +113,12 @@ func New(remapRules []remapdata.RemapRule, caches map[string]icache.Cache, cache
 		cacheCapacityBytes: cacheCapacityBytes,
 		httpConns:          httpConns,
 		httpsConns:         httpsConns,
+		parentHealth:       parentHealth,
+		rateLimiters:       rateLimiters,
 	}
 }
 
-// Write writes to the remapRuleStats of s, and returns the bytes written to the connection
+// Write writes to the remapRuleStats of s, and returns the bytes written to the connection. The reqFQDN is the stats key of the request's rule, see NewStatsRemaps.
 func (stats *stats) Write(w http.ResponseWriter, conn *web.InterceptConn, reqFQDN string, remoteAddr string, code int, bytesWritten uint64, cacheHit bool) uint64 {
 	remapRuleStats, ok := stats.Remap().Stats(reqFQDN)
 	if !ok {
@@ -142,6 +178,8 @@ type stats struct {
 	cacheCapacityBytes uint64
 	httpConns          *web.ConnMap
 	httpsConns         *web.ConnMap
+	parentHealth       map[string]*health.Checker
+	rateLimiters       map[string]*ratelimit.Limiter
 }
 
 func (s stats) Connections() uint64 {
@@ -206,6 +244,46 @@ func (s stats) CacheCapacityByName(cName string) (uint64, bool) {
 
 func (s stats) CacheCapacity() uint64 { return s.cacheCapacityBytes }
 
+func (s stats) ParentHealth() map[string]map[string]health.Status {
+	statuses := make(map[string]map[string]health.Status, len(s.parentHealth))
+	for rule, checker := range s.parentHealth {
+		statuses[rule] = checker.Statuses()
+	}
+	return statuses
+}
+
+func (s stats) RateLimits() map[string]ratelimit.Stats {
+	limits := make(map[string]ratelimit.Stats, len(s.rateLimiters))
+	for rule, limiter := range s.rateLimiters {
+		limits[rule] = limiter.Stats()
+	}
+	return limits
+}
+
+// CacheStatsByName returns the request and admission stats of the named cache, and whether the cache exists and counts them.
+func (s stats) CacheStatsByName(cName string) (icache.Stats, bool) {
+	statser, ok := s.caches[cName].(icache.Statser)
+	if !ok {
+		return icache.Stats{}, false
+	}
+	return statser.Stats(), true
+}
+
+// tierStatser is a cache made of two tiers, which counts requests and admissions of each, e.g. a tiercache.TierCache.
+type tierStatser interface {
+	TierStats() (icache.Stats, icache.Stats)
+}
+
+// CacheTierStatsByName returns the request and admission stats of the first and second tiers of the named cache, and whether the cache exists and has tiers.
+func (s stats) CacheTierStatsByName(cName string) (icache.Stats, icache.Stats, bool) {
+	tiered, ok := s.caches[cName].(tierStatser)
+	if !ok {
+		return icache.Stats{}, icache.Stats{}, false
+	}
+	first, second := tiered.TierStats()
+	return first, second, true
+}
+
 type StatsRemaps interface {
 	Stats(fqdn string) (StatsRemap, bool)
 	Rules() []string
@@ -244,10 +322,15 @@ func getFromFQDN(r remapdata.RemapRule) string {
 	return path
 }
 
+// NewStatsRemaps returns the stats of the given rules. Rules are keyed by the FQDN of their From, except rules with a regex match, which may match any host, and are keyed by their name.
 func NewStatsRemaps(remapRules []remapdata.RemapRule) StatsRemaps {
 	m := make(map[string]StatsRemap, len(remapRules))
 	for _, rule := range remapRules {
-		m[getFromFQDN(rule)] = NewStatsRemap() // must pre-allocate, for threadsafety, so users are never changing the map itself, only the value pointed to.
+		key := getFromFQDN(rule)
+		if rule.Matcher != nil {
+			key = rule.Name
+		}
+		m[key] = NewStatsRemap() // must pre-allocate, for threadsafety, so users are never changing the map itself, only the value pointed to.
 	}
 	return statsRemaps(m)
 }
@@ -313,6 +396,8 @@ type statsSystem struct {
 	lastReloadUnixNano        int64
 	astatsLoadUnixNano        int64
 	version                   string
+	certificates              atomic.Value // []certstore.Info
+	siblings                  atomic.Value // *sibling.Siblings
 }
 
 func (s *statsSystem) ConfigReloadRequests() uint64 {
@@ -348,6 +433,20 @@ func (s *statsSystem) SetAstatsLoad(t time.Time) {
 func (s *statsSystem) Version() string {
 	return s.version
 }
+func (s *statsSystem) Certificates() []certstore.Info {
+	certs, _ := s.certificates.Load().([]certstore.Info)
+	return certs
+}
+func (s *statsSystem) SetCertificates(certs []certstore.Info) {
+	s.certificates.Store(certs)
+}
+func (s *statsSystem) Siblings() sibling.Stats {
+	siblings, _ := s.siblings.Load().(*sibling.Siblings)
+	return siblings.Stats()
+}
+func (s *statsSystem) SetSiblings(siblings *sibling.Siblings) {
+	s.siblings.Store(siblings)
+}
 
 const ATSVersion = "5.3.2" // of course, we're not really ATS. We're terrible liars.
 
@@ -173,3 +173,19 @@ func TestStatsCount(t *testing.T) {
 	}
 
 }
+
+func TestNewStatsRemapsRegexRules(t *testing.T) {
+	matcher, err := remapdata.NewRegexMatcher(remapdata.RemapMatch{Host: `^(.+)\.example\.net$`})
+	if err != nil {
+		t.Fatalf("NewRegexMatcher expected nil error, actual %v", err)
+	}
+	literal := remapdata.RemapRule{RemapRuleBase: remapdata.RemapRuleBase{Name: "literal", From: "http://foo.example.net/"}}
+	regex := remapdata.RemapRule{RemapRuleBase: remapdata.RemapRuleBase{Name: "regex"}, Matcher: matcher}
+	remaps := NewStatsRemaps([]remapdata.RemapRule{literal, regex})
+	if _, ok := remaps.Stats("foo.example.net"); !ok {
+		t.Errorf("Stats of literal rule by From FQDN expected found, actual not found")
+	}
+	if _, ok := remaps.Stats("regex"); !ok {
+		t.Errorf("Stats of regex rule by name expected found, actual not found")
+	}
+}
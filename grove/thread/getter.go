@@ -30,7 +30,7 @@ type GetterResp struct {
 }
 
 func NewGetter() Getter {
-	return &getter{waiters: map[string][]chan GetterResp{}}
+	return &getter{waiters: map[string][]chan GetterResp{}, fetching: map[string]GetterResp{}}
 }
 
 // getter implements Getter, and does a fan-in so only one real request is made to the parent at any given time, and then that object is given to all concurrent requesters.
@@ -40,12 +40,16 @@ func NewGetter() Getter {
 // Then, when other requests come in, they see that waiters[key] exists, and add themselves to it, and block reading from their chan.
 // Then, when the Author gets its response, it iterates over the Waiters and sends the response to all of them, at the same time (with the same lock, atomically) clearing the waiters for the next request that comes in.
 //
+// Objects are returned before their bodies have been fetched, and aren't cached until they have. So, until the Author's object body is done, subsequent requests which can use it are given it, rather than making their own request.
+//
 // If the Author response can't be used, all Waiters make their own requests.
 // Note this assumes an uncacheable response for one request is likely uncacheable for all, and it's faster and less load on the origin if so.
 // If it's likely the author request is uncacheable, but a different waiter is cacheable for all other waiters, this will be more network, more origin load, and more work. If that's the case for you, consider creating another type that fulfills the Getter interface, and making the Getter configurable.
 type getter struct {
 	// waiters is a map of cache keys to chans for getters.
-	waiters  map[string][]chan GetterResp
+	waiters map[string][]chan GetterResp
+	// fetching is a map of cache keys to objects whose bodies are still being fetched.
+	fetching map[string]GetterResp
 	waitersM sync.Mutex
 }
 
@@ -56,6 +60,10 @@ func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse fun
 	getChan := make(chan GetterResp, 1)
 
 	g.waitersM.Lock()
+	if fetchResp, ok := g.fetching[key]; ok && canUse(fetchResp.CacheObj) {
+		g.waitersM.Unlock()
+		return fetchResp.CacheObj, fetchResp.GetReqID
+	}
 	if _, ok := g.waiters[key]; !ok {
 		isAuthor = true
 		g.waiters[key] = []chan GetterResp{}
@@ -73,6 +81,10 @@ func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse fun
 			waitChan <- waitResp
 		}
 		delete(g.waiters, key)
+		if obj.Body != nil {
+			g.fetching[key] = waitResp
+			go g.doneFetching(key, waitResp)
+		}
 		g.waitersM.Unlock()
 
 		return obj, reqID
@@ -85,3 +97,13 @@ func (g *getter) Get(key string, actualGet func() *cacheobj.CacheObj, canUse fun
 	// if the Author response can't be used, all Waiters make their own requests
 	return actualGet(), reqID
 }
+
+// doneFetching removes the given response from the fetching objects, once its body is done.
+func (g *getter) doneFetching(key string, resp GetterResp) {
+	<-resp.CacheObj.Body.Done()
+	g.waitersM.Lock()
+	defer g.waitersM.Unlock()
+	if g.fetching[key] == resp {
+		delete(g.fetching, key)
+	}
+}
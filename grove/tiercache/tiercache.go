@@ -15,6 +15,9 @@ package tiercache
 */
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/apache/trafficcontrol/grove/cacheobj"
 	"github.com/apache/trafficcontrol/grove/icache"
 
@@ -27,13 +30,19 @@ import (
 //
 // An alternative implementation would be to Add to the first only, and when an object is evicted from the first, then store in the second. That would be more efficient for any given frequency, but less efficient for known infrequent objects.
 type TierCache struct {
-	first  icache.Cache
-	second icache.Cache
+	first       icache.Cache
+	second      icache.Cache
+	promoteHits uint64
+	promoting   map[string]struct{} // mutexed: MUST NOT access without locking promotingM. The keys of objects being promoted.
+	promotingM  sync.Mutex
 }
 
-// New creates a new TierCache with the given first and second caches to use.
-func New(first, second icache.Cache) *TierCache {
-	return &TierCache{first: first, second: second}
+// MaxPromoteFraction is the inverse of the largest fraction of the first cache's capacity an object may be to be promoted to it from the second. Larger objects are only served from the second cache, so promoting them doesn't read their whole bodies into memory, nor evict most of the first cache.
+const MaxPromoteFraction = 8
+
+// New creates a new TierCache with the given first and second caches to use. If promoteHits is 0, objects are added to both caches. Otherwise, new objects are only added to the second cache, and added to the first after they've been hit promoteHits times in the second, so objects requested once don't evict frequently requested objects from the first.
+func New(first, second icache.Cache, promoteHits uint64) *TierCache {
+	return &TierCache{first: first, second: second, promoteHits: promoteHits, promoting: map[string]struct{}{}}
 }
 
 // Get returns the object if it's in the first cache. Else, it returns the object from the second cache. Else, false.
@@ -43,15 +52,88 @@ func (c *TierCache) Get(key string) (*cacheobj.CacheObj, bool) {
 	log.Debugf("TierCache.Get '"+key+"' FOUND FIRST: %+v\n", ok)
 	if !ok {
 		v, ok = c.second.Get(key)
-		if ok {
+		// HitCount includes the request which added the object, so it's been hit promoteHits times when it exceeds promoteHits
+		if ok && atomic.LoadUint64(&v.HitCount) > c.promoteHits && c.canPromote(v) && c.startPromoting(key) {
 			// if it was in second but not first, add back to first (LRU behavior)
-			c.first.Add(key, v)
+			obj := *v // copied before returning, because the second cache may update it concurrently
+			go func() {
+				defer c.donePromoting(key)
+				c.promote(key, &obj)
+			}()
 		}
 		log.Debugf("TierCache.Get '"+key+"' FOUND SECOND: %+v\n", ok)
 	}
 	return v, ok
 }
 
+// canPromote returns whether the given object is small enough to be promoted to the first cache.
+func (c *TierCache) canPromote(v *cacheobj.CacheObj) bool {
+	return v.Size <= c.first.Capacity()/MaxPromoteFraction
+}
+
+// startPromoting returns whether the object with the given key may be promoted, because it isn't already being promoted. If it returns true, donePromoting must be called when the promotion is done.
+func (c *TierCache) startPromoting(key string) bool {
+	c.promotingM.Lock()
+	defer c.promotingM.Unlock()
+	if _, ok := c.promoting[key]; ok {
+		return false
+	}
+	c.promoting[key] = struct{}{}
+	return true
+}
+
+func (c *TierCache) donePromoting(key string) {
+	c.promotingM.Lock()
+	defer c.promotingM.Unlock()
+	delete(c.promoting, key)
+}
+
+// promote adds the given object from the second cache to the first. The second cache's body may not be in memory, e.g. if it's a disk cache, so it's read into memory first, so the first cache is actually faster. This reads the whole body, and should be called in a goroutine.
+func (c *TierCache) promote(key string, v *cacheobj.CacheObj) {
+	body := cacheobj.NewMemBody()
+	if _, err := body.ReadFrom(cacheobj.NewReader(v.Body)); err != nil {
+		log.Errorln("TierCache.promote '" + key + "' reading body from second cache: " + err.Error())
+		return
+	}
+	// the object may have been removed or invalidated while its body was read
+	cur, ok := c.second.Peek(key)
+	if !ok {
+		return
+	}
+	obj := *v
+	obj.Body = body
+	obj.Invalidated = cur.Invalidated
+	c.first.Add(key, &obj)
+}
+
+// Warm adds the hottest objects of the second cache to the first, until the first is full, if the second cache is an icache.Hotter. This reads the objects' bodies, and should be called in a goroutine.
+func (c *TierCache) Warm() {
+	hotter, ok := c.second.(icache.Hotter)
+	if !ok {
+		log.Warnf("TierCache.Warm second cache %T can't list its hottest objects, not warming\n", c.second)
+		return
+	}
+	warmed := 0
+	for _, key := range hotter.HottestKeys() {
+		size, capacity := c.first.Size(), c.first.Capacity()
+		if size >= capacity {
+			break
+		}
+		free := capacity - size
+		if _, ok := c.first.Peek(key); ok {
+			continue
+		}
+		v, ok := c.second.Peek(key)
+		if !ok || v.Size > free || !c.canPromote(v) || !c.startPromoting(key) {
+			continue
+		}
+		c.promote(key, v)
+		c.donePromoting(key)
+		warmed++
+	}
+	log.Infof("TierCache.Warm added %v objects to the first cache\n", warmed)
+}
+
 // Peek returns the object if it's in the first cache. Else, it returns the object from the second cache. Else, false.
 // Peek does not change the lru-ness, or the first cache
 func (c *TierCache) Peek(key string) (*cacheobj.CacheObj, bool) {
@@ -63,12 +145,63 @@ func (c *TierCache) Peek(key string) (*cacheobj.CacheObj, bool) {
 }
 
 // Add adds to both internal caches. Returns whether either reported an eviction.
+// If the TierCache has promoteHits, objects not already in the first cache are only added to the second, and are promoted to the first by Get.
+// Objects whose bodies aren't in memory, e.g. because they were spooled to the second cache, are only added to the second, and any older object in the first is removed. They're promoted to the first by Get.
 func (c *TierCache) Add(key string, val *cacheobj.CacheObj) bool {
-	aevict := c.first.Add(key, val)
+	aevict := false
+	_, inFirst := c.first.Peek(key)
+	if !cacheobj.InMemory(val.Body) {
+		if inFirst {
+			c.first.Remove(key)
+		}
+	} else if c.promoteHits == 0 || inFirst {
+		aevict = c.first.Add(key, val)
+	}
 	bevict := c.second.Add(key, val)
 	return aevict || bevict
 }
 
+// Spool implements icache.Spooler, spooling to the second cache, if it's an icache.Spooler. Else, it returns nil.
+func (c *TierCache) Spool(key string, size uint64) cacheobj.Spool {
+	spooler, ok := c.second.(icache.Spooler)
+	if !ok {
+		return nil
+	}
+	return spooler.Spool(key, size)
+}
+
+// Remove removes from both internal caches. Returns whether either had the object.
+func (c *TierCache) Remove(key string) bool {
+	aok := c.first.Remove(key)
+	bok := c.second.Remove(key)
+	return aok || bok
+}
+
+// Invalidate invalidates in both internal caches. Returns whether either had the object.
+func (c *TierCache) Invalidate(key string) bool {
+	aok := c.first.Invalidate(key)
+	bok := c.second.Invalidate(key)
+	return aok || bok
+}
+
+// Stats returns the stats of the TierCache as a whole: hits in either cache, misses in the second cache, and objects admitted and rejected by the second cache. If either cache isn't an icache.Statser, its stats are zero.
+func (c *TierCache) Stats() icache.Stats {
+	first, second := c.TierStats()
+	return icache.Stats{Hits: first.Hits + second.Hits, Misses: second.Misses, Admitted: second.Admitted, Rejected: second.Rejected}
+}
+
+// TierStats returns the stats of the first and second caches. Note the second cache is only requested when the first misses. If either cache isn't an icache.Statser, its stats are zero.
+func (c *TierCache) TierStats() (icache.Stats, icache.Stats) {
+	first, second := icache.Stats{}, icache.Stats{}
+	if statser, ok := c.first.(icache.Statser); ok {
+		first = statser.Stats()
+	}
+	if statser, ok := c.second.(icache.Statser); ok {
+		second = statser.Stats()
+	}
+	return first, second
+}
+
 // Size returns the size of the second cache. This is because, since all objects are added to both, they are presumed to have the same content, and the second is presumed to be larger.
 //
 // For example, if the first is a memory cache and the second is a disk cache, it's most useful to report the size used on disk.
@@ -0,0 +1,139 @@
+package tiercache
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/grove/cacheobj"
+	"github.com/apache/trafficcontrol/grove/memcache"
+)
+
+func newTestObj(body string) *cacheobj.CacheObj {
+	return cacheobj.New(http.Header{}, cacheobj.NewMemBodyBytes([]byte(body)), http.StatusOK, http.StatusOK, "", http.Header{}, time.Now(), time.Now(), time.Now(), time.Now())
+}
+
+// waitFor returns whether the given func returns true within a second.
+func waitFor(f func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if f() {
+			return true
+		}
+	}
+	return f()
+}
+
+func TestPromoteHits(t *testing.T) {
+	first, second := memcache.New(1024, nil), memcache.New(1024, nil)
+	c := New(first, second, 2)
+
+	c.Add("a", newTestObj("foo"))
+	if _, ok := first.Peek("a"); ok {
+		t.Fatalf("first cache after Add expected not found, actual found")
+	}
+	if _, ok := second.Peek("a"); !ok {
+		t.Fatalf("second cache after Add expected found, actual not found")
+	}
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("Get expected found, actual not found")
+	}
+	// promotion is only started by a Get with enough hits, so the first cache can be checked immediately
+	if _, ok := first.Peek("a"); ok {
+		t.Fatalf("first cache after 1 hit expected not found, actual found")
+	}
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("Get expected found, actual not found")
+	}
+	if !waitFor(func() bool { _, ok := first.Peek("a"); return ok }) {
+		t.Fatalf("first cache after 2 hits expected found, actual not found")
+	}
+	obj, _ := first.Peek("a")
+	if chunk, err := obj.Body.Chunk(0); err != nil || string(chunk) != "foo" {
+		t.Errorf("promoted body expected %v, actual %v error %v", "foo", string(chunk), err)
+	}
+
+	// objects already in the first cache are replaced in both
+	c.Add("a", newTestObj("bar"))
+	if obj, ok := first.Peek("a"); !ok || obj.Size != 3 {
+		t.Errorf("first cache after replacing expected found, actual found %v", ok)
+	} else if chunk, _ := obj.Body.Chunk(0); string(chunk) != "bar" {
+		t.Errorf("first cache body after replacing expected %v, actual %v", "bar", string(chunk))
+	}
+}
+
+func TestPromoteHitsZero(t *testing.T) {
+	first, second := memcache.New(1024, nil), memcache.New(1024, nil)
+	c := New(first, second, 0)
+	c.Add("a", newTestObj("foo"))
+	if _, ok := first.Peek("a"); !ok {
+		t.Errorf("first cache without promoteHits expected found, actual not found")
+	}
+	if _, ok := second.Peek("a"); !ok {
+		t.Errorf("second cache without promoteHits expected found, actual not found")
+	}
+}
+
+func TestPromoteTooLarge(t *testing.T) {
+	first, second := memcache.New(8*MaxPromoteFraction, nil), memcache.New(1024, nil)
+	c := New(first, second, 1)
+
+	c.Add("small", newTestObj("12345678"))
+	c.Add("large", newTestObj("123456789"))
+	c.Get("small")
+	c.Get("large")
+	if !waitFor(func() bool { _, ok := first.Peek("small"); return ok }) {
+		t.Errorf("first cache after hitting small object expected found, actual not found")
+	}
+	// promotion isn't started for objects which are too large, so the first cache can be checked immediately
+	if _, ok := first.Peek("large"); ok {
+		t.Errorf("first cache after hitting large object expected not found, actual found")
+	}
+}
+
+func TestPromoteInFlight(t *testing.T) {
+	first, second := memcache.New(1024, nil), memcache.New(1024, nil)
+	c := New(first, second, 1)
+	c.Add("a", newTestObj("foo"))
+
+	if !c.startPromoting("a") {
+		t.Fatalf("startPromoting expected true, actual false")
+	}
+	if c.startPromoting("a") {
+		t.Errorf("startPromoting while promoting expected false, actual true")
+	}
+	// a hit while the object is being promoted doesn't promote it again
+	c.Get("a")
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := first.Peek("a"); ok {
+		t.Errorf("first cache after hit while promoting expected not found, actual found")
+	}
+
+	c.donePromoting("a")
+	c.Get("a")
+	if !waitFor(func() bool { _, ok := first.Peek("a"); return ok }) {
+		t.Errorf("first cache after hit when done promoting expected found, actual not found")
+	}
+	if !waitFor(func() bool {
+		c.promotingM.Lock()
+		defer c.promotingM.Unlock()
+		return len(c.promoting) == 0
+	}) {
+		t.Errorf("promoting after promotion done expected no keys, actual keys")
+	}
+}
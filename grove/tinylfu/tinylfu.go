@@ -0,0 +1,118 @@
+package tinylfu
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"sync"
+
+	"github.com/dchest/siphash"
+)
+
+// DefaultCounters is the default number of counters in each row of the frequency sketch. Each counter is 4 bits, so the default sketch uses 2MiB.
+const DefaultCounters = 1 << 20
+
+// depth is the number of rows in the frequency sketch, each using a different hash of the key.
+const depth = 4
+
+// countersPerWord is the number of 4-bit counters in each uint64.
+const countersPerWord = 16
+
+// maxCount is the maximum value of a 4-bit counter.
+const maxCount = 15
+
+// TinyLFU is a cache admission filter, which admits a new object to a full cache only if it's been requested more frequently than the object it would evict. Frequencies are estimated with a Count-Min Sketch of 4-bit counters, which are halved periodically, so old popularity decays.
+//
+// See "TinyLFU: A Highly Efficient Cache Admission Policy" by Einziger, Friedman, and Manes.
+type TinyLFU struct {
+	rows       [depth][]uint64
+	mask       uint64
+	additions  uint64
+	sampleSize uint64
+	m          sync.Mutex
+}
+
+// New creates a new TinyLFU with the given number of counters per row, rounded up to a power of 2. If counters is 0, DefaultCounters is used. The counters are halved after 10 times as many requests as counters, so the number of counters should be roughly the number of objects the cache holds.
+func New(counters uint64) *TinyLFU {
+	if counters == 0 {
+		counters = DefaultCounters
+	}
+	width := uint64(countersPerWord)
+	for width < counters {
+		width *= 2
+	}
+	f := &TinyLFU{mask: width - 1, sampleSize: 10 * width}
+	for i := range f.rows {
+		f.rows[i] = make([]uint64, width/countersPerWord)
+	}
+	return f
+}
+
+// Access records a request for the given key.
+func (f *TinyLFU) Access(key string) {
+	idxs := f.indexes(key)
+	f.m.Lock()
+	defer f.m.Unlock()
+	for i, idx := range idxs {
+		word, shift := idx/countersPerWord, (idx%countersPerWord)*4
+		if (f.rows[i][word]>>shift)&maxCount < maxCount {
+			f.rows[i][word] += 1 << shift
+		}
+	}
+	f.additions++
+	if f.additions >= f.sampleSize {
+		f.reset()
+	}
+}
+
+// Admit returns whether the candidate key has been requested more frequently than the victim key, which would be evicted to add it.
+func (f *TinyLFU) Admit(candidate, victim string) bool {
+	return f.Estimate(candidate) > f.Estimate(victim)
+}
+
+// Estimate returns the estimated number of recent requests for the given key. It may overestimate, but never underestimates, up to the maximum of 15.
+func (f *TinyLFU) Estimate(key string) uint64 {
+	idxs := f.indexes(key)
+	f.m.Lock()
+	defer f.m.Unlock()
+	min := uint64(maxCount)
+	for i, idx := range idxs {
+		word, shift := idx/countersPerWord, (idx%countersPerWord)*4
+		if count := (f.rows[i][word] >> shift) & maxCount; count < min {
+			min = count
+		}
+	}
+	return min
+}
+
+// indexes returns the counter index of the key in each row, via double hashing.
+func (f *TinyLFU) indexes(key string) [depth]uint64 {
+	h := siphash.Hash(0, 0, []byte(key))
+	h1, h2 := h&0xffffffff, h>>32
+	idxs := [depth]uint64{}
+	for i := range idxs {
+		idxs[i] = (h1 + uint64(i)*h2) & f.mask
+	}
+	return idxs
+}
+
+// reset halves all counters. It must be called with the mutex locked.
+func (f *TinyLFU) reset() {
+	for _, row := range f.rows {
+		for i, word := range row {
+			row[i] = (word >> 1) & 0x7777777777777777
+		}
+	}
+	f.additions /= 2
+}
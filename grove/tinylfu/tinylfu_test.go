@@ -0,0 +1,58 @@
+package tinylfu
+
+/*
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+import (
+	"testing"
+)
+
+func TestTinyLFU(t *testing.T) {
+	f := New(1024)
+	for i := 0; i < 5; i++ {
+		f.Access("hot")
+	}
+	f.Access("cold")
+
+	if est := f.Estimate("hot"); est != 5 {
+		t.Errorf("expected hot estimate 5, actual %v", est)
+	}
+	if !f.Admit("hot", "cold") {
+		t.Errorf("expected hot to be admitted over cold")
+	}
+	if f.Admit("cold", "hot") {
+		t.Errorf("expected cold to be rejected over hot")
+	}
+	if f.Admit("new", "cold") {
+		t.Errorf("expected unrequested key to be rejected over cold")
+	}
+
+	for i := 0; i < 100; i++ {
+		f.Access("hot")
+	}
+	if est := f.Estimate("hot"); est != maxCount {
+		t.Errorf("expected hot estimate to saturate at %v, actual %v", maxCount, est)
+	}
+
+	// 10 times as many requests as counters halves all counters
+	for i := uint64(0); i < f.sampleSize; i++ {
+		f.Access("other")
+	}
+	if est := f.Estimate("cold"); est != 0 {
+		t.Errorf("expected cold estimate to decay to 0, actual %v", est)
+	}
+	if est := f.Estimate("hot"); est != maxCount/2 {
+		t.Errorf("expected hot estimate to decay to %v, actual %v", maxCount/2, est)
+	}
+}
@@ -67,14 +67,14 @@ func InterceptListen(network, laddr string) (net.Listener, *ConnMap, func(net.Co
 }
 
 // InterceptListenTLS is like InterceptListen but for serving HTTPS. It returns the tls.Config, which must be set on the http.Server using this listener for HTTP/2 to be set up.
-func InterceptListenTLS(network string, laddr string, certs []tls.Certificate, h2Disabled bool) (net.Listener, *ConnMap, func(net.Conn, http.ConnState), *tls.Config, error) {
+// The getCertificate func is called for each new connection, with the client's SNI, so certificates may be changed without recreating the listener.
+func InterceptListenTLS(network string, laddr string, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), h2Disabled bool) (net.Listener, *ConnMap, func(net.Conn, http.ConnState), *tls.Config, error) {
 	config := &tls.Config{}
 	// HTTP2 is enabled if config.DisableHTTP2 is false
 	if !h2Disabled {
 		config.NextProtos = []string{"h2"}
 	}
-	config.Certificates = certs
-	config.BuildNameToCertificate()
+	config.GetCertificate = getCertificate
 	l, err := net.Listen(network, laddr)
 	if err != nil {
 		return l, nil, nil, nil, err
@@ -16,7 +16,7 @@ package web
 
 import (
 	"errors"
-	"io/ioutil"
+	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -108,7 +108,8 @@ func TryFlush(w http.ResponseWriter) {
 }
 
 // request makes the given request and returns its response code, headers, body, the request time, response time, and any error.
-func Request(transport *http.Transport, r *http.Request) (int, http.Header, []byte, time.Time, time.Time, error) {
+// The body is streamed from the parent as it's read, and MUST be closed by the caller.
+func Request(transport *http.Transport, r *http.Request) (int, http.Header, io.ReadCloser, time.Time, time.Time, error) {
 	log.Debugf("request requesting %v headers %v\n", r.RequestURI, r.Header)
 	rr := r
 
@@ -118,20 +119,13 @@ func Request(transport *http.Transport, r *http.Request) (int, http.Header, []by
 	if err != nil {
 		return 0, nil, nil, reqTime, respTime, errors.New("request error: " + err.Error())
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
 	// TODO determine if respTime should go here
-
-	if err != nil {
-		return 0, nil, nil, reqTime, respTime, errors.New("reading response body: " + err.Error())
-	}
-
-	return resp.StatusCode, resp.Header, body, reqTime, respTime, nil
+	return resp.StatusCode, resp.Header, resp.Body, reqTime, respTime, nil
 }
 
 // Respond writes the given code, header, and body to the ResponseWriter. If connectionClose, a Connection: Close header is also written. Returns the bytes written, and any error.
-func Respond(w http.ResponseWriter, code int, header http.Header, body []byte, connectionClose bool) (uint64, error) {
+// The body is copied to the client as it's read, and may be nil for no body.
+func Respond(w http.ResponseWriter, code int, header http.Header, body io.Reader, connectionClose bool) (uint64, error) {
 	// TODO move connectionClose to modhdr plugin
 	dH := w.Header()
 	CopyHeaderTo(header, &dH)
@@ -139,7 +133,10 @@ func Respond(w http.ResponseWriter, code int, header http.Header, body []byte, c
 		dH.Add("Connection", "close")
 	}
 	w.WriteHeader(code)
-	bytesWritten, err := w.Write(body) // get the less-accurate body bytes written, in case we can't get the more accurate intercepted data
+	if body == nil {
+		return 0, nil
+	}
+	bytesWritten, err := io.Copy(w, body) // get the less-accurate body bytes written, in case we can't get the more accurate intercepted data
 
 	// bytesWritten = int(WriteStats(stats, w, conn, reqFQDN, remoteAddr, code, uint64(bytesWritten))) // TODO write err to stats?
 	return uint64(bytesWritten), err
@@ -390,6 +390,22 @@ func FreshFor(respHeaders http.Header, respCC CacheControlMap, reqTime, respTime
 	return freshnessLifetime - currentAge
 }
 
+// StaleWhileRevalidate returns the RFC5861§3 stale-while-revalidate of the
+// given response Cache-Control, which is how long after the response becomes
+// stale it may be served while it's revalidated in the background, and
+// whether the response had one.
+func StaleWhileRevalidate(respCC CacheControlMap) (time.Duration, bool) {
+	return getHTTPDeltaSecondsCacheControl(respCC, "stale-while-revalidate")
+}
+
+// StaleIfError returns the RFC5861§4 stale-if-error of the given response
+// Cache-Control, which is how long after the response becomes stale it may be
+// served if revalidating it fails with an error, and whether the response had
+// one.
+func StaleIfError(respCC CacheControlMap) (time.Duration, bool) {
+	return getHTTPDeltaSecondsCacheControl(respCC, "stale-if-error")
+}
+
 // Reuse is an "enumerated" type describing the necessary behavior of a cache
 // with regard to its cached objects.
 type Reuse int
@@ -946,3 +946,25 @@ func BenchmarkCanReuseStored(b *testing.B) {
 		CanReuseStored(reqHdr, respHdr, reqCC, respCC, respReqHdrs, respReqTime, respRespTime, strictRFC)
 	}
 }
+
+func TestStaleDirectives(t *testing.T) {
+	hdrs := http.Header{}
+	hdrs.Set(CacheControl, "max-age=600, stale-while-revalidate=30, stale-if-error=86400")
+	cc := ParseCacheControl(hdrs)
+
+	if swr, ok := StaleWhileRevalidate(cc); !ok || swr != 30*time.Second {
+		t.Errorf("StaleWhileRevalidate expected 30s true, actual %v %v", swr, ok)
+	}
+	if sie, ok := StaleIfError(cc); !ok || sie != 86400*time.Second {
+		t.Errorf("StaleIfError expected 86400s true, actual %v %v", sie, ok)
+	}
+
+	hdrs.Set(CacheControl, "max-age=600, stale-while-revalidate=soon")
+	cc = ParseCacheControl(hdrs)
+	if swr, ok := StaleWhileRevalidate(cc); ok {
+		t.Errorf("StaleWhileRevalidate with invalid value expected false, actual %v %v", swr, ok)
+	}
+	if sie, ok := StaleIfError(cc); ok {
+		t.Errorf("StaleIfError without directive expected false, actual %v %v", sie, ok)
+	}
+}
@@ -40,8 +40,30 @@ type IsAvailable struct {
 	IsAvailable   bool `json:"isAvailable"`
 	Ipv4Available bool `json:"ipv4Available"`
 	Ipv6Available bool `json:"ipv6Available"`
+	// DampingState is the flap damping state of a cache, if its availability
+	// is currently being held. It is empty if the cache's availability is
+	// that of its latest poll.
+	DampingState DampingState `json:"dampingState,omitempty"`
+	// FlapPenalty is the current flap damping penalty of a cache.
+	FlapPenalty float64 `json:"flapPenalty,omitempty"`
 }
 
+// DampingState is the state of flap damping of a cache's availability.
+type DampingState string
+
+const (
+	// DampingStatePendingUnavailable indicates a cache which has been polled
+	// unavailable, but not for enough consecutive polls to be marked
+	// unavailable.
+	DampingStatePendingUnavailable = DampingState("pendingUnavailable")
+	// DampingStatePendingAvailable indicates a cache which has been polled
+	// available, but not for enough consecutive polls to be marked available.
+	DampingStatePendingAvailable = DampingState("pendingAvailable")
+	// DampingStateSuppressed indicates a cache which is held unavailable,
+	// because its flap penalty exceeded the suppress threshold.
+	DampingStateSuppressed = DampingState("suppressed")
+)
+
 // NewCRStates creates a new CR states object, initializing pointer members.
 func NewCRStates() CRStates {
 	return CRStates{
@@ -80,6 +102,95 @@ func (a CRStates) CopyCaches() map[CacheName]IsAvailable {
 	return b
 }
 
+// CRStatesDelta is the changes between two CRStates: the caches and delivery
+// services which were added or changed, and those which were deleted. It is
+// designed for streaming CRStates changes to Traffic Routers. Traffic Monitor
+// peers don't use it yet, and still poll the full CRStates.
+type CRStatesDelta struct {
+	Caches                  map[CacheName]IsAvailable                       `json:"caches"`
+	DeliveryService         map[DeliveryServiceName]CRStatesDeliveryService `json:"deliveryServices"`
+	DeletedCaches           []CacheName                                     `json:"deletedCaches"`
+	DeletedDeliveryServices []DeliveryServiceName                           `json:"deletedDeliveryServices"`
+}
+
+// CRStatesDiff returns the changes from the old CRStates to the new. It does
+// not mutate either, and is thus safe for multiple goroutines.
+//
+// A cache whose FlapPenalty changed, but nothing else, isn't changed: the
+// penalty decays on every poll, which would otherwise make every poll a change.
+func CRStatesDiff(old CRStates, new CRStates) CRStatesDelta {
+	delta := CRStatesDelta{
+		Caches:                  map[CacheName]IsAvailable{},
+		DeliveryService:         map[DeliveryServiceName]CRStatesDeliveryService{},
+		DeletedCaches:           []CacheName{},
+		DeletedDeliveryServices: []DeliveryServiceName{},
+	}
+	for name, available := range new.Caches {
+		if oldAvailable, ok := old.Caches[name]; !ok || !oldAvailable.equalIgnoringFlapPenalty(available) {
+			delta.Caches[name] = available
+		}
+	}
+	for name := range old.Caches {
+		if _, ok := new.Caches[name]; !ok {
+			delta.DeletedCaches = append(delta.DeletedCaches, name)
+		}
+	}
+	for name, ds := range new.DeliveryService {
+		if oldDS, ok := old.DeliveryService[name]; !ok || !oldDS.Equal(ds) {
+			delta.DeliveryService[name] = ds
+		}
+	}
+	for name := range old.DeliveryService {
+		if _, ok := new.DeliveryService[name]; !ok {
+			delta.DeletedDeliveryServices = append(delta.DeletedDeliveryServices, name)
+		}
+	}
+	return delta
+}
+
+// equalIgnoringFlapPenalty returns whether the cache availability data is the
+// same, other than the FlapPenalty.
+func (a IsAvailable) equalIgnoringFlapPenalty(b IsAvailable) bool {
+	a.FlapPenalty = b.FlapPenalty
+	return a == b
+}
+
+// Empty returns whether the delta has no changes.
+func (d CRStatesDelta) Empty() bool {
+	return len(d.Caches) == 0 && len(d.DeliveryService) == 0 && len(d.DeletedCaches) == 0 && len(d.DeletedDeliveryServices) == 0
+}
+
+// Apply applies the given delta to the CRStates, which must have been
+// created with NewCRStates or otherwise have non-nil maps.
+func (a CRStates) Apply(d CRStatesDelta) {
+	for name, available := range d.Caches {
+		a.Caches[name] = available
+	}
+	for _, name := range d.DeletedCaches {
+		delete(a.Caches, name)
+	}
+	for name, ds := range d.DeliveryService {
+		a.DeliveryService[name] = ds
+	}
+	for _, name := range d.DeletedDeliveryServices {
+		delete(a.DeliveryService, name)
+	}
+}
+
+// Equal returns whether the delivery service availability data is the same,
+// including the order of its DisabledLocations.
+func (a CRStatesDeliveryService) Equal(b CRStatesDeliveryService) bool {
+	if a.IsAvailable != b.IsAvailable || len(a.DisabledLocations) != len(b.DisabledLocations) {
+		return false
+	}
+	for i, loc := range a.DisabledLocations {
+		if b.DisabledLocations[i] != loc {
+			return false
+		}
+	}
+	return true
+}
+
 // CRStatesMarshall serializes the given CRStates into bytes.
 func CRStatesMarshall(states CRStates) ([]byte, error) {
 	return json.Marshal(states)
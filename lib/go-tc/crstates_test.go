@@ -0,0 +1,51 @@
+package tc
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+)
+
+func TestCRStatesDiff(t *testing.T) {
+	old := NewCRStates()
+	old.Caches["edge0"] = IsAvailable{IsAvailable: true, FlapPenalty: 800}
+	old.Caches["edge1"] = IsAvailable{IsAvailable: true}
+	old.Caches["edge2"] = IsAvailable{IsAvailable: true}
+
+	new := old.Copy()
+	new.Caches["edge0"] = IsAvailable{IsAvailable: true, FlapPenalty: 400}
+	new.Caches["edge1"] = IsAvailable{IsAvailable: false}
+	delete(new.Caches, "edge2")
+
+	delta := CRStatesDiff(old, new)
+	if _, ok := delta.Caches["edge0"]; ok {
+		t.Errorf("expected a decayed flap penalty not to be a change, actual delta %+v", delta)
+	}
+	if available, ok := delta.Caches["edge1"]; !ok || available.IsAvailable {
+		t.Errorf("expected edge1 changed to unavailable, actual delta %+v", delta)
+	}
+	if len(delta.DeletedCaches) != 1 || delta.DeletedCaches[0] != "edge2" {
+		t.Errorf("expected edge2 deleted, actual delta %+v", delta)
+	}
+
+	if delta := CRStatesDiff(new, new); !delta.Empty() {
+		t.Errorf("expected no changes between the same states, actual delta %+v", delta)
+	}
+}
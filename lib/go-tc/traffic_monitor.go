@@ -39,6 +39,11 @@ const (
 	StatNameBandwidth = "bandwidth"
 )
 
+// PrometheusMappingPrefix is the prefix of all Names of Parameters used to map
+// Prometheus metric names to the statistics Traffic Monitor needs, for cache
+// servers using the "prometheus" health.polling.format.
+const PrometheusMappingPrefix = "prometheus."
+
 // TMConfigResponse is the response to requests made to the
 // cdns/{{Name}}/configs/monitoring endpoint of the Traffic Ops API.
 type TMConfigResponse struct {
@@ -425,6 +430,32 @@ type TMParameters struct {
 	HistoryCount            int    `json:"history.count"`
 	MinFreeKbps             int64
 	Thresholds              map[string]HealthThreshold `json:"health_threshold"`
+	// WindowThresholds are the thresholds on functions of stats' recent
+	// history, keyed by the Parameter Name without ThresholdPrefix, e.g.
+	// "pctavg(5m).kbps".
+	WindowThresholds map[string]WindowThreshold `json:"health_window_threshold"`
+	// HysteresisMarkDown is the number of consecutive unavailable poll
+	// results needed to mark an available cache server unavailable.
+	HysteresisMarkDown int `json:"health.hysteresis.markDown"`
+	// HysteresisMarkUp is the number of consecutive available poll results
+	// needed to mark an unavailable cache server available.
+	HysteresisMarkUp int `json:"health.hysteresis.markUp"`
+	// FlapPenalty is the penalty added each time a cache server's
+	// availability changes. If it is 0, flap damping is disabled.
+	FlapPenalty float64 `json:"health.flap.penalty"`
+	// FlapSuppress is the penalty at or above which a cache server is held
+	// unavailable.
+	FlapSuppress float64 `json:"health.flap.suppress"`
+	// FlapReuse is the penalty at or below which a held cache server is
+	// released.
+	FlapReuse float64 `json:"health.flap.reuse"`
+	// FlapHalfLife is the number of seconds over which the penalty decays by
+	// half.
+	FlapHalfLife int `json:"health.flap.halfLife"`
+	// PrometheusMappings holds the Values of all Parameters with Names
+	// beginning with PrometheusMappingPrefix, keyed by the remainder of the
+	// Name.
+	PrometheusMappings map[string]string `json:"prometheus"`
 }
 
 const DefaultHealthThresholdComparator = "<"
@@ -444,6 +475,71 @@ func (t HealthThreshold) String() string {
 	return fmt.Sprintf("%s%f", t.Comparator, t.Val)
 }
 
+// The functions of a stat's history which a WindowThreshold may compare.
+const (
+	// WindowFunctionDelta is the stat's latest value minus its value at the
+	// start of the window.
+	WindowFunctionDelta = "delta"
+	// WindowFunctionRate is the delta divided by the window, in seconds.
+	WindowFunctionRate = "rate"
+	// WindowFunctionAvg is the stat's time-weighted average over the window.
+	WindowFunctionAvg = "avg"
+	// WindowFunctionPctAvg is the percent change of the stat's latest value
+	// from its average over the window, e.g. -80 if it dropped to 20% of the
+	// average.
+	WindowFunctionPctAvg = "pctavg"
+)
+
+// WindowThreshold is a HealthThreshold on a function of a stat's history over
+// a window of time, rather than on its latest value. Its Parameter Name is of
+// the form "health.threshold.function(window).stat", for example
+// "health.threshold.rate(30s).proxy.process.http.5xx_responses".
+type WindowThreshold struct {
+	HealthThreshold
+	Stat     string
+	Function string
+	Window   time.Duration
+}
+
+// String implements the fmt.Stringer interface.
+func (t WindowThreshold) String() string {
+	return fmt.Sprintf("%s(%v).%s%s", t.Function, t.Window, t.Stat, t.HealthThreshold)
+}
+
+// strToWindowThreshold takes a threshold Parameter Name without the
+// ThresholdPrefix, like "pctavg(5m).kbps", and its Value, like ">-80", and
+// returns the WindowThreshold. If the name isn't of the form
+// "function(window).stat", ok is false.
+func strToWindowThreshold(name string, val string) (WindowThreshold, bool, error) {
+	open := strings.Index(name, "(")
+	if open < 0 {
+		return WindowThreshold{}, false, nil
+	}
+	function := name[:open]
+	switch function {
+	case WindowFunctionDelta, WindowFunctionRate, WindowFunctionAvg, WindowFunctionPctAvg:
+	default:
+		return WindowThreshold{}, false, nil
+	}
+	closeDot := strings.Index(name, ").")
+	if closeDot < open {
+		return WindowThreshold{}, true, fmt.Errorf("invalid window threshold name '%s': expected function(window).stat", name)
+	}
+	window, err := time.ParseDuration(name[open+1 : closeDot])
+	if err != nil || window <= 0 {
+		return WindowThreshold{}, true, fmt.Errorf("invalid window threshold name '%s': window must be a positive duration like 30s or 5m", name)
+	}
+	stat := name[closeDot+len(")."):]
+	if stat == "" {
+		return WindowThreshold{}, true, fmt.Errorf("invalid window threshold name '%s': missing stat", name)
+	}
+	threshold, err := strToThreshold(val)
+	if err != nil {
+		return WindowThreshold{}, true, err
+	}
+	return WindowThreshold{HealthThreshold: threshold, Stat: stat, Function: function, Window: window}, true, nil
+}
+
 // strToThreshold takes a string like ">=42" and returns a HealthThreshold with
 // a Val of `42` and a Comparator of `">="`. If no comparator exists,
 // `DefaultHealthThresholdComparator` is used. If the string does not match
@@ -469,6 +565,12 @@ func strToThreshold(s string) (HealthThreshold, error) {
 	return HealthThreshold{Val: val, Comparator: DefaultHealthThresholdComparator}, nil
 }
 
+// paramFloat returns the number of a parameter value, which may be a JSON
+// number or a string, as Traffic Ops sends non-integer parameter values.
+func paramFloat(v interface{}) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(fmt.Sprintf("%v", v)), 64)
+}
+
 // UnmarshalJSON implements the encoding/json.Unmarshaler interface.
 func (params *TMParameters) UnmarshalJSON(bytes []byte) (err error) {
 	raw := map[string]interface{}{}
@@ -516,17 +618,80 @@ func (params *TMParameters) UnmarshalJSON(bytes []byte) (err error) {
 		}
 	}
 
+	if vi, ok := raw["health.hysteresis.markDown"]; ok {
+		if v, err := paramFloat(vi); err != nil {
+			return fmt.Errorf("Unmarshalling TMParameters health.hysteresis.markDown expected integer, got %v", vi)
+		} else {
+			params.HysteresisMarkDown = int(v)
+		}
+	}
+
+	if vi, ok := raw["health.hysteresis.markUp"]; ok {
+		if v, err := paramFloat(vi); err != nil {
+			return fmt.Errorf("Unmarshalling TMParameters health.hysteresis.markUp expected integer, got %v", vi)
+		} else {
+			params.HysteresisMarkUp = int(v)
+		}
+	}
+
+	if vi, ok := raw["health.flap.penalty"]; ok {
+		if v, err := paramFloat(vi); err != nil {
+			return fmt.Errorf("Unmarshalling TMParameters health.flap.penalty expected number, got %v", vi)
+		} else {
+			params.FlapPenalty = v
+		}
+	}
+
+	if vi, ok := raw["health.flap.suppress"]; ok {
+		if v, err := paramFloat(vi); err != nil {
+			return fmt.Errorf("Unmarshalling TMParameters health.flap.suppress expected number, got %v", vi)
+		} else {
+			params.FlapSuppress = v
+		}
+	}
+
+	if vi, ok := raw["health.flap.reuse"]; ok {
+		if v, err := paramFloat(vi); err != nil {
+			return fmt.Errorf("Unmarshalling TMParameters health.flap.reuse expected number, got %v", vi)
+		} else {
+			params.FlapReuse = v
+		}
+	}
+
+	if vi, ok := raw["health.flap.halfLife"]; ok {
+		if v, err := paramFloat(vi); err != nil {
+			return fmt.Errorf("Unmarshalling TMParameters health.flap.halfLife expected integer, got %v", vi)
+		} else {
+			params.FlapHalfLife = int(v)
+		}
+	}
+
 	params.Thresholds = make(map[string]HealthThreshold, len(raw))
 	for k, v := range raw {
 		if strings.HasPrefix(k, ThresholdPrefix) {
 			stat := k[len(ThresholdPrefix):]
 			vStr := fmt.Sprintf("%v", v) // allows string or numeric JSON types. TODO check if a type switch is faster.
+			if t, ok, err := strToWindowThreshold(stat, vStr); err != nil {
+				return fmt.Errorf("Unmarshalling TMParameters `%s` window threshold parameter '%s' value '%v': %v", ThresholdPrefix, k, v, err)
+			} else if ok {
+				if params.WindowThresholds == nil {
+					params.WindowThresholds = map[string]WindowThreshold{}
+				}
+				params.WindowThresholds[stat] = t
+				continue
+			}
 			if t, err := strToThreshold(vStr); err != nil {
 				return fmt.Errorf("Unmarshalling TMParameters `%s` parameter value not of the form `(>|)(=|)\\d+`: stat '%s' value '%v': %v", ThresholdPrefix, k, v, err)
 			} else {
 				params.Thresholds[stat] = t
 			}
 		}
+		if strings.HasPrefix(k, PrometheusMappingPrefix) {
+			if params.PrometheusMappings == nil {
+				params.PrometheusMappings = map[string]string{}
+			}
+			params.PrometheusMappings[k[len(PrometheusMappingPrefix):]] = fmt.Sprintf("%v", v)
+		}
 	}
 	return nil
 }
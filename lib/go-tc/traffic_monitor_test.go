@@ -195,7 +195,11 @@ func ExampleTMParameters_UnmarshalJSON() {
 		"health.polling.format": "stats_over_http",
 		"history.count": 1,
 		"health.threshold.bandwidth": ">50",
-		"health.threshold.foo": "<=500"
+		"health.threshold.foo": "<=500",
+		"prometheus.loadavg": "node_load1",
+		"health.hysteresis.markDown": 3,
+		"health.flap.halfLife": 60,
+		"health.flap.penalty": "0.5"
 	}`
 
 	var params TMParameters
@@ -208,12 +212,16 @@ func ExampleTMParameters_UnmarshalJSON() {
 	fmt.Printf("format: %s\n", params.HealthPollingFormat)
 	fmt.Printf("history: %d\n", params.HistoryCount)
 	fmt.Printf("# of Thresholds: %d - foo: %s, bandwidth: %s\n", len(params.Thresholds), params.Thresholds["foo"], params.Thresholds["bandwidth"])
+	fmt.Printf("prometheus loadavg: %s\n", params.PrometheusMappings["loadavg"])
+	fmt.Printf("mark down: %d, half-life: %d, penalty: %v\n", params.HysteresisMarkDown, params.FlapHalfLife, params.FlapPenalty)
 
 	// Output: timeout: 5
 	// url: https://example.com/
 	// format: stats_over_http
 	// history: 1
 	// # of Thresholds: 2 - foo: <=500.000000, bandwidth: >50.000000
+	// prometheus loadavg: node_load1
+	// mark down: 3, half-life: 60, penalty: 0.5
 }
 
 func ExampleTrafficMonitorConfigMap_Valid() {
@@ -612,3 +620,25 @@ func TestTrafficMonitorTransformToMap(t *testing.T) {
 		t.Errorf("Incorrect number of IP addresses on converted traffic server's interface; expected: 1, got: %d", len(converted.TrafficServer["testHostname"].Interfaces[0].IPAddresses))
 	}
 }
+
+func TestTMParametersWindowThresholds(t *testing.T) {
+	params := TMParameters{}
+	if err := json.Unmarshal([]byte(`{"health.threshold.loadavg": "25.0", "health.threshold.pctavg(5m).kbps": ">-80", "health.threshold.rate(30s).proxy.process.http.5xx_responses": 10}`), &params); err != nil {
+		t.Fatalf("unmarshalling TMParameters: %v", err)
+	}
+	if len(params.Thresholds) != 1 {
+		t.Errorf("expected 1 threshold, actual %+v", params.Thresholds)
+	}
+	if threshold, ok := params.WindowThresholds["pctavg(5m).kbps"]; !ok || threshold.Stat != StatNameKBPS || threshold.Function != WindowFunctionPctAvg || threshold.Window != 5*time.Minute || threshold.Comparator != ">" || threshold.Val != -80 {
+		t.Errorf("expected pctavg(5m).kbps >-80 window threshold, actual %+v %v", threshold, ok)
+	}
+	if threshold, ok := params.WindowThresholds["rate(30s).proxy.process.http.5xx_responses"]; !ok || threshold.Stat != "proxy.process.http.5xx_responses" || threshold.Function != WindowFunctionRate || threshold.Window != 30*time.Second || threshold.Comparator != DefaultHealthThresholdComparator || threshold.Val != 10 {
+		t.Errorf("expected rate(30s).proxy.process.http.5xx_responses <10 window threshold, actual %+v %v", threshold, ok)
+	}
+
+	for _, invalid := range []string{`{"health.threshold.avg(forever).kbps": "<1"}`, `{"health.threshold.delta(30s)kbps": "<1"}`, `{"health.threshold.avg(30s).kbps": "lots"}`} {
+		if err := json.Unmarshal([]byte(invalid), &TMParameters{}); err == nil {
+			t.Errorf("expected error unmarshalling invalid window threshold %s", invalid)
+		}
+	}
+}
@@ -75,7 +75,10 @@ func astatsParse(cacheName string, rdr io.Reader, pollCTX interface{}) (Statisti
 		return stats, nil, errors.New("handler got nil reader")
 	}
 
-	ctx := pollCTX.(*poller.HTTPPollCtx)
+	ctx, ok := poller.HTTPPollContext(pollCTX)
+	if !ok {
+		return stats, nil, fmt.Errorf("astats poll context had unrecognized type '%T'", pollCTX)
+	}
 
 	ctype := ctx.HTTPHeader.Get("Content-Type")
 
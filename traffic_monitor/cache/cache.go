@@ -25,6 +25,7 @@ import (
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
 
@@ -142,6 +143,12 @@ type Vitals struct {
 	BytesIn    uint64
 	KbpsOut    int64
 	MaxKbpsOut int64
+	// TLSConnectTime, TLSHandshakeTime, and TLSCertNotAfter are the results of
+	// the TLS poller's check of the cache server's TLS listener. They are zero
+	// for other pollers.
+	TLSConnectTime   time.Duration
+	TLSHandshakeTime time.Duration
+	TLSCertNotAfter  time.Time
 }
 
 // Stat is a generic stat, including the untyped value and the time the stat was
@@ -196,6 +203,18 @@ func ComputedStats() map[string]StatComputeFunc {
 		"queryTime": func(info ResultInfo, _ tc.TrafficServer, _ tc.TMProfile, _ tc.IsAvailable) interface{} {
 			return info.RequestTime.Nanoseconds() / nsPerMs
 		},
+		"tls.connectTime": func(info ResultInfo, _ tc.TrafficServer, _ tc.TMProfile, _ tc.IsAvailable) interface{} {
+			return info.Vitals.TLSConnectTime.Nanoseconds() / nsPerMs
+		},
+		"tls.handshakeTime": func(info ResultInfo, _ tc.TrafficServer, _ tc.TMProfile, _ tc.IsAvailable) interface{} {
+			return info.Vitals.TLSHandshakeTime.Nanoseconds() / nsPerMs
+		},
+		"tls.certExpiresInDays": func(info ResultInfo, _ tc.TrafficServer, _ tc.TMProfile, _ tc.IsAvailable) interface{} {
+			if info.Vitals.TLSCertNotAfter.IsZero() {
+				return float64(0)
+			}
+			return info.Vitals.TLSCertNotAfter.Sub(info.Time).Hours() / 24
+		},
 		"stateUrl": func(_ ResultInfo, _ tc.TrafficServer, serverProfile tc.TMProfile, _ tc.IsAvailable) interface{} {
 			return serverProfile.Parameters.HealthPollingURL
 		},
@@ -279,6 +298,12 @@ func (handler Handler) Handle(id string, rdr io.Reader, format string, reqTime t
 		PollFinished: pollFinished,
 	}
 
+	if check := poller.TLSCheckResult(pollCtx); check != nil {
+		result.Vitals.TLSConnectTime = check.ConnectTime
+		result.Vitals.TLSHandshakeTime = check.HandshakeTime
+		result.Vitals.TLSCertNotAfter = check.CertNotAfter
+	}
+
 	if reqErr != nil {
 		log.Warnf("%v handler given error '%v'\n", id, reqErr) // error here, in case the thing that called Handle didn't error
 		result.Error = reqErr
@@ -69,6 +69,17 @@ type AvailableStatus struct {
 	UnavailableStat string
 	// Poller is the name of the poller which set this availability status.
 	Poller string
+	// ConsecutiveAvailable and ConsecutiveUnavailable are the number of
+	// consecutive poll results, before flap damping, which were available and
+	// unavailable, respectively. At most one is non-zero.
+	ConsecutiveAvailable   uint64
+	ConsecutiveUnavailable uint64
+	// FlapPenalty is the flap damping penalty, as of FlapPenaltyTime.
+	FlapPenalty     float64
+	FlapPenaltyTime time.Time
+	// DampingState is the flap damping state, if ProcessedAvailable is being
+	// held by flap damping.
+	DampingState tc.DampingState
 }
 
 // CacheAvailableStatuses is the available status of each cache.
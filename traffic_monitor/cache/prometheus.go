@@ -0,0 +1,467 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// PrometheusStatsType is the health.polling.format of cache servers which
+// serve their statistics in the Prometheus text exposition format.
+const PrometheusStatsType = "prometheus"
+
+func init() {
+	registerDecoder(PrometheusStatsType, prometheusParse, prometheusPrecompute)
+}
+
+// PrometheusMapping is the set of Prometheus metric and label names from which
+// the statistics Traffic Monitor needs are read. Each cache server's Profile
+// may override any of these with a Parameter named by
+// tc.PrometheusMappingPrefix followed by the key given in each field's
+// comment.
+type PrometheusMapping struct {
+	// LoadavgOne is the one-minute load average gauge (loadavg.one).
+	LoadavgOne string
+	// LoadavgFive is the five-minute load average gauge (loadavg.five).
+	LoadavgFive string
+	// LoadavgFifteen is the fifteen-minute load average gauge (loadavg.fifteen).
+	LoadavgFifteen string
+
+	// InterfaceLabel is the label holding the network interface name
+	// (interface.label).
+	InterfaceLabel string
+	// InterfaceBytesIn is the received bytes counter (interface.bytes_in).
+	InterfaceBytesIn string
+	// InterfaceBytesOut is the transmitted bytes counter (interface.bytes_out).
+	InterfaceBytesOut string
+	// InterfaceSpeed is the interface speed gauge, in bytes per second
+	// (interface.speed).
+	InterfaceSpeed string
+
+	// DSLabel is the label holding the Delivery Service XMLID (ds.label).
+	DSLabel string
+	// DSRequests is the per-Delivery Service request counter (ds.requests).
+	DSRequests string
+	// DSStatusLabel is the label of DSRequests holding the HTTP status code,
+	// or status class such as "2xx" (ds.status_label).
+	DSStatusLabel string
+	// DSBytesIn is the per-Delivery Service received bytes counter
+	// (ds.bytes_in).
+	DSBytesIn string
+	// DSBytesOut is the per-Delivery Service sent bytes counter
+	// (ds.bytes_out).
+	DSBytesOut string
+}
+
+// DefaultPrometheusMapping returns the mapping used for metrics which aren't
+// overridden by Profile Parameters. The system metrics are those of the
+// Prometheus node_exporter.
+func DefaultPrometheusMapping() PrometheusMapping {
+	return PrometheusMapping{
+		LoadavgOne:        "node_load1",
+		LoadavgFive:       "node_load5",
+		LoadavgFifteen:    "node_load15",
+		InterfaceLabel:    "device",
+		InterfaceBytesIn:  "node_network_receive_bytes_total",
+		InterfaceBytesOut: "node_network_transmit_bytes_total",
+		InterfaceSpeed:    "node_network_speed_bytes",
+		DSLabel:           "deliveryservice",
+		DSRequests:        "cache_requests_total",
+		DSStatusLabel:     "code",
+		DSBytesIn:         "cache_received_bytes_total",
+		DSBytesOut:        "cache_sent_bytes_total",
+	}
+}
+
+// NewPrometheusMapping returns the default mapping, overridden by the given
+// Parameters, which are keyed by their Names without the
+// tc.PrometheusMappingPrefix. Unknown keys are logged and ignored.
+func NewPrometheusMapping(params map[string]string) PrometheusMapping {
+	m := DefaultPrometheusMapping()
+	for key, val := range params {
+		switch key {
+		case "loadavg.one":
+			m.LoadavgOne = val
+		case "loadavg.five":
+			m.LoadavgFive = val
+		case "loadavg.fifteen":
+			m.LoadavgFifteen = val
+		case "interface.label":
+			m.InterfaceLabel = val
+		case "interface.bytes_in":
+			m.InterfaceBytesIn = val
+		case "interface.bytes_out":
+			m.InterfaceBytesOut = val
+		case "interface.speed":
+			m.InterfaceSpeed = val
+		case "ds.label":
+			m.DSLabel = val
+		case "ds.requests":
+			m.DSRequests = val
+		case "ds.status_label":
+			m.DSStatusLabel = val
+		case "ds.bytes_in":
+			m.DSBytesIn = val
+		case "ds.bytes_out":
+			m.DSBytesOut = val
+		default:
+			log.Warnf("unknown Prometheus mapping Parameter '%s%s', ignoring", tc.PrometheusMappingPrefix, key)
+		}
+	}
+	return m
+}
+
+var prometheusMappings = map[string]PrometheusMapping{}
+var prometheusMappingsM = sync.RWMutex{}
+
+// SetPrometheusMappings sets the Prometheus mappings of all cache servers,
+// keyed by cache server name. Cache servers without a mapping use
+// DefaultPrometheusMapping.
+//
+// This should be called whenever the Monitoring Config changes.
+func SetPrometheusMappings(mappings map[string]PrometheusMapping) {
+	prometheusMappingsM.Lock()
+	prometheusMappings = mappings
+	prometheusMappingsM.Unlock()
+}
+
+func getPrometheusMapping(cacheName string) PrometheusMapping {
+	prometheusMappingsM.RLock()
+	m, ok := prometheusMappings[cacheName]
+	prometheusMappingsM.RUnlock()
+	if !ok {
+		return DefaultPrometheusMapping()
+	}
+	return m
+}
+
+// prometheusSample is a single parsed sample, i.e. line, of a Prometheus text
+// exposition.
+type prometheusSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// Series returns the sample's name and labels, with the labels sorted, in the
+// form they'd appear in the text exposition. This is used as the name of
+// miscellaneous stats.
+func (s prometheusSample) Series() string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+	names := make([]string, 0, len(s.Labels))
+	for name := range s.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b := strings.Builder{}
+	b.WriteString(s.Name)
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(prometheusLabelEscaper.Replace(s.Labels[name]))
+		b.WriteString(`"`)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func prometheusParse(cacheName string, data io.Reader, pollCTX interface{}) (Statistics, map[string]interface{}, error) {
+	var stats Statistics
+	if data == nil {
+		log.Warnf("Cannot read stats data for cache '%s' - nil data reader", cacheName)
+		return stats, nil, errors.New("handler got nil reader")
+	}
+
+	samples, err := prometheusParseText(data)
+	if err != nil {
+		return stats, nil, fmt.Errorf("parsing Prometheus stats for cache '%s': %v", cacheName, err)
+	}
+
+	mapping := getPrometheusMapping(cacheName)
+
+	foundLoadavg := false
+	stats.Interfaces = map[string]Interface{}
+	miscStats := make(map[string]interface{}, len(samples))
+	for _, sample := range samples {
+		switch sample.Name {
+		case mapping.LoadavgOne:
+			stats.Loadavg.One = sample.Value
+			foundLoadavg = true
+			continue
+		case mapping.LoadavgFive:
+			stats.Loadavg.Five = sample.Value
+			continue
+		case mapping.LoadavgFifteen:
+			stats.Loadavg.Fifteen = sample.Value
+			continue
+		case mapping.InterfaceBytesIn, mapping.InterfaceBytesOut, mapping.InterfaceSpeed:
+			ifaceName, ok := sample.Labels[mapping.InterfaceLabel]
+			if !ok {
+				log.Warnf("cache '%s' stat '%s' appears to be network related, but has no '%s' label", cacheName, sample.Series(), mapping.InterfaceLabel)
+				break
+			}
+			if sample.Value < 0 || sample.Value > math.MaxInt64 || math.IsNaN(sample.Value) {
+				log.Warnf("cache '%s' stat '%s' value %v out of range", cacheName, sample.Series(), sample.Value)
+				continue
+			}
+			iface := stats.Interfaces[ifaceName]
+			switch sample.Name {
+			case mapping.InterfaceBytesIn:
+				iface.BytesIn = uint64(sample.Value)
+			case mapping.InterfaceBytesOut:
+				iface.BytesOut = uint64(sample.Value)
+			case mapping.InterfaceSpeed:
+				iface.Speed = int64(sample.Value * 8 / 1000000) // bytes per second to megabits per second
+			}
+			stats.Interfaces[ifaceName] = iface
+			continue
+		}
+		miscStats[sample.Series()] = sample.Value
+	}
+
+	if !foundLoadavg {
+		return stats, nil, fmt.Errorf("cache '%s' data was missing '%s'", cacheName, mapping.LoadavgOne)
+	}
+	if len(stats.Interfaces) < 1 {
+		return stats, nil, fmt.Errorf("cache '%s' had no interfaces", cacheName)
+	}
+
+	return stats, miscStats, nil
+}
+
+// prometheusParseText parses the Prometheus text exposition format. Comments,
+// including HELP and TYPE metadata, and timestamps are ignored.
+func prometheusParseText(data io.Reader) ([]prometheusSample, error) {
+	samples := []prometheusSample{}
+	scanner := bufio.NewScanner(data)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		sample, err := prometheusParseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(samples) < 1 {
+		return nil, errors.New("no samples found")
+	}
+	return samples, nil
+}
+
+// prometheusParseSample parses a single sample line of the form
+// `name{label="value",...} value [timestamp]`.
+func prometheusParseSample(line string) (prometheusSample, error) {
+	sample := prometheusSample{}
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return sample, errors.New("malformed sample: no value")
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if rest[0] == '{' {
+		labels, remaining, err := prometheusParseLabels(rest[1:])
+		if err != nil {
+			return sample, fmt.Errorf("metric '%s': %v", sample.Name, err)
+		}
+		sample.Labels = labels
+		rest = remaining
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 {
+		return sample, fmt.Errorf("metric '%s': no value", sample.Name)
+	}
+	val, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("metric '%s': value '%s' is not a number", sample.Name, fields[0])
+	}
+	sample.Value = val
+	return sample, nil
+}
+
+// prometheusParseLabels parses the label pairs of a sample, starting after the
+// opening brace, and returns them along with the remainder of the line after
+// the closing brace.
+func prometheusParseLabels(s string) (map[string]string, string, error) {
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return nil, "", errors.New("unterminated label set")
+		}
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq < 1 {
+			return nil, "", errors.New("malformed label")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if s == "" || s[0] != '"' {
+			return nil, "", fmt.Errorf("label '%s' value is not quoted", name)
+		}
+
+		val := strings.Builder{}
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] != '\\' || i+1 >= len(s) {
+				val.WriteByte(s[i])
+				continue
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				val.WriteByte('\n')
+			default:
+				val.WriteByte(s[i])
+			}
+		}
+		if i >= len(s) {
+			return nil, "", fmt.Errorf("label '%s' value is unterminated", name)
+		}
+		labels[name] = val.String()
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if s != "" && s[0] == ',' {
+			s = s[1:]
+		}
+	}
+}
+
+func prometheusPrecompute(cacheName string, data todata.TOData, stats Statistics, miscStats map[string]interface{}) PrecomputedData {
+	var precomputed PrecomputedData
+	precomputed.DeliveryServiceStats = make(map[string]*DSStat)
+
+	precomputed.OutBytes = 0
+	precomputed.MaxKbps = 0
+	for _, iface := range stats.Interfaces {
+		precomputed.OutBytes += iface.BytesOut
+		if iface.Speed > precomputed.MaxKbps {
+			precomputed.MaxKbps = iface.Speed
+		}
+	}
+	precomputed.MaxKbps *= 1000
+
+	mapping := getPrometheusMapping(cacheName)
+
+	for stat, value := range miscStats {
+		sample, err := prometheusParseSample(stat + " 0")
+		if err != nil {
+			continue // not a Prometheus series, nothing to precompute
+		}
+		if sample.Name != mapping.DSRequests && sample.Name != mapping.DSBytesIn && sample.Name != mapping.DSBytesOut {
+			continue
+		}
+
+		dsName, ok := sample.Labels[mapping.DSLabel]
+		if !ok || dsName == "" {
+			err := fmt.Errorf("stat has no '%s' label", mapping.DSLabel)
+			log.Infof("precomputing cache %s stat %s value %v error %v", cacheName, stat, value, err)
+			precomputed.Errors = append(precomputed.Errors, err)
+			continue
+		}
+		if _, ok := data.DeliveryServiceTypes[tc.DeliveryServiceName(dsName)]; !ok {
+			err := errors.New("No Delivery Service match for stat")
+			log.Infof("precomputing cache %s stat %s value %v error %v", cacheName, stat, value, err)
+			precomputed.Errors = append(precomputed.Errors, err)
+			continue
+		}
+
+		fVal, ok := value.(float64)
+		if !ok || fVal < 0 || fVal > math.MaxUint64 || math.IsNaN(fVal) {
+			err := fmt.Errorf("stat value '%v' out of range for uint64", value)
+			log.Infof("precomputing cache %s stat %s value %v error %v", cacheName, stat, value, err)
+			precomputed.Errors = append(precomputed.Errors, err)
+			continue
+		}
+		parsedStat := uint64(fVal)
+
+		dsStat, ok := precomputed.DeliveryServiceStats[dsName]
+		if !ok || dsStat == nil {
+			dsStat = new(DSStat)
+		}
+
+		switch sample.Name {
+		case mapping.DSBytesIn:
+			dsStat.InBytes += parsedStat
+		case mapping.DSBytesOut:
+			dsStat.OutBytes += parsedStat
+		case mapping.DSRequests:
+			// status labels may be codes ("204") or classes ("2xx"); either way
+			// the class is the first character.
+			status := sample.Labels[mapping.DSStatusLabel]
+			if status == "" {
+				err := fmt.Errorf("stat has no '%s' label", mapping.DSStatusLabel)
+				log.Infof("precomputing cache %s stat %s value %v error %v", cacheName, stat, value, err)
+				precomputed.Errors = append(precomputed.Errors, err)
+				continue
+			}
+			switch status[0] {
+			case '2':
+				dsStat.Status2xx += parsedStat
+			case '3':
+				dsStat.Status3xx += parsedStat
+			case '4':
+				dsStat.Status4xx += parsedStat
+			case '5':
+				dsStat.Status5xx += parsedStat
+			default:
+				err := fmt.Errorf("Unknown status '%s'", status)
+				log.Infof("precomputing cache %s stat %s value %v error %v", cacheName, stat, value, err)
+				precomputed.Errors = append(precomputed.Errors, err)
+				continue
+			}
+		}
+		precomputed.DeliveryServiceStats[dsName] = dsStat
+	}
+	return precomputed
+}
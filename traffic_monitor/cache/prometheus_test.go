@@ -0,0 +1,146 @@
+package cache
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+const testPrometheusStats = `# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.25
+node_load5 0.5
+node_load15 0.75
+# TYPE node_network_receive_bytes_total counter
+node_network_receive_bytes_total{device="eth0"} 1000
+node_network_transmit_bytes_total{device="eth0"} 2000 1600000000000
+node_network_speed_bytes{device="eth0"} 1.25e+09
+node_network_receive_bytes_total{device="lo"} 10
+node_network_transmit_bytes_total{device="lo"} 20
+cache_requests_total{deliveryservice="ds0",code="200"} 5
+cache_requests_total{code="204", deliveryservice="ds0"} 1
+cache_requests_total{deliveryservice="ds0",code="5xx"} 2
+cache_sent_bytes_total{deliveryservice="ds0"} 300
+cache_received_bytes_total{deliveryservice="ds0"} 100
+cache_sent_bytes_total{deliveryservice="unknown-ds"} 42
+varnish_uptime_seconds{note="a \"quoted\" \\ value"} 12
+`
+
+func TestPrometheusParse(t *testing.T) {
+	stats, misc, err := prometheusParse("test", strings.NewReader(testPrometheusStats), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Loadavg.One != 0.25 || stats.Loadavg.Five != 0.5 || stats.Loadavg.Fifteen != 0.75 {
+		t.Errorf("expected loadavg 0.25 0.5 0.75, actual %v %v %v", stats.Loadavg.One, stats.Loadavg.Five, stats.Loadavg.Fifteen)
+	}
+
+	if len(stats.Interfaces) != 2 {
+		t.Fatalf("expected 2 interfaces, actual %d", len(stats.Interfaces))
+	}
+	eth0 := stats.Interfaces["eth0"]
+	if eth0.BytesIn != 1000 || eth0.BytesOut != 2000 {
+		t.Errorf("expected eth0 bytes in 1000 out 2000, actual in %d out %d", eth0.BytesIn, eth0.BytesOut)
+	}
+	if eth0.Speed != 10000 {
+		t.Errorf("expected eth0 speed 10000, actual %d", eth0.Speed)
+	}
+
+	if _, ok := misc["node_load1"]; ok {
+		t.Error("expected system stats to be removed from miscellaneous stats")
+	}
+	if val := misc[`cache_requests_total{code="204",deliveryservice="ds0"}`]; val != float64(1) {
+		t.Errorf("expected series with sorted labels to be 1, actual %v", val)
+	}
+	if val := misc[`varnish_uptime_seconds{note="a \"quoted\" \\ value"}`]; val != float64(12) {
+		t.Errorf("expected series with escaped label to be 12, actual %v", val)
+	}
+}
+
+func TestPrometheusParseErrors(t *testing.T) {
+	if _, _, err := prometheusParse("test", strings.NewReader("node_network_receive_bytes_total{device=\"eth0\"} 1\n"), nil); err == nil {
+		t.Error("expected missing loadavg to error")
+	}
+	if _, _, err := prometheusParse("test", strings.NewReader("node_load1 1\n"), nil); err == nil {
+		t.Error("expected missing interfaces to error")
+	}
+	if _, _, err := prometheusParse("test", strings.NewReader("node_load1{a=\"b\" 1\n"), nil); err == nil {
+		t.Error("expected malformed labels to error")
+	}
+	if _, _, err := prometheusParse("test", nil, nil); err == nil {
+		t.Error("expected nil reader to error")
+	}
+}
+
+func TestPrometheusPrecompute(t *testing.T) {
+	stats, misc, err := prometheusParse("test", strings.NewReader(testPrometheusStats), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toData := *todata.New()
+	toData.DeliveryServiceTypes["ds0"] = tc.DSTypeCategoryHTTP
+
+	precomputed := prometheusPrecompute("test", toData, stats, misc)
+	if precomputed.OutBytes != 2020 {
+		t.Errorf("expected out bytes 2020, actual %d", precomputed.OutBytes)
+	}
+	if precomputed.MaxKbps != 10000000 {
+		t.Errorf("expected max kbps 10000000, actual %d", precomputed.MaxKbps)
+	}
+	if len(precomputed.Errors) != 1 {
+		t.Errorf("expected 1 error for the unknown delivery service, actual %v", precomputed.Errors)
+	}
+
+	dsStat, ok := precomputed.DeliveryServiceStats["ds0"]
+	if !ok {
+		t.Fatal("expected ds0 stats")
+	}
+	if dsStat.Status2xx != 6 || dsStat.Status5xx != 2 {
+		t.Errorf("expected 2xx 6 5xx 2, actual 2xx %d 5xx %d", dsStat.Status2xx, dsStat.Status5xx)
+	}
+	if dsStat.InBytes != 100 || dsStat.OutBytes != 300 {
+		t.Errorf("expected in bytes 100 out bytes 300, actual in %d out %d", dsStat.InBytes, dsStat.OutBytes)
+	}
+}
+
+func TestNewPrometheusMapping(t *testing.T) {
+	m := NewPrometheusMapping(map[string]string{"loadavg.one": "varnish_load1", "ds.label": "backend"})
+	if m.LoadavgOne != "varnish_load1" || m.DSLabel != "backend" {
+		t.Errorf("expected overridden loadavg.one and ds.label, actual %+v", m)
+	}
+	if m.InterfaceBytesIn != DefaultPrometheusMapping().InterfaceBytesIn {
+		t.Errorf("expected default interface.bytes_in, actual %s", m.InterfaceBytesIn)
+	}
+
+	SetPrometheusMappings(map[string]PrometheusMapping{"custom": m})
+	defer SetPrometheusMappings(map[string]PrometheusMapping{})
+	if actual := getPrometheusMapping("custom"); actual != m {
+		t.Errorf("expected custom mapping %+v, actual %+v", m, actual)
+	}
+	if actual := getPrometheusMapping("other"); actual != DefaultPrometheusMapping() {
+		t.Errorf("expected default mapping, actual %+v", actual)
+	}
+}
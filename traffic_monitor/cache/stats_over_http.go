@@ -70,7 +70,10 @@ func statsOverHTTPParse(cacheName string, data io.Reader, pollCTX interface{}) (
 	var sohData stats_over_httpData
 	var err error
 
-	ctx := pollCTX.(*poller.HTTPPollCtx)
+	ctx, ok := poller.HTTPPollContext(pollCTX)
+	if !ok {
+		return stats, nil, fmt.Errorf("stats_over_http poll context had unrecognized type '%T'", pollCTX)
+	}
 
 	ctype := ctx.HTTPHeader.Get("Content-Type")
 
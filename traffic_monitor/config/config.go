@@ -22,6 +22,7 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"strings"
 	"time"
@@ -47,6 +48,8 @@ const (
 	CRConfigBackupFile = "/opt/traffic_monitor/crconfig.backup"
 	//TmConfigBackupFile is the default file name to store the last tmconfig
 	TMConfigBackupFile = "/opt/traffic_monitor/tmconfig.backup"
+	//StateBackupFile is the default file name to store the last stat and health history, events, and cache states
+	StateBackupFile = "/opt/traffic_monitor/state.backup"
 	//HTTPPollingFormat is the default accept encoding for stats from caches
 	HTTPPollingFormat = "text/json"
 )
@@ -95,39 +98,74 @@ func (t *PollingProtocol) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// PeerCombineMode is how the cache states of peer Traffic Monitors are combined with the local states.
+type PeerCombineMode string
+
+const (
+	// PeerCombineModeOptimistic marks a cache available if any available Traffic Monitor, including this one, sees it available.
+	PeerCombineModeOptimistic = PeerCombineMode("optimistic")
+	// PeerCombineModeWeighted marks a cache unavailable only if Traffic Monitors with more than the peer_weighted_majority of the total weight see it unavailable.
+	PeerCombineModeWeighted = PeerCombineMode("weighted")
+)
+
+// UnmarshalJSON implements the json.Unmarshaller interface
+func (t *PeerCombineMode) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	switch mode := PeerCombineMode(strings.ToLower(s)); mode {
+	case PeerCombineModeOptimistic, PeerCombineModeWeighted:
+		*t = mode
+		return nil
+	default:
+		return errors.New("parsed invalid PeerCombineMode: " + s)
+	}
+}
+
 // Config is the configuration for the application. It includes myriad data, such as polling intervals and log locations.
 type Config struct {
-	CacheHealthPollingInterval   time.Duration   `json:"-"`
-	CacheStatPollingInterval     time.Duration   `json:"-"`
-	MonitorConfigPollingInterval time.Duration   `json:"-"`
-	HTTPTimeout                  time.Duration   `json:"-"`
-	PeerPollingInterval          time.Duration   `json:"-"`
-	PeerOptimistic               bool            `json:"peer_optimistic"`
-	PeerOptimisticQuorumMin      int             `json:"peer_optimistic_quorum_min"`
-	MaxEvents                    uint64          `json:"max_events"`
-	MaxStatHistory               uint64          `json:"max_stat_history"`
-	MaxHealthHistory             uint64          `json:"max_health_history"`
-	HealthFlushInterval          time.Duration   `json:"-"`
-	StatFlushInterval            time.Duration   `json:"-"`
-	StatBufferInterval           time.Duration   `json:"-"`
-	LogLocationError             string          `json:"log_location_error"`
-	LogLocationWarning           string          `json:"log_location_warning"`
-	LogLocationInfo              string          `json:"log_location_info"`
-	LogLocationDebug             string          `json:"log_location_debug"`
-	LogLocationEvent             string          `json:"log_location_event"`
-	ServeReadTimeout             time.Duration   `json:"-"`
-	ServeWriteTimeout            time.Duration   `json:"-"`
-	HealthToStatRatio            uint64          `json:"health_to_stat_ratio"`
-	StaticFileDir                string          `json:"static_file_dir"`
-	CRConfigHistoryCount         uint64          `json:"crconfig_history_count"`
-	TrafficOpsMinRetryInterval   time.Duration   `json:"-"`
-	TrafficOpsMaxRetryInterval   time.Duration   `json:"-"`
-	CRConfigBackupFile           string          `json:"crconfig_backup_file"`
-	TMConfigBackupFile           string          `json:"tmconfig_backup_file"`
-	TrafficOpsDiskRetryMax       uint64          `json:"-"`
-	CachePollingProtocol         PollingProtocol `json:"cache_polling_protocol"`
-	PeerPollingProtocol          PollingProtocol `json:"peer_polling_protocol"`
-	HTTPPollingFormat            string          `json:"http_polling_format"`
+	CacheHealthPollingInterval   time.Duration      `json:"-"`
+	CacheStatPollingInterval     time.Duration      `json:"-"`
+	MonitorConfigPollingInterval time.Duration      `json:"-"`
+	HTTPTimeout                  time.Duration      `json:"-"`
+	PeerPollingInterval          time.Duration      `json:"-"`
+	PeerOptimistic               bool               `json:"peer_optimistic"`
+	PeerOptimisticQuorumMin      int                `json:"peer_optimistic_quorum_min"`
+	PeerCombineMode              PeerCombineMode    `json:"peer_combine_mode"`
+	PeerWeightedMajority         float64            `json:"peer_weighted_majority"`
+	PeerWeights                  map[string]float64 `json:"peer_weights"`
+	PeerLocalityWeight           float64            `json:"peer_locality_weight"`
+	MaxEvents                    uint64             `json:"max_events"`
+	MaxStatHistory               uint64             `json:"max_stat_history"`
+	MaxHealthHistory             uint64             `json:"max_health_history"`
+	HealthFlushInterval          time.Duration      `json:"-"`
+	StatFlushInterval            time.Duration      `json:"-"`
+	StatBufferInterval           time.Duration      `json:"-"`
+	LogLocationError             string             `json:"log_location_error"`
+	LogLocationWarning           string             `json:"log_location_warning"`
+	LogLocationInfo              string             `json:"log_location_info"`
+	LogLocationDebug             string             `json:"log_location_debug"`
+	LogLocationEvent             string             `json:"log_location_event"`
+	ServeReadTimeout             time.Duration      `json:"-"`
+	ServeWriteTimeout            time.Duration      `json:"-"`
+	HealthToStatRatio            uint64             `json:"health_to_stat_ratio"`
+	StaticFileDir                string             `json:"static_file_dir"`
+	CRConfigHistoryCount         uint64             `json:"crconfig_history_count"`
+	TrafficOpsMinRetryInterval   time.Duration      `json:"-"`
+	TrafficOpsMaxRetryInterval   time.Duration      `json:"-"`
+	CRConfigBackupFile           string             `json:"crconfig_backup_file"`
+	TMConfigBackupFile           string             `json:"tmconfig_backup_file"`
+	StateBackupFile              string             `json:"state_backup_file"`
+	StateBackupInterval          time.Duration      `json:"-"`
+	StateBackupMaxAge            time.Duration      `json:"-"`
+	RecordFile                   string             `json:"record_file"`
+	ReplayFile                   string             `json:"replay_file"`
+	Webhooks                     []Webhook          `json:"webhooks"`
+	TrafficOpsDiskRetryMax       uint64             `json:"-"`
+	CachePollingProtocol         PollingProtocol    `json:"cache_polling_protocol"`
+	PeerPollingProtocol          PollingProtocol    `json:"peer_polling_protocol"`
+	HTTPPollingFormat            string             `json:"http_polling_format"`
 }
 
 func (c Config) ErrorLog() log.LogLocation   { return log.LogLocation(c.LogLocationError) }
@@ -145,6 +183,9 @@ var DefaultConfig = Config{
 	PeerPollingInterval:          5 * time.Second,
 	PeerOptimistic:               true,
 	PeerOptimisticQuorumMin:      0,
+	PeerCombineMode:              PeerCombineModeOptimistic,
+	PeerWeightedMajority:         0.5,
+	PeerLocalityWeight:           1,
 	MaxEvents:                    200,
 	MaxStatHistory:               5,
 	MaxHealthHistory:             5,
@@ -165,6 +206,9 @@ var DefaultConfig = Config{
 	TrafficOpsMaxRetryInterval:   60000 * time.Millisecond,
 	CRConfigBackupFile:           CRConfigBackupFile,
 	TMConfigBackupFile:           TMConfigBackupFile,
+	StateBackupFile:              StateBackupFile,
+	StateBackupInterval:          time.Minute,
+	StateBackupMaxAge:            5 * time.Minute,
 	TrafficOpsDiskRetryMax:       2,
 	CachePollingProtocol:         Both,
 	PeerPollingProtocol:          Both,
@@ -188,6 +232,8 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		StatBufferIntervalMs           uint64 `json:"stat_buffer_interval_ms"`
 		ServeReadTimeoutMs             uint64 `json:"serve_read_timeout_ms"`
 		ServeWriteTimeoutMs            uint64 `json:"serve_write_timeout_ms"`
+		StateBackupIntervalMs          uint64 `json:"state_backup_interval_ms"`
+		StateBackupMaxAgeMs            uint64 `json:"state_backup_max_age_ms"`
 		*Alias
 	}{
 		CacheHealthPollingIntervalMs:   uint64(c.CacheHealthPollingInterval / time.Millisecond),
@@ -200,6 +246,8 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		HealthFlushIntervalMs:          uint64(c.HealthFlushInterval / time.Millisecond),
 		StatFlushIntervalMs:            uint64(c.StatFlushInterval / time.Millisecond),
 		StatBufferIntervalMs:           uint64(c.StatBufferInterval / time.Millisecond),
+		StateBackupIntervalMs:          uint64(c.StateBackupInterval / time.Millisecond),
+		StateBackupMaxAgeMs:            uint64(c.StateBackupMaxAge / time.Millisecond),
 		Alias:                          (*Alias)(c),
 	})
 }
@@ -225,6 +273,11 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 		TrafficOpsDiskRetryMax         *uint64 `json:"traffic_ops_disk_retry_max"`
 		CRConfigBackupFile             *string `json:"crconfig_backup_file"`
 		TMConfigBackupFile             *string `json:"tmconfig_backup_file"`
+		StateBackupFile                *string `json:"state_backup_file"`
+		StateBackupIntervalMs          *uint64 `json:"state_backup_interval_ms"`
+		StateBackupMaxAgeMs            *uint64 `json:"state_backup_max_age_ms"`
+		RecordFile                     *string `json:"record_file"`
+		ReplayFile                     *string `json:"replay_file"`
 		HTTPPollingFormat              *string `json:"http_polling_format"`
 		*Alias
 	}{
@@ -286,9 +339,101 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	if aux.TMConfigBackupFile != nil {
 		c.TMConfigBackupFile = *aux.TMConfigBackupFile
 	}
+	if aux.StateBackupFile != nil {
+		c.StateBackupFile = *aux.StateBackupFile
+	}
+	if aux.StateBackupIntervalMs != nil {
+		c.StateBackupInterval = time.Duration(*aux.StateBackupIntervalMs) * time.Millisecond
+	}
+	if aux.StateBackupMaxAgeMs != nil {
+		c.StateBackupMaxAge = time.Duration(*aux.StateBackupMaxAgeMs) * time.Millisecond
+	}
+	if aux.RecordFile != nil {
+		c.RecordFile = *aux.RecordFile
+	}
+	if aux.ReplayFile != nil {
+		c.ReplayFile = *aux.ReplayFile
+	}
 	if aux.HTTPPollingFormat != nil {
 		c.HTTPPollingFormat = *aux.HTTPPollingFormat
 	}
+	if c.PeerWeightedMajority < 0 || c.PeerWeightedMajority >= 1 {
+		return fmt.Errorf("peer_weighted_majority must be at least 0 and less than 1, was %v", c.PeerWeightedMajority)
+	}
+	if c.PeerLocalityWeight < 0 {
+		return fmt.Errorf("peer_locality_weight must not be negative, was %v", c.PeerLocalityWeight)
+	}
+	return nil
+}
+
+// Webhook is a URL which events are POSTed to.
+type Webhook struct {
+	URL string `json:"url"`
+	// EventTypes are the types of events to send, of "cache",
+	// "deliveryservice", "peer", and "peerquorum". If empty, all events are
+	// sent.
+	EventTypes []string `json:"event_types"`
+	// UnavailableOnly is whether to only send events for things becoming
+	// unavailable, and not for them becoming available again.
+	UnavailableOnly bool `json:"unavailable_only"`
+	// Headers are added to every request, for example for authorization.
+	Headers          map[string]string `json:"headers"`
+	Timeout          time.Duration     `json:"-"`
+	RetryMax         uint64            `json:"retry_max"`
+	RetryMinInterval time.Duration     `json:"-"`
+	RetryMaxInterval time.Duration     `json:"-"`
+}
+
+// DefaultWebhook is the default configuration of each webhook, for settings which don't exist in the config file.
+var DefaultWebhook = Webhook{
+	Timeout:          5 * time.Second,
+	RetryMax:         5,
+	RetryMinInterval: time.Second,
+	RetryMaxInterval: time.Minute,
+}
+
+// MarshalJSON marshals custom millisecond durations.
+func (w *Webhook) MarshalJSON() ([]byte, error) {
+	type Alias Webhook
+	json := jsoniter.ConfigFastest
+	return json.Marshal(&struct {
+		TimeoutMs          uint64 `json:"timeout_ms"`
+		RetryMinIntervalMs uint64 `json:"retry_min_interval_ms"`
+		RetryMaxIntervalMs uint64 `json:"retry_max_interval_ms"`
+		*Alias
+	}{
+		TimeoutMs:          uint64(w.Timeout / time.Millisecond),
+		RetryMinIntervalMs: uint64(w.RetryMinInterval / time.Millisecond),
+		RetryMaxIntervalMs: uint64(w.RetryMaxInterval / time.Millisecond),
+		Alias:              (*Alias)(w),
+	})
+}
+
+// UnmarshalJSON populates this webhook from given JSON bytes, with the DefaultWebhook values for missing settings.
+func (w *Webhook) UnmarshalJSON(data []byte) error {
+	type Alias Webhook
+	*w = DefaultWebhook
+	aux := &struct {
+		TimeoutMs          *uint64 `json:"timeout_ms"`
+		RetryMinIntervalMs *uint64 `json:"retry_min_interval_ms"`
+		RetryMaxIntervalMs *uint64 `json:"retry_max_interval_ms"`
+		*Alias
+	}{
+		Alias: (*Alias)(w),
+	}
+	json := jsoniter.ConfigFastest
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.TimeoutMs != nil {
+		w.Timeout = time.Duration(*aux.TimeoutMs) * time.Millisecond
+	}
+	if aux.RetryMinIntervalMs != nil {
+		w.RetryMinInterval = time.Duration(*aux.RetryMinIntervalMs) * time.Millisecond
+	}
+	if aux.RetryMaxIntervalMs != nil {
+		w.RetryMaxInterval = time.Duration(*aux.RetryMaxIntervalMs) * time.Millisecond
+	}
 	return nil
 }
 
@@ -0,0 +1,248 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// EventStreamContentType is the Content-Type of Server-Sent Events streams.
+const EventStreamContentType = "text/event-stream"
+
+// CRStatesStreamKeepaliveInterval is the interval at which comments are sent on CRStates streams without changes, to keep idle connections from being closed by intermediaries.
+// It is less than CRStatesStreamWriteTimeout and the default serve_write_timeout_ms.
+const CRStatesStreamKeepaliveInterval = 5 * time.Second
+
+// CRStatesStreamWriteTimeout is the timeout of each write to a CRStates stream. Streams aren't subject to serve_write_timeout_ms, which would close them, so this closes streams to clients which stop reading.
+const CRStatesStreamWriteTimeout = 10 * time.Second
+
+// Server-Sent Event names of CRStates streams.
+const (
+	// CRStatesStreamEventStates is the event whose data is the full CRStates. It is sent when a client connects.
+	CRStatesStreamEventStates = "states"
+	// CRStatesStreamEventDelta is the event whose data is a tc.CRStatesDelta of the changes since the last event.
+	CRStatesStreamEventDelta = "delta"
+	// CRStatesStreamEventUnavailable is the event whose data is the error message string sent when optimistic peer quorum is lost, after which the stream is closed, as /publish/CrStates serves a 503.
+	CRStatesStreamEventUnavailable = "unavailable"
+)
+
+// srvTRStateStream returns a handler which streams CRStates as Server-Sent Events: the full states on connect, and then the changes whenever the states change.
+// Like /publish/CrStates, the `raw` parameter streams the local states, and otherwise the combined states are streamed.
+func srvTRStateStream(errorCount threadsafe.Uint, localStates peer.CRStatesThreadsafe, combinedStates peer.CRStatesThreadsafe, peerStates peer.CRStatesPeersThreadsafe) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		states := combinedStates
+		_, raw := r.URL.Query()["raw"]
+		if raw {
+			states = localStates
+		} else if err := optimisticQuorumErr(peerStates); err != nil {
+			HandleErr(errorCount, r.URL.EscapedPath(), err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			log.Write(w, []byte(http.StatusText(http.StatusServiceUnavailable)), r.URL.EscapedPath())
+			return
+		}
+
+		// quorumLost returns whether optimistic peer quorum was lost since the stream started, in which case it sends the error to the client. The stream must then be closed, as /publish/CrStates serves a 503.
+		quorumLost := func(stream *eventStream) bool {
+			if raw {
+				return false
+			}
+			err := optimisticQuorumErr(peerStates)
+			if err == nil {
+				return false
+			}
+			HandleErr(errorCount, r.URL.EscapedPath(), err)
+			if err := stream.Send(CRStatesStreamEventUnavailable, err.Error()); err != nil {
+				log.Infof("streaming CRStates to %s: %v", r.RemoteAddr, err)
+			}
+			return true
+		}
+
+		changed, unsubscribe := states.Subscribe()
+		defer unsubscribe()
+
+		stream, err := newEventStream(w, r)
+		if err != nil {
+			HandleErr(errorCount, r.URL.EscapedPath(), errors.New("streaming unsupported: "+err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Write(w, []byte(http.StatusText(http.StatusInternalServerError)), r.URL.EscapedPath())
+			return
+		}
+		defer stream.Close()
+
+		last := states.Get()
+		if err := stream.Send(CRStatesStreamEventStates, last); err != nil {
+			log.Warnf("streaming CRStates to %s: %v", r.RemoteAddr, err)
+			return
+		}
+
+		keepalive := time.NewTicker(CRStatesStreamKeepaliveInterval)
+		defer keepalive.Stop()
+
+		for {
+			select {
+			case <-stream.Done():
+				return
+			case <-keepalive.C:
+				if quorumLost(stream) {
+					return
+				}
+				if err := stream.Keepalive(); err != nil {
+					log.Infof("streaming CRStates to %s: %v", r.RemoteAddr, err)
+					return
+				}
+			case <-changed:
+				if quorumLost(stream) {
+					return
+				}
+				current := states.Get()
+				delta := tc.CRStatesDiff(last, current)
+				if delta.Empty() {
+					continue
+				}
+				last = current
+				if err := stream.Send(CRStatesStreamEventDelta, delta); err != nil {
+					log.Infof("streaming CRStates to %s: %v", r.RemoteAddr, err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// optimisticQuorumErr returns an error if optimistic peer quorum is enabled and there aren't enough peers available for it, in which case the combined states mustn't be served. See srvTRState.
+func optimisticQuorumErr(peerStates peer.CRStatesPeersThreadsafe) error {
+	if !peerStates.OptimisticQuorumEnabled() {
+		return nil
+	}
+	if optimisticQuorum, peersAvailable, peerCount, minimum := peerStates.HasOptimisticQuorum(); !optimisticQuorum {
+		return fmt.Errorf("number of peers available (%d/%d) is less than the minimum number of %d required for optimistic peer quorum", peersAvailable, peerCount, minimum)
+	}
+	return nil
+}
+
+// eventStream is a Server-Sent Events stream to a client.
+//
+// HTTP/1.x connections are hijacked, so the stream isn't closed by the server's write timeout. Other connections, i.e. HTTP/2, are streamed through the http.ResponseWriter, and are closed by the server's write timeout.
+type eventStream struct {
+	w     *bufio.Writer
+	conn  net.Conn // nil if the connection isn't hijacked
+	flush func()
+	done  <-chan struct{}
+}
+
+// newEventStream starts a Server-Sent Events stream, writing the response header. The stream must be closed when the caller is done with it.
+func newEventStream(w http.ResponseWriter, r *http.Request) (*eventStream, error) {
+	if r.ProtoMajor > 1 {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return nil, errors.New("response writer is not a flusher")
+		}
+		w.Header().Set("Content-Type", EventStreamContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		return &eventStream{w: bufio.NewWriter(w), flush: flusher.Flush, done: r.Context().Done()}, nil
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("response writer is not a hijacker")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.New("hijacking connection: " + err.Error())
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, errors.New("clearing connection deadline: " + err.Error())
+	}
+
+	// the client never sends anything else on the connection, so a read returns only when it's closed.
+	done := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, rw.Reader)
+		close(done)
+	}()
+
+	s := &eventStream{w: rw.Writer, conn: conn, flush: func() {}, done: done}
+	if err := s.write("HTTP/1.1 200 OK\r\nContent-Type: " + EventStreamContentType + "\r\nCache-Control: no-cache\r\nConnection: close\r\n\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Done returns a channel which is closed when the client closes the stream.
+func (s *eventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send sends the given data as an event with the given name. The data is serialized as compact JSON, like tc.CRStatesMarshall, which never contains newlines, so it is always a single data line.
+func (s *eventStream) Send(event string, data interface{}) error {
+	bts, err := json.Marshal(data)
+	if err != nil {
+		return errors.New("marshalling event: " + err.Error())
+	}
+	if err := s.write("event: " + event + "\ndata: " + string(bts) + "\n\n"); err != nil {
+		return errors.New("writing event: " + err.Error())
+	}
+	return nil
+}
+
+// Keepalive sends a comment, which clients ignore.
+func (s *eventStream) Keepalive() error {
+	return s.write(": keepalive\n\n")
+}
+
+// write writes and flushes the given string to the client, within CRStatesStreamWriteTimeout if the connection is hijacked.
+func (s *eventStream) write(str string) error {
+	if s.conn != nil {
+		if err := s.conn.SetWriteDeadline(time.Now().Add(CRStatesStreamWriteTimeout)); err != nil {
+			return errors.New("setting write deadline: " + err.Error())
+		}
+	}
+	if _, err := s.w.WriteString(str); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+// Close closes the stream's connection, if it was hijacked. Otherwise, the connection is closed by the server when the handler returns.
+func (s *eventStream) Close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
@@ -0,0 +1,242 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// readServerSentEvent reads the next event from the stream, skipping comments, and returns its name and data.
+func readServerSentEvent(rdr *bufio.Reader) (string, string, error) {
+	event := ""
+	data := ""
+	for {
+		line, err := rdr.ReadString('\n')
+		if err != nil {
+			return "", "", err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data, nil
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestSrvTRStateStream(t *testing.T) {
+	localStates := peer.NewCRStatesThreadsafe()
+	combinedStates := peer.NewCRStatesThreadsafe()
+	combinedStates.AddCache("edge0", tc.IsAvailable{IsAvailable: true})
+	peerStates := peer.NewCRStatesPeersThreadsafe(0)
+
+	srv := httptest.NewServer(srvTRStateStream(threadsafe.NewUint(), localStates, combinedStates, peerStates))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ctype := resp.Header.Get("Content-Type"); ctype != EventStreamContentType {
+		t.Errorf("expected Content-Type %s, actual %s", EventStreamContentType, ctype)
+	}
+
+	// the reader stops when the stream is closed at the end of the test
+	events := make(chan [2]string)
+	go func() {
+		defer close(events)
+		rdr := bufio.NewReader(resp.Body)
+		for {
+			name, data, err := readServerSentEvent(rdr)
+			if err != nil {
+				return
+			}
+			events <- [2]string{name, data}
+		}
+	}()
+	nextEvent := func() (string, string) {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatal("event stream closed unexpectedly")
+			}
+			return e[0], e[1]
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return "", ""
+	}
+
+	name, data := nextEvent()
+	if name != CRStatesStreamEventStates {
+		t.Fatalf("expected first event '%s', actual '%s'", CRStatesStreamEventStates, name)
+	}
+	states := tc.NewCRStates()
+	if err := json.Unmarshal([]byte(data), &states); err != nil {
+		t.Fatalf("unmarshalling states: %v", err)
+	}
+	if !states.Caches["edge0"].IsAvailable {
+		t.Errorf("expected edge0 available in initial states, actual %+v", states.Caches)
+	}
+
+	combinedStates.SetCache("edge0", tc.IsAvailable{IsAvailable: false})
+	combinedStates.SetDeliveryService("ds0", tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{}})
+
+	delta := tc.CRStatesDelta{}
+	for len(delta.Caches) == 0 || len(delta.DeliveryService) == 0 {
+		name, data = nextEvent()
+		if name != CRStatesStreamEventDelta {
+			t.Fatalf("expected event '%s', actual '%s'", CRStatesStreamEventDelta, name)
+		}
+		d := tc.CRStatesDelta{}
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			t.Fatalf("unmarshalling delta: %v", err)
+		}
+		if delta.Caches == nil {
+			delta = d
+			continue
+		}
+		for k, v := range d.Caches {
+			delta.Caches[k] = v
+		}
+		for k, v := range d.DeliveryService {
+			delta.DeliveryService[k] = v
+		}
+	}
+
+	states.Apply(delta)
+	if states.Caches["edge0"].IsAvailable {
+		t.Errorf("expected edge0 unavailable after delta, actual %+v", states.Caches)
+	}
+	if !states.DeliveryService["ds0"].IsAvailable {
+		t.Errorf("expected ds0 available after delta, actual %+v", states.DeliveryService)
+	}
+}
+
+func TestSrvTRStateStreamOutlivesWriteTimeout(t *testing.T) {
+	localStates := peer.NewCRStatesThreadsafe()
+	combinedStates := peer.NewCRStatesThreadsafe()
+	combinedStates.AddCache("edge0", tc.IsAvailable{IsAvailable: true})
+	peerStates := peer.NewCRStatesPeersThreadsafe(0)
+
+	srv := httptest.NewUnstartedServer(srvTRStateStream(threadsafe.NewUint(), localStates, combinedStates, peerStates))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		rdr := bufio.NewReader(resp.Body)
+		for {
+			name, _, err := readServerSentEvent(rdr)
+			if err != nil {
+				return
+			}
+			events <- name
+		}
+	}()
+
+	if name := <-events; name != CRStatesStreamEventStates {
+		t.Fatalf("expected first event '%s', actual '%s'", CRStatesStreamEventStates, name)
+	}
+
+	time.Sleep(3 * srv.Config.WriteTimeout)
+	combinedStates.SetCache("edge0", tc.IsAvailable{IsAvailable: false})
+
+	select {
+	case name, ok := <-events:
+		if !ok {
+			t.Fatal("expected stream to outlive the server write timeout, actual: stream closed")
+		}
+		if name != CRStatesStreamEventDelta {
+			t.Errorf("expected event '%s', actual '%s'", CRStatesStreamEventDelta, name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+}
+
+func TestSrvTRStateStreamQuorumLost(t *testing.T) {
+	localStates := peer.NewCRStatesThreadsafe()
+	combinedStates := peer.NewCRStatesThreadsafe()
+	combinedStates.AddCache("edge0", tc.IsAvailable{IsAvailable: true})
+	peerStates := peer.NewCRStatesPeersThreadsafe(2)
+	peerStates.Set(peer.Result{ID: "tm0", Available: true, PeerStates: tc.NewCRStates(), Time: time.Now()})
+	peerStates.Set(peer.Result{ID: "tm1", Available: true, PeerStates: tc.NewCRStates(), Time: time.Now()})
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{"tm0": {}, "tm1": {}})
+
+	srv := httptest.NewServer(srvTRStateStream(threadsafe.NewUint(), localStates, combinedStates, peerStates))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %v with quorum, actual %v", http.StatusOK, resp.StatusCode)
+	}
+
+	rdr := bufio.NewReader(resp.Body)
+	if name, _, err := readServerSentEvent(rdr); err != nil || name != CRStatesStreamEventStates {
+		t.Fatalf("expected first event '%s', actual '%s' error %v", CRStatesStreamEventStates, name, err)
+	}
+
+	peerStates.Set(peer.Result{ID: "tm1", Available: false, PeerStates: tc.NewCRStates(), Time: time.Now()})
+	combinedStates.SetCache("edge0", tc.IsAvailable{IsAvailable: false})
+
+	if name, data, err := readServerSentEvent(rdr); err != nil || name != CRStatesStreamEventUnavailable {
+		t.Fatalf("expected event '%s' after losing quorum, actual '%s' data '%s' error %v", CRStatesStreamEventUnavailable, name, data, err)
+	}
+	if _, _, err := readServerSentEvent(rdr); err == nil {
+		t.Errorf("expected stream closed after losing quorum, actual another event")
+	}
+
+	resp, err = http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status %v without quorum, actual %v", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
@@ -78,6 +78,7 @@ func MakeDispatchMap(
 			bytes, statusCode, err := srvTRState(params, localStates, combinedStates, peerStates)
 			return WrapErrStatusCode(errorCount, path, bytes, statusCode, err)
 		}, rfc.ApplicationJSON)),
+		"/publish/CrStates/stream": wrap(srvTRStateStream(errorCount, localStates, combinedStates, peerStates)),
 		"/publish/CacheStatsNew": wrap(WrapParams(func(params url.Values, path string) ([]byte, int) {
 			return srvCacheStats(params, errorCount, path, toData, statResultHistory, statInfoHistory, monitorConfig, combinedStates, statMaxKbpses)
 		}, rfc.ApplicationJSON)),
@@ -132,6 +133,9 @@ func MakeDispatchMap(
 		"/api/crconfig-history": wrap(WrapErr(errorCount, func() ([]byte, error) {
 			return srvAPICRConfigHist(toSession)
 		}, rfc.ApplicationJSON)),
+		"/metrics": wrap(WrapBytes(func() []byte {
+			return srvPrometheusMetrics(toData, statInfoHistory, combinedStates, dsStats, peerStates, lastHealthDurations, fetchCount, errorCount)
+		}, PrometheusContentType)),
 	}
 	return addTrailingSlashEndpoints(dispatchMap)
 }
@@ -33,9 +33,11 @@ import (
 )
 
 // APIPeerStates contains the data to be returned for an API call to get the peer states of a Traffic Monitor. This contains common API data returned by most endpoints, and a map of peers, to caches' states.
+// In the weighted peer combine mode, it also contains the breakdown of the last vote on each cache.
 type APIPeerStates struct {
 	tc.CommonAPIData
 	Peers map[tc.TrafficMonitorName]map[tc.CacheName][]CacheState `json:"peers"`
+	Votes map[tc.CacheName]peer.CacheVotes                        `json:"votes,omitempty"`
 }
 
 // CacheState represents the available state of a cache.
@@ -52,11 +54,11 @@ func srvPeerStates(params url.Values, errorCount threadsafe.Uint, path string, t
 		return []byte(err.Error()), http.StatusBadRequest
 	}
 	json := jsoniter.ConfigFastest
-	bytes, err := json.Marshal(createAPIPeerStates(peerStates.GetCrstates(), peerStates.GetPeersOnline(), filter, params))
+	bytes, err := json.Marshal(createAPIPeerStates(peerStates.GetCrstates(), peerStates.GetPeersOnline(), peerStates.GetCacheVotes(), filter, params))
 	return WrapErrCode(errorCount, path, bytes, err)
 }
 
-func createAPIPeerStates(peerStates map[tc.TrafficMonitorName]tc.CRStates, peersOnline map[tc.TrafficMonitorName]bool, filter *PeerStateFilter, params url.Values) APIPeerStates {
+func createAPIPeerStates(peerStates map[tc.TrafficMonitorName]tc.CRStates, peersOnline map[tc.TrafficMonitorName]bool, cacheVotes map[tc.CacheName]peer.CacheVotes, filter *PeerStateFilter, params url.Values) APIPeerStates {
 	apiPeerStates := APIPeerStates{
 		CommonAPIData: srvhttp.GetCommonAPIData(params, time.Now()),
 		Peers:         map[tc.TrafficMonitorName]map[tc.CacheName][]CacheState{},
@@ -81,5 +83,15 @@ func createAPIPeerStates(peerStates map[tc.TrafficMonitorName]tc.CRStates, peers
 		}
 		apiPeerStates.Peers[peer] = peerState
 	}
+
+	for cache, votes := range cacheVotes {
+		if !filter.UseCache(cache) {
+			continue
+		}
+		if apiPeerStates.Votes == nil {
+			apiPeerStates.Votes = map[tc.CacheName]peer.CacheVotes{}
+		}
+		apiPeerStates.Votes[cache] = votes
+	}
 	return apiPeerStates
 }
@@ -0,0 +1,278 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsdata"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// PrometheusContentType is the Content-Type of the Prometheus text exposition format served by the /metrics endpoint.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusMetricPrefix is prepended to the name of every metric served by the /metrics endpoint.
+const PrometheusMetricPrefix = "traffic_monitor_"
+
+func srvPrometheusMetrics(
+	toData todata.TODataThreadsafe,
+	statInfoHistory threadsafe.ResultInfoHistory,
+	combinedStates peer.CRStatesThreadsafe,
+	dsStats threadsafe.DSStatsReader,
+	peerStates peer.CRStatesPeersThreadsafe,
+	lastHealthDurations threadsafe.DurationMap,
+	fetchCount threadsafe.Uint,
+	errorCount threadsafe.Uint,
+) []byte {
+	w := newPromWriter()
+	writeCacheMetrics(w, toData.Get(), statInfoHistory.Get(), combinedStates.GetCaches(), lastHealthDurations.Get())
+	writeDSMetrics(w, combinedStates.GetDeliveryServices(), dsStats.Get())
+	writePeerMetrics(w, peerStates, time.Now())
+
+	w.family("fetches_total", "The number of individual cache polls this Traffic Monitor has performed.", "counter")
+	w.sample("fetches_total", nil, float64(fetchCount.Get()))
+	w.family("errors_total", "The number of errors this Traffic Monitor has encountered.", "counter")
+	w.sample("errors_total", nil, float64(errorCount.Get()))
+	return w.Bytes()
+}
+
+// writeCacheMetrics writes the combined availability, the latest vitals from the stat poller, and the last health poll duration of every cache.
+func writeCacheMetrics(w *promWriter, toData todata.TOData, statInfo cache.ResultInfoHistory, cacheStates map[tc.CacheName]tc.IsAvailable, healthDurations map[tc.CacheName]time.Duration) {
+	cacheNames := make([]string, 0, len(cacheStates))
+	for cacheName := range cacheStates {
+		cacheNames = append(cacheNames, string(cacheName))
+	}
+	sort.Strings(cacheNames)
+
+	cacheLabels := func(cacheName tc.CacheName) []promLabel {
+		return []promLabel{
+			{"cache", string(cacheName)},
+			{"type", toData.ServerTypes[cacheName].String()},
+			{"cachegroup", string(toData.ServerCachegroups[cacheName])},
+		}
+	}
+
+	w.family("cache_available", "Whether the cache is available, combined with peer states.", "gauge")
+	for _, name := range cacheNames {
+		w.sample("cache_available", cacheLabels(tc.CacheName(name)), boolToFloat(cacheStates[tc.CacheName(name)].IsAvailable))
+	}
+	w.family("cache_ipv4_available", "Whether the cache is available over IPv4, combined with peer states.", "gauge")
+	for _, name := range cacheNames {
+		w.sample("cache_ipv4_available", cacheLabels(tc.CacheName(name)), boolToFloat(cacheStates[tc.CacheName(name)].Ipv4Available))
+	}
+	w.family("cache_ipv6_available", "Whether the cache is available over IPv6, combined with peer states.", "gauge")
+	for _, name := range cacheNames {
+		w.sample("cache_ipv6_available", cacheLabels(tc.CacheName(name)), boolToFloat(cacheStates[tc.CacheName(name)].Ipv6Available))
+	}
+
+	vitals := func(metric string, help string, typ string, f func(cache.Vitals) float64) {
+		w.family(metric, help, typ)
+		for _, name := range cacheNames {
+			infos := statInfo[tc.CacheName(name)]
+			if len(infos) == 0 || infos[0].Error != nil {
+				continue
+			}
+			w.sample(metric, cacheLabels(tc.CacheName(name)), f(infos[0].Vitals))
+		}
+	}
+	vitals("cache_loadavg", "The one-minute load average of the cache.", "gauge", func(v cache.Vitals) float64 { return v.LoadAvg })
+	vitals("cache_kbps_out", "The outgoing bandwidth of the cache, in kilobits per second.", "gauge", func(v cache.Vitals) float64 { return float64(v.KbpsOut) })
+	vitals("cache_max_kbps_out", "The maximum outgoing bandwidth of the cache, in kilobits per second.", "gauge", func(v cache.Vitals) float64 { return float64(v.MaxKbpsOut) })
+	vitals("cache_bytes_in_total", "The total bytes received by all interfaces of the cache.", "counter", func(v cache.Vitals) float64 { return float64(v.BytesIn) })
+	vitals("cache_bytes_out_total", "The total bytes sent by all interfaces of the cache.", "counter", func(v cache.Vitals) float64 { return float64(v.BytesOut) })
+
+	w.family("cache_interface_kbps_out", "The outgoing bandwidth of the cache interface, in kilobits per second.", "gauge")
+	for _, name := range cacheNames {
+		infos := statInfo[tc.CacheName(name)]
+		if len(infos) == 0 || infos[0].Error != nil {
+			continue
+		}
+		interfaceNames := make([]string, 0, len(infos[0].InterfaceVitals))
+		for interfaceName := range infos[0].InterfaceVitals {
+			interfaceNames = append(interfaceNames, interfaceName)
+		}
+		sort.Strings(interfaceNames)
+		for _, interfaceName := range interfaceNames {
+			labels := append(cacheLabels(tc.CacheName(name)), promLabel{"interface", interfaceName})
+			w.sample("cache_interface_kbps_out", labels, float64(infos[0].InterfaceVitals[interfaceName].KbpsOut))
+		}
+	}
+
+	w.family("cache_stat_request_seconds", "The duration of the latest stat poll request to the cache.", "gauge")
+	for _, name := range cacheNames {
+		infos := statInfo[tc.CacheName(name)]
+		if len(infos) == 0 {
+			continue
+		}
+		w.sample("cache_stat_request_seconds", cacheLabels(tc.CacheName(name)), infos[0].RequestTime.Seconds())
+	}
+
+	w.family("cache_health_poll_duration_seconds", "The time between the completion of the latest two health polls of the cache.", "gauge")
+	for _, name := range cacheNames {
+		d, ok := healthDurations[tc.CacheName(name)]
+		if !ok {
+			continue
+		}
+		w.sample("cache_health_poll_duration_seconds", cacheLabels(tc.CacheName(name)), d.Seconds())
+	}
+}
+
+// writeDSMetrics writes the combined availability and the total bandwidth and transactions per second of every delivery service.
+func writeDSMetrics(w *promWriter, dsStates map[tc.DeliveryServiceName]tc.CRStatesDeliveryService, dsStats dsdata.StatsReadonly) {
+	dsNames := make([]string, 0, len(dsStates))
+	for dsName := range dsStates {
+		dsNames = append(dsNames, string(dsName))
+	}
+	sort.Strings(dsNames)
+
+	w.family("deliveryservice_available", "Whether the delivery service is available, combined with peer states.", "gauge")
+	for _, name := range dsNames {
+		w.sample("deliveryservice_available", []promLabel{{"deliveryservice", name}}, boolToFloat(dsStates[tc.DeliveryServiceName(name)].IsAvailable))
+	}
+	w.family("deliveryservice_disabled_locations", "The number of cache groups in which the delivery service has no available caches.", "gauge")
+	for _, name := range dsNames {
+		w.sample("deliveryservice_disabled_locations", []promLabel{{"deliveryservice", name}}, float64(len(dsStates[tc.DeliveryServiceName(name)].DisabledLocations)))
+	}
+
+	totals := func(metric string, help string, f func(*dsdata.StatCacheStats) float64) {
+		w.family(metric, help, "gauge")
+		for _, name := range dsNames {
+			stat, ok := dsStats.Get(tc.DeliveryServiceName(name))
+			if !ok {
+				continue
+			}
+			w.sample(metric, []promLabel{{"deliveryservice", name}}, f(stat.Total()))
+		}
+	}
+	totals("deliveryservice_kbps", "The total bandwidth of the delivery service, in kilobits per second.", func(s *dsdata.StatCacheStats) float64 { return s.Kbps.Value })
+	totals("deliveryservice_tps", "The total transactions per second of the delivery service.", func(s *dsdata.StatCacheStats) float64 { return s.TpsTotal.Value })
+
+	w.family("deliveryservice_tps_by_class", "The transactions per second of the delivery service, by HTTP status class.", "gauge")
+	for _, name := range dsNames {
+		stat, ok := dsStats.Get(tc.DeliveryServiceName(name))
+		if !ok {
+			continue
+		}
+		total := stat.Total()
+		for _, class := range []struct {
+			Name string
+			Val  float64
+		}{
+			{"2xx", total.Tps2xx.Value},
+			{"3xx", total.Tps3xx.Value},
+			{"4xx", total.Tps4xx.Value},
+			{"5xx", total.Tps5xx.Value},
+		} {
+			w.sample("deliveryservice_tps_by_class", []promLabel{{"deliveryservice", name}, {"class", class.Name}}, class.Val)
+		}
+	}
+}
+
+// writePeerMetrics writes the availability and the time since the last poll of every peer which is ONLINE in the CRConfig.
+func writePeerMetrics(w *promWriter, peerStates peer.CRStatesPeersThreadsafe, now time.Time) {
+	peersOnline := peerStates.GetPeersOnline()
+	queryTimes := peerStates.GetQueryTimes()
+
+	peerNames := make([]string, 0, len(peersOnline))
+	for peerName, online := range peersOnline {
+		if !online {
+			continue
+		}
+		peerNames = append(peerNames, string(peerName))
+	}
+	sort.Strings(peerNames)
+
+	w.family("peer_available", "Whether the peer Traffic Monitor is reachable.", "gauge")
+	for _, name := range peerNames {
+		w.sample("peer_available", []promLabel{{"peer", name}}, boolToFloat(peerStates.GetPeerAvailability(tc.TrafficMonitorName(name))))
+	}
+	w.family("peer_last_poll_age_seconds", "The time since the peer Traffic Monitor was last polled.", "gauge")
+	for _, name := range peerNames {
+		t, ok := queryTimes[tc.TrafficMonitorName(name)]
+		if !ok {
+			continue
+		}
+		w.sample("peer_last_poll_age_seconds", []promLabel{{"peer", name}}, now.Sub(t).Seconds())
+	}
+}
+
+// promLabel is a single Prometheus metric label name and value.
+type promLabel struct {
+	Name string
+	Val  string
+}
+
+// promWriter builds a Prometheus text exposition format document. Families must be written before their samples, and each family written exactly once.
+type promWriter struct {
+	buf bytes.Buffer
+}
+
+func newPromWriter() *promWriter {
+	return &promWriter{}
+}
+
+// family writes the HELP and TYPE lines of the given metric.
+func (w *promWriter) family(metric string, help string, typ string) {
+	w.buf.WriteString("# HELP " + PrometheusMetricPrefix + metric + " " + help + "\n")
+	w.buf.WriteString("# TYPE " + PrometheusMetricPrefix + metric + " " + typ + "\n")
+}
+
+// sample writes a single sample of the given metric.
+func (w *promWriter) sample(metric string, labels []promLabel, val float64) {
+	w.buf.WriteString(PrometheusMetricPrefix + metric)
+	if len(labels) > 0 {
+		w.buf.WriteString("{")
+		for i, label := range labels {
+			if i > 0 {
+				w.buf.WriteString(",")
+			}
+			w.buf.WriteString(label.Name + `="` + escapePromLabel(label.Val) + `"`)
+		}
+		w.buf.WriteString("}")
+	}
+	w.buf.WriteString(" " + strconv.FormatFloat(val, 'g', -1, 64) + "\n")
+}
+
+// Bytes returns the document written so far.
+func (w *promWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePromLabel(s string) string {
+	return promLabelEscaper.Replace(s)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package datareq
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/dsdata"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+func TestWriteCacheMetrics(t *testing.T) {
+	toData := *todata.New()
+	toData.ServerTypes["edge0"] = tc.CacheTypeEdge
+	toData.ServerCachegroups["edge0"] = "cg0"
+
+	statInfo := cache.ResultInfoHistory{
+		"edge0": []cache.ResultInfo{{
+			ID:              "edge0",
+			RequestTime:     250 * time.Millisecond,
+			Vitals:          cache.Vitals{LoadAvg: 1.5, KbpsOut: 42, MaxKbpsOut: 1000, BytesIn: 10, BytesOut: 20},
+			InterfaceVitals: map[string]cache.Vitals{"eth0": {KbpsOut: 42}},
+		}},
+	}
+	states := map[tc.CacheName]tc.IsAvailable{
+		"edge0": {IsAvailable: true, Ipv4Available: true, Ipv6Available: false},
+		"edge1": {IsAvailable: false},
+	}
+	durations := map[tc.CacheName]time.Duration{"edge0": 2 * time.Second}
+
+	w := newPromWriter()
+	writeCacheMetrics(w, toData, statInfo, states, durations)
+	out := string(w.Bytes())
+
+	expected := []string{
+		"# TYPE traffic_monitor_cache_available gauge\n",
+		`traffic_monitor_cache_available{cache="edge0",type="EDGE",cachegroup="cg0"} 1` + "\n",
+		`traffic_monitor_cache_available{cache="edge1",type="INVALIDCACHETYPE",cachegroup=""} 0` + "\n",
+		`traffic_monitor_cache_ipv6_available{cache="edge0",type="EDGE",cachegroup="cg0"} 0` + "\n",
+		`traffic_monitor_cache_loadavg{cache="edge0",type="EDGE",cachegroup="cg0"} 1.5` + "\n",
+		`traffic_monitor_cache_kbps_out{cache="edge0",type="EDGE",cachegroup="cg0"} 42` + "\n",
+		"# TYPE traffic_monitor_cache_bytes_out_total counter\n",
+		`traffic_monitor_cache_interface_kbps_out{cache="edge0",type="EDGE",cachegroup="cg0",interface="eth0"} 42` + "\n",
+		`traffic_monitor_cache_stat_request_seconds{cache="edge0",type="EDGE",cachegroup="cg0"} 0.25` + "\n",
+		`traffic_monitor_cache_health_poll_duration_seconds{cache="edge0",type="EDGE",cachegroup="cg0"} 2` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected metrics to contain %q, actual: %s", line, out)
+		}
+	}
+	if strings.Contains(out, `traffic_monitor_cache_loadavg{cache="edge1"`) {
+		t.Errorf("expected no vitals for unpolled cache, actual: %s", out)
+	}
+}
+
+func TestWriteDSMetrics(t *testing.T) {
+	dsStates := map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{
+		"ds0": {IsAvailable: true, DisabledLocations: []tc.CacheGroupName{"cg1"}},
+	}
+	stats := dsdata.NewStats(1)
+	stat := dsdata.NewStat()
+	stat.TotalStats.Kbps.Value = 123.5
+	stat.TotalStats.TpsTotal.Value = 10
+	stat.TotalStats.Tps5xx.Value = 2
+	stats.DeliveryService["ds0"] = stat
+
+	w := newPromWriter()
+	writeDSMetrics(w, dsStates, *stats)
+	out := string(w.Bytes())
+
+	expected := []string{
+		`traffic_monitor_deliveryservice_available{deliveryservice="ds0"} 1` + "\n",
+		`traffic_monitor_deliveryservice_disabled_locations{deliveryservice="ds0"} 1` + "\n",
+		`traffic_monitor_deliveryservice_kbps{deliveryservice="ds0"} 123.5` + "\n",
+		`traffic_monitor_deliveryservice_tps{deliveryservice="ds0"} 10` + "\n",
+		`traffic_monitor_deliveryservice_tps_by_class{deliveryservice="ds0",class="5xx"} 2` + "\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected metrics to contain %q, actual: %s", line, out)
+		}
+	}
+}
+
+func TestEscapePromLabel(t *testing.T) {
+	if actual, expected := escapePromLabel("a\"b\\c\nd"), `a\"b\\c\nd`; actual != expected {
+		t.Errorf("expected %q, actual %q", expected, actual)
+	}
+}
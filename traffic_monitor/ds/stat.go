@@ -118,7 +118,7 @@ func addAvailableData(dsStats *dsdata.Stats, crStates tc.CRStates, serverCachegr
 				Description: desc,
 				Name:        dsName.String(),
 				Hostname:    dsName.String(),
-				Type:        "Delivery Service",
+				Type:        health.EventTypeDeliveryService,
 				Available:   stat.CommonStats.IsAvailable.Value,
 			}
 		}
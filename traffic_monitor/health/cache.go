@@ -147,8 +147,10 @@ func EvalInterface(infVitals map[string]cache.Vitals, inf tc.ServerInterfaceInfo
 }
 
 // EvalAggregate calculates the availability of a cache server as an aggregate
-// of server metrics and metrics of its network interfaces.
-func EvalAggregate(result cache.ResultInfo, resultStats *threadsafe.ResultStatValHistory, mc *tc.TrafficMonitorConfigMap) (bool, string, string) {
+// of server metrics and metrics of its network interfaces. The stat history
+// resultStats and result history infoHistory may be nil, in which case
+// thresholds needing them aren't evaluated.
+func EvalAggregate(result cache.ResultInfo, resultStats *threadsafe.ResultStatValHistory, infoHistory []cache.ResultInfo, mc *tc.TrafficMonitorConfigMap) (bool, string, string) {
 	serverInfo, ok := mc.TrafficServer[string(result.ID)]
 	if !ok {
 		log.Errorf("Cache %v missing from from Traffic Ops Monitor Config - treating as OFFLINE\n", result.ID)
@@ -200,6 +202,34 @@ func EvalAggregate(result cache.ResultInfo, resultStats *threadsafe.ResultStatVa
 		}
 	}
 
+	for name, threshold := range profile.Parameters.WindowThresholds {
+		samples := []statSample(nil)
+		ok := false
+		if computeStat, isComputed := computedStats[threshold.Stat]; isComputed {
+			if infoHistory == nil {
+				continue
+			}
+			samples, ok = computedStatSamples(infoHistory, computeStat, serverInfo, profile)
+		} else {
+			if resultStats == nil {
+				continue
+			}
+			samples, ok = statHistorySamples(resultStats.Load(threshold.Stat))
+		}
+		if !ok {
+			log.Errorf("health.EvalCache window threshold %s stat %s was not a number", name, threshold.Stat)
+			continue
+		}
+
+		val, ok := windowFunction(threshold.Function, threshold.Window, samples)
+		if !ok {
+			continue
+		}
+		if !inThreshold(threshold.HealthThreshold, val) {
+			return false, eventDesc(status, exceedsThresholdMsg(name, threshold.HealthThreshold, val)), name
+		}
+	}
+
 	return avail, eventDescVal, eventMsg
 }
 
@@ -231,12 +261,13 @@ func getProcessAvailableTuple(protocol config.PollingProtocol) func(cache.Availa
 }
 
 // CalcAvailability calculates the availability of each cache in results.
-// statResultHistory may be nil, in which case stats won't be used to calculate
-// availability.
+// statResultHistory and statInfoHistory may be nil, in which case stats and
+// window thresholds won't be used to calculate availability.
 func CalcAvailability(
 	results []cache.Result,
 	pollerName string,
 	statResultHistory *threadsafe.ResultStatHistory,
+	statInfoHistory cache.ResultInfoHistory,
 	mc tc.TrafficMonitorConfigMap,
 	toData todata.TOData,
 	localCacheStatusThreadsafe threadsafe.CacheAvailableStatus,
@@ -265,8 +296,8 @@ func CalcAvailability(
 			Status:             serverInfo.ServerStatus,
 		}
 
-		lastStatus, ok := localCacheStatuses[result.ID]
-		if ok {
+		lastStatus, hasLastStatus := localCacheStatuses[result.ID]
+		if hasLastStatus {
 			if result.UsingIPv4 {
 				availStatus.Available.IPv4 = true
 				availStatus.Available.IPv6 = serverInfo.IPv6() != "" && lastStatus.Available.IPv6
@@ -300,9 +331,9 @@ func CalcAvailability(
 		var aggUnavailableStat string
 
 		if statResultsVal != nil {
-			aggIsAvailable, aggWhyAvailable, aggUnavailableStat = EvalAggregate(cache.ToInfo(result), &statResultsVal.Stats, &mc)
+			aggIsAvailable, aggWhyAvailable, aggUnavailableStat = EvalAggregate(cache.ToInfo(result), &statResultsVal.Stats, statInfoHistory[tc.CacheName(result.ID)], &mc)
 		} else {
-			aggIsAvailable, aggWhyAvailable, aggUnavailableStat = EvalAggregate(cache.ToInfo(result), nil, &mc)
+			aggIsAvailable, aggWhyAvailable, aggUnavailableStat = EvalAggregate(cache.ToInfo(result), nil, statInfoHistory[tc.CacheName(result.ID)], &mc)
 		}
 
 		if result.UsingIPv4 {
@@ -313,6 +344,10 @@ func CalcAvailability(
 
 		availStatus.ProcessedAvailable = processAvailableTuple(availStatus.Available, serverInfo)
 
+		if dampingWhy := dampAvailability(&availStatus, lastStatus, hasLastStatus, mc.Profile[serverInfo.Profile].Parameters, time.Now()); dampingWhy != "" {
+			reasons = append(reasons, dampingWhy)
+		}
+
 		if aggWhyAvailable != "" {
 			reasons = append([]string{aggWhyAvailable}, reasons...)
 		}
@@ -325,9 +360,11 @@ func CalcAvailability(
 			IsAvailable:   availStatus.ProcessedAvailable,
 			Ipv4Available: availStatus.Available.IPv4,
 			Ipv6Available: availStatus.Available.IPv6,
+			DampingState:  availStatus.DampingState,
+			FlapPenalty:   availStatus.FlapPenalty,
 		})
 
-		if available, ok := localStates.GetCache(tc.CacheName(result.ID)); !ok || available.IsAvailable != lastStatus.ProcessedAvailable {
+		if available, ok := localStates.GetCache(tc.CacheName(result.ID)); !ok || available.IsAvailable != lastStatus.ProcessedAvailable || availStatus.DampingState != lastStatus.DampingState {
 			protocol := "IPv4"
 			if !availStatus.LastCheckedIPv4 {
 				protocol = "IPv6"
@@ -344,13 +381,14 @@ func CalcAvailability(
 				Available:     availStatus.ProcessedAvailable,
 				IPv4Available: availStatus.Available.IPv4,
 				IPv6Available: availStatus.Available.IPv6,
+				DampingState:  availStatus.DampingState,
 			}
 			events.Add(event)
 		}
 
 		localCacheStatuses[result.ID] = availStatus
 	}
-	calculateDeliveryServiceState(toData.DeliveryServiceServers, localStates, toData)
+	calculateDeliveryServiceState(toData.DeliveryServiceServers, localStates, toData, events)
 	localCacheStatusThreadsafe.Set(localCacheStatuses)
 }
 
@@ -399,8 +437,8 @@ func eventDesc(status tc.CacheStatus, message string) string {
 	return fmt.Sprintf("%s - %s", status, message)
 }
 
-//calculateDeliveryServiceState calculates the state of delivery services from the new cache state data `cacheState` and the CRConfig data `deliveryServiceServers` and puts the calculated state in the outparam `deliveryServiceStates`
-func calculateDeliveryServiceState(deliveryServiceServers map[tc.DeliveryServiceName][]tc.CacheName, states peer.CRStatesThreadsafe, toData todata.TOData) {
+//calculateDeliveryServiceState calculates the state of delivery services from the new cache state data `cacheState` and the CRConfig data `deliveryServiceServers` and puts the calculated state in the outparam `deliveryServiceStates`. An event is added for each cache group which becomes disabled or enabled for a delivery service.
+func calculateDeliveryServiceState(deliveryServiceServers map[tc.DeliveryServiceName][]tc.CacheName, states peer.CRStatesThreadsafe, toData todata.TOData, events ThreadsafeEvents) {
 	cacheStates := states.GetCaches()
 
 	deliveryServices := states.GetDeliveryServices()
@@ -409,8 +447,43 @@ func calculateDeliveryServiceState(deliveryServiceServers map[tc.DeliveryService
 			log.Infof("CRConfig does not have delivery service %s, but traffic monitor poller does; skipping\n", deliveryServiceName)
 			continue
 		}
+		lastDisabledLocations := deliveryServiceState.DisabledLocations
 		deliveryServiceState.DisabledLocations = getDisabledLocations(deliveryServiceName, toData.DeliveryServiceServers[deliveryServiceName], cacheStates, toData.ServerCachegroups)
 		states.SetDeliveryService(deliveryServiceName, deliveryServiceState)
+		addDisabledLocationEvents(events, deliveryServiceName, lastDisabledLocations, deliveryServiceState.DisabledLocations)
+	}
+}
+
+// addDisabledLocationEvents adds an event for each cache group in disabledLocations and not lastDisabledLocations, and each in lastDisabledLocations and not disabledLocations.
+func addDisabledLocationEvents(events ThreadsafeEvents, deliveryService tc.DeliveryServiceName, lastDisabledLocations []tc.CacheGroupName, disabledLocations []tc.CacheGroupName) {
+	wasDisabled := map[tc.CacheGroupName]struct{}{}
+	for _, cg := range lastDisabledLocations {
+		wasDisabled[cg] = struct{}{}
+	}
+	isDisabled := map[tc.CacheGroupName]struct{}{}
+	for _, cg := range disabledLocations {
+		isDisabled[cg] = struct{}{}
+	}
+	getEvent := func(cg tc.CacheGroupName, available bool, desc string) Event {
+		return Event{
+			Time:        Time(time.Now()),
+			Description: desc,
+			Name:        deliveryService.String(),
+			Hostname:    deliveryService.String(),
+			Type:        EventTypeDeliveryService,
+			Available:   available,
+			CacheGroup:  cg,
+		}
+	}
+	for _, cg := range disabledLocations {
+		if _, ok := wasDisabled[cg]; !ok {
+			events.Add(getEvent(cg, false, "no available caches in cache group "+string(cg)))
+		}
+	}
+	for _, cg := range lastDisabledLocations {
+		if _, ok := isDisabled[cg]; !ok {
+			events.Add(getEvent(cg, true, "available caches in cache group "+string(cg)))
+		}
 	}
 }
 
@@ -131,10 +131,10 @@ func TestCalcAvailabilityThresholds(t *testing.T) {
 	// Ensure that if the interfaces haven't been reported yet that CalcAvailability doesn't panic
 	original := results[0].Statistics.Interfaces
 	results[0].Statistics.Interfaces = make(map[string]cache.Interface)
-	CalcAvailability(results, pollerName, statResultHistory, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
+	CalcAvailability(results, pollerName, statResultHistory, nil, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
 	results[0].Statistics.Interfaces = original
 
-	CalcAvailability(results, pollerName, statResultHistory, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
+	CalcAvailability(results, pollerName, statResultHistory, nil, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
 
 	localCacheStatuses := localCacheStatusThreadsafe.Get()
 	localCacheStatus, ok := localCacheStatuses[result.ID]
@@ -171,7 +171,7 @@ func TestCalcAvailabilityThresholds(t *testing.T) {
 	GetVitals(&healthResult, &result, nil)
 	healthPollerName := "health"
 	healthResults := []cache.Result{healthResult}
-	CalcAvailability(healthResults, healthPollerName, nil, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
+	CalcAvailability(healthResults, healthPollerName, nil, nil, mc, toData, localCacheStatusThreadsafe, localStates, events, config.Both)
 
 	localCacheStatuses = localCacheStatusThreadsafe.Get()
 	if _, ok := localCacheStatuses[result.ID]; !ok {
@@ -268,3 +268,24 @@ func TestEvalInterface(t *testing.T) {
 		t.Errorf("Incorrect reason for interface exceeding threshold to be unavailable; expected: 'maximum bandwidth exceeded', got: '%s'", why)
 	}
 }
+
+func TestAddDisabledLocationEvents(t *testing.T) {
+	events := NewThreadsafeEvents(10)
+	added := []Event{}
+	events.OnAdd(func(e Event) { added = append(added, e) })
+
+	addDisabledLocationEvents(events, "ds0", []tc.CacheGroupName{"cg0", "cg1"}, []tc.CacheGroupName{"cg1", "cg2"})
+
+	if len(added) != 2 {
+		t.Fatalf("expected 2 events, actual %d: %+v", len(added), added)
+	}
+	if e := added[0]; e.CacheGroup != "cg2" || e.Available || e.Name != "ds0" || e.Type != EventTypeDeliveryService {
+		t.Errorf("expected unavailable ds0 event for newly disabled cg2, actual %+v", e)
+	}
+	if e := added[1]; e.CacheGroup != "cg0" || !e.Available || e.Index != 1 {
+		t.Errorf("expected available ds0 event with index 1 for re-enabled cg0, actual %+v", e)
+	}
+	if logged := events.Get(); len(logged) != 2 {
+		t.Errorf("expected 2 events in the event log, actual %d", len(logged))
+	}
+}
@@ -0,0 +1,119 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+// dampAvailability applies the hysteresis and flap damping configured by the
+// given Profile Parameters to the availability of a newly polled cache,
+// holding its ProcessedAvailable at the last status' value until enough
+// consecutive polls agree, and holding it unavailable while its flap penalty
+// is suppressed.
+//
+// The status is modified in place. The returned string describes why the
+// availability is being held, and is empty if it is not.
+func dampAvailability(status *cache.AvailableStatus, lastStatus cache.AvailableStatus, hasLastStatus bool, params tc.TMParameters, now time.Time) string {
+	polledAvailable := status.ProcessedAvailable
+	if polledAvailable {
+		status.ConsecutiveAvailable = lastStatus.ConsecutiveAvailable + 1
+		status.ConsecutiveUnavailable = 0
+	} else {
+		status.ConsecutiveAvailable = 0
+		status.ConsecutiveUnavailable = lastStatus.ConsecutiveUnavailable + 1
+	}
+	if !hasLastStatus {
+		return "" // the first result always sets the availability
+	}
+
+	status.FlapPenalty = lastStatus.FlapPenalty
+	status.FlapPenaltyTime = now
+	if params.FlapHalfLife > 0 && status.FlapPenalty > 0 && !lastStatus.FlapPenaltyTime.IsZero() {
+		halfLives := now.Sub(lastStatus.FlapPenaltyTime).Seconds() / float64(params.FlapHalfLife)
+		status.FlapPenalty *= math.Pow(0.5, halfLives)
+	}
+
+	markDown := uint64(1)
+	if params.HysteresisMarkDown > 1 {
+		markDown = uint64(params.HysteresisMarkDown)
+	}
+	markUp := uint64(1)
+	if params.HysteresisMarkUp > 1 {
+		markUp = uint64(params.HysteresisMarkUp)
+	}
+
+	available := lastStatus.ProcessedAvailable
+	if available && !polledAvailable && status.ConsecutiveUnavailable >= markDown {
+		available = false
+	} else if !available && polledAvailable && status.ConsecutiveAvailable >= markUp {
+		available = true
+	}
+
+	suppressed := false
+	if params.FlapPenalty > 0 && params.FlapSuppress > 0 {
+		reuse := params.FlapReuse
+		if reuse <= 0 {
+			reuse = params.FlapSuppress / 2
+		}
+		suppressed = lastStatus.DampingState == tc.DampingStateSuppressed && status.FlapPenalty > reuse
+		if suppressed {
+			available = false
+		}
+		// releasing a suppressed cache isn't a flap, else a penalty over
+		// suppress - reuse would suppress it again on every release.
+		if available != lastStatus.ProcessedAvailable && lastStatus.DampingState != tc.DampingStateSuppressed {
+			status.FlapPenalty += params.FlapPenalty
+		}
+		suppressed = suppressed || status.FlapPenalty >= params.FlapSuppress
+	} else {
+		status.FlapPenalty = 0
+	}
+
+	why := ""
+	status.DampingState = ""
+	switch {
+	case suppressed:
+		available = false
+		status.DampingState = tc.DampingStateSuppressed
+		why = fmt.Sprintf("flap damping suppressed, penalty %.0f", status.FlapPenalty)
+	case available && !polledAvailable:
+		status.DampingState = tc.DampingStatePendingUnavailable
+		why = fmt.Sprintf("held available, %d of %d unavailable polls", status.ConsecutiveUnavailable, markDown)
+	case !available && polledAvailable:
+		status.DampingState = tc.DampingStatePendingAvailable
+		why = fmt.Sprintf("held unavailable, %d of %d available polls", status.ConsecutiveAvailable, markUp)
+	}
+
+	if available != polledAvailable {
+		if available == lastStatus.ProcessedAvailable {
+			status.Available = lastStatus.Available
+		} else {
+			status.Available = cache.AvailableTuple{}
+		}
+	}
+	status.ProcessedAvailable = available
+	return why
+}
@@ -0,0 +1,132 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+// dampPolls applies damping to a sequence of polled availabilities, one
+// second apart, and returns the resulting statuses.
+func dampPolls(params tc.TMParameters, polls []bool) []cache.AvailableStatus {
+	statuses := make([]cache.AvailableStatus, 0, len(polls))
+	now := time.Unix(1600000000, 0)
+	last := cache.AvailableStatus{}
+	hasLast := false
+	for _, polled := range polls {
+		status := cache.AvailableStatus{
+			Available:          cache.AvailableTuple{IPv4: polled, IPv6: polled},
+			ProcessedAvailable: polled,
+		}
+		dampAvailability(&status, last, hasLast, params, now)
+		statuses = append(statuses, status)
+		last = status
+		hasLast = true
+		now = now.Add(time.Second)
+	}
+	return statuses
+}
+
+func TestDampAvailabilityDisabled(t *testing.T) {
+	polls := []bool{true, false, true, false}
+	for i, status := range dampPolls(tc.TMParameters{}, polls) {
+		if status.ProcessedAvailable != polls[i] {
+			t.Errorf("poll %d: expected availability %t without damping, actual %t", i, polls[i], status.ProcessedAvailable)
+		}
+		if status.DampingState != "" {
+			t.Errorf("poll %d: expected no damping state, actual %s", i, status.DampingState)
+		}
+	}
+}
+
+func TestDampAvailabilityHysteresis(t *testing.T) {
+	params := tc.TMParameters{HysteresisMarkDown: 3, HysteresisMarkUp: 2}
+	polls := []bool{true, false, false, true, false, false, false, true, true}
+	expected := []bool{true, true, true, true, true, true, false, false, true}
+	expectedStates := []tc.DampingState{"", tc.DampingStatePendingUnavailable, tc.DampingStatePendingUnavailable, "", tc.DampingStatePendingUnavailable, tc.DampingStatePendingUnavailable, "", tc.DampingStatePendingAvailable, ""}
+
+	for i, status := range dampPolls(params, polls) {
+		if status.ProcessedAvailable != expected[i] {
+			t.Errorf("poll %d: expected availability %t, actual %t", i, expected[i], status.ProcessedAvailable)
+		}
+		if status.DampingState != expectedStates[i] {
+			t.Errorf("poll %d: expected damping state '%s', actual '%s'", i, expectedStates[i], status.DampingState)
+		}
+		if status.Available.IPv4 != status.ProcessedAvailable {
+			t.Errorf("poll %d: expected IPv4 availability to match held availability %t, actual %t", i, status.ProcessedAvailable, status.Available.IPv4)
+		}
+	}
+}
+
+func TestDampAvailabilityFlapPenalty(t *testing.T) {
+	params := tc.TMParameters{FlapPenalty: 1000, FlapSuppress: 2500, FlapReuse: 1000, FlapHalfLife: 10}
+	statuses := dampPolls(params, []bool{true, false, true, false, true})
+
+	// the third flap, at poll 3, exceeds the suppress threshold.
+	if statuses[3].DampingState != tc.DampingStateSuppressed || statuses[3].ProcessedAvailable {
+		t.Fatalf("expected suppressed and unavailable after 3 flaps, actual %+v", statuses[3])
+	}
+	if statuses[4].DampingState != tc.DampingStateSuppressed || statuses[4].ProcessedAvailable || statuses[4].Available.IPv4 {
+		t.Errorf("expected suppressed cache to be held unavailable while penalty above reuse, actual %+v", statuses[4])
+	}
+
+	released := cache.AvailableStatus{Available: cache.AvailableTuple{IPv4: true, IPv6: true}, ProcessedAvailable: true}
+	dampAvailability(&released, statuses[4], true, params, statuses[4].FlapPenaltyTime.Add(time.Minute))
+	if released.DampingState != "" || !released.ProcessedAvailable {
+		t.Errorf("expected suppression released after penalty decays below reuse, actual %+v", released)
+	}
+
+	status := cache.AvailableStatus{ProcessedAvailable: true}
+	last := cache.AvailableStatus{ProcessedAvailable: true, FlapPenalty: 800, FlapPenaltyTime: time.Unix(0, 0)}
+	dampAvailability(&status, last, true, params, time.Unix(20, 0))
+	if math.Abs(status.FlapPenalty-200) > 0.001 {
+		t.Errorf("expected penalty to decay by half each half-life to 200, actual %v", status.FlapPenalty)
+	}
+}
+
+func TestDampAvailabilityFlapReleaseNotPenalized(t *testing.T) {
+	// the penalty exceeds suppress - reuse, so charging it on release would re-suppress the cache on every release.
+	params := tc.TMParameters{FlapPenalty: 1000, FlapSuppress: 1500, FlapHalfLife: 10}
+	polls := []bool{true, false, true}
+	for i := 0; i < 60; i++ {
+		polls = append(polls, true)
+	}
+	statuses := dampPolls(params, polls)
+	if statuses[2].DampingState != tc.DampingStateSuppressed {
+		t.Fatalf("expected suppressed after 2 flaps, actual %+v", statuses[2])
+	}
+
+	released := -1
+	for i, status := range statuses[3:] {
+		if released == -1 && status.DampingState == "" {
+			released = i
+		} else if released != -1 && (status.DampingState != "" || !status.ProcessedAvailable) {
+			t.Fatalf("poll %d: expected stable cache to stay available after release, actual %+v", i, status)
+		}
+	}
+	if released == -1 {
+		t.Fatal("expected suppressed cache to be released after its penalty decays below reuse")
+	}
+}
@@ -25,10 +25,18 @@ import (
 	"time"
 
 	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
 )
 
 type Time time.Time
 
+// The types of events which aren't for a cache. Cache events' type is the cache's server type.
+const (
+	EventTypeDeliveryService = "Delivery Service"
+	EventTypePeer            = "PEER"
+	EventTypePeerQuorum      = "PEER_QUORUM"
+)
+
 func (t Time) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("%d", time.Time(t).Unix())), nil
 }
@@ -44,6 +52,12 @@ type Event struct {
 	Available     bool   `json:"isAvailable"`
 	IPv4Available bool   `json:"isAvailable"`
 	IPv6Available bool   `json:"isAvailable"`
+	// DampingState is the flap damping state of the cache when the event
+	// occurred, if its availability was being held.
+	DampingState tc.DampingState `json:"dampingState,omitempty"`
+	// CacheGroup is the cache group which became available or unavailable to
+	// the delivery service, for delivery service cache group events.
+	CacheGroup tc.CacheGroupName `json:"cachegroup,omitempty"`
 }
 
 // Events provides safe access for multiple goroutines readers and a single writer to a stored Events slice.
@@ -52,6 +66,7 @@ type ThreadsafeEvents struct {
 	m         *sync.RWMutex
 	nextIndex *uint64
 	max       uint64
+	listeners *[]func(Event)
 }
 
 func copyEvents(a []Event) []Event {
@@ -63,7 +78,7 @@ func copyEvents(a []Event) []Event {
 // NewEvents creates a new single-writer-multiple-reader Threadsafe object
 func NewThreadsafeEvents(maxEvents uint64) ThreadsafeEvents {
 	i := uint64(0)
-	return ThreadsafeEvents{m: &sync.RWMutex{}, events: &[]Event{}, nextIndex: &i, max: maxEvents}
+	return ThreadsafeEvents{m: &sync.RWMutex{}, events: &[]Event{}, nextIndex: &i, max: maxEvents, listeners: &[]func(Event){}}
 }
 
 // Get returns the internal slice of Events for reading. This MUST NOT be modified. If modification is necessary, copy the slice.
@@ -87,5 +102,34 @@ func (o *ThreadsafeEvents) Add(e Event) {
 	// o.m.Lock()
 	*o.events = events
 	*o.nextIndex++
+	listeners := *o.listeners
+	o.m.Unlock()
+	for _, listener := range listeners {
+		listener(e)
+	}
+}
+
+// OnAdd adds a listener which is called with every event added afterward, including its index. Listeners are called by the goroutine adding the event, and so must not block.
+func (o *ThreadsafeEvents) OnAdd(listener func(Event)) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	listeners := make([]func(Event), len(*o.listeners), len(*o.listeners)+1)
+	copy(listeners, *o.listeners)
+	*o.listeners = append(listeners, listener)
+}
+
+// Set replaces the events with the given events, which must be ordered newest first, as returned by Get. Events added afterward are indexed after the newest given event. This MUST NOT be called by multiple threads, or concurrently with Add.
+func (o *ThreadsafeEvents) Set(events []Event) {
+	events = copyEvents(events)
+	if len(events) > int(o.max) {
+		events = events[:o.max]
+	}
+	nextIndex := uint64(0)
+	if len(events) > 0 {
+		nextIndex = events[0].Index + 1
+	}
+	o.m.Lock()
+	*o.events = events
+	*o.nextIndex = nextIndex
 	o.m.Unlock()
 }
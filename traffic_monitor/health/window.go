@@ -0,0 +1,162 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+)
+
+// statSample is a stat's value as of a poll.
+type statSample struct {
+	Time time.Time
+	Val  float64
+}
+
+// statHistorySamples returns the numeric samples of the given stat history,
+// newest first. Consecutive polls with the same value are a single sample at
+// the time of the latest of them, as they are in the history.
+func statHistorySamples(history []tc.ResultStatVal) ([]statSample, bool) {
+	samples := make([]statSample, 0, len(history))
+	for _, val := range history {
+		num, ok := util.ToNumeric(val.Val)
+		if !ok {
+			return nil, false
+		}
+		samples = append(samples, statSample{Time: val.Time, Val: num})
+	}
+	return samples, true
+}
+
+// computedStatSamples returns the samples of the given computed stat from the
+// given result history, newest first.
+func computedStatSamples(history []cache.ResultInfo, computeStat cache.StatComputeFunc, serverInfo tc.TrafficServer, profile tc.TMProfile) ([]statSample, bool) {
+	samples := make([]statSample, 0, len(history))
+	for _, info := range history {
+		num, ok := util.ToNumeric(computeStat(info, serverInfo, profile, dummyCombinedState))
+		if !ok {
+			return nil, false
+		}
+		samples = append(samples, statSample{Time: info.Time, Val: num})
+	}
+	return samples, true
+}
+
+// windowFunction returns the given tc.WindowFunction* of the given samples,
+// which must be newest first, over the window ending at the newest sample.
+//
+// A sample's value is taken to hold from just after the next older sample
+// until its own time, and the oldest sample's to hold indefinitely before it,
+// so an unchanged stat is constant over any window, and a window longer than
+// the history is evaluated as though the oldest value preceded it.
+//
+// Returns false if there are no samples, the function is unknown, or it is a
+// percent of a zero average.
+func windowFunction(function string, window time.Duration, samples []statSample) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+	end := samples[0].Time
+	start := end.Add(-window)
+	switch function {
+	case tc.WindowFunctionDelta:
+		return samples[0].Val - valueAt(samples, start), true
+	case tc.WindowFunctionRate:
+		return (samples[0].Val - valueAt(samples, start)) / window.Seconds(), true
+	case tc.WindowFunctionAvg:
+		return average(samples, start, end), true
+	case tc.WindowFunctionPctAvg:
+		avg := average(samples, start, end)
+		if avg == 0 {
+			return 0, false
+		}
+		return (samples[0].Val - avg) / avg * 100, true
+	default:
+		log.Errorf("unknown window threshold function '%s'", function)
+		return 0, false
+	}
+}
+
+// valueAt returns the value of the samples at the given time, which is the
+// value of the oldest sample no older than it.
+func valueAt(samples []statSample, t time.Time) float64 {
+	val := samples[0].Val
+	for _, sample := range samples {
+		if sample.Time.Before(t) {
+			break
+		}
+		val = sample.Val
+	}
+	return val
+}
+
+// average returns the time-weighted average of the samples between start and
+// end.
+func average(samples []statSample, start time.Time, end time.Time) float64 {
+	sum := float64(0)
+	total := time.Duration(0)
+	for i, sample := range samples {
+		from := start
+		if i+1 < len(samples) && samples[i+1].Time.After(start) {
+			from = samples[i+1].Time
+		}
+		to := sample.Time
+		if to.After(end) {
+			to = end
+		}
+		if !to.After(from) {
+			if to.Before(start) {
+				break
+			}
+			continue
+		}
+		sum += sample.Val * to.Sub(from).Seconds()
+		total += to.Sub(from)
+	}
+	if total == 0 {
+		return samples[0].Val
+	}
+	return sum / total.Seconds()
+}
+
+// WindowHistoryCount returns the number of results needed in the stat history
+// for the given Parameters' window thresholds to see their whole window, when
+// results are polled every pollInterval. It's 0 if there are no window
+// thresholds.
+func WindowHistoryCount(params tc.TMParameters, pollInterval time.Duration) uint64 {
+	if pollInterval <= 0 {
+		return 0
+	}
+	maxWindow := time.Duration(0)
+	for _, threshold := range params.WindowThresholds {
+		if threshold.Window > maxWindow {
+			maxWindow = threshold.Window
+		}
+	}
+	if maxWindow == 0 {
+		return 0
+	}
+	// one result before the window holds the value at its start, and one more covers jitter in the poll interval
+	return uint64(maxWindow/pollInterval) + 2
+}
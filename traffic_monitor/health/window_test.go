@@ -0,0 +1,109 @@
+package health
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+func TestWindowFunction(t *testing.T) {
+	now := time.Now()
+	// 100 until 40s ago, then 20
+	samples := []statSample{
+		{Time: now, Val: 20},
+		{Time: now.Add(-40 * time.Second), Val: 100},
+	}
+
+	tests := []struct {
+		function string
+		window   time.Duration
+		expected float64
+	}{
+		{tc.WindowFunctionDelta, 30 * time.Second, 0},
+		{tc.WindowFunctionDelta, 60 * time.Second, -80},
+		{tc.WindowFunctionRate, 40 * time.Second, -2},
+		{tc.WindowFunctionAvg, 80 * time.Second, 60},
+		{tc.WindowFunctionAvg, 20 * time.Second, 20},
+		{tc.WindowFunctionPctAvg, 80 * time.Second, -200.0 / 3},
+	}
+	for _, test := range tests {
+		val, ok := windowFunction(test.function, test.window, samples)
+		if !ok || math.Abs(val-test.expected) > 0.0001 {
+			t.Errorf("%s(%v) expected %v, actual %v %v", test.function, test.window, test.expected, val, ok)
+		}
+	}
+
+	// an unchanged stat is a single sample, and is constant over any window
+	if val, ok := windowFunction(tc.WindowFunctionDelta, time.Minute, samples[:1]); !ok || val != 0 {
+		t.Errorf("delta of an unchanged stat expected 0, actual %v %v", val, ok)
+	}
+	if _, ok := windowFunction(tc.WindowFunctionPctAvg, time.Minute, []statSample{{Time: now, Val: 0}}); ok {
+		t.Error("pctavg of a zero average expected not to be evaluated")
+	}
+	if _, ok := windowFunction(tc.WindowFunctionAvg, time.Minute, nil); ok {
+		t.Error("window function of no samples expected not to be evaluated")
+	}
+}
+
+func TestEvalAggregateWindowThresholds(t *testing.T) {
+	now := time.Now()
+	mc := tc.TrafficMonitorConfigMap{
+		TrafficServer: map[string]tc.TrafficServer{"edge0": {ServerStatus: string(tc.CacheStatusReported), Profile: "EDGE"}},
+		Profile: map[string]tc.TMProfile{"EDGE": {Name: "EDGE", Parameters: tc.TMParameters{
+			WindowThresholds: map[string]tc.WindowThreshold{
+				"pctavg(5m).kbps":  {HealthThreshold: tc.HealthThreshold{Val: -80, Comparator: ">"}, Stat: tc.StatNameKBPS, Function: tc.WindowFunctionPctAvg, Window: 5 * time.Minute},
+				"rate(30s).errors": {HealthThreshold: tc.HealthThreshold{Val: 10, Comparator: "<"}, Stat: "errors", Function: tc.WindowFunctionRate, Window: 30 * time.Second},
+			},
+		}}},
+	}
+
+	infoHistory := []cache.ResultInfo{}
+	for i := 0; i < 30; i++ {
+		infoHistory = append(infoHistory, cache.ResultInfo{ID: "edge0", Available: true, Time: now.Add(time.Duration(-10*i) * time.Second), Vitals: cache.Vitals{KbpsOut: 1000000}})
+	}
+	resultStats := threadsafe.NewResultStatValHistory()
+	resultStats.Store("errors", []tc.ResultStatVal{{Time: now, Val: float64(200), Span: 1}, {Time: now.Add(-30 * time.Second), Val: float64(100), Span: 3}})
+
+	if avail, why, _ := EvalAggregate(infoHistory[0], &resultStats, infoHistory, &mc); !avail {
+		t.Errorf("expected error rate of 3.33/s under 10/s to be available, actual unavailable: %s", why)
+	}
+
+	resultStats.Store("errors", []tc.ResultStatVal{{Time: now, Val: float64(500), Span: 1}, {Time: now.Add(-30 * time.Second), Val: float64(100), Span: 3}})
+	if avail, why, stat := EvalAggregate(infoHistory[0], &resultStats, infoHistory, &mc); avail || stat != "rate(30s).errors" || !strings.Contains(why, "rate(30s).errors too high") {
+		t.Errorf("expected error rate of 13.33/s to be unavailable for rate(30s).errors, actual %v '%s' '%s'", avail, why, stat)
+	}
+
+	resultStats.Store("errors", []tc.ResultStatVal{{Time: now, Val: float64(100), Span: 4}})
+	infoHistory[0].Vitals.KbpsOut = 100000
+	if avail, why, stat := EvalAggregate(infoHistory[0], &resultStats, infoHistory, &mc); avail || stat != "pctavg(5m).kbps" {
+		t.Errorf("expected kbps dropping 90%% from its average to be unavailable for pctavg(5m).kbps, actual %v '%s' '%s'", avail, why, stat)
+	}
+
+	if avail, why, _ := EvalAggregate(infoHistory[0], nil, nil, &mc); !avail {
+		t.Errorf("expected window thresholds without history not to be evaluated, actual unavailable: %s", why)
+	}
+}
@@ -33,8 +33,10 @@ import (
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/handler"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/notify"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
 	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/record"
 	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 	"github.com/apache/trafficcontrol/traffic_monitor/towrap"
@@ -44,7 +46,17 @@ import (
 // Start starts the poller and handler goroutines
 //
 func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData, trafficMonitorConfigFileName string) error {
+	recorder := (*record.Recorder)(nil)
+	if cfg.RecordFile != "" {
+		r, err := record.New(cfg.RecordFile)
+		if err != nil {
+			return fmt.Errorf("opening record file: %v", err)
+		}
+		recorder = r
+	}
+
 	toSession := towrap.NewTrafficOpsSessionThreadsafe(nil, nil, cfg.CRConfigHistoryCount, cfg)
+	toSession.Recorder = recorder
 
 	localStates := peer.NewCRStatesThreadsafe() // this is the local state as discoverer by this traffic_monitor
 	fetchCount := threadsafe.NewUint()          // note this is the number of individual caches fetched from, not the number of times all the caches were polled.
@@ -61,12 +73,28 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 	peerHandler := peer.NewHandler()
 	peerPoller := poller.NewCache(cfg.PeerPollingInterval, false, peerHandler, cfg, appData, cfg.PeerPollingProtocol)
 
-	go monitorConfigPoller.Poll()
-	go cacheHealthPoller.Poll()
-	go cacheStatPoller.Poll()
-	go peerPoller.Poll()
+	cacheHealthPoller.Recorder, cacheHealthPoller.RecordType = recorder, record.TypeHealth
+	cacheStatPoller.Recorder, cacheStatPoller.RecordType = recorder, record.TypeStat
+	peerPoller.Recorder, peerPoller.RecordType = recorder, record.TypePeer
+
+	if cfg.ReplayFile == "" {
+		go monitorConfigPoller.Poll()
+		go cacheHealthPoller.Poll()
+		go cacheStatPoller.Poll()
+		go peerPoller.Poll()
+	} else {
+		drainPollerConfigs([]chan poller.CachePollerConfig{cacheHealthPoller.ConfigChannel, cacheStatPoller.ConfigChannel, peerPoller.ConfigChannel}, monitorConfigPoller.IntervalChan)
+	}
 
 	events := health.NewThreadsafeEvents(cfg.MaxEvents)
+	if cfg.ReplayFile == "" {
+		// replayed events are for debugging, and mustn't page anyone
+		notifier, err := notify.New(cfg.Webhooks, appData.Hostname)
+		if err != nil {
+			return fmt.Errorf("creating webhook notifier: %v", err)
+		}
+		events.OnAdd(notifier.Notify)
+	}
 
 	cachesChanged := make(chan struct{})
 	peerStates := peer.NewCRStatesPeersThreadsafe(cfg.PeerOptimisticQuorumMin) // each peer's last state is saved in this map
@@ -86,7 +114,7 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		toData,
 	)
 
-	combinedStates, combineStateFunc := StartStateCombiner(events, peerStates, localStates, toData)
+	combinedStates, combineStateFunc := StartStateCombiner(events, peerStates, localStates, toData, monitorConfig, cfg, appData.Hostname)
 
 	StartPeerManager(
 		peerHandler.ResultChannel,
@@ -121,6 +149,22 @@ func Start(opsConfigFile string, cfg config.Config, appData config.StaticAppData
 		localCacheStatus,
 	)
 
+	if cfg.ReplayFile == "" {
+		// nothing is polled until the ops config manager starts, so the state can be safely restored here
+		restoreStateBackup(cfg, localStates, localCacheStatus, healthHistory, statResultHistory, events)
+		StartStateBackupManager(cfg, localStates, localCacheStatus, healthHistory, statResultHistory, events)
+	} else {
+		// a replay starts from no state, so its results depend only on the archive
+		handlers := map[string]handler.Handler{
+			record.TypeHealth: cacheHealthHandler,
+			record.TypeStat:   cacheStatHandler,
+			record.TypePeer:   peerHandler,
+		}
+		if err := StartReplay(cfg.ReplayFile, toData, monitorConfigPoller.ConfigChannel, handlers); err != nil {
+			return fmt.Errorf("starting replay: %v", err)
+		}
+	}
+
 	StartOpsConfigManager(
 		opsConfigFile,
 		toSession,
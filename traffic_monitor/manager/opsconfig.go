@@ -149,6 +149,10 @@ func StartOpsConfigManager(
 			}
 		}
 
+		if cfg.ReplayFile != "" {
+			return // when replaying, the configuration comes from the replayed archive, not Traffic Ops
+		}
+
 		// TODO config? parameter?
 		useCache := false
 		trafficOpsRequestTimeout := time.Second * time.Duration(10)
@@ -20,6 +20,9 @@ package manager
  */
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/apache/trafficcontrol/lib/go-util"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
@@ -33,9 +36,11 @@ func StartPeerManager(
 	combineState func(),
 ) {
 	go func() {
+		hadQuorum := true
 		for peerResult := range peerChan {
 			comparePeerState(events, peerResult, peerStates)
 			peerStates.Set(peerResult)
+			hadQuorum = comparePeerQuorum(events, peerStates, hadQuorum)
 			combineState()
 			peerResult.PollFinished <- peerResult.PollID
 		}
@@ -52,6 +57,23 @@ func comparePeerState(events health.ThreadsafeEvents, result peer.Result, peerSt
 			description = "Peer is unreachable"
 		}
 
-		events.Add(health.Event{Time: health.Time(result.Time), Description: description, Name: result.ID.String(), Hostname: result.ID.String(), Type: "PEER", Available: result.Available})
+		events.Add(health.Event{Time: health.Time(result.Time), Description: description, Name: result.ID.String(), Hostname: result.ID.String(), Type: health.EventTypePeer, Available: result.Available})
+	}
+}
+
+// comparePeerQuorum adds an event if the optimistic quorum was lost or regained, and returns whether there is now a quorum. If optimistic quorum isn't enabled, there is always a quorum.
+func comparePeerQuorum(events health.ThreadsafeEvents, peerStates peer.CRStatesPeersThreadsafe, hadQuorum bool) bool {
+	if !peerStates.OptimisticQuorumEnabled() {
+		return true
+	}
+	hasQuorum, peersAvailable, peerCount, minimum := peerStates.HasOptimisticQuorum()
+	if hasQuorum == hadQuorum {
+		return hasQuorum
+	}
+	description := fmt.Sprintf("Optimistic quorum regained: %d of %d peers available, minimum %d", peersAvailable, peerCount, minimum)
+	if !hasQuorum {
+		description = fmt.Sprintf("Optimistic quorum lost: %d of %d peers available, minimum %d", peersAvailable, peerCount, minimum)
 	}
+	events.Add(health.Event{Time: health.Time(time.Now()), Description: description, Type: health.EventTypePeerQuorum, Available: hasQuorum})
+	return hasQuorum
 }
@@ -0,0 +1,63 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"testing"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+)
+
+func TestComparePeerQuorum(t *testing.T) {
+	events := health.NewThreadsafeEvents(10)
+	peerStates := peer.NewCRStatesPeersThreadsafe(2)
+	peerStates.Set(peer.Result{ID: "tm0", Available: true})
+	peerStates.Set(peer.Result{ID: "tm1", Available: true})
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{"tm0": {}, "tm1": {}})
+
+	hasQuorum := comparePeerQuorum(events, peerStates, true)
+	if !hasQuorum || len(events.Get()) != 0 {
+		t.Fatalf("expected quorum with no events, actual quorum %v events %+v", hasQuorum, events.Get())
+	}
+
+	peerStates.Set(peer.Result{ID: "tm1", Available: false})
+	hasQuorum = comparePeerQuorum(events, peerStates, hasQuorum)
+	if hasQuorum {
+		t.Error("expected quorum lost with 1 of 2 peers available")
+	}
+	if evts := events.Get(); len(evts) != 1 || evts[0].Type != health.EventTypePeerQuorum || evts[0].Available {
+		t.Errorf("expected 1 unavailable peer quorum event, actual %+v", evts)
+	}
+
+	hasQuorum = comparePeerQuorum(events, peerStates, hasQuorum)
+	if len(events.Get()) != 1 {
+		t.Errorf("expected no event while quorum stays lost, actual %+v", events.Get())
+	}
+
+	peerStates.Set(peer.Result{ID: "tm1", Available: true})
+	if hasQuorum = comparePeerQuorum(events, peerStates, hasQuorum); !hasQuorum {
+		t.Error("expected quorum regained")
+	}
+	if evts := events.Get(); len(evts) != 2 || !evts[0].Available {
+		t.Errorf("expected available peer quorum event, actual %+v", evts)
+	}
+}
@@ -0,0 +1,186 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"math"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+// peerVoter weighs the votes of this Traffic Monitor and its available peers on the availability of caches, for the weighted peer combine mode.
+type peerVoter struct {
+	self           tc.TrafficMonitorName
+	majority       float64
+	weights        map[string]float64
+	localityWeight float64
+}
+
+// newPeerVoter returns the voter for the given config, or nil if the config's peer combine mode isn't weighted.
+func newPeerVoter(cfg config.Config, self string) *peerVoter {
+	if cfg.PeerCombineMode != config.PeerCombineModeWeighted {
+		return nil
+	}
+	return &peerVoter{
+		self:           tc.TrafficMonitorName(self),
+		majority:       cfg.PeerWeightedMajority,
+		weights:        cfg.PeerWeights,
+		localityWeight: cfg.PeerLocalityWeight,
+	}
+}
+
+// peerVoteRound is the data needed to weigh the votes on each cache, which is gathered once per combine, rather than once per cache.
+type peerVoteRound struct {
+	voter *peerVoter
+	// peers are the CrStates of the available peers.
+	peers map[tc.TrafficMonitorName]tc.CRStates
+	// monitors are all the ONLINE Traffic Monitors, including this one, whether they're available or not. The majority is of their total weight.
+	monitors map[tc.TrafficMonitorName]struct{}
+	// nearest are the Traffic Monitors nearest each cache group, whose votes on its caches are multiplied by the locality weight.
+	nearest         map[tc.CacheGroupName]map[tc.TrafficMonitorName]struct{}
+	cacheGroups     map[tc.CacheName]tc.CacheGroupName
+	cacheGroupCoord map[tc.CacheGroupName]tc.MonitoringCoordinates
+	monitorCoords   map[tc.TrafficMonitorName]tc.MonitoringCoordinates
+}
+
+// newRound gathers the peers' states and the locations of monitors and caches, for weighing the votes of one combine.
+func (v *peerVoter) newRound(peerStates peer.CRStatesPeersThreadsafe, monitorConfig tc.TrafficMonitorConfigMap, toData todata.TOData) *peerVoteRound {
+	round := &peerVoteRound{
+		voter:           v,
+		peers:           map[tc.TrafficMonitorName]tc.CRStates{},
+		monitors:        map[tc.TrafficMonitorName]struct{}{v.self: {}},
+		nearest:         map[tc.CacheGroupName]map[tc.TrafficMonitorName]struct{}{},
+		cacheGroups:     toData.ServerCachegroups,
+		cacheGroupCoord: map[tc.CacheGroupName]tc.MonitoringCoordinates{},
+		monitorCoords:   map[tc.TrafficMonitorName]tc.MonitoringCoordinates{},
+	}
+	for peerName, crStates := range peerStates.GetCrstates() {
+		if peerName != v.self && peerStates.GetPeerAvailability(peerName) {
+			round.peers[peerName] = crStates
+		}
+	}
+	for name, tm := range monitorConfig.TrafficMonitor {
+		if tc.CacheStatusFromString(tm.ServerStatus) == tc.CacheStatusOnline {
+			round.monitors[tc.TrafficMonitorName(name)] = struct{}{}
+		}
+	}
+	if v.localityWeight == 1 {
+		return round
+	}
+	for name, cg := range monitorConfig.CacheGroup {
+		round.cacheGroupCoord[tc.CacheGroupName(name)] = cg.Coordinates
+	}
+	for name, tm := range monitorConfig.TrafficMonitor {
+		tmName := tc.TrafficMonitorName(name)
+		if _, ok := round.monitors[tmName]; !ok {
+			continue // only monitors which would vote if available can be nearest
+		}
+		if coord, ok := round.cacheGroupCoord[tc.CacheGroupName(tm.Location)]; ok {
+			round.monitorCoords[tmName] = coord
+		}
+	}
+	return round
+}
+
+// nearestMonitors returns the ONLINE Traffic Monitors nearest the given cache group, which is all of them at the same least distance.
+func (r *peerVoteRound) nearestMonitors(cacheGroup tc.CacheGroupName) map[tc.TrafficMonitorName]struct{} {
+	if nearest, ok := r.nearest[cacheGroup]; ok {
+		return nearest
+	}
+	nearest := map[tc.TrafficMonitorName]struct{}{}
+	if cgCoord, ok := r.cacheGroupCoord[cacheGroup]; ok {
+		minDistance := math.Inf(1)
+		for tmName, tmCoord := range r.monitorCoords {
+			distance := greatCircleDistance(cgCoord, tmCoord)
+			if distance < minDistance {
+				minDistance = distance
+				nearest = map[tc.TrafficMonitorName]struct{}{}
+			}
+			if distance == minDistance {
+				nearest[tmName] = struct{}{}
+			}
+		}
+	}
+	r.nearest[cacheGroup] = nearest
+	return nearest
+}
+
+// weight returns the weight of the given Traffic Monitor's vote on the given cache.
+func (r *peerVoteRound) weight(monitor tc.TrafficMonitorName, cacheName tc.CacheName) float64 {
+	weight, ok := r.voter.weights[string(monitor)]
+	if !ok {
+		weight = 1
+	}
+	if r.voter.localityWeight == 1 {
+		return weight
+	}
+	cacheGroup, ok := r.cacheGroups[cacheName]
+	if !ok {
+		return weight
+	}
+	if _, ok := r.nearestMonitors(cacheGroup)[monitor]; ok {
+		weight *= r.voter.localityWeight
+	}
+	return weight
+}
+
+// vote weighs the votes of this Traffic Monitor, with the given local state, and of each available peer which has the cache, against the weight of all ONLINE monitors.
+func (r *peerVoteRound) vote(cacheName tc.CacheName, localCacheState tc.IsAvailable) peer.CacheVotes {
+	votes := map[tc.TrafficMonitorName]peer.Vote{
+		r.voter.self: {
+			Weight:        r.weight(r.voter.self, cacheName),
+			IsAvailable:   localCacheState.IsAvailable,
+			Ipv4Available: localCacheState.Ipv4Available,
+			Ipv6Available: localCacheState.Ipv6Available,
+		},
+	}
+	for peerName, crStates := range r.peers {
+		peerCacheState, ok := crStates.Caches[cacheName]
+		if !ok {
+			continue
+		}
+		votes[peerName] = peer.Vote{
+			Weight:        r.weight(peerName, cacheName),
+			IsAvailable:   peerCacheState.IsAvailable,
+			Ipv4Available: peerCacheState.Ipv4Available,
+			Ipv6Available: peerCacheState.Ipv6Available,
+		}
+	}
+	absentWeight := float64(0)
+	for monitor := range r.monitors {
+		if _, ok := votes[monitor]; !ok {
+			absentWeight += r.weight(monitor, cacheName)
+		}
+	}
+	return peer.WeighVotes(votes, absentWeight, r.voter.majority)
+}
+
+// greatCircleDistance returns the distance in kilometers between the given coordinates, by the haversine formula.
+func greatCircleDistance(a tc.MonitoringCoordinates, b tc.MonitoringCoordinates) float64 {
+	const earthRadiusKm = 6371
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(b.Latitude - a.Latitude)
+	dLon := toRad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(a.Latitude))*math.Cos(toRad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,159 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/handler"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/record"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+	"github.com/apache/trafficcontrol/traffic_monitor/towrap"
+)
+
+// StartReplay starts replaying the recorded archive in the given file, in place of polling and fetching configuration from Traffic Ops. Poll results are given to the handler for their record type, and configurations are given to the TO data and monitor config manager, at the pace they were recorded.
+// The archive is replayed again whenever the file is written, after any replay in progress finishes.
+func StartReplay(
+	fileName string,
+	toData todata.TODataThreadsafe,
+	monitorConfigChan chan<- poller.MonitorCfg,
+	handlers map[string]handler.Handler,
+) error {
+	m := &sync.Mutex{}
+	_, err := poller.File(fileName, func(bts []byte, err error) {
+		if err != nil {
+			log.Errorf("replay: reading archive '%s': %v", fileName, err)
+			return
+		}
+		records, err := record.Read(bytes.NewReader(bts))
+		if err != nil {
+			log.Errorf("replay: reading archive '%s': %v", fileName, err)
+			return
+		}
+		m.Lock()
+		defer m.Unlock()
+		log.Infof("replay: replaying %d records from '%s'", len(records), fileName)
+		replayRecords(records, toData, monitorConfigChan, handlers, time.Sleep)
+		log.Infof("replay: finished replaying '%s'", fileName)
+	})
+	return err
+}
+
+// drainPollerConfigs discards the configs sent to pollers which aren't running, because results are being replayed instead, so the monitor config manager never blocks sending them.
+func drainPollerConfigs(cacheConfigChans []chan poller.CachePollerConfig, intervalChan <-chan time.Duration) {
+	for _, configChan := range cacheConfigChans {
+		go func(c <-chan poller.CachePollerConfig) {
+			for range c {
+			}
+		}(configChan)
+	}
+	go func() {
+		for range intervalChan {
+		}
+	}()
+}
+
+// replayRecords replays the given records, waiting between them as long as passed between their recordings. Each poll result is handled and processed before the next record is replayed.
+func replayRecords(
+	records []record.Record,
+	toData todata.TODataThreadsafe,
+	monitorConfigChan chan<- poller.MonitorCfg,
+	handlers map[string]handler.Handler,
+	sleep func(time.Duration),
+) {
+	monitoringJSON := []byte(nil)
+	crConfigJSON := []byte(nil)
+	lastTime := time.Time{}
+	pollID := uint64(0)
+	for _, rec := range records {
+		if !lastTime.IsZero() && rec.Time.After(lastTime) {
+			sleep(rec.Time.Sub(lastTime))
+		}
+		if rec.Time.After(lastTime) {
+			lastTime = rec.Time
+		}
+
+		switch rec.Type {
+		case record.TypeMonitorConfig, record.TypeCRConfig:
+			if rec.Type == record.TypeMonitorConfig {
+				monitoringJSON = rec.Config
+			} else {
+				crConfigJSON = rec.Config
+				if err := toData.UpdateCRConfig(crConfigJSON); err != nil {
+					log.Errorf("replay: updating TO data from CRConfig recorded at %v: %v", rec.Time, err)
+				}
+			}
+			if monitoringJSON == nil || crConfigJSON == nil {
+				continue // the monitor config needs both
+			}
+			monitorConfig, err := replayMonitorConfig(monitoringJSON, crConfigJSON)
+			if err != nil {
+				log.Errorf("replay: creating monitor config recorded at %v: %v", rec.Time, err)
+				continue
+			}
+			monitorConfigChan <- poller.MonitorCfg{CDN: rec.ID, Cfg: *monitorConfig}
+		default:
+			h, ok := handlers[rec.Type]
+			if !ok {
+				log.Warnf("replay: skipping record of unknown type '%s'", rec.Type)
+				continue
+			}
+			rdr := io.Reader(nil)
+			if rec.Body != nil {
+				rdr = bytes.NewReader(rec.Body)
+			}
+			reqErr := error(nil)
+			if rec.Error != "" {
+				reqErr = errors.New(rec.Error)
+			}
+			pollID++
+			pollFinished := make(chan uint64)
+			// results are given the current time, not the recorded time, because processing compares them to the current time, e.g. for peer timeouts
+			go h.Handle(rec.ID, rdr, rec.Format, rec.RequestTime, time.Now(), reqErr, pollID, rec.UsingIPv4, poller.ReplayPollContext(rec), pollFinished)
+			<-pollFinished
+		}
+	}
+}
+
+// replayMonitorConfig creates the monitor config from the recorded monitoring configuration and CRConfig, as towrap.TrafficMonitorConfigMap does from Traffic Ops.
+func replayMonitorConfig(monitoringJSON []byte, crConfigJSON []byte) (*tc.TrafficMonitorConfigMap, error) {
+	tmConfig := tc.TrafficMonitorConfig{}
+	if err := json.Unmarshal(monitoringJSON, &tmConfig); err != nil {
+		return nil, fmt.Errorf("unmarshalling monitoring config: %v", err)
+	}
+	monitorConfig, err := tc.TrafficMonitorTransformToMap(&tmConfig)
+	if err != nil {
+		return nil, fmt.Errorf("transforming monitoring config: %v", err)
+	}
+	crConfig := tc.CRConfig{}
+	if err := json.Unmarshal(crConfigJSON, &crConfig); err != nil {
+		return nil, fmt.Errorf("unmarshalling CRConfig: %v", err)
+	}
+	return towrap.CreateMonitorConfig(crConfig, monitorConfig)
+}
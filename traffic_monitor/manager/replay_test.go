@@ -0,0 +1,97 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/handler"
+	"github.com/apache/trafficcontrol/traffic_monitor/poller"
+	"github.com/apache/trafficcontrol/traffic_monitor/record"
+	"github.com/apache/trafficcontrol/traffic_monitor/todata"
+)
+
+type replayedResult struct {
+	ID      string
+	Body    string
+	Err     error
+	PollCtx interface{}
+}
+
+// replayHandler is a handler.Handler which saves the results it's given.
+type replayHandler struct {
+	results *[]replayedResult
+}
+
+func (h replayHandler) Handle(id string, rdr io.Reader, format string, reqTime time.Duration, reqEnd time.Time, err error, pollID uint64, usingIPv4 bool, pollCtx interface{}, pollFinished chan<- uint64) {
+	body := []byte(nil)
+	if rdr != nil {
+		body, _ = ioutil.ReadAll(rdr)
+	}
+	*h.results = append(*h.results, replayedResult{ID: id, Body: string(body), Err: err, PollCtx: pollCtx})
+	pollFinished <- pollID
+}
+
+func TestReplayRecords(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	records := []record.Record{
+		{Time: start, Type: record.TypeCRConfig, ID: "cdn0", Config: []byte(`{"contentServers":{"edge0":{"cacheGroup":"cg0","type":"EDGE"}},"deliveryServices":{}}`)},
+		{Time: start.Add(2 * time.Second), Type: record.TypeStat, ID: "edge0", Body: []byte(`{"ats":{}}`)},
+		{Time: start.Add(time.Second), Type: record.TypeHealth, ID: "edge0", Error: "timed out", TLS: &record.TLSCheck{HandshakeTime: time.Millisecond}},
+		{Time: start.Add(3 * time.Second), Type: "unknown", ID: "edge0"},
+	}
+
+	healthResults := []replayedResult{}
+	statResults := []replayedResult{}
+	handlers := map[string]handler.Handler{
+		record.TypeHealth: replayHandler{results: &healthResults},
+		record.TypeStat:   replayHandler{results: &statResults},
+	}
+	toData := todata.NewThreadsafe()
+	monitorConfigs := make(chan poller.MonitorCfg, 1)
+	slept := time.Duration(0)
+	replayRecords(records, toData, monitorConfigs, handlers, func(d time.Duration) { slept += d })
+
+	if slept != 3*time.Second {
+		t.Errorf("expected replay to wait as long as the records were recorded over, 3s, actual %v", slept)
+	}
+	if cacheType := toData.Get().ServerTypes["edge0"]; cacheType != tc.CacheTypeEdge {
+		t.Errorf("expected TO data updated from replayed CRConfig, actual edge0 type '%s'", cacheType)
+	}
+	select {
+	case cfg := <-monitorConfigs:
+		t.Errorf("expected no monitor config without a replayed monitoring config, actual %+v", cfg)
+	default:
+	}
+
+	if len(statResults) != 1 || statResults[0].ID != "edge0" || statResults[0].Body != `{"ats":{}}` || statResults[0].Err != nil {
+		t.Errorf("expected stat result for edge0 to be replayed, actual %+v", statResults)
+	}
+	if len(healthResults) != 1 || healthResults[0].Err == nil || healthResults[0].Err.Error() != "timed out" {
+		t.Fatalf("expected failed health result for edge0 to be replayed, actual %+v", healthResults)
+	}
+	if check := poller.TLSCheckResult(healthResults[0].PollCtx); check == nil || check.HandshakeTime != time.Millisecond {
+		t.Errorf("expected replayed health result to have its recorded TLS check, actual %+v", check)
+	}
+}
@@ -277,6 +277,12 @@ func processStatResults(
 			log.Infof("processStatResults got history count %v for %v, setting to 1\n", maxStats, result.ID)
 			maxStats = 1
 		}
+		if lastResult, ok := lastResults[tc.CacheName(result.ID)]; ok {
+			// keep enough history for window thresholds to see their whole window
+			if windowStats := health.WindowHistoryCount(mc.Profile[mc.TrafficServer[string(result.ID)].Profile].Parameters, result.Time.Sub(lastResult.Time)); windowStats > maxStats {
+				maxStats = windowStats
+			}
+		}
 
 		// TODO determine if we want to add results with errors, or just print the errors now and don't add them.
 		if lastResult, ok := lastResults[tc.CacheName(result.ID)]; ok && result.Error == nil {
@@ -320,7 +326,7 @@ func processStatResults(
 	}
 
 	pollerName := "stat"
-	health.CalcAvailability(results, pollerName, &statResultHistoryThreadsafe, mc, toData, localCacheStatusThreadsafe, localStates, events, pollingProtocol)
+	health.CalcAvailability(results, pollerName, &statResultHistoryThreadsafe, statInfoHistory, mc, toData, localCacheStatusThreadsafe, localStates, events, pollingProtocol)
 	combineState()
 
 	endTime := time.Now()
@@ -0,0 +1,336 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+// stateBackup is the state of this Traffic Monitor which is written to the state backup file, and restored from it on startup.
+// The history and event types aren't serializable as-is, so they're converted to the backup types below.
+type stateBackup struct {
+	Time          time.Time                         `json:"time"`
+	LocalStates   tc.CRStates                       `json:"localStates"`
+	CacheStatus   cache.AvailableStatuses           `json:"cacheStatus"`
+	HealthHistory map[tc.CacheName][]resultBackup   `json:"healthHistory"`
+	StatHistory   map[string]cacheStatHistoryBackup `json:"statHistory"`
+	Events        []eventBackup                     `json:"events"`
+}
+
+// resultBackup is the serializable part of a cache.Result.
+type resultBackup struct {
+	ID              string                  `json:"id"`
+	Available       bool                    `json:"available"`
+	Error           string                  `json:"error,omitempty"`
+	Miscellaneous   map[string]interface{}  `json:"miscellaneous"`
+	RequestTime     time.Duration           `json:"requestTime"`
+	Statistics      cache.Statistics        `json:"statistics"`
+	Time            time.Time               `json:"time"`
+	UsingIPv4       bool                    `json:"usingIPv4"`
+	Vitals          cache.Vitals            `json:"vitals"`
+	InterfaceVitals map[string]cache.Vitals `json:"interfaceVitals"`
+}
+
+// resultStatValBackup is a tc.ResultStatVal. Its own JSON serialization stringifies values, which would make them unusable for thresholds when restored.
+type resultStatValBackup struct {
+	Val  interface{} `json:"value"`
+	Time time.Time   `json:"time"`
+	Span uint64      `json:"span"`
+}
+
+// cacheStatHistoryBackup is a threadsafe.CacheStatHistory.
+type cacheStatHistoryBackup struct {
+	Interfaces map[string]map[string][]resultStatValBackup `json:"interfaces"`
+	Stats      map[string][]resultStatValBackup            `json:"stats"`
+}
+
+// eventBackup is a health.Event, whose JSON serialization loses its time precision and IP availability.
+type eventBackup struct {
+	Time          time.Time       `json:"time"`
+	Index         uint64          `json:"index"`
+	Description   string          `json:"description"`
+	Name          string          `json:"name"`
+	Hostname      string          `json:"hostname"`
+	Type          string          `json:"type"`
+	Available     bool            `json:"isAvailable"`
+	IPv4Available bool            `json:"ipv4Available"`
+	IPv6Available bool            `json:"ipv6Available"`
+	DampingState  tc.DampingState `json:"dampingState,omitempty"`
+}
+
+// StartStateBackupManager starts the goroutine which writes the local cache states, stat and health history, and events to the state backup file every state backup interval, so they survive a restart. If the interval is 0, no backups are written.
+func StartStateBackupManager(
+	cfg config.Config,
+	localStates peer.CRStatesThreadsafe,
+	localCacheStatus threadsafe.CacheAvailableStatus,
+	healthHistory threadsafe.ResultHistory,
+	statResultHistory threadsafe.ResultStatHistory,
+	events health.ThreadsafeEvents,
+) {
+	if cfg.StateBackupInterval <= 0 || cfg.StateBackupFile == "" {
+		log.Infoln("state backup interval or file not set, not backing up state")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.StateBackupInterval)
+		for now := range ticker.C {
+			backup := newStateBackup(localStates, localCacheStatus, healthHistory, statResultHistory, events, now)
+			if err := writeStateBackup(cfg.StateBackupFile, backup); err != nil {
+				log.Errorf("writing state backup file '%s': %v", cfg.StateBackupFile, err)
+			}
+		}
+	}()
+}
+
+// restoreStateBackup restores the local cache states, stat and health history, and events from the state backup file, if it exists and is no older than the state backup max age.
+// This MUST be called before any results are processed, because the history and events it restores are only safe for a single writer.
+func restoreStateBackup(
+	cfg config.Config,
+	localStates peer.CRStatesThreadsafe,
+	localCacheStatus threadsafe.CacheAvailableStatus,
+	healthHistory threadsafe.ResultHistory,
+	statResultHistory threadsafe.ResultStatHistory,
+	events health.ThreadsafeEvents,
+) {
+	if cfg.StateBackupFile == "" {
+		return
+	}
+	backup, err := readStateBackup(cfg.StateBackupFile)
+	if os.IsNotExist(err) {
+		log.Infof("state backup file '%s' does not exist, starting without state", cfg.StateBackupFile)
+		return
+	} else if err != nil {
+		log.Errorf("reading state backup file '%s', starting without state: %v", cfg.StateBackupFile, err)
+		return
+	}
+	if age := time.Since(backup.Time); age > cfg.StateBackupMaxAge {
+		log.Infof("state backup file '%s' is %v old, older than the max age %v, starting without state", cfg.StateBackupFile, age, cfg.StateBackupMaxAge)
+		return
+	}
+	backup.restore(localStates, localCacheStatus, healthHistory, statResultHistory, events)
+	log.Infof("restored state from backup file '%s' written at %v", cfg.StateBackupFile, backup.Time)
+}
+
+func newStateBackup(
+	localStates peer.CRStatesThreadsafe,
+	localCacheStatus threadsafe.CacheAvailableStatus,
+	healthHistory threadsafe.ResultHistory,
+	statResultHistory threadsafe.ResultStatHistory,
+	events health.ThreadsafeEvents,
+	now time.Time,
+) stateBackup {
+	backup := stateBackup{
+		Time:          now,
+		LocalStates:   localStates.Get(),
+		CacheStatus:   localCacheStatus.Get(),
+		HealthHistory: map[tc.CacheName][]resultBackup{},
+		StatHistory:   map[string]cacheStatHistoryBackup{},
+	}
+
+	for cacheName, results := range healthHistory.Get() {
+		resultBackups := make([]resultBackup, 0, len(results))
+		for _, result := range results {
+			errStr := ""
+			if result.Error != nil {
+				errStr = result.Error.Error()
+			}
+			resultBackups = append(resultBackups, resultBackup{
+				ID:              result.ID,
+				Available:       result.Available,
+				Error:           errStr,
+				Miscellaneous:   result.Miscellaneous,
+				RequestTime:     result.RequestTime,
+				Statistics:      result.Statistics,
+				Time:            result.Time,
+				UsingIPv4:       result.UsingIPv4,
+				Vitals:          result.Vitals,
+				InterfaceVitals: result.InterfaceVitals,
+			})
+		}
+		backup.HealthHistory[cacheName] = resultBackups
+	}
+
+	statResultHistory.Range(func(cacheName string, history threadsafe.CacheStatHistory) bool {
+		historyBackup := cacheStatHistoryBackup{
+			Interfaces: make(map[string]map[string][]resultStatValBackup, len(history.Interfaces)),
+			Stats:      newStatHistoryBackup(history.Stats),
+		}
+		for interfaceName, interfaceHistory := range history.Interfaces {
+			historyBackup.Interfaces[interfaceName] = newStatHistoryBackup(interfaceHistory)
+		}
+		backup.StatHistory[cacheName] = historyBackup
+		return true
+	})
+
+	for _, event := range events.Get() {
+		backup.Events = append(backup.Events, eventBackup{
+			Time:          time.Time(event.Time),
+			Index:         event.Index,
+			Description:   event.Description,
+			Name:          event.Name,
+			Hostname:      event.Hostname,
+			Type:          event.Type,
+			Available:     event.Available,
+			IPv4Available: event.IPv4Available,
+			IPv6Available: event.IPv6Available,
+			DampingState:  event.DampingState,
+		})
+	}
+	return backup
+}
+
+func newStatHistoryBackup(history threadsafe.ResultStatValHistory) map[string][]resultStatValBackup {
+	backup := map[string][]resultStatValBackup{}
+	history.Range(func(stat string, vals []tc.ResultStatVal) bool {
+		valBackups := make([]resultStatValBackup, 0, len(vals))
+		for _, val := range vals {
+			valBackups = append(valBackups, resultStatValBackup{Val: val.Val, Time: val.Time, Span: val.Span})
+		}
+		backup[stat] = valBackups
+		return true
+	})
+	return backup
+}
+
+func restoreStatHistory(history threadsafe.ResultStatValHistory, backup map[string][]resultStatValBackup) {
+	for stat, valBackups := range backup {
+		vals := make([]tc.ResultStatVal, 0, len(valBackups))
+		for _, val := range valBackups {
+			vals = append(vals, tc.ResultStatVal{Val: val.Val, Time: val.Time, Span: val.Span})
+		}
+		history.Store(stat, vals)
+	}
+}
+
+// restore sets the given local states, statuses, history, and events from the backup.
+func (b stateBackup) restore(
+	localStates peer.CRStatesThreadsafe,
+	localCacheStatus threadsafe.CacheAvailableStatus,
+	healthHistory threadsafe.ResultHistory,
+	statResultHistory threadsafe.ResultStatHistory,
+	events health.ThreadsafeEvents,
+) {
+	for cacheName, available := range b.LocalStates.Caches {
+		localStates.AddCache(cacheName, available)
+	}
+	for dsName, ds := range b.LocalStates.DeliveryService {
+		localStates.SetDeliveryService(dsName, ds)
+	}
+
+	if b.CacheStatus != nil {
+		localCacheStatus.Set(b.CacheStatus)
+	}
+
+	history := cache.ResultHistory{}
+	for cacheName, resultBackups := range b.HealthHistory {
+		results := make([]cache.Result, 0, len(resultBackups))
+		for _, result := range resultBackups {
+			var err error
+			if result.Error != "" {
+				err = errors.New(result.Error)
+			}
+			results = append(results, cache.Result{
+				ID:              result.ID,
+				Available:       result.Available,
+				Error:           err,
+				Miscellaneous:   result.Miscellaneous,
+				RequestTime:     result.RequestTime,
+				Statistics:      result.Statistics,
+				Time:            result.Time,
+				UsingIPv4:       result.UsingIPv4,
+				Vitals:          result.Vitals,
+				InterfaceVitals: result.InterfaceVitals,
+			})
+		}
+		history[cacheName] = results
+	}
+	healthHistory.Set(history)
+
+	for cacheName, historyBackup := range b.StatHistory {
+		cacheHistory := statResultHistory.LoadOrStore(cacheName)
+		restoreStatHistory(cacheHistory.Stats, historyBackup.Stats)
+		for interfaceName, interfaceBackup := range historyBackup.Interfaces {
+			interfaceHistory, ok := cacheHistory.Interfaces[interfaceName]
+			if !ok {
+				interfaceHistory = threadsafe.NewResultStatValHistory()
+				cacheHistory.Interfaces[interfaceName] = interfaceHistory
+			}
+			restoreStatHistory(interfaceHistory, interfaceBackup)
+		}
+	}
+
+	restoredEvents := make([]health.Event, 0, len(b.Events))
+	for _, event := range b.Events {
+		restoredEvents = append(restoredEvents, health.Event{
+			Time:          health.Time(event.Time),
+			Index:         event.Index,
+			Description:   event.Description,
+			Name:          event.Name,
+			Hostname:      event.Hostname,
+			Type:          event.Type,
+			Available:     event.Available,
+			IPv4Available: event.IPv4Available,
+			IPv6Available: event.IPv6Available,
+			DampingState:  event.DampingState,
+		})
+	}
+	events.Set(restoredEvents)
+}
+
+// writeStateBackup writes the backup to the given file. It writes to a temporary file which is then renamed, so a crash while writing never leaves a truncated backup.
+func writeStateBackup(fileName string, backup stateBackup) error {
+	bts, err := json.Marshal(backup)
+	if err != nil {
+		return errors.New("marshalling: " + err.Error())
+	}
+	tmpFileName := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpFileName, bts, 0644); err != nil {
+		return errors.New("writing temp file: " + err.Error())
+	}
+	if err := os.Rename(tmpFileName, fileName); err != nil {
+		return errors.New("renaming temp file: " + err.Error())
+	}
+	return nil
+}
+
+// readStateBackup reads the backup from the given file. If the file doesn't exist, the returned error satisfies os.IsNotExist.
+func readStateBackup(fileName string) (stateBackup, error) {
+	backup := stateBackup{}
+	bts, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return backup, err
+	}
+	if err := json.Unmarshal(bts, &backup); err != nil {
+		return backup, errors.New("unmarshalling: " + err.Error())
+	}
+	return backup, nil
+}
@@ -0,0 +1,152 @@
+package manager
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/cache"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
+)
+
+func TestStateBackupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-state-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.DefaultConfig
+	cfg.StateBackupFile = filepath.Join(dir, "state.backup")
+
+	localStates := peer.NewCRStatesThreadsafe()
+	localStates.AddCache("edge0", tc.IsAvailable{IsAvailable: false, Ipv4Available: false, Ipv6Available: false})
+	localStates.SetDeliveryService("ds0", tc.CRStatesDeliveryService{IsAvailable: true, DisabledLocations: []tc.CacheGroupName{}})
+
+	localCacheStatus := threadsafe.NewCacheAvailableStatus()
+	localCacheStatus.Set(cache.AvailableStatuses{"edge0": {Status: "REPORTED", Why: "loadavg too high", FlapPenalty: 1500, DampingState: tc.DampingStateSuppressed}})
+
+	pollTime := time.Now().Add(-time.Second)
+	healthHistory := threadsafe.NewResultHistory()
+	healthHistory.Set(cache.ResultHistory{"edge0": {{ID: "edge0", Error: errors.New("timed out"), Time: pollTime, Vitals: cache.Vitals{BytesOut: 42}}}})
+
+	statResultHistory := threadsafe.NewResultStatHistory()
+	if err := statResultHistory.Add(cache.Result{
+		ID:            "edge0",
+		Miscellaneous: map[string]interface{}{"loadavg": 1.5},
+		Statistics:    cache.Statistics{Interfaces: map[string]cache.Interface{"eth0": {Speed: 10000, BytesOut: 100}}},
+		Time:          pollTime,
+	}, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	events := health.NewThreadsafeEvents(10)
+	events.Add(health.Event{Time: health.Time(pollTime), Hostname: "edge0", Type: "EDGE", Description: "timed out", IPv4Available: true})
+
+	backup := newStateBackup(localStates, localCacheStatus, healthHistory, statResultHistory, events, time.Now())
+	if err := writeStateBackup(cfg.StateBackupFile, backup); err != nil {
+		t.Fatalf("writing state backup: %v", err)
+	}
+
+	restoredStates := peer.NewCRStatesThreadsafe()
+	restoredCacheStatus := threadsafe.NewCacheAvailableStatus()
+	restoredHealthHistory := threadsafe.NewResultHistory()
+	restoredStatResultHistory := threadsafe.NewResultStatHistory()
+	restoredEvents := health.NewThreadsafeEvents(10)
+	restoreStateBackup(cfg, restoredStates, restoredCacheStatus, restoredHealthHistory, restoredStatResultHistory, restoredEvents)
+
+	if available, ok := restoredStates.GetCache("edge0"); !ok || available.IsAvailable {
+		t.Errorf("expected restored edge0 unavailable, actual %+v %v", available, ok)
+	}
+	if ds, ok := restoredStates.GetDeliveryService("ds0"); !ok || !ds.IsAvailable {
+		t.Errorf("expected restored ds0 available, actual %+v %v", ds, ok)
+	}
+
+	if status := restoredCacheStatus.Get()["edge0"]; status.DampingState != tc.DampingStateSuppressed || status.FlapPenalty != 1500 || status.Why != "loadavg too high" {
+		t.Errorf("expected restored edge0 status to be suppressed with penalty 1500, actual %+v", status)
+	}
+
+	results := restoredHealthHistory.Get()["edge0"]
+	if len(results) != 1 {
+		t.Fatalf("expected 1 restored health result, actual %d", len(results))
+	}
+	if results[0].Error == nil || results[0].Error.Error() != "timed out" || results[0].Vitals.BytesOut != 42 || !results[0].Time.Equal(pollTime) {
+		t.Errorf("expected restored health result to match, actual %+v", results[0])
+	}
+
+	cacheHistory := restoredStatResultHistory.LoadOrStore("edge0")
+	if vals := cacheHistory.Stats.Load("loadavg"); len(vals) != 1 || vals[0].Val != 1.5 {
+		t.Errorf("expected restored loadavg history [1.5], actual %+v", vals)
+	}
+	interfaceHistory, ok := cacheHistory.Interfaces["eth0"]
+	if !ok {
+		t.Fatal("expected restored eth0 interface history")
+	}
+	if vals := interfaceHistory.Load(threadsafe.InterfaceStatNameBytesOut); len(vals) != 1 || vals[0].Val != float64(100) {
+		t.Errorf("expected restored eth0 outBytes history [100], actual %+v", vals)
+	}
+
+	restored := restoredEvents.Get()
+	if len(restored) != 1 || restored[0].Hostname != "edge0" || !restored[0].IPv4Available || !time.Time(restored[0].Time).Equal(pollTime) {
+		t.Fatalf("expected restored edge0 event, actual %+v", restored)
+	}
+	restoredEvents.Add(health.Event{Hostname: "edge1"})
+	if next := restoredEvents.Get()[0]; next.Index != restored[0].Index+1 {
+		t.Errorf("expected events added after restore to be indexed after restored events, actual index %d after %d", next.Index, restored[0].Index)
+	}
+}
+
+func TestStateBackupRestoreStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-state-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.DefaultConfig
+	cfg.StateBackupFile = filepath.Join(dir, "state.backup")
+
+	localStates := peer.NewCRStatesThreadsafe()
+	localStates.AddCache("edge0", tc.IsAvailable{IsAvailable: true})
+	localCacheStatus := threadsafe.NewCacheAvailableStatus()
+	healthHistory := threadsafe.NewResultHistory()
+	statResultHistory := threadsafe.NewResultStatHistory()
+	events := health.NewThreadsafeEvents(10)
+
+	backup := newStateBackup(localStates, localCacheStatus, healthHistory, statResultHistory, events, time.Now().Add(-2*cfg.StateBackupMaxAge))
+	if err := writeStateBackup(cfg.StateBackupFile, backup); err != nil {
+		t.Fatalf("writing state backup: %v", err)
+	}
+
+	restoredStates := peer.NewCRStatesThreadsafe()
+	restoreStateBackup(cfg, restoredStates, localCacheStatus, healthHistory, statResultHistory, events)
+	if _, ok := restoredStates.GetCache("edge0"); ok {
+		t.Error("expected state backup older than the max age not to be restored")
+	}
+}
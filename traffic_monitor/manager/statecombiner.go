@@ -27,14 +27,18 @@ import (
 
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/health"
 	"github.com/apache/trafficcontrol/traffic_monitor/peer"
+	"github.com/apache/trafficcontrol/traffic_monitor/threadsafe"
 	"github.com/apache/trafficcontrol/traffic_monitor/todata"
 )
 
 // StartStateCombiner starts the State Combiner goroutine, and returns the threadsafe CombinedStates, and a func to signal to combine states.
-func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStatesPeersThreadsafe, localStates peer.CRStatesThreadsafe, toData todata.TODataThreadsafe) (peer.CRStatesThreadsafe, func()) {
+// The self is the hostname of this Traffic Monitor, whose vote is counted with its peers' in the weighted peer combine mode.
+func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStatesPeersThreadsafe, localStates peer.CRStatesThreadsafe, toData todata.TODataThreadsafe, monitorConfig threadsafe.TrafficMonitorConfigMap, cfg config.Config, self string) (peer.CRStatesThreadsafe, func()) {
 	combinedStates := peer.NewCRStatesThreadsafe()
+	voter := newPeerVoter(cfg, self)
 
 	// the chan buffer just reduces the number of goroutines on our infinite buffer hack in combineState(), no real writer will block, since combineState() writes in a goroutine.
 	combineStateChan := make(chan struct{}, 5)
@@ -58,7 +62,7 @@ func StartStateCombiner(events health.ThreadsafeEvents, peerStates peer.CRStates
 		overrideMap := map[tc.CacheName]bool{}
 		for range combineStateChan {
 			drain(combineStateChan)
-			combineCrStates(events, true, peerStates, localStates.Get(), combinedStates, overrideMap, toData.Get())
+			combineCrStates(events, true, voter, peerStates, monitorConfig.Get(), localStates.Get(), combinedStates, overrideMap, toData.Get())
 		}
 	}()
 
@@ -135,7 +139,49 @@ func combineCacheState(
 		events.Add(health.Event{Time: health.Time(time.Now()), Description: fmt.Sprintf("Health protocol override condition %s", overrideCondition), Name: cacheName.String(), Hostname: cacheName.String(), Type: toData.ServerTypes[cacheName].String(), Available: available, IPv4Available: ipv4Available, IPv6Available: ipv6Available})
 	}
 
-	combinedStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: available, Ipv4Available: ipv4Available, Ipv6Available: ipv6Available})
+	combinedStates.AddCache(cacheName, tc.IsAvailable{IsAvailable: available, Ipv4Available: ipv4Available, Ipv6Available: ipv6Available, DampingState: localCacheState.DampingState, FlapPenalty: localCacheState.FlapPenalty})
+}
+
+// combineCacheStateWeighted combines the cache's local state with its peers' by the weighted vote of the given round, rather than optimistically.
+func combineCacheStateWeighted(
+	cacheName tc.CacheName,
+	localCacheState tc.IsAvailable,
+	events health.ThreadsafeEvents,
+	round *peerVoteRound,
+	combinedStates peer.CRStatesThreadsafe,
+	overrideMap map[tc.CacheName]bool,
+	toData todata.TOData,
+) peer.CacheVotes {
+	votes := round.vote(cacheName, localCacheState)
+	available := votes.Result
+	overrideCondition := ""
+	override := overrideMap[cacheName]
+
+	if available != (tc.IsAvailable{IsAvailable: localCacheState.IsAvailable, Ipv4Available: localCacheState.Ipv4Available, Ipv6Available: localCacheState.Ipv6Available}) {
+		if !override {
+			overrideCondition = fmt.Sprintf("detected; %s by weighted vote (unavailable weight %g of %g)", availableStr(available.IsAvailable), votes.UnavailableWeight, votes.TotalWeight)
+			overrideMap[cacheName] = true
+		}
+	} else if override {
+		overrideCondition = "cleared; weighted vote agrees with local health"
+		overrideMap[cacheName] = false
+	}
+
+	if overrideCondition != "" {
+		events.Add(health.Event{Time: health.Time(time.Now()), Description: fmt.Sprintf("Health protocol override condition %s", overrideCondition), Name: cacheName.String(), Hostname: cacheName.String(), Type: toData.ServerTypes[cacheName].String(), Available: available.IsAvailable, IPv4Available: available.Ipv4Available, IPv6Available: available.Ipv6Available})
+	}
+
+	available.DampingState = localCacheState.DampingState
+	available.FlapPenalty = localCacheState.FlapPenalty
+	combinedStates.AddCache(cacheName, available)
+	return votes
+}
+
+func availableStr(available bool) string {
+	if available {
+		return "available"
+	}
+	return "unavailable"
 }
 
 func combineDSState(
@@ -199,9 +245,19 @@ func pruneCombinedCaches(combinedStates peer.CRStatesThreadsafe, localStates tc.
 	}
 }
 
-func combineCrStates(events health.ThreadsafeEvents, peerOptimistic bool, peerStates peer.CRStatesPeersThreadsafe, localStates tc.CRStates, combinedStates peer.CRStatesThreadsafe, overrideMap map[tc.CacheName]bool, toData todata.TOData) {
-	for cacheName, localCacheState := range localStates.Caches { // localStates gets pruned when servers are disabled, it's the source of truth
-		combineCacheState(cacheName, localCacheState, events, peerOptimistic, peerStates, combinedStates, overrideMap, toData)
+// combineCrStates combines the local states with the peer states. If voter is nil, caches are combined optimistically, else by the weighted vote, whose breakdown is set in the peer states.
+func combineCrStates(events health.ThreadsafeEvents, peerOptimistic bool, voter *peerVoter, peerStates peer.CRStatesPeersThreadsafe, monitorConfig tc.TrafficMonitorConfigMap, localStates tc.CRStates, combinedStates peer.CRStatesThreadsafe, overrideMap map[tc.CacheName]bool, toData todata.TOData) {
+	if voter == nil {
+		for cacheName, localCacheState := range localStates.Caches { // localStates gets pruned when servers are disabled, it's the source of truth
+			combineCacheState(cacheName, localCacheState, events, peerOptimistic, peerStates, combinedStates, overrideMap, toData)
+		}
+	} else {
+		round := voter.newRound(peerStates, monitorConfig, toData)
+		cacheVotes := make(map[tc.CacheName]peer.CacheVotes, len(localStates.Caches))
+		for cacheName, localCacheState := range localStates.Caches {
+			cacheVotes[cacheName] = combineCacheStateWeighted(cacheName, localCacheState, events, round, combinedStates, overrideMap, toData)
+		}
+		peerStates.SetCacheVotes(cacheVotes)
 	}
 
 	for deliveryServiceName, localDeliveryService := range localStates.DeliveryService {
@@ -154,3 +154,80 @@ func TestCombineCacheStateCacheDown(t *testing.T) {
 		t.Fatalf("cache IPv6 is unavailable and should be available")
 	}
 }
+
+func TestCombineCrStatesWeighted(t *testing.T) {
+	cacheName := tc.CacheName("testCache")
+	peerStates := peer.NewCRStatesPeersThreadsafe(0)
+	for _, peerName := range []tc.TrafficMonitorName{"tm-east", "tm-west"} {
+		peerStates.Set(peer.Result{
+			ID:         peerName,
+			Available:  true,
+			PeerStates: tc.CRStates{Caches: map[tc.CacheName]tc.IsAvailable{cacheName: {IsAvailable: true, Ipv4Available: true, Ipv6Available: true}}},
+			Time:       time.Now(),
+		})
+	}
+	peerStates.SetPeers(map[tc.TrafficMonitorName]struct{}{"tm-east": {}, "tm-west": {}})
+	monitorConfig := tc.TrafficMonitorConfigMap{
+		CacheGroup: map[string]tc.TMCacheGroup{
+			"cg-self": {Name: "cg-self", Coordinates: tc.MonitoringCoordinates{Latitude: 40, Longitude: -105}},
+			"cg-east": {Name: "cg-east", Coordinates: tc.MonitoringCoordinates{Latitude: 40, Longitude: -75}},
+			"cg-west": {Name: "cg-west", Coordinates: tc.MonitoringCoordinates{Latitude: 37, Longitude: -122}},
+			"cg-edge": {Name: "cg-edge", Coordinates: tc.MonitoringCoordinates{Latitude: 39.7, Longitude: -104.9}},
+		},
+		TrafficMonitor: map[string]tc.TrafficMonitor{
+			"tm-self": {HostName: "tm-self", Location: "cg-self", ServerStatus: "ONLINE"},
+			"tm-east": {HostName: "tm-east", Location: "cg-east", ServerStatus: "ONLINE"},
+			"tm-west": {HostName: "tm-west", Location: "cg-west", ServerStatus: "ONLINE"},
+		},
+	}
+	toData := todata.TOData{
+		ServerTypes:       map[tc.CacheName]tc.CacheType{cacheName: tc.CacheTypeEdge},
+		ServerCachegroups: map[tc.CacheName]tc.CacheGroupName{cacheName: "cg-edge"},
+	}
+	localStates := tc.CRStates{Caches: map[tc.CacheName]tc.IsAvailable{cacheName: {}}, DeliveryService: map[tc.DeliveryServiceName]tc.CRStatesDeliveryService{}}
+	events := health.NewThreadsafeEvents(10)
+	combinedStates := peer.NewCRStatesThreadsafe()
+	overrideMap := map[tc.CacheName]bool{}
+
+	voter := &peerVoter{self: "tm-self", majority: 0.5, localityWeight: 1}
+	combineCrStates(events, true, voter, peerStates, monitorConfig, localStates, combinedStates, overrideMap, toData)
+	if !combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Errorf("expected one of three equally weighted monitors not to mark a cache unavailable, actual unavailable")
+	}
+	if votes := peerStates.GetCacheVotes()[cacheName]; votes.TotalWeight != 3 || votes.UnavailableWeight != 1 || len(votes.Monitors) != 3 {
+		t.Errorf("expected votes total weight 3 unavailable weight 1 from 3 monitors, actual %+v", votes)
+	}
+	if !overrideMap[cacheName] || len(events.Get()) != 1 {
+		t.Errorf("expected an override event, actual override %v events %+v", overrideMap[cacheName], events.Get())
+	}
+
+	voter.localityWeight = 3
+	combineCrStates(events, true, voter, peerStates, monitorConfig, localStates, combinedStates, overrideMap, toData)
+	if combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Errorf("expected the monitor nearest the cache with locality weight 3 of 5 to mark it unavailable, actual available")
+	}
+	if votes := peerStates.GetCacheVotes()[cacheName]; votes.Monitors["tm-self"].Weight != 3 || votes.Monitors["tm-east"].Weight != 1 {
+		t.Errorf("expected the nearest monitor weight 3 and others 1, actual %+v", votes.Monitors)
+	}
+	if overrideMap[cacheName] || len(events.Get()) != 2 {
+		t.Errorf("expected the override to be cleared, actual override %v events %+v", overrideMap[cacheName], events.Get())
+	}
+
+	voter.localityWeight = 1
+	voter.weights = map[string]float64{"tm-east": 0.4, "tm-west": 0.4}
+	combineCrStates(events, true, voter, peerStates, monitorConfig, localStates, combinedStates, overrideMap, toData)
+	if combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Errorf("expected a monitor with weight 1 of 1.8 to mark a cache unavailable, actual available")
+	}
+
+	// partitioned from its peers, this monitor must not decide alone.
+	voter.weights = nil
+	partitionedPeerStates := peer.NewCRStatesPeersThreadsafe(0)
+	combineCrStates(events, true, voter, partitionedPeerStates, monitorConfig, localStates, combinedStates, overrideMap, toData)
+	if !combinedStates.Get().Caches[cacheName].IsAvailable {
+		t.Errorf("expected a monitor without available peers, with weight 1 of 3, not to mark a cache unavailable, actual unavailable")
+	}
+	if votes := partitionedPeerStates.GetCacheVotes()[cacheName]; votes.TotalWeight != 3 || votes.AbsentWeight != 2 || len(votes.Monitors) != 1 {
+		t.Errorf("expected votes total weight 3 absent weight 2 from 1 monitor, actual %+v", votes)
+	}
+}
@@ -0,0 +1,247 @@
+// Package notify POSTs Traffic Monitor's availability events to webhooks, so
+// changes can be acted on as they happen, without polling the event log.
+package notify
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+	"github.com/apache/trafficcontrol/lib/go-util"
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+)
+
+// The event types webhooks may be filtered by.
+const (
+	EventTypeCache           = "cache"
+	EventTypeDeliveryService = "deliveryservice"
+	EventTypePeer            = "peer"
+	EventTypePeerQuorum      = "peerquorum"
+)
+
+// queueSize is the number of notifications which may be waiting to be sent to
+// a webhook, for example while it's being retried, before new notifications
+// are dropped.
+const queueSize = 1000
+
+// Notification is the JSON body POSTed to webhooks.
+type Notification struct {
+	// Monitor is the hostname of the Traffic Monitor which sent the
+	// notification.
+	Monitor string `json:"monitor"`
+	// EventType is the type of event, as filtered by webhooks' event types.
+	EventType string    `json:"eventType"`
+	Time      time.Time `json:"time"`
+	// Index is the event's index in the event log.
+	Index uint64 `json:"index"`
+	// Name is the cache, delivery service, or peer name. It's empty for peer
+	// quorum events.
+	Name string `json:"name"`
+	// ServerType is the cache's type, for cache events.
+	ServerType    string `json:"serverType,omitempty"`
+	CacheGroup    string `json:"cachegroup,omitempty"`
+	Available     bool   `json:"isAvailable"`
+	IPv4Available bool   `json:"ipv4Available"`
+	IPv6Available bool   `json:"ipv6Available"`
+	DampingState  string `json:"dampingState,omitempty"`
+	Description   string `json:"description"`
+}
+
+// Notifier sends events to webhooks. A nil *Notifier sends nothing.
+type Notifier struct {
+	monitor      string
+	destinations []destination
+}
+
+type destination struct {
+	cfg        config.Webhook
+	eventTypes map[string]struct{}
+	client     *http.Client
+	queue      chan Notification
+}
+
+// New validates the given webhooks, and starts a goroutine for each to send
+// notifications to it. The monitor is the hostname of this Traffic Monitor.
+// If there are no webhooks, nil is returned.
+func New(webhooks []config.Webhook, monitor string) (*Notifier, error) {
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	n := &Notifier{monitor: monitor}
+	for i, cfg := range webhooks {
+		if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("webhook %d: invalid url '%s'", i, cfg.URL)
+		}
+		eventTypes := map[string]struct{}{}
+		for _, eventType := range cfg.EventTypes {
+			switch eventType {
+			case EventTypeCache, EventTypeDeliveryService, EventTypePeer, EventTypePeerQuorum:
+				eventTypes[eventType] = struct{}{}
+			default:
+				return nil, fmt.Errorf("webhook '%s': unknown event type '%s'", cfg.URL, eventType)
+			}
+		}
+		if cfg.RetryMinInterval <= 0 || cfg.RetryMaxInterval < cfg.RetryMinInterval {
+			return nil, fmt.Errorf("webhook '%s': retry intervals must be positive, and the max at least the min", cfg.URL)
+		}
+		n.destinations = append(n.destinations, destination{
+			cfg:        cfg,
+			eventTypes: eventTypes,
+			client:     &http.Client{Timeout: cfg.Timeout},
+			queue:      make(chan Notification, queueSize),
+		})
+	}
+	for _, dest := range n.destinations {
+		go dest.send()
+	}
+	return n, nil
+}
+
+// Notify queues the given event to be sent to each webhook it passes the
+// filters of. It never blocks; if a webhook's queue is full, the event is
+// dropped for that webhook.
+func (n *Notifier) Notify(e health.Event) {
+	if n == nil {
+		return
+	}
+	notification := n.newNotification(e)
+	for _, dest := range n.destinations {
+		if !dest.wants(notification) {
+			continue
+		}
+		select {
+		case dest.queue <- notification:
+		default:
+			log.Errorf("webhook '%s': queue full, dropping %s event %d for '%s'", dest.cfg.URL, notification.EventType, notification.Index, notification.Name)
+		}
+	}
+}
+
+func (n *Notifier) newNotification(e health.Event) Notification {
+	notification := Notification{
+		Monitor:       n.monitor,
+		EventType:     eventType(e.Type),
+		Time:          time.Time(e.Time),
+		Index:         e.Index,
+		Name:          e.Name,
+		CacheGroup:    string(e.CacheGroup),
+		Available:     e.Available,
+		IPv4Available: e.IPv4Available,
+		IPv6Available: e.IPv6Available,
+		DampingState:  string(e.DampingState),
+		Description:   e.Description,
+	}
+	if notification.EventType == EventTypeCache {
+		notification.ServerType = e.Type
+	}
+	return notification
+}
+
+// eventType returns the notification event type of the given health event type.
+func eventType(healthEventType string) string {
+	switch healthEventType {
+	case health.EventTypeDeliveryService:
+		return EventTypeDeliveryService
+	case health.EventTypePeer:
+		return EventTypePeer
+	case health.EventTypePeerQuorum:
+		return EventTypePeerQuorum
+	default:
+		return EventTypeCache // cache events' type is the server type
+	}
+}
+
+func (d destination) wants(n Notification) bool {
+	if d.cfg.UnavailableOnly && n.Available {
+		return false
+	}
+	if len(d.eventTypes) == 0 {
+		return true
+	}
+	_, ok := d.eventTypes[n.EventType]
+	return ok
+}
+
+// send sends queued notifications to the webhook, in order, retrying each with backoff until it succeeds or the retries are exhausted. Does not return.
+func (d destination) send() {
+	backoff := util.NewConstantBackoff(d.cfg.RetryMinInterval)
+	if d.cfg.RetryMaxInterval > d.cfg.RetryMinInterval {
+		if b, err := util.NewBackoff(d.cfg.RetryMinInterval, d.cfg.RetryMaxInterval, util.DefaultFactor); err != nil {
+			log.Errorf("webhook '%s': creating backoff, retrying at the min interval: %v", d.cfg.URL, err)
+		} else {
+			backoff = b
+		}
+	}
+	for notification := range d.queue {
+		body, err := json.Marshal(notification)
+		if err != nil {
+			log.Errorf("webhook '%s': marshalling %s event %d: %v", d.cfg.URL, notification.EventType, notification.Index, err)
+			continue
+		}
+		backoff.Reset()
+		for attempt := uint64(0); ; attempt++ {
+			err := d.post(body)
+			if err == nil {
+				break
+			}
+			if attempt >= d.cfg.RetryMax {
+				log.Errorf("webhook '%s': sending %s event %d for '%s' failed after %d attempts, dropping: %v", d.cfg.URL, notification.EventType, notification.Index, notification.Name, attempt+1, err)
+				break
+			}
+			wait := backoff.BackoffDuration()
+			log.Warnf("webhook '%s': sending %s event %d for '%s', retrying in %v: %v", d.cfg.URL, notification.EventType, notification.Index, notification.Name, wait, err)
+			time.Sleep(wait)
+		}
+	}
+}
+
+// post POSTs the given body to the webhook, returning an error if the request fails or the response isn't a 2xx.
+func (d destination) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, d.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("creating request: " + err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, val := range d.cfg.Headers {
+		req.Header.Set(name, val)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("response code %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	io.Copy(ioutil.Discard, resp.Body) // drain, so the connection is reused
+	return nil
+}
@@ -0,0 +1,103 @@
+package notify
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/health"
+)
+
+func TestNotifierRetryAndFilter(t *testing.T) {
+	received := make(chan Notification, 10)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("expected configured Authorization header, actual '%s'", r.Header.Get("Authorization"))
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		n := Notification{}
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("decoding notification: %v", err)
+		}
+		received <- n
+	}))
+	defer srv.Close()
+
+	webhook := config.DefaultWebhook
+	webhook.URL = srv.URL
+	webhook.EventTypes = []string{EventTypeCache}
+	webhook.UnavailableOnly = true
+	webhook.Headers = map[string]string{"Authorization": "Bearer secret"}
+	webhook.RetryMinInterval = time.Millisecond
+	webhook.RetryMaxInterval = 2 * time.Millisecond
+
+	notifier, err := New([]config.Webhook{webhook}, "tm0")
+	if err != nil {
+		t.Fatalf("creating notifier: %v", err)
+	}
+
+	notifier.Notify(health.Event{Index: 0, Name: "edge0", Type: "EDGE", Available: false, Description: "timed out"})
+	notifier.Notify(health.Event{Index: 1, Name: "edge0", Type: "EDGE", Available: true})
+	notifier.Notify(health.Event{Index: 2, Name: "ds0", Type: health.EventTypeDeliveryService, Available: false})
+	notifier.Notify(health.Event{Index: 3, Name: "edge1", Type: "MID", Available: false})
+
+	for _, expected := range []uint64{0, 3} {
+		select {
+		case n := <-received:
+			if n.Index != expected || n.EventType != EventTypeCache || n.Monitor != "tm0" || n.Available {
+				t.Errorf("expected unavailable cache notification %d from tm0, actual %+v", expected, n)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected notification %d, actual none", expected)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests including 1 retry, actual %d", requests)
+	}
+}
+
+func TestNewInvalidWebhook(t *testing.T) {
+	webhook := config.DefaultWebhook
+	webhook.URL = "ftp://example.net"
+	if _, err := New([]config.Webhook{webhook}, "tm0"); err == nil {
+		t.Error("expected error for non-HTTP url")
+	}
+
+	webhook.URL = "https://example.net"
+	webhook.EventTypes = []string{"bogus"}
+	if _, err := New([]config.Webhook{webhook}, "tm0"); err == nil {
+		t.Error("expected error for unknown event type")
+	}
+
+	if notifier, err := New(nil, "tm0"); err != nil || notifier != nil {
+		t.Errorf("expected nil notifier without webhooks, actual %v %v", notifier, err)
+	}
+	(*Notifier)(nil).Notify(health.Event{}) // must not panic
+}
@@ -30,14 +30,50 @@ import (
 // This could be made lock-free, if the performance was necessary
 // TODO add separate locks for Caches and DeliveryService maps?
 type CRStatesThreadsafe struct {
-	crStates *tc.CRStates
-	m        *sync.RWMutex
+	crStates    *tc.CRStates
+	m           *sync.RWMutex
+	subscribers *crStatesSubscribers
+}
+
+// crStatesSubscribers is the set of channels notified when a CRStatesThreadsafe changes.
+type crStatesSubscribers struct {
+	chans map[chan struct{}]struct{}
+	m     sync.Mutex
 }
 
 // NewCRStatesThreadsafe creates a new CRStatesThreadsafe object safe for multiple goroutine readers and a single writer.
 func NewCRStatesThreadsafe() CRStatesThreadsafe {
 	crs := tc.NewCRStates()
-	return CRStatesThreadsafe{m: &sync.RWMutex{}, crStates: &crs}
+	return CRStatesThreadsafe{m: &sync.RWMutex{}, crStates: &crs, subscribers: &crStatesSubscribers{chans: map[chan struct{}]struct{}{}}}
+}
+
+// Subscribe returns a channel which receives whenever the states change, and a func to unsubscribe, which MUST be called when the subscriber is done.
+// Notifications are coalesced: a subscriber which hasn't received the last notification won't be sent another, so subscribers should Get the current states on each receive, rather than counting them.
+func (t *CRStatesThreadsafe) Subscribe() (<-chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+	t.subscribers.m.Lock()
+	t.subscribers.chans[c] = struct{}{}
+	t.subscribers.m.Unlock()
+	return c, func() {
+		t.subscribers.m.Lock()
+		delete(t.subscribers.chans, c)
+		t.subscribers.m.Unlock()
+	}
+}
+
+// notify notifies all subscribers of a change, without blocking.
+func (t *CRStatesThreadsafe) notify() {
+	if t.subscribers == nil {
+		return
+	}
+	t.subscribers.m.Lock()
+	for c := range t.subscribers.chans {
+		select {
+		case c <- struct{}{}:
+		default: // the subscriber already has a pending notification
+		}
+	}
+	t.subscribers.m.Unlock()
 }
 
 // Get returns the internal Crstates object for reading.
@@ -84,6 +120,7 @@ func (t *CRStatesThreadsafe) SetCache(cacheName tc.CacheName, available tc.IsAva
 		t.crStates.Caches[cacheName] = available
 	}
 	t.m.Unlock()
+	t.notify()
 }
 
 // AddCache adds the internal availability data for a particular cache.
@@ -91,6 +128,7 @@ func (t *CRStatesThreadsafe) AddCache(cacheName tc.CacheName, available tc.IsAva
 	t.m.Lock()
 	t.crStates.Caches[cacheName] = available
 	t.m.Unlock()
+	t.notify()
 }
 
 // DeleteCache deletes the given cache from the internal data.
@@ -98,6 +136,7 @@ func (t *CRStatesThreadsafe) DeleteCache(name tc.CacheName) {
 	t.m.Lock()
 	delete(t.crStates.Caches, name)
 	t.m.Unlock()
+	t.notify()
 }
 
 // SetDeliveryService sets the availability data for the given delivery service.
@@ -105,6 +144,7 @@ func (t *CRStatesThreadsafe) SetDeliveryService(name tc.DeliveryServiceName, ds
 	t.m.Lock()
 	t.crStates.DeliveryService[name] = ds
 	t.m.Unlock()
+	t.notify()
 }
 
 // DeleteDeliveryService deletes the given delivery service from the internal data. This MUST NOT be called by multiple goroutines.
@@ -112,6 +152,7 @@ func (t *CRStatesThreadsafe) DeleteDeliveryService(name tc.DeliveryServiceName)
 	t.m.Lock()
 	delete(t.crStates.DeliveryService, name)
 	t.m.Unlock()
+	t.notify()
 }
 
 // CRStatesPeersThreadsafe provides safe access for multiple goroutines to read a map of Traffic Monitor peers to their returned Crstates, with a single goroutine writer.
@@ -124,6 +165,7 @@ type CRStatesPeersThreadsafe struct {
 	peerCount  *int
 	quorumMin  *int
 	timeout    *time.Duration
+	cacheVotes *map[tc.CacheName]CacheVotes
 	m          *sync.RWMutex
 }
 
@@ -131,6 +173,7 @@ type CRStatesPeersThreadsafe struct {
 func NewCRStatesPeersThreadsafe(quorumMin int) CRStatesPeersThreadsafe {
 	count := 0
 	timeout := time.Hour // default to a large timeout
+	cacheVotes := map[tc.CacheName]CacheVotes{}
 	return CRStatesPeersThreadsafe{
 		m:          &sync.RWMutex{},
 		timeout:    &timeout,
@@ -140,6 +183,7 @@ func NewCRStatesPeersThreadsafe(quorumMin int) CRStatesPeersThreadsafe {
 		peerTimes:  map[tc.TrafficMonitorName]time.Time{},
 		peerCount:  &count,
 		quorumMin:  &quorumMin,
+		cacheVotes: &cacheVotes,
 	}
 }
 
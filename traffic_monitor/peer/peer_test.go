@@ -49,3 +49,46 @@ func TestCrStates(t *testing.T) {
 	}
 
 }
+
+func TestWeighVotes(t *testing.T) {
+	votes := map[tc.TrafficMonitorName]Vote{
+		"tm0": {Weight: 1, IsAvailable: false, Ipv4Available: false, Ipv6Available: true},
+		"tm1": {Weight: 1, IsAvailable: true, Ipv4Available: true, Ipv6Available: true},
+		"tm2": {Weight: 1, IsAvailable: true, Ipv4Available: true, Ipv6Available: true},
+	}
+	result := WeighVotes(votes, 0, 0.5)
+	if !result.Result.IsAvailable || !result.Result.Ipv4Available || !result.Result.Ipv6Available {
+		t.Errorf("expected one of three monitors not to mark a cache unavailable, actual %+v", result.Result)
+	}
+	if result.TotalWeight != 3 || result.UnavailableWeight != 1 {
+		t.Errorf("expected total weight 3 unavailable weight 1, actual %v %v", result.TotalWeight, result.UnavailableWeight)
+	}
+
+	votes["tm1"] = Vote{Weight: 1, IsAvailable: false, Ipv4Available: false, Ipv6Available: true}
+	result = WeighVotes(votes, 0, 0.5)
+	if result.Result.IsAvailable || result.Result.Ipv4Available || !result.Result.Ipv6Available {
+		t.Errorf("expected two of three monitors to mark a cache and its IPv4 unavailable, actual %+v", result.Result)
+	}
+
+	votes["tm2"] = Vote{Weight: 3, IsAvailable: true, Ipv4Available: true, Ipv6Available: true}
+	result = WeighVotes(votes, 0, 0.5)
+	if !result.Result.IsAvailable {
+		t.Errorf("expected a monitor with more than half the weight to keep a cache available, actual %+v", result.Result)
+	}
+
+	result = WeighVotes(votes, 0, 0.3)
+	if result.Result.IsAvailable {
+		t.Errorf("expected unavailable weight 2 of 5 with majority 0.3 to mark a cache unavailable, actual available")
+	}
+
+	partitioned := map[tc.TrafficMonitorName]Vote{"tm0": {Weight: 1}}
+	result = WeighVotes(partitioned, 2, 0.5)
+	if !result.Result.IsAvailable || result.TotalWeight != 3 || result.AbsentWeight != 2 {
+		t.Errorf("expected a monitor partitioned from its peers with weight 1 of 3 not to mark a cache unavailable, actual %+v", result)
+	}
+
+	result = WeighVotes(map[tc.TrafficMonitorName]Vote{}, 0, 0.5)
+	if result.Result.IsAvailable {
+		t.Errorf("expected no votes to mark a cache unavailable, actual available")
+	}
+}
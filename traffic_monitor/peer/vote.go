@@ -0,0 +1,104 @@
+package peer
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"github.com/apache/trafficcontrol/lib/go-tc"
+)
+
+// Vote is a single Traffic Monitor's vote on the availability of a cache, in
+// the weighted peer combine mode.
+type Vote struct {
+	Weight        float64 `json:"weight"`
+	IsAvailable   bool    `json:"isAvailable"`
+	Ipv4Available bool    `json:"ipv4Available"`
+	Ipv6Available bool    `json:"ipv6Available"`
+}
+
+// CacheVotes is the breakdown of the weighted vote of the Traffic Monitors on
+// the availability of a cache.
+type CacheVotes struct {
+	// Majority is the fraction of the total weight which must vote a cache
+	// unavailable to mark it unavailable.
+	Majority float64 `json:"majority"`
+	// TotalWeight is the total weight of the Traffic Monitors, including
+	// those which didn't vote.
+	TotalWeight float64 `json:"totalWeight"`
+	// AbsentWeight is the weight of the Traffic Monitors which didn't vote,
+	// because they're unavailable or don't have the cache. They're counted as
+	// voting it available.
+	AbsentWeight float64 `json:"absentWeight"`
+	// UnavailableWeight is the weight of the Traffic Monitors which voted the
+	// cache unavailable.
+	UnavailableWeight float64 `json:"unavailableWeight"`
+	// Result is the availability decided by the vote.
+	Result tc.IsAvailable `json:"result"`
+	// Monitors are the votes of each Traffic Monitor, including this one.
+	Monitors map[tc.TrafficMonitorName]Vote `json:"monitors"`
+}
+
+// WeighVotes returns the availability of a cache decided by the given votes,
+// and the given weight of the Traffic Monitors which didn't vote. The cache,
+// and each of its IPv4 and IPv6 availabilities, are unavailable only if more
+// than the majority fraction of the total weight voted them unavailable.
+// Thus, no Traffic Monitors with less than the majority can mark a cache
+// unavailable, or keep it unavailable, by themselves, even if they're
+// partitioned from the others.
+func WeighVotes(votes map[tc.TrafficMonitorName]Vote, absentWeight float64, majority float64) CacheVotes {
+	result := CacheVotes{Majority: majority, Monitors: votes, TotalWeight: absentWeight, AbsentWeight: absentWeight}
+	unavailableWeight, ipv4UnavailableWeight, ipv6UnavailableWeight := float64(0), float64(0), float64(0)
+	for _, vote := range votes {
+		result.TotalWeight += vote.Weight
+		if !vote.IsAvailable {
+			unavailableWeight += vote.Weight
+		}
+		if !vote.Ipv4Available {
+			ipv4UnavailableWeight += vote.Weight
+		}
+		if !vote.Ipv6Available {
+			ipv6UnavailableWeight += vote.Weight
+		}
+	}
+	result.UnavailableWeight = unavailableWeight
+	required := result.TotalWeight * majority
+	result.Result = tc.IsAvailable{
+		IsAvailable:   unavailableWeight <= required,
+		Ipv4Available: ipv4UnavailableWeight <= required,
+		Ipv6Available: ipv6UnavailableWeight <= required,
+	}
+	if len(votes) == 0 {
+		result.Result = tc.IsAvailable{} // nobody voted, so nothing says it's available
+	}
+	return result
+}
+
+// SetCacheVotes sets the breakdown of the last weighted vote on each cache.
+func (t *CRStatesPeersThreadsafe) SetCacheVotes(votes map[tc.CacheName]CacheVotes) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	*t.cacheVotes = votes
+}
+
+// GetCacheVotes returns the breakdown of the last weighted vote on each cache, which is empty if the weighted combine mode isn't used. This MUST NOT be modified.
+func (t *CRStatesPeersThreadsafe) GetCacheVotes() map[tc.CacheName]CacheVotes {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return *t.cacheVotes
+}
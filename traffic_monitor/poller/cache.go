@@ -30,6 +30,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
 	"github.com/apache/trafficcontrol/traffic_monitor/handler"
+	"github.com/apache/trafficcontrol/traffic_monitor/record"
 )
 
 type CachePoller struct {
@@ -38,6 +39,10 @@ type CachePoller struct {
 	TickChan       chan uint64
 	GlobalContexts map[string]interface{}
 	Handler        handler.Handler
+	// Recorder records every poll result as a record of RecordType. If it's
+	// nil, nothing is recorded.
+	Recorder   *record.Recorder
+	RecordType string
 }
 
 type PollConfig struct {
@@ -47,6 +52,7 @@ type PollConfig struct {
 	Timeout  time.Duration
 	Format   string
 	PollType string
+	TLSPort  int
 }
 
 type CachePollerConfig struct {
@@ -121,12 +127,13 @@ func (p CachePoller) Poll() {
 				Timeout:     info.Timeout,
 				NoKeepAlive: info.NoKeepAlive,
 				PollerID:    info.ID,
+				TLSPort:     info.TLSPort,
 			}
 			pollerCtx := interface{}(nil)
 			if pollerObj.Init != nil {
 				pollerCtx = pollerObj.Init(pollerCfg, p.GlobalContexts[info.PollType])
 			}
-			go poller(info.Interval, info.ID, info.PollingProtocol, info.URL, info.URLv6, info.Host, info.Format, p.Handler, pollerObj.Poll, pollerCtx, kill)
+			go poller(info.Interval, info.ID, info.PollingProtocol, info.URL, info.URLv6, info.Host, info.Format, p.Handler, pollerObj.Poll, pollerCtx, p.Recorder, p.RecordType, kill)
 		}
 		p.Config = newConfig
 	}
@@ -153,6 +160,8 @@ func poller(
 	handler handler.Handler,
 	pollFunc PollerFunc,
 	pollCtx interface{},
+	recorder *record.Recorder,
+	recordType string,
 	die <-chan struct{},
 ) {
 	pollSpread := time.Duration(rand.Float64()*float64(interval/time.Nanosecond)) * time.Nanosecond
@@ -193,6 +202,9 @@ func poller(
 			}
 
 			log.Debugf("poll %v %v poller end\n", pollID, time.Now())
+			if recorder != nil {
+				recorder.Record(newRecord(recordType, id, format, usingIPv4, bts, reqEnd, reqTime, err, pollCtx))
+			}
 			go handler.Handle(id, rdr, format, reqTime, reqEnd, err, pollID, usingIPv4, pollCtx, pollFinishedChan)
 
 			if oscillateProtocols {
@@ -207,6 +219,41 @@ func poller(
 	}
 }
 
+// newRecord creates the record of a poll result, including the parts of its poll context needed to parse it again.
+func newRecord(recordType string, id string, format string, usingIPv4 bool, bts []byte, reqEnd time.Time, reqTime time.Duration, err error, pollCtx interface{}) record.Record {
+	rec := record.Record{
+		Time:        reqEnd,
+		Type:        recordType,
+		ID:          id,
+		Format:      format,
+		UsingIPv4:   usingIPv4,
+		RequestTime: reqTime,
+		Body:        bts,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if httpCtx, ok := HTTPPollContext(pollCtx); ok {
+		rec.Header = httpCtx.HTTPHeader
+	}
+	if check := TLSCheckResult(pollCtx); check != nil {
+		rec.TLS = &record.TLSCheck{ConnectTime: check.ConnectTime, HandshakeTime: check.HandshakeTime, CertNotAfter: check.CertNotAfter}
+	}
+	return rec
+}
+
+// ReplayPollContext returns a poll context for replaying the given recorded poll result to a handler, as the poller which recorded it would have given the handler.
+func ReplayPollContext(rec record.Record) interface{} {
+	httpCtx := &HTTPPollCtx{PollerID: rec.ID, HTTPHeader: rec.Header}
+	if rec.TLS == nil {
+		return httpCtx
+	}
+	return &TLSPollCtx{
+		HTTPPollCtx: httpCtx,
+		TLSCheck:    TLSCheck{ConnectTime: rec.TLS.ConnectTime, HandshakeTime: rec.TLS.HandshakeTime, CertNotAfter: rec.TLS.CertNotAfter},
+	}
+}
+
 // diffConfigs takes the old and new configs, and returns a list of deleted IDs, and a list of new polls to do
 func diffConfigs(old CachePollerConfig, new CachePollerConfig) ([]string, []CachePollInfo) {
 	deletions := []string{}
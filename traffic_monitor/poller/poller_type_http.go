@@ -101,6 +101,23 @@ type HTTPPollCtx struct {
 	FormatAccept string
 }
 
+// HTTPPollContext returns the HTTP poll context of the given poll context,
+// which may be that of an HTTP poller or of a poller which embeds one, such as
+// the TLS poller. It returns false if the poll context has no HTTP poll
+// context.
+func HTTPPollContext(pollCtx interface{}) (*HTTPPollCtx, bool) {
+	switch ctx := pollCtx.(type) {
+	case *HTTPPollCtx:
+		return ctx, ctx != nil
+	case *TLSPollCtx:
+		if ctx == nil {
+			return nil, false
+		}
+		return ctx.HTTPPollCtx, ctx.HTTPPollCtx != nil
+	}
+	return nil, false
+}
+
 func httpPoll(ctxI interface{}, url string, host string, pollID uint64) ([]byte, time.Time, time.Duration, error) {
 	ctx := (ctxI).(*HTTPPollCtx)
 	req, err := http.NewRequest("GET", url, nil)
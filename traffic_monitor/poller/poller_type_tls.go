@@ -0,0 +1,149 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// PollerTypeTLS is a poller which checks the TCP connect and TLS handshake of a
+// cache's TLS listener before polling its stats over HTTP, like the HTTP
+// poller.
+const PollerTypeTLS = "tls"
+
+// DefaultTLSPort is the port of the TLS listener checked by the TLS poller, if
+// the cache has no HTTPS port configured.
+const DefaultTLSPort = 443
+
+func init() {
+	AddPollerType(PollerTypeTLS, httpGlobalInit, tlsInit, tlsPoll)
+}
+
+// TLSCheck is the result of a TLS poller's check of a cache's TLS listener.
+type TLSCheck struct {
+	// ConnectTime is the time taken to establish the TCP connection.
+	ConnectTime time.Duration
+	// HandshakeTime is the time taken to complete the TLS handshake, after
+	// the TCP connection was established.
+	HandshakeTime time.Duration
+	// CertNotAfter is the expiration time of the certificate served by the
+	// cache.
+	CertNotAfter time.Time
+}
+
+// TLSPollCtx is the context of a TLS poller. The TLS check result of the
+// latest poll is in TLSCheck, and the HTTP poll context is embedded.
+type TLSPollCtx struct {
+	*HTTPPollCtx
+	TLSPort  int
+	TLSCheck TLSCheck
+}
+
+func tlsInit(cfg PollerConfig, globalCtxI interface{}) interface{} {
+	tlsPort := cfg.TLSPort
+	if tlsPort == 0 {
+		tlsPort = DefaultTLSPort
+	}
+	return &TLSPollCtx{
+		HTTPPollCtx: httpInit(cfg, globalCtxI).(*HTTPPollCtx),
+		TLSPort:     tlsPort,
+	}
+}
+
+func tlsPoll(ctxI interface{}, pollURL string, host string, pollID uint64) ([]byte, time.Time, time.Duration, error) {
+	ctx := (ctxI).(*TLSPollCtx)
+	startReq := time.Now()
+	check, err := checkTLS(ctx, pollURL, host)
+	ctx.TLSCheck = check
+	if err != nil {
+		reqEnd := time.Now()
+		return nil, reqEnd, reqEnd.Sub(startReq), fmt.Errorf("id %v url %v TLS check error: %v", ctx.PollerID, pollURL, err)
+	}
+	return httpPoll(ctx.HTTPPollCtx, pollURL, host, pollID)
+}
+
+// checkTLS connects to the TLS port of the host in pollURL and performs a TLS
+// handshake, using the given host for SNI. It returns an error if either
+// fails, or if the served certificate is expired.
+func checkTLS(ctx *TLSPollCtx, pollURL string, host string) (TLSCheck, error) {
+	check := TLSCheck{}
+	u, err := url.Parse(pollURL)
+	if err != nil {
+		return check, errors.New("parsing poll URL: " + err.Error())
+	}
+	addr := net.JoinHostPort(u.Hostname(), strconv.Itoa(ctx.TLSPort))
+
+	serverName := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		serverName = h
+	}
+
+	deadline := time.Time{}
+	if ctx.Client.Timeout > 0 {
+		deadline = time.Now().Add(ctx.Client.Timeout)
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	startConnect := time.Now()
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return check, errors.New("connecting: " + err.Error())
+	}
+	defer conn.Close()
+	check.ConnectTime = time.Since(startConnect)
+
+	// certificate validity isn't checked here, for the same reason the HTTP
+	// poller doesn't, but expiration is, below.
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err := tlsConn.SetDeadline(deadline); err != nil {
+		return check, errors.New("setting deadline: " + err.Error())
+	}
+	startHandshake := time.Now()
+	if err := tlsConn.Handshake(); err != nil {
+		return check, errors.New("handshake: " + err.Error())
+	}
+	check.HandshakeTime = time.Since(startHandshake)
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return check, errors.New("no certificate served")
+	}
+	check.CertNotAfter = certs[0].NotAfter
+	if time.Now().After(check.CertNotAfter) {
+		return check, errors.New("certificate expired at " + check.CertNotAfter.Format(time.RFC3339))
+	}
+	return check, nil
+}
+
+// TLSCheckResult returns the result of the latest TLS check, if the poll
+// context is a TLS poller's context; otherwise it returns nil.
+func TLSCheckResult(pollCtx interface{}) *TLSCheck {
+	ctx, ok := pollCtx.(*TLSPollCtx)
+	if !ok || ctx == nil {
+		return nil
+	}
+	check := ctx.TLSCheck
+	return &check
+}
@@ -0,0 +1,106 @@
+package poller
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestTLSPollCtx(t *testing.T, serverURL string) *TLSPollCtx {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &TLSPollCtx{
+		HTTPPollCtx: &HTTPPollCtx{Client: &http.Client{Timeout: 5 * time.Second}, PollerID: "test"},
+		TLSPort:     port,
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx := newTestTLSPollCtx(t, srv.URL)
+	check, err := checkTLS(ctx, "http://127.0.0.1/_astats", "edge.example.net")
+	if err != nil {
+		t.Fatalf("expected TLS check to succeed, actual error: %v", err)
+	}
+	if !check.CertNotAfter.Equal(srv.Certificate().NotAfter) {
+		t.Errorf("expected cert expiry %v, actual %v", srv.Certificate().NotAfter, check.CertNotAfter)
+	}
+
+	ctx.TLSCheck = check
+	if actual := TLSCheckResult(ctx); actual == nil || *actual != check {
+		t.Errorf("expected TLS check result %+v, actual %+v", check, actual)
+	}
+	if actual := TLSCheckResult(&HTTPPollCtx{}); actual != nil {
+		t.Errorf("expected nil TLS check result for HTTP poll context, actual %+v", *actual)
+	}
+}
+
+func TestCheckTLSHandshakeFailure(t *testing.T) {
+	// a plain TCP listener which closes connections never completes a handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	ctx := newTestTLSPollCtx(t, "http://"+listener.Addr().String())
+	if _, err := checkTLS(ctx, "http://127.0.0.1/_astats", "edge.example.net"); err == nil {
+		t.Error("expected TLS check of non-TLS listener to fail")
+	}
+}
+
+func TestHTTPPollContext(t *testing.T) {
+	httpCtx := &HTTPPollCtx{PollerID: "test"}
+	if actual, ok := HTTPPollContext(httpCtx); !ok || actual != httpCtx {
+		t.Errorf("expected HTTP poll context to be returned, actual %v %v", actual, ok)
+	}
+	if actual, ok := HTTPPollContext(&TLSPollCtx{HTTPPollCtx: httpCtx}); !ok || actual != httpCtx {
+		t.Errorf("expected embedded HTTP poll context to be returned, actual %v %v", actual, ok)
+	}
+	if _, ok := HTTPPollContext(nil); ok {
+		t.Error("expected nil poll context to have no HTTP poll context")
+	}
+	if actual, ok := HTTPPollContext((*TLSPollCtx)(nil)); ok || actual != nil {
+		t.Errorf("expected nil TLS poll context to have no HTTP poll context, actual %v %v", actual, ok)
+	}
+}
@@ -42,6 +42,9 @@ type PollerConfig struct {
 	Timeout     time.Duration
 	NoKeepAlive bool
 	PollerID    string
+	// TLSPort is the port of the cache's TLS listener, for pollers which
+	// check it. It may be 0 if the cache has no HTTPS port configured.
+	TLSPort int
 }
 
 // PollerGlobalInit performs global initialization, and returns a global context object.
@@ -0,0 +1,160 @@
+// Package record records the raw results of Traffic Monitor's polls, and the
+// monitoring configuration they were evaluated against, to an archive which can
+// later be replayed to reproduce the availability decisions made from them.
+package record
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/trafficcontrol/lib/go-log"
+)
+
+// The types of records in an archive.
+const (
+	// TypeHealth is the result of a cache health poll.
+	TypeHealth = "health"
+	// TypeStat is the result of a cache stat poll.
+	TypeStat = "stat"
+	// TypePeer is the result of a peer Traffic Monitor CrStates poll.
+	TypePeer = "peer"
+	// TypeMonitorConfig is the monitoring configuration from Traffic Ops,
+	// whose ID is the CDN name.
+	TypeMonitorConfig = "monitorConfig"
+	// TypeCRConfig is the CRConfig snapshot from Traffic Ops, whose ID is the
+	// CDN name.
+	TypeCRConfig = "crConfig"
+)
+
+// Record is a single recorded poll result or configuration.
+type Record struct {
+	// Time is the time the poll request finished, or the configuration was
+	// fetched.
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// ID is the poller ID, which is the cache or peer name, or the CDN name
+	// for configurations.
+	ID          string        `json:"id"`
+	Format      string        `json:"format,omitempty"`
+	UsingIPv4   bool          `json:"usingIPv4,omitempty"`
+	RequestTime time.Duration `json:"requestTime,omitempty"`
+	// Error is the poll error, if the poll failed.
+	Error string `json:"error,omitempty"`
+	// Header is the HTTP response header of the poll, for pollers which make
+	// HTTP requests. Parsers may use it, for example, to detect the format.
+	Header http.Header `json:"header,omitempty"`
+	// TLS is the result of the TLS poller's check, for caches polled by it.
+	TLS *TLSCheck `json:"tls,omitempty"`
+	// Body is the raw poll response body.
+	Body []byte `json:"body,omitempty"`
+	// Config is the configuration, for configuration records. It's JSON, so
+	// it can be read and edited in the archive, unlike poll response bodies,
+	// which may be any format.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// TLSCheck is the recorded result of a TLS poller's check.
+type TLSCheck struct {
+	ConnectTime   time.Duration `json:"connectTime"`
+	HandshakeTime time.Duration `json:"handshakeTime"`
+	CertNotAfter  time.Time     `json:"certNotAfter"`
+}
+
+// Recorder appends Records to an archive file. It is safe for multiple
+// goroutines. A nil *Recorder records nothing, so callers don't need to check
+// whether recording is enabled.
+type Recorder struct {
+	file *os.File
+	m    *sync.Mutex
+	// lastConfigs is the config of the last record of each configuration type
+	// and ID. Configurations are fetched far more often than they change,
+	// and are large, so unchanged configurations are not recorded again.
+	lastConfigs map[string][]byte
+}
+
+// New returns a Recorder which appends to the given archive file, creating it
+// if it doesn't exist.
+func New(fileName string) (*Recorder, error) {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{file: file, m: &sync.Mutex{}, lastConfigs: map[string][]byte{}}, nil
+}
+
+// Record appends the given record to the archive. Errors are logged rather
+// than returned, because recording must never interfere with monitoring.
+func (r *Recorder) Record(rec Record) {
+	if r == nil {
+		return
+	}
+	bts, err := json.Marshal(rec)
+	if err != nil {
+		log.Errorf("recording %s result for '%s': marshalling: %v", rec.Type, rec.ID, err)
+		return
+	}
+	bts = append(bts, '\n')
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	if rec.Type == TypeMonitorConfig || rec.Type == TypeCRConfig {
+		key := rec.Type + "/" + rec.ID
+		if last, ok := r.lastConfigs[key]; ok && bytes.Equal(last, rec.Config) {
+			return
+		}
+		r.lastConfigs[key] = rec.Config
+	}
+	if _, err := r.file.Write(bts); err != nil {
+		log.Errorf("recording %s result for '%s': writing: %v", rec.Type, rec.ID, err)
+	}
+}
+
+// Close closes the archive file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.file.Close()
+}
+
+// Read reads all the records of an archive, in the order they were recorded.
+func Read(rdr io.Reader) ([]Record, error) {
+	records := []Record{}
+	decoder := json.NewDecoder(rdr)
+	for {
+		rec := Record{}
+		if err := decoder.Decode(&rec); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, errors.New("decoding record: " + err.Error())
+		}
+		records = append(records, rec)
+	}
+}
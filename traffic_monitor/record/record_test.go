@@ -0,0 +1,91 @@
+package record
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tm-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "archive.json")
+
+	recorder, err := New(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pollTime := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	recorder.Record(Record{Time: pollTime, Type: TypeCRConfig, ID: "cdn0", Config: []byte(`{"config":{}}`)})
+	recorder.Record(Record{Time: pollTime, Type: TypeCRConfig, ID: "cdn0", Config: []byte(`{"config":{}}`)})
+	recorder.Record(Record{
+		Time:        pollTime,
+		Type:        TypeStat,
+		ID:          "edge0",
+		Format:      "astats",
+		UsingIPv4:   true,
+		RequestTime: time.Second,
+		Header:      http.Header{"Content-Type": {"text/json"}},
+		TLS:         &TLSCheck{HandshakeTime: time.Millisecond},
+		Body:        []byte(`{"ats":{}}`),
+	})
+	recorder.Record(Record{Time: pollTime, Type: TypeHealth, ID: "edge0", Error: "timed out"})
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := Read(file)
+	if err != nil {
+		t.Fatalf("reading records: %v", err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records with the unchanged CRConfig skipped, actual %d: %+v", len(records), records)
+	}
+	if records[0].Type != TypeCRConfig || string(records[0].Config) != `{"config":{}}` {
+		t.Errorf("expected CRConfig record, actual %+v", records[0])
+	}
+	stat := records[1]
+	if stat.ID != "edge0" || stat.Format != "astats" || !stat.UsingIPv4 || stat.RequestTime != time.Second || !stat.Time.Equal(pollTime) {
+		t.Errorf("expected stat record to match recorded, actual %+v", stat)
+	}
+	if stat.Header.Get("Content-Type") != "text/json" || stat.TLS == nil || stat.TLS.HandshakeTime != time.Millisecond || string(stat.Body) != `{"ats":{}}` {
+		t.Errorf("expected stat record header, TLS check, and body to match recorded, actual %+v", stat)
+	}
+	if records[2].Error != "timed out" || records[2].Body != nil {
+		t.Errorf("expected failed health record, actual %+v", records[2])
+	}
+
+	var nilRecorder *Recorder
+	nilRecorder.Record(Record{Type: TypeHealth}) // must not panic
+}
@@ -155,12 +155,16 @@ func (d TODataThreadsafe) Update(to towrap.TrafficOpsSessionThreadsafe, cdn stri
 	if err != nil {
 		return fmt.Errorf("Error getting last CRConfig: %v", err)
 	}
+	return d.UpdateCRConfig(crConfigBytes)
+}
 
+// UpdateCRConfig updates the TOData data with the given CRConfig, rather than one fetched from Traffic Ops.
+func (d TODataThreadsafe) UpdateCRConfig(crConfigBytes []byte) error {
 	newTOData := TOData{}
 
 	var crConfig CRConfig
 	json := jsoniter.ConfigFastest
-	err = json.Unmarshal(crConfigBytes, &crConfig)
+	err := json.Unmarshal(crConfigBytes, &crConfig)
 	if err != nil {
 		return fmt.Errorf("Error unmarshalling CRconfig: %v", err)
 	}
@@ -34,6 +34,7 @@ import (
 	"github.com/apache/trafficcontrol/lib/go-log"
 	"github.com/apache/trafficcontrol/lib/go-tc"
 	"github.com/apache/trafficcontrol/traffic_monitor/config"
+	"github.com/apache/trafficcontrol/traffic_monitor/record"
 	legacyClient "github.com/apache/trafficcontrol/traffic_ops/v2-client"
 	client "github.com/apache/trafficcontrol/traffic_ops/v3-client"
 
@@ -196,6 +197,9 @@ type TrafficOpsSessionThreadsafe struct {
 	useLegacy          bool
 	CRConfigBackupFile string
 	TMConfigBackupFile string
+	// Recorder records the CRConfig and monitoring configuration whenever they
+	// change. If it's nil, nothing is recorded.
+	Recorder *record.Recorder
 }
 
 // NewTrafficOpsSessionThreadsafe returns a new threadsafe
@@ -404,6 +408,7 @@ func (s TrafficOpsSessionThreadsafe) CRConfigRaw(cdn string) ([]byte, error) {
 	}
 
 	s.lastCRConfig.Set(cdn, data, &crc.Stats)
+	s.Recorder.Record(record.Record{Time: hist.ReqTime, Type: record.TypeCRConfig, ID: cdn, Config: data})
 	return data, nil
 }
 
@@ -485,6 +490,7 @@ func (s TrafficOpsSessionThreadsafe) trafficMonitorConfigMapRaw(cdn string) (*tc
 		if err := json.Unmarshal(b, &tmConfig); err != nil {
 			return nil, errors.New("unmarshalling backup file monitoring.json: " + err.Error())
 		}
+		s.Recorder.Record(record.Record{Time: time.Now(), Type: record.TypeMonitorConfig, ID: cdn, Config: b})
 		return tc.TrafficMonitorTransformToMap(&tmConfig)
 	}
 
@@ -492,6 +498,7 @@ func (s TrafficOpsSessionThreadsafe) trafficMonitorConfigMapRaw(cdn string) (*tc
 	data, err := json.Marshal(*config)
 	if err == nil {
 		ioutil.WriteFile(s.TMConfigBackupFile, data, 0644)
+		s.Recorder.Record(record.Record{Time: time.Now(), Type: record.TypeMonitorConfig, ID: cdn, Config: data})
 	}
 
 	return configMap, err